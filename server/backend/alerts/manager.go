@@ -0,0 +1,81 @@
+// Package alerts stores device alerts. An alert type is open at most once per
+// device until it is resolved.
+package alerts
+
+import (
+	"backend/models"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Notifier is told about each newly opened alert. It is called on the
+// caller's goroutine and must not block.
+type Notifier interface {
+	AlertRaised(alert models.Alert)
+}
+
+// Muter reports whether notifications about a device are held back, e.g.
+// during maintenance.
+type Muter interface {
+	Muted(deviceID string, at time.Time) (bool, error)
+}
+
+type Manager struct {
+	db        *sql.DB
+	notifiers []Notifier
+	muter     Muter
+}
+
+func NewManager(db *sql.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// AddNotifier registers n for new alerts. Call it before any alerts are raised.
+func (m *Manager) AddNotifier(n Notifier) {
+	m.notifiers = append(m.notifiers, n)
+}
+
+// SetMuter makes Raise still record alerts but skip the notifiers for muted
+// devices.
+func (m *Manager) SetMuter(muter Muter) {
+	m.muter = muter
+}
+
+// Raise opens an alert unless one of the same type is already open for the
+// device. It reports whether a new alert was created.
+func (m *Manager) Raise(alert models.Alert) (bool, error) {
+	result, err := m.db.Exec(`
+		INSERT INTO alerts (device_id, alert_type, severity, message, created_at)
+		SELECT $1, $2, $3, $4, $5
+		WHERE NOT EXISTS (
+			SELECT 1 FROM alerts WHERE device_id = $1 AND alert_type = $2 AND resolved_at IS NULL
+		)`,
+		alert.DeviceID, alert.AlertType, alert.Severity, alert.Message, alert.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if m.muter != nil {
+		muted, err := m.muter.Muted(alert.DeviceID, alert.CreatedAt)
+		if err != nil {
+			log.Printf("Failed to check silences for device %s: %v", alert.DeviceID, err)
+		}
+		if muted {
+			return true, nil
+		}
+	}
+	for _, notifier := range m.notifiers {
+		notifier.AlertRaised(alert)
+	}
+	return true, nil
+}
+
+func (m *Manager) Resolve(deviceID, alertType string, at time.Time) error {
+	_, err := m.db.Exec("UPDATE alerts SET resolved_at = $1 WHERE device_id = $2 AND alert_type = $3 AND resolved_at IS NULL", at, deviceID, alertType)
+	return err
+}
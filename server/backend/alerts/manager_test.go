@@ -0,0 +1,128 @@
+package alerts
+
+import (
+	"backend/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaise(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	alert := models.Alert{DeviceID: "device-001", AlertType: models.AlertCrashLoop, Severity: "critical", Message: "crash loop", CreatedAt: now}
+
+	mock.ExpectExec("INSERT INTO alerts").
+		WithArgs("device-001", models.AlertCrashLoop, "critical", "crash loop", now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// 同じ種類のアラートが未解決の場合は追加されない
+	mock.ExpectExec("INSERT INTO alerts").
+		WithArgs("device-001", models.AlertCrashLoop, "critical", "crash loop", now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	manager := NewManager(db)
+
+	created, err := manager.Raise(alert)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = manager.Raise(alert)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolve(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectExec("UPDATE alerts SET resolved_at = \\$1").
+		WithArgs(now, "device-001", models.AlertCrashLoop).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	manager := NewManager(db)
+	assert.NoError(t, manager.Resolve("device-001", models.AlertCrashLoop, now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type recordingNotifier struct {
+	alerts []models.Alert
+}
+
+func (r *recordingNotifier) AlertRaised(alert models.Alert) {
+	r.alerts = append(r.alerts, alert)
+}
+
+func TestRaise_NotifiesOnlyNewAlerts(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO alerts").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO alerts").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	notifier := &recordingNotifier{}
+	manager := NewManager(db)
+	manager.AddNotifier(notifier)
+
+	alert := models.Alert{DeviceID: "device-001", AlertType: models.AlertMemoryLeak, Severity: "warning", Message: "leak", CreatedAt: time.Now()}
+	_, err = manager.Raise(alert)
+	assert.NoError(t, err)
+	_, err = manager.Raise(alert)
+	assert.NoError(t, err)
+
+	// アサーション
+	assert.Equal(t, []models.Alert{alert}, notifier.alerts)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type fixedMuter bool
+
+func (m fixedMuter) Muted(deviceID string, at time.Time) (bool, error) {
+	return bool(m), nil
+}
+
+func TestRaise_MutedDeviceIsNotNotified(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO alerts").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	notifier := &recordingNotifier{}
+	manager := NewManager(db)
+	manager.AddNotifier(notifier)
+	manager.SetMuter(fixedMuter(true))
+
+	alert := models.Alert{DeviceID: "device-001", AlertType: models.AlertCrashLoop, Severity: "critical", Message: "crash loop", CreatedAt: time.Now()}
+	created, err := manager.Raise(alert)
+
+	// アサーション（アラートは記録され、通知だけ抑制される）
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Empty(t, notifier.alerts)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,209 @@
+package analysis
+
+import "time"
+
+// DeviceHistory is the event stream of one device within a report period,
+// together with what was known about the device just before the period.
+type DeviceHistory struct {
+	DeviceID string
+	Site     string
+	Group    string
+	// Last power_on/power_off before the period, or "" if none.
+	PriorPowerState string
+	// When PriorPowerState was reported, if the loader fetched it.
+	PriorPowerStateAt *time.Time
+	// Last event of any type before the period, or nil if none.
+	LastSeenBefore *time.Time
+	// Events within the period, sorted by timestamp.
+	Events []Event
+	// Planned maintenance within the period, sorted and non-overlapping.
+	Maintenance []Period
+}
+
+// InMaintenance reports whether t falls inside one of h's maintenance periods.
+func (h DeviceHistory) InMaintenance(t time.Time) bool {
+	for _, p := range h.Maintenance {
+		if !t.Before(p.Start) && t.Before(p.End) {
+			return true
+		}
+	}
+	return false
+}
+
+type Availability struct {
+	Scope                string   `json:"scope"`
+	Key                  string   `json:"key"`
+	DeviceCount          int      `json:"device_count"`
+	PeriodSeconds        float64  `json:"period_seconds"`
+	UpSeconds            float64  `json:"up_seconds"`
+	OutageSeconds        float64  `json:"outage_seconds"`
+	UnknownSeconds       float64  `json:"unknown_seconds"`
+	AvailabilityPct      *float64 `json:"availability_pct"`
+	CoveragePct          float64  `json:"coverage_pct"`
+	OutageCount          int      `json:"outage_count"`
+	LongestOutageSeconds float64  `json:"longest_outage_seconds"`
+	MTBFSeconds          *float64 `json:"mtbf_seconds"`
+	MTTRSeconds          *float64 `json:"mttr_seconds"`
+	// Time inside maintenance windows, excluded from the figures above.
+	MaintenanceSeconds float64 `json:"maintenance_seconds"`
+	// Outages that began during maintenance and ended with it.
+	ExpectedOutageCount int `json:"expected_outage_count"`
+}
+
+// ComputeAvailability walks a device's events and splits [from, to) into time
+// with mains power, confirmed outage (power_off reported, device still
+// reporting on battery) and unknown (device silent for longer than
+// offlineAfter, or no data yet). Time inside the device's maintenance periods
+// is counted separately, and an outage that begins there only counts once it
+// runs past the end of the maintenance.
+func ComputeAvailability(h DeviceHistory, from, to time.Time, offlineAfter time.Duration) Availability {
+	a := Availability{Scope: "device", Key: h.DeviceID, DeviceCount: 1, PeriodSeconds: to.Sub(from).Seconds()}
+
+	powered := h.PriorPowerState != "power_off"
+	lastSeen := h.LastSeenBefore
+	var episode float64
+	inEpisode, expectedEpisode := false, false
+	startEpisode := func(at time.Time) {
+		inEpisode = true
+		expectedEpisode = h.InMaintenance(at)
+		if expectedEpisode {
+			a.ExpectedOutageCount++
+		} else {
+			a.OutageCount++
+		}
+	}
+	if !powered {
+		startEpisode(from)
+	}
+
+	endEpisode := func() {
+		if episode > a.LongestOutageSeconds {
+			a.LongestOutageSeconds = episode
+		}
+		episode = 0
+		inEpisode = false
+	}
+
+	account := func(start, end time.Time) {
+		if !end.After(start) {
+			return
+		}
+		known := time.Duration(0)
+		if lastSeen != nil {
+			knownUntil := lastSeen.Add(offlineAfter)
+			if knownUntil.After(start) {
+				if knownUntil.Before(end) {
+					known = knownUntil.Sub(start)
+				} else {
+					known = end.Sub(start)
+				}
+			}
+		}
+		a.UnknownSeconds += (end.Sub(start) - known).Seconds()
+		if powered {
+			a.UpSeconds += known.Seconds()
+		} else {
+			a.OutageSeconds += known.Seconds()
+			episode += known.Seconds()
+			// 計画停電がメンテナンス終了後も続いた場合は通常の停電として数える
+			if expectedEpisode && known > 0 {
+				expectedEpisode = false
+				a.ExpectedOutageCount--
+				a.OutageCount++
+			}
+		}
+	}
+
+	advance := func(start, end time.Time) {
+		for _, m := range h.Maintenance {
+			if !m.End.After(start) {
+				continue
+			}
+			if !m.Start.Before(end) {
+				break
+			}
+			account(start, m.Start)
+			if m.Start.After(start) {
+				start = m.Start
+			}
+			stop := m.End
+			if stop.After(end) {
+				stop = end
+			}
+			a.MaintenanceSeconds += stop.Sub(start).Seconds()
+			start = stop
+		}
+		account(start, end)
+	}
+
+	cursor := from
+	for _, e := range h.Events {
+		if e.Timestamp.Before(from) || !e.Timestamp.Before(to) {
+			continue
+		}
+		advance(cursor, e.Timestamp)
+		cursor = e.Timestamp
+		ts := e.Timestamp
+		lastSeen = &ts
+
+		switch e.EventType {
+		case "power_off":
+			if powered {
+				powered = false
+				startEpisode(e.Timestamp)
+			}
+		case "power_on":
+			if !powered {
+				powered = true
+				endEpisode()
+			}
+		}
+	}
+	advance(cursor, to)
+	if inEpisode {
+		endEpisode()
+	}
+
+	a.finalize()
+	return a
+}
+
+// Aggregate sums device-level results into a group, site or fleet row.
+func Aggregate(scope, key string, rows []Availability) Availability {
+	a := Availability{Scope: scope, Key: key}
+	for _, r := range rows {
+		a.DeviceCount += r.DeviceCount
+		a.PeriodSeconds += r.PeriodSeconds
+		a.UpSeconds += r.UpSeconds
+		a.OutageSeconds += r.OutageSeconds
+		a.UnknownSeconds += r.UnknownSeconds
+		a.OutageCount += r.OutageCount
+		a.MaintenanceSeconds += r.MaintenanceSeconds
+		a.ExpectedOutageCount += r.ExpectedOutageCount
+		if r.LongestOutageSeconds > a.LongestOutageSeconds {
+			a.LongestOutageSeconds = r.LongestOutageSeconds
+		}
+	}
+	a.finalize()
+	return a
+}
+
+func (a *Availability) finalize() {
+	a.AvailabilityPct, a.MTBFSeconds, a.MTTRSeconds = nil, nil, nil
+	a.CoveragePct = 0
+
+	known := a.UpSeconds + a.OutageSeconds
+	if known > 0 {
+		pct := a.UpSeconds / known * 100
+		a.AvailabilityPct = &pct
+	}
+	if scheduled := a.PeriodSeconds - a.MaintenanceSeconds; scheduled > 0 {
+		a.CoveragePct = known / scheduled * 100
+	}
+	if a.OutageCount > 0 {
+		mtbf := a.UpSeconds / float64(a.OutageCount)
+		mttr := a.OutageSeconds / float64(a.OutageCount)
+		a.MTBFSeconds = &mtbf
+		a.MTTRSeconds = &mttr
+	}
+}
@@ -0,0 +1,166 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// periodic_status を毎分送信するデバイスのイベント列を作る
+func heartbeat(deviceID string, start time.Time, minutes int) []Event {
+	var events []Event
+	for i := 0; i < minutes; i++ {
+		events = append(events, Event{DeviceID: deviceID, EventType: "periodic_status", Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+	return events
+}
+
+func TestComputeAvailability_AlwaysUp(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	before := from.Add(-30 * time.Second)
+
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_on", LastSeenBefore: &before, Events: heartbeat("device-001", from, 60)}
+	a := ComputeAvailability(h, from, to, 5*time.Minute)
+
+	assert.InDelta(t, 3600, a.UpSeconds, 0.001)
+	assert.Equal(t, 0.0, a.OutageSeconds)
+	assert.Equal(t, 0.0, a.UnknownSeconds)
+	assert.InDelta(t, 100, *a.AvailabilityPct, 0.001)
+	assert.Equal(t, 0, a.OutageCount)
+	assert.Nil(t, a.MTBFSeconds)
+	assert.Nil(t, a.MTTRSeconds)
+}
+
+func TestComputeAvailability_ConfirmedOutage(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	before := from.Add(-30 * time.Second)
+
+	// 10分〜20分の間、バッテリー駆動で報告を続けた停電
+	events := heartbeat("device-001", from, 60)
+	events[10].EventType = "power_off"
+	events[20].EventType = "power_on"
+
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_on", LastSeenBefore: &before, Events: events}
+	a := ComputeAvailability(h, from, to, 5*time.Minute)
+
+	assert.InDelta(t, 600, a.OutageSeconds, 0.001)
+	assert.InDelta(t, 3000, a.UpSeconds, 0.001)
+	assert.Equal(t, 1, a.OutageCount)
+	assert.InDelta(t, 600, a.LongestOutageSeconds, 0.001)
+	assert.InDelta(t, 600, *a.MTTRSeconds, 0.001)
+	assert.InDelta(t, 3000, *a.MTBFSeconds, 0.001)
+}
+
+func TestComputeAvailability_MaintenanceExcluded(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	before := from.Add(-30 * time.Second)
+
+	// 10分〜30分のメンテナンス中の停電（15分〜25分）と、40分〜50分の停電
+	events := heartbeat("device-001", from, 60)
+	events[15].EventType = "power_off"
+	events[25].EventType = "power_on"
+	events[40].EventType = "power_off"
+	events[50].EventType = "power_on"
+	maintenance := []Period{{Start: from.Add(10 * time.Minute), End: from.Add(30 * time.Minute)}}
+
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_on", LastSeenBefore: &before, Events: events, Maintenance: maintenance}
+	a := ComputeAvailability(h, from, to, 5*time.Minute)
+
+	assert.InDelta(t, 1200, a.MaintenanceSeconds, 0.001)
+	assert.InDelta(t, 600, a.OutageSeconds, 0.001)
+	assert.InDelta(t, 1800, a.UpSeconds, 0.001)
+	assert.Equal(t, 1, a.OutageCount)
+	assert.Equal(t, 1, a.ExpectedOutageCount)
+	assert.InDelta(t, 100, a.CoveragePct, 0.001)
+}
+
+func TestComputeAvailability_MaintenanceOverrun(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	before := from.Add(-30 * time.Second)
+
+	// メンテナンス（10分〜20分）中に停電し、終了後の30分まで復旧しない
+	events := heartbeat("device-001", from, 60)
+	events[15].EventType = "power_off"
+	events[30].EventType = "power_on"
+	maintenance := []Period{{Start: from.Add(10 * time.Minute), End: from.Add(20 * time.Minute)}}
+
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_on", LastSeenBefore: &before, Events: events, Maintenance: maintenance}
+	a := ComputeAvailability(h, from, to, 5*time.Minute)
+
+	assert.InDelta(t, 600, a.MaintenanceSeconds, 0.001)
+	assert.InDelta(t, 600, a.OutageSeconds, 0.001)
+	assert.Equal(t, 1, a.OutageCount)
+	assert.Equal(t, 0, a.ExpectedOutageCount)
+}
+
+func TestComputeAvailability_SilenceIsUnknown(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	// 停電後10分でバッテリー切れ、40分に復電して起動
+	events := heartbeat("device-001", from, 11)
+	events[0].EventType = "power_off"
+	events = append(events, Event{EventType: "power_on", Timestamp: from.Add(40 * time.Minute)})
+	events = append(events, heartbeat("device-001", from.Add(41*time.Minute), 19)...)
+
+	h := DeviceHistory{DeviceID: "device-001", Events: events}
+	a := ComputeAvailability(h, from, to, 5*time.Minute)
+
+	// 確認できた停電は最後の報告から5分後まで
+	assert.InDelta(t, 15*60, a.OutageSeconds, 0.001)
+	assert.InDelta(t, 25*60, a.UnknownSeconds, 0.001)
+	assert.InDelta(t, 20*60, a.UpSeconds, 0.001)
+	assert.Equal(t, 1, a.OutageCount)
+	assert.InDelta(t, 15*60, a.LongestOutageSeconds, 0.001)
+}
+
+func TestComputeAvailability_NoData(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	a := ComputeAvailability(DeviceHistory{DeviceID: "device-001"}, from, to, 5*time.Minute)
+
+	assert.InDelta(t, 3600, a.UnknownSeconds, 0.001)
+	assert.Nil(t, a.AvailabilityPct)
+	assert.Equal(t, 0.0, a.CoveragePct)
+}
+
+func TestComputeAvailability_OutageOngoingAtStart(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	before := from.Add(-time.Minute)
+
+	events := heartbeat("device-001", from, 60)
+	events[30].EventType = "power_on"
+
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_off", LastSeenBefore: &before, Events: events}
+	a := ComputeAvailability(h, from, to, 5*time.Minute)
+
+	assert.Equal(t, 1, a.OutageCount)
+	assert.InDelta(t, 1800, a.OutageSeconds, 0.001)
+	assert.InDelta(t, 1800, a.LongestOutageSeconds, 0.001)
+}
+
+func TestAggregate(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	before := from.Add(-30 * time.Second)
+
+	up := ComputeAvailability(DeviceHistory{DeviceID: "a", LastSeenBefore: &before, Events: heartbeat("a", from, 60)}, from, to, 5*time.Minute)
+	events := heartbeat("b", from, 60)
+	events[0].EventType = "power_off"
+	events[30].EventType = "power_on"
+	down := ComputeAvailability(DeviceHistory{DeviceID: "b", LastSeenBefore: &before, Events: events}, from, to, 5*time.Minute)
+
+	fleet := Aggregate("fleet", "all", []Availability{up, down})
+
+	assert.Equal(t, 2, fleet.DeviceCount)
+	assert.Equal(t, 1, fleet.OutageCount)
+	assert.InDelta(t, 75, *fleet.AvailabilityPct, 0.001)
+	assert.InDelta(t, 1800, fleet.LongestOutageSeconds, 0.001)
+}
@@ -0,0 +1,209 @@
+package analysis
+
+import "time"
+
+// Sessions shorter than this are too noisy to derive a discharge rate from.
+const minDischargeDuration = 5 * time.Minute
+
+type DischargePoint struct {
+	ElapsedSeconds    float64 `json:"elapsed_seconds"`
+	BatteryPercentage float64 `json:"battery_percentage"`
+	BatteryVoltage    float64 `json:"battery_voltage"`
+}
+
+// DischargeSession is one period of running on battery, from power_off until
+// power_on, the device going silent, or now.
+type DischargeSession struct {
+	StartedAt                 time.Time        `json:"started_at"`
+	EndedAt                   time.Time        `json:"ended_at"`
+	EndReason                 string           `json:"end_reason"`
+	DurationSeconds           float64          `json:"duration_seconds"`
+	StartPercentage           float64          `json:"start_percentage"`
+	EndPercentage             float64          `json:"end_percentage"`
+	RatePctPerHour            *float64         `json:"rate_pct_per_hour"`
+	EstimatedFullRuntimeHours *float64         `json:"estimated_full_runtime_hours"`
+	Samples                   []DischargePoint `json:"samples"`
+}
+
+type BatteryDegradation struct {
+	SessionCount        int     `json:"session_count"`
+	FirstRuntimeHours   float64 `json:"first_runtime_hours"`
+	LatestRuntimeHours  float64 `json:"latest_runtime_hours"`
+	ChangePct           float64 `json:"change_pct"`
+	TrendHoursPer30Days float64 `json:"trend_hours_per_30_days"`
+}
+
+type BatteryReport struct {
+	DeviceID                  string              `json:"device_id"`
+	OnBattery                 bool                `json:"on_battery"`
+	CurrentPercentage         *float64            `json:"current_percentage"`
+	CurrentVoltage            *float64            `json:"current_voltage"`
+	AverageRatePctPerHour     *float64            `json:"average_rate_pct_per_hour"`
+	EstimatedRemainingSeconds *float64            `json:"estimated_remaining_seconds"`
+	EstimatedEmptyAt          *time.Time          `json:"estimated_empty_at"`
+	EstimateSource            string              `json:"estimate_source,omitempty"`
+	Sessions                  []DischargeSession  `json:"sessions"`
+	Degradation               *BatteryDegradation `json:"degradation"`
+}
+
+// AnalyzeBattery builds discharge curves for each time the device ran on
+// battery, estimates time-to-empty for an ongoing outage, and tracks how the
+// projected full-charge runtime changes across outages.
+func AnalyzeBattery(deviceID string, events []Event, now time.Time, offlineAfter time.Duration) BatteryReport {
+	report := BatteryReport{DeviceID: deviceID, Sessions: []DischargeSession{}}
+
+	var current *DischargeSession
+	var lastSeen time.Time
+	closeSession := func(reason string) {
+		current.EndReason = reason
+		current.finalize()
+		report.Sessions = append(report.Sessions, *current)
+		current = nil
+	}
+
+	for _, e := range events {
+		if current != nil && e.Timestamp.Sub(lastSeen) > offlineAfter {
+			closeSession("device_offline")
+		}
+		lastSeen = e.Timestamp
+
+		if e.HasBattery {
+			pct, volt := e.BatteryPercentage, e.BatteryVoltage
+			report.CurrentPercentage, report.CurrentVoltage = &pct, &volt
+		}
+
+		switch {
+		case e.EventType == "power_off" && current == nil:
+			current = &DischargeSession{StartedAt: e.Timestamp}
+			current.add(e)
+		case e.EventType == "power_on" && current != nil:
+			current.add(e)
+			closeSession("power_restored")
+		case current != nil:
+			current.add(e)
+		}
+	}
+
+	if current != nil {
+		if now.Sub(lastSeen) > offlineAfter {
+			closeSession("device_offline")
+		} else {
+			report.OnBattery = true
+			closeSession("ongoing")
+		}
+	}
+
+	report.AverageRatePctPerHour = averageRate(report.Sessions)
+	report.estimateRemaining(now)
+	report.Degradation = degradation(report.Sessions)
+	return report
+}
+
+func (s *DischargeSession) add(e Event) {
+	s.EndedAt = e.Timestamp
+	if !e.HasBattery {
+		return
+	}
+	s.Samples = append(s.Samples, DischargePoint{
+		ElapsedSeconds:    e.Timestamp.Sub(s.StartedAt).Seconds(),
+		BatteryPercentage: e.BatteryPercentage,
+		BatteryVoltage:    e.BatteryVoltage,
+	})
+}
+
+func (s *DischargeSession) finalize() {
+	s.DurationSeconds = s.EndedAt.Sub(s.StartedAt).Seconds()
+	if len(s.Samples) == 0 {
+		s.Samples = []DischargePoint{}
+		return
+	}
+	s.StartPercentage = s.Samples[0].BatteryPercentage
+	s.EndPercentage = s.Samples[len(s.Samples)-1].BatteryPercentage
+
+	if s.DurationSeconds < minDischargeDuration.Seconds() {
+		return
+	}
+	xs := make([]float64, len(s.Samples))
+	ys := make([]float64, len(s.Samples))
+	for i, p := range s.Samples {
+		xs[i] = p.ElapsedSeconds / 3600
+		ys[i] = p.BatteryPercentage
+	}
+	slope, _, ok := linearRegression(xs, ys)
+	if !ok || slope >= 0 {
+		return
+	}
+	rate := -slope
+	runtime := 100 / rate
+	s.RatePctPerHour = &rate
+	s.EstimatedFullRuntimeHours = &runtime
+}
+
+func averageRate(sessions []DischargeSession) *float64 {
+	var sum float64
+	var n int
+	for _, s := range sessions {
+		if s.RatePctPerHour != nil && s.EndReason != "ongoing" {
+			sum += *s.RatePctPerHour
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	avg := sum / float64(n)
+	return &avg
+}
+
+func (r *BatteryReport) estimateRemaining(now time.Time) {
+	if !r.OnBattery || r.CurrentPercentage == nil {
+		return
+	}
+
+	// 進行中の放電で傾きが取れればそれを使い、なければ過去の平均を使う
+	ongoing := r.Sessions[len(r.Sessions)-1]
+	rate := ongoing.RatePctPerHour
+	r.EstimateSource = "current_session"
+	if rate == nil {
+		rate = r.AverageRatePctPerHour
+		r.EstimateSource = "history"
+	}
+	if rate == nil {
+		r.EstimateSource = ""
+		return
+	}
+
+	remaining := *r.CurrentPercentage / *rate * 3600
+	emptyAt := now.Add(time.Duration(remaining) * time.Second)
+	r.EstimatedRemainingSeconds = &remaining
+	r.EstimatedEmptyAt = &emptyAt
+}
+
+func degradation(sessions []DischargeSession) *BatteryDegradation {
+	var xs, ys []float64
+	var first time.Time
+	for _, s := range sessions {
+		if s.EstimatedFullRuntimeHours == nil || s.EndReason == "ongoing" {
+			continue
+		}
+		if len(xs) == 0 {
+			first = s.StartedAt
+		}
+		xs = append(xs, s.StartedAt.Sub(first).Hours()/24)
+		ys = append(ys, *s.EstimatedFullRuntimeHours)
+	}
+	if len(xs) < 2 {
+		return nil
+	}
+
+	d := &BatteryDegradation{
+		SessionCount:       len(xs),
+		FirstRuntimeHours:  ys[0],
+		LatestRuntimeHours: ys[len(ys)-1],
+		ChangePct:          (ys[len(ys)-1] - ys[0]) / ys[0] * 100,
+	}
+	if slope, _, ok := linearRegression(xs, ys); ok {
+		d.TrendHoursPer30Days = slope * 30
+	}
+	return d
+}
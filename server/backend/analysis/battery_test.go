@@ -0,0 +1,142 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"backend/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// power_off から毎分 ratePerHour/60 % ずつ減るバッテリー放電を作る
+func discharge(start time.Time, minutes int, startPct, ratePerHour float64, restored bool) []Event {
+	var events []Event
+	for i := 0; i <= minutes; i++ {
+		eventType := "periodic_status"
+		if i == 0 {
+			eventType = "power_off"
+		}
+		if i == minutes && restored {
+			eventType = "power_on"
+		}
+		events = append(events, Event{
+			EventType:         eventType,
+			Timestamp:         start.Add(time.Duration(i) * time.Minute),
+			HasData:           true,
+			HasBattery:        true,
+			BatteryPercentage: startPct - ratePerHour*float64(i)/60,
+			BatteryVoltage:    4.1,
+		})
+	}
+	return events
+}
+
+func TestLinearRegression(t *testing.T) {
+	slope, intercept, ok := linearRegression([]float64{0, 1, 2}, []float64{1, 3, 5})
+	assert.True(t, ok)
+	assert.InDelta(t, 2, slope, 1e-9)
+	assert.InDelta(t, 1, intercept, 1e-9)
+
+	_, _, ok = linearRegression([]float64{1}, []float64{1})
+	assert.False(t, ok)
+	_, _, ok = linearRegression([]float64{1, 1}, []float64{1, 2})
+	assert.False(t, ok)
+}
+
+func TestAnalyzeBattery_CompletedSession(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := discharge(start, 60, 100, 20, true)
+
+	r := AnalyzeBattery("device-001", events, start.Add(2*time.Hour), 5*time.Minute)
+
+	assert.False(t, r.OnBattery)
+	assert.Len(t, r.Sessions, 1)
+	assert.Equal(t, "power_restored", r.Sessions[0].EndReason)
+	assert.InDelta(t, 20, *r.Sessions[0].RatePctPerHour, 1e-6)
+	assert.InDelta(t, 5, *r.Sessions[0].EstimatedFullRuntimeHours, 1e-6)
+	assert.Len(t, r.Sessions[0].Samples, 61)
+	assert.Nil(t, r.EstimatedRemainingSeconds)
+}
+
+func TestAnalyzeBattery_RebootDuringSession(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := discharge(start, 60, 100, 20, true)
+
+	// 停電中に検出した再起動（稼働時間とメッセージだけでバッテリー値はない）
+	uptime, message := int64(1000), "Reboot detected"
+	var reboot Event
+	reboot.EventType = "reboot"
+	reboot.Timestamp = start.Add(30*time.Minute + 30*time.Second)
+	reboot.SetData(models.EventData{UptimeMs: &uptime, Message: &message})
+	events = append(events[:31], append([]Event{reboot}, events[31:]...)...)
+
+	r := AnalyzeBattery("device-001", events, start.Add(2*time.Hour), 5*time.Minute)
+
+	// アサーション（0% のサンプルにならない）
+	assert.True(t, reboot.HasData)
+	assert.False(t, reboot.HasBattery)
+	assert.Len(t, r.Sessions, 1)
+	assert.Len(t, r.Sessions[0].Samples, 61)
+	assert.InDelta(t, 20, *r.Sessions[0].RatePctPerHour, 1e-6)
+	assert.InDelta(t, 80, *r.CurrentPercentage, 1e-6)
+}
+
+func TestAnalyzeBattery_OngoingOutage(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := discharge(start, 30, 80, 20, false)
+	now := start.Add(30 * time.Minute)
+
+	r := AnalyzeBattery("device-001", events, now, 5*time.Minute)
+
+	assert.True(t, r.OnBattery)
+	assert.Equal(t, "current_session", r.EstimateSource)
+	assert.InDelta(t, 70, *r.CurrentPercentage, 1e-6)
+	// 70% を 20%/h で消費 → 3.5時間
+	assert.InDelta(t, 3.5*3600, *r.EstimatedRemainingSeconds, 1)
+	assert.WithinDuration(t, now.Add(210*time.Minute), *r.EstimatedEmptyAt, time.Second)
+}
+
+func TestAnalyzeBattery_OngoingOutageUsesHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := discharge(start, 60, 100, 25, true)
+
+	// 停電直後で傾きが取れない場合は過去の平均を使う
+	outage := start.Add(24 * time.Hour)
+	events = append(events, Event{EventType: "power_off", Timestamp: outage, HasData: true, HasBattery: true, BatteryPercentage: 50})
+	r := AnalyzeBattery("device-001", events, outage.Add(time.Minute), 5*time.Minute)
+
+	assert.True(t, r.OnBattery)
+	assert.Equal(t, "history", r.EstimateSource)
+	assert.InDelta(t, 2*3600, *r.EstimatedRemainingSeconds, 1)
+}
+
+func TestAnalyzeBattery_DeviceWentOffline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := discharge(start, 20, 30, 60, false)
+
+	r := AnalyzeBattery("device-001", events, start.Add(3*time.Hour), 5*time.Minute)
+
+	assert.False(t, r.OnBattery)
+	assert.Equal(t, "device_offline", r.Sessions[0].EndReason)
+	assert.Nil(t, r.EstimatedRemainingSeconds)
+}
+
+func TestAnalyzeBattery_Degradation(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 放電速度が徐々に上がる（フル充電時の稼働時間が短くなる）
+	var events []Event
+	events = append(events, discharge(start, 60, 100, 20, true)...)
+	events = append(events, discharge(start.AddDate(0, 0, 30), 60, 100, 25, true)...)
+	events = append(events, discharge(start.AddDate(0, 0, 60), 60, 100, 40, true)...)
+
+	r := AnalyzeBattery("device-001", events, start.AddDate(0, 0, 61), 5*time.Minute)
+
+	assert.NotNil(t, r.Degradation)
+	assert.Equal(t, 3, r.Degradation.SessionCount)
+	assert.InDelta(t, 5, r.Degradation.FirstRuntimeHours, 1e-6)
+	assert.InDelta(t, 2.5, r.Degradation.LatestRuntimeHours, 1e-6)
+	assert.InDelta(t, -50, r.Degradation.ChangePct, 1e-6)
+	assert.Less(t, r.Degradation.TrendHoursPer30Days, 0.0)
+}
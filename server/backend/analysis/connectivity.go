@@ -0,0 +1,286 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+)
+
+type ConnectivityOptions struct {
+	// Silence longer than this while on mains power counts as a failed delivery.
+	GapAfter time.Duration
+	// RSSI (dBm) below this is considered low when correlating with gaps.
+	LowRSSI int
+	// Width of the buckets in the RSSI time series.
+	Bucket time.Duration
+}
+
+func DefaultConnectivityOptions() ConnectivityOptions {
+	return ConnectivityOptions{GapAfter: 5 * time.Minute, LowRSSI: -75, Bucket: 24 * time.Hour}
+}
+
+// RSSIDistribution counts samples by signal quality: excellent >= -55 dBm,
+// good >= -67, fair >= -75, poor below that.
+type RSSIDistribution struct {
+	Excellent int `json:"excellent"`
+	Good      int `json:"good"`
+	Fair      int `json:"fair"`
+	Poor      int `json:"poor"`
+}
+
+func (d *RSSIDistribution) add(rssi int) {
+	switch {
+	case rssi >= -55:
+		d.Excellent++
+	case rssi >= -67:
+		d.Good++
+	case rssi >= -75:
+		d.Fair++
+	default:
+		d.Poor++
+	}
+}
+
+func (d *RSSIDistribution) merge(o RSSIDistribution) {
+	d.Excellent += o.Excellent
+	d.Good += o.Good
+	d.Fair += o.Fair
+	d.Poor += o.Poor
+}
+
+type rssiSummary struct {
+	Samples      int              `json:"samples"`
+	AvgRSSI      *float64         `json:"avg_rssi"`
+	MinRSSI      *int             `json:"min_rssi"`
+	MaxRSSI      *int             `json:"max_rssi"`
+	Distribution RSSIDistribution `json:"distribution"`
+
+	sum float64
+}
+
+func (s *rssiSummary) add(rssi int) {
+	if s.Samples == 0 || rssi < *s.MinRSSI {
+		v := rssi
+		s.MinRSSI = &v
+	}
+	if s.Samples == 0 || rssi > *s.MaxRSSI {
+		v := rssi
+		s.MaxRSSI = &v
+	}
+	s.Samples++
+	s.sum += float64(rssi)
+	s.Distribution.add(rssi)
+}
+
+func (s *rssiSummary) merge(o rssiSummary) {
+	if o.Samples == 0 {
+		return
+	}
+	if s.Samples == 0 || *o.MinRSSI < *s.MinRSSI {
+		s.MinRSSI = o.MinRSSI
+	}
+	if s.Samples == 0 || *o.MaxRSSI > *s.MaxRSSI {
+		s.MaxRSSI = o.MaxRSSI
+	}
+	s.Samples += o.Samples
+	s.sum += o.sum
+	s.Distribution.merge(o.Distribution)
+}
+
+func (s *rssiSummary) finalize() {
+	s.AvgRSSI = nil
+	if s.Samples > 0 {
+		avg := s.sum / float64(s.Samples)
+		s.AvgRSSI = &avg
+	}
+}
+
+type RSSIBucket struct {
+	Start time.Time `json:"start"`
+	rssiSummary
+}
+
+type Connectivity struct {
+	Scope       string `json:"scope"`
+	Key         string `json:"key"`
+	Site        string `json:"site,omitempty"`
+	Rank        int    `json:"rank,omitempty"`
+	DeviceCount int    `json:"device_count"`
+	rssiSummary
+	LowRSSIPct *float64 `json:"low_rssi_pct"`
+
+	Reconnects        int     `json:"reconnects"`
+	ReconnectsPerDay  float64 `json:"reconnects_per_day"`
+	DeliveryGaps      int     `json:"delivery_gaps"`
+	GapsPerDay        float64 `json:"gaps_per_day"`
+	GapSeconds        float64 `json:"gap_seconds"`
+	LongestGapSeconds float64 `json:"longest_gap_seconds"`
+
+	// Gaps whose last sample before the silence had low RSSI, and the chance
+	// of a gap following a low versus a normal sample.
+	GapsAfterLowRSSI  int      `json:"gaps_after_low_rssi"`
+	LowRSSIGapRate    *float64 `json:"low_rssi_gap_rate"`
+	NormalRSSIGapRate *float64 `json:"normal_rssi_gap_rate"`
+
+	Series []RSSIBucket `json:"series"`
+
+	periodSeconds   float64
+	lowSamples      int
+	gapsAfterNormal int
+	buckets         map[time.Time]*rssiSummary
+}
+
+// ComputeConnectivity summarizes a device's RSSI samples and wifi_reconnected
+// events within [from, to) and finds delivery gaps. Silences that start after
+// a power_off are left out, since the device may simply have run flat.
+func ComputeConnectivity(h DeviceHistory, from, to time.Time, opts ConnectivityOptions) Connectivity {
+	c := Connectivity{
+		Scope: "device", Key: h.DeviceID, Site: h.Site, DeviceCount: 1,
+		periodSeconds: to.Sub(from).Seconds(),
+		buckets:       map[time.Time]*rssiSummary{},
+	}
+
+	powered := h.PriorPowerState != "power_off"
+	var lastSeen time.Time
+	var lastRSSI *int
+	for _, e := range h.Events {
+		if e.Timestamp.Before(from) || !e.Timestamp.Before(to) {
+			continue
+		}
+
+		if !lastSeen.IsZero() && powered {
+			if gap := e.Timestamp.Sub(lastSeen); gap > opts.GapAfter {
+				c.addGap(gap, lastRSSI, opts)
+			}
+		}
+		lastSeen = e.Timestamp
+
+		switch e.EventType {
+		case "power_off":
+			powered = false
+		case "power_on":
+			powered = true
+		case "wifi_reconnected":
+			c.Reconnects++
+		}
+
+		if e.HasData && e.WiFiSignalStrength < 0 {
+			rssi := e.WiFiSignalStrength
+			lastRSSI = &rssi
+			c.add(e.Timestamp, rssi, opts)
+		}
+	}
+
+	c.finalize()
+	return c
+}
+
+func (c *Connectivity) add(at time.Time, rssi int, opts ConnectivityOptions) {
+	c.rssiSummary.add(rssi)
+	if rssi < opts.LowRSSI {
+		c.lowSamples++
+	}
+
+	start := at.Truncate(opts.Bucket)
+	b, ok := c.buckets[start]
+	if !ok {
+		b = &rssiSummary{}
+		c.buckets[start] = b
+	}
+	b.add(rssi)
+}
+
+func (c *Connectivity) addGap(gap time.Duration, lastRSSI *int, opts ConnectivityOptions) {
+	c.DeliveryGaps++
+	c.GapSeconds += gap.Seconds()
+	if gap.Seconds() > c.LongestGapSeconds {
+		c.LongestGapSeconds = gap.Seconds()
+	}
+	if lastRSSI == nil {
+		return
+	}
+	if *lastRSSI < opts.LowRSSI {
+		c.GapsAfterLowRSSI++
+	} else {
+		c.gapsAfterNormal++
+	}
+}
+
+// AggregateConnectivity sums device-level results into a site or fleet row.
+// Per-day rates are per device-day.
+func AggregateConnectivity(scope, key string, rows []Connectivity) Connectivity {
+	c := Connectivity{Scope: scope, Key: key, buckets: map[time.Time]*rssiSummary{}}
+	for _, r := range rows {
+		c.DeviceCount += r.DeviceCount
+		c.rssiSummary.merge(r.rssiSummary)
+		c.lowSamples += r.lowSamples
+		c.Reconnects += r.Reconnects
+		c.DeliveryGaps += r.DeliveryGaps
+		c.GapSeconds += r.GapSeconds
+		if r.LongestGapSeconds > c.LongestGapSeconds {
+			c.LongestGapSeconds = r.LongestGapSeconds
+		}
+		c.GapsAfterLowRSSI += r.GapsAfterLowRSSI
+		c.gapsAfterNormal += r.gapsAfterNormal
+		c.periodSeconds += r.periodSeconds
+		for start, b := range r.buckets {
+			if _, ok := c.buckets[start]; !ok {
+				c.buckets[start] = &rssiSummary{}
+			}
+			c.buckets[start].merge(*b)
+		}
+	}
+	c.finalize()
+	return c
+}
+
+func (c *Connectivity) finalize() {
+	c.rssiSummary.finalize()
+
+	c.LowRSSIPct, c.LowRSSIGapRate, c.NormalRSSIGapRate = nil, nil, nil
+	if c.Samples > 0 {
+		pct := float64(c.lowSamples) / float64(c.Samples) * 100
+		c.LowRSSIPct = &pct
+	}
+	if c.lowSamples > 0 {
+		rate := float64(c.GapsAfterLowRSSI) / float64(c.lowSamples)
+		c.LowRSSIGapRate = &rate
+	}
+	if normal := c.Samples - c.lowSamples; normal > 0 {
+		rate := float64(c.gapsAfterNormal) / float64(normal)
+		c.NormalRSSIGapRate = &rate
+	}
+
+	if days := c.periodSeconds / 86400; days > 0 {
+		c.ReconnectsPerDay = float64(c.Reconnects) / days
+		c.GapsPerDay = float64(c.DeliveryGaps) / days
+	}
+
+	c.Series = []RSSIBucket{}
+	for start, b := range c.buckets {
+		b.finalize()
+		c.Series = append(c.Series, RSSIBucket{Start: start, rssiSummary: *b})
+	}
+	sort.Slice(c.Series, func(i, j int) bool { return c.Series[i].Start.Before(c.Series[j].Start) })
+}
+
+// RankConnectivity orders devices worst first: most delivery gaps per day,
+// then most reconnects per day, then lowest average RSSI. Devices without
+// RSSI samples sort after those with samples on the last key.
+func RankConnectivity(rows []Connectivity) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.GapsPerDay != b.GapsPerDay {
+			return a.GapsPerDay > b.GapsPerDay
+		}
+		if a.ReconnectsPerDay != b.ReconnectsPerDay {
+			return a.ReconnectsPerDay > b.ReconnectsPerDay
+		}
+		if (a.AvgRSSI == nil) != (b.AvgRSSI == nil) {
+			return a.AvgRSSI != nil
+		}
+		return a.AvgRSSI != nil && *a.AvgRSSI < *b.AvgRSSI
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+}
@@ -0,0 +1,96 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withRSSI(events []Event, rssi int) []Event {
+	for i := range events {
+		events[i].HasData = true
+		events[i].WiFiSignalStrength = rssi
+	}
+	return events
+}
+
+func TestComputeConnectivity_GapsAfterLowRSSI(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+	opts := DefaultConnectivityOptions()
+
+	// 前半は良好な電波、後半は弱い電波で10分の欠落が発生し再接続
+	events := withRSSI(heartbeat("device-001", from, 30), -50)
+	weak := withRSSI(heartbeat("device-001", from.Add(30*time.Minute), 20), -82)
+	events = append(events, weak...)
+	resumed := withRSSI(heartbeat("device-001", from.Add(60*time.Minute), 60), -80)
+	resumed[0].EventType = "wifi_reconnected"
+	events = append(events, resumed...)
+
+	c := ComputeConnectivity(DeviceHistory{DeviceID: "device-001", Site: "tokyo-office", Events: events}, from, to, opts)
+
+	assert.Equal(t, 110, c.Samples)
+	assert.Equal(t, 30, c.Distribution.Excellent)
+	assert.Equal(t, 80, c.Distribution.Poor)
+	assert.Equal(t, -82, *c.MinRSSI)
+	assert.Equal(t, -50, *c.MaxRSSI)
+	assert.Equal(t, 1, c.Reconnects)
+	assert.InDelta(t, 12, c.ReconnectsPerDay, 0.001)
+	assert.Equal(t, 1, c.DeliveryGaps)
+	assert.InDelta(t, 660, c.GapSeconds, 0.001)
+	assert.Equal(t, 1, c.GapsAfterLowRSSI)
+	assert.InDelta(t, 1.0/80, *c.LowRSSIGapRate, 1e-9)
+	assert.InDelta(t, 0, *c.NormalRSSIGapRate, 1e-9)
+	assert.Len(t, c.Series, 1)
+}
+
+func TestComputeConnectivity_IgnoresSilenceOnBattery(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+
+	// 停電でバッテリーが切れて沈黙した期間は欠落として数えない
+	events := heartbeat("device-001", from, 10)
+	events[9].EventType = "power_off"
+	restored := heartbeat("device-001", from.Add(time.Hour), 10)
+	restored[0].EventType = "power_on"
+	events = append(events, restored...)
+
+	c := ComputeConnectivity(DeviceHistory{DeviceID: "device-001", Events: events}, from, to, DefaultConnectivityOptions())
+
+	assert.Equal(t, 0, c.DeliveryGaps)
+	assert.Equal(t, 0, c.Samples)
+	assert.Nil(t, c.AvgRSSI)
+	assert.Empty(t, c.Series)
+}
+
+func TestAggregateAndRankConnectivity(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(48 * time.Hour)
+	opts := DefaultConnectivityOptions()
+
+	good := withRSSI(heartbeat("device-001", from, 60), -50)
+	bad := withRSSI(heartbeat("device-002", from, 60), -85)
+	bad[10].EventType = "wifi_reconnected"
+	quiet := heartbeat("device-003", from, 60)
+
+	rows := []Connectivity{
+		ComputeConnectivity(DeviceHistory{DeviceID: "device-001", Events: good}, from, to, opts),
+		ComputeConnectivity(DeviceHistory{DeviceID: "device-002", Events: bad}, from, to, opts),
+		ComputeConnectivity(DeviceHistory{DeviceID: "device-003", Events: quiet}, from, to, opts),
+	}
+
+	site := AggregateConnectivity("site", "tokyo-office", rows)
+	assert.Equal(t, 3, site.DeviceCount)
+	assert.Equal(t, 120, site.Samples)
+	assert.InDelta(t, -67.5, *site.AvgRSSI, 0.001)
+	assert.InDelta(t, 50, *site.LowRSSIPct, 0.001)
+	assert.Len(t, site.Series, 1)
+	assert.Equal(t, 120, site.Series[0].Samples)
+
+	RankConnectivity(rows)
+	assert.Equal(t, "device-002", rows[0].Key)
+	assert.Equal(t, "device-001", rows[1].Key)
+	assert.Equal(t, "device-003", rows[2].Key)
+	assert.Equal(t, 3, rows[2].Rank)
+}
@@ -0,0 +1,50 @@
+// Package analysis derives reports from the raw power event stream. It has no
+// database access; handlers load the events and pass them in.
+package analysis
+
+import (
+	"backend/models"
+	"time"
+)
+
+type Event struct {
+	DeviceID  string
+	EventType string
+	Timestamp time.Time
+
+	// Fields from the event's data; HasData is false when the event carried
+	// no data, and HasBattery when it carried no battery_percentage (e.g. a
+	// detected reboot).
+	HasData            bool
+	HasBattery         bool
+	UptimeMs           int64
+	Message            string
+	BatteryPercentage  float64
+	BatteryVoltage     float64
+	WiFiSignalStrength int
+	FreeHeap           int64
+}
+
+// SetData fills the metric fields of e from the event's stored data.
+func (e *Event) SetData(d models.EventData) {
+	e.HasData = !d.Empty()
+	e.HasBattery = d.BatteryPercentage != nil
+	if d.UptimeMs != nil {
+		e.UptimeMs = *d.UptimeMs
+	}
+	if d.Message != nil {
+		e.Message = *d.Message
+	}
+	if d.BatteryPercentage != nil {
+		e.BatteryPercentage = float64(*d.BatteryPercentage)
+	}
+	if d.BatteryVoltage != nil {
+		e.BatteryVoltage = *d.BatteryVoltage
+	}
+	if d.WiFiSignalStrength != nil {
+		e.WiFiSignalStrength = *d.WiFiSignalStrength
+	}
+	if d.FreeHeap != nil {
+		e.FreeHeap = *d.FreeHeap
+	}
+}
@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+type HeapOptions struct {
+	// Minimum samples and uptime span before a session's trend is trusted.
+	MinSamples int
+	MinSpan    time.Duration
+	// A session is flagged when heap declines faster than this (bytes/hour)
+	// and the linear fit explains at least MinRSquared of the variance.
+	MinLeakRate float64
+	MinRSquared float64
+	// Free heap at which the device is expected to fail.
+	ExhaustionBytes float64
+}
+
+func DefaultHeapOptions() HeapOptions {
+	return HeapOptions{
+		MinSamples:      10,
+		MinSpan:         2 * time.Hour,
+		MinLeakRate:     50,
+		MinRSquared:     0.6,
+		ExhaustionBytes: 10000,
+	}
+}
+
+type HeapSession struct {
+	StartedAt             time.Time  `json:"started_at"`
+	EndedAt               time.Time  `json:"ended_at"`
+	Samples               int        `json:"samples"`
+	FirstFreeHeap         int64      `json:"first_free_heap"`
+	LastFreeHeap          int64      `json:"last_free_heap"`
+	SlopeBytesPerHour     *float64   `json:"slope_bytes_per_hour"`
+	RSquared              *float64   `json:"r_squared"`
+	LeakSuspected         bool       `json:"leak_suspected"`
+	ProjectedExhaustionAt *time.Time `json:"projected_exhaustion_at"`
+
+	uptimeHours []float64
+	freeHeap    []float64
+}
+
+// SegmentHeapSessions splits free_heap samples into boot sessions at every
+// uptime_ms reset.
+func SegmentHeapSessions(events []Event) []HeapSession {
+	var sessions []HeapSession
+	var current *HeapSession
+	var lastUptime int64
+
+	for _, e := range events {
+		if !e.HasData || e.FreeHeap <= 0 || e.UptimeMs <= 0 {
+			continue
+		}
+		if current == nil || e.UptimeMs < lastUptime {
+			sessions = append(sessions, HeapSession{StartedAt: e.Timestamp, FirstFreeHeap: e.FreeHeap})
+			current = &sessions[len(sessions)-1]
+		}
+		lastUptime = e.UptimeMs
+
+		current.EndedAt = e.Timestamp
+		current.LastFreeHeap = e.FreeHeap
+		current.Samples++
+		current.uptimeHours = append(current.uptimeHours, float64(e.UptimeMs)/float64(time.Hour/time.Millisecond))
+		current.freeHeap = append(current.freeHeap, float64(e.FreeHeap))
+	}
+	return sessions
+}
+
+// AnalyzeHeap fits a linear trend of free_heap over uptime for each boot
+// session and projects when a declining heap will reach exhaustion.
+func AnalyzeHeap(events []Event, opts HeapOptions) []HeapSession {
+	sessions := SegmentHeapSessions(events)
+	for i := range sessions {
+		sessions[i].fit(opts)
+	}
+	return sessions
+}
+
+func (s *HeapSession) fit(opts HeapOptions) {
+	xs, ys := s.uptimeHours, s.freeHeap
+	if s.Samples < opts.MinSamples || xs[len(xs)-1]-xs[0] < opts.MinSpan.Hours() {
+		return
+	}
+
+	slope, intercept, ok := linearRegression(xs, ys)
+	if !ok {
+		return
+	}
+	r2 := rSquared(xs, ys, slope, intercept)
+	s.SlopeBytesPerHour = &slope
+	s.RSquared = &r2
+
+	if slope > -opts.MinLeakRate || r2 < opts.MinRSquared {
+		return
+	}
+	s.LeakSuspected = true
+
+	fitted := intercept + slope*xs[len(xs)-1]
+	hoursLeft := math.Max(0, (fitted-opts.ExhaustionBytes)/-slope)
+	exhaustion := s.EndedAt.Add(time.Duration(hoursLeft * float64(time.Hour)))
+	s.ProjectedExhaustionAt = &exhaustion
+}
+
+func rSquared(xs, ys []float64, slope, intercept float64) float64 {
+	var mean float64
+	for _, y := range ys {
+		mean += y
+	}
+	mean /= float64(len(ys))
+
+	var ssRes, ssTot float64
+	for i := range xs {
+		r := ys[i] - (intercept + slope*xs[i])
+		ssRes += r * r
+		d := ys[i] - mean
+		ssTot += d * d
+	}
+	if ssTot == 0 {
+		return 1
+	}
+	return 1 - ssRes/ssTot
+}
@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 毎分の periodic_status で free_heap が bytesPerHour ずつ変化する起動セッション
+func heapSession(start time.Time, minutes int, startHeap, bytesPerHour float64) []Event {
+	var events []Event
+	for i := 0; i < minutes; i++ {
+		events = append(events, Event{
+			EventType: "periodic_status",
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			HasData:   true,
+			UptimeMs:  int64(i+1) * 60000,
+			FreeHeap:  int64(startHeap + bytesPerHour*float64(i)/60),
+		})
+	}
+	return events
+}
+
+func TestSegmentHeapSessions(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := heapSession(start, 30, 100000, 0)
+	events = append(events, heapSession(start.Add(time.Hour), 20, 100000, 0)...)
+
+	sessions := SegmentHeapSessions(events)
+
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, 30, sessions[0].Samples)
+	assert.Equal(t, 20, sessions[1].Samples)
+	assert.Equal(t, start.Add(time.Hour), sessions[1].StartedAt)
+}
+
+func TestAnalyzeHeap_SteadyDecline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 1時間に1000バイトずつ減少（6時間分）
+	events := heapSession(start, 360, 60000, -1000)
+
+	sessions := AnalyzeHeap(events, DefaultHeapOptions())
+
+	assert.Len(t, sessions, 1)
+	s := sessions[0]
+	assert.True(t, s.LeakSuspected)
+	assert.InDelta(t, -1000, *s.SlopeBytesPerHour, 5)
+	assert.Greater(t, *s.RSquared, 0.99)
+
+	// 約54000バイトから10000バイトまで約44時間
+	assert.WithinDuration(t, s.EndedAt.Add(44*time.Hour), *s.ProjectedExhaustionAt, 30*time.Minute)
+}
+
+func TestAnalyzeHeap_StableHeap(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := heapSession(start, 360, 60000, 0)
+	// 一時的な確保による揺らぎ
+	for i := range events {
+		if i%7 == 0 {
+			events[i].FreeHeap -= 4000
+		}
+	}
+
+	sessions := AnalyzeHeap(events, DefaultHeapOptions())
+
+	assert.Len(t, sessions, 1)
+	assert.False(t, sessions[0].LeakSuspected)
+	assert.NotNil(t, sessions[0].SlopeBytesPerHour)
+	assert.Nil(t, sessions[0].ProjectedExhaustionAt)
+}
+
+func TestAnalyzeHeap_TooShortToJudge(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := heapSession(start, 30, 60000, -5000)
+
+	sessions := AnalyzeHeap(events, DefaultHeapOptions())
+
+	assert.Len(t, sessions, 1)
+	assert.False(t, sessions[0].LeakSuspected)
+	assert.Nil(t, sessions[0].SlopeBytesPerHour)
+}
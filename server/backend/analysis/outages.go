@@ -0,0 +1,52 @@
+package analysis
+
+import "time"
+
+type Outage struct {
+	DeviceID string
+	Site     string
+	Start    time.Time
+	// nil while power has not come back by the end of the period.
+	End *time.Time
+	// The outage began inside a maintenance window of the device.
+	Expected bool
+}
+
+// FindOutages pairs each power_off within [from, to) with the next power_on.
+// An outage already in progress at from starts at PriorPowerStateAt, or at
+// from when that is unknown. Repeated power_off events extend the same
+// outage.
+func FindOutages(h DeviceHistory, from, to time.Time) []Outage {
+	var outages []Outage
+	var current *Outage
+	if h.PriorPowerState == "power_off" {
+		start := from
+		if h.PriorPowerStateAt != nil {
+			start = *h.PriorPowerStateAt
+		}
+		current = &Outage{DeviceID: h.DeviceID, Site: h.Site, Start: start, Expected: h.InMaintenance(start)}
+	}
+
+	for _, e := range h.Events {
+		if e.Timestamp.Before(from) || !e.Timestamp.Before(to) {
+			continue
+		}
+		switch e.EventType {
+		case "power_off":
+			if current == nil {
+				current = &Outage{DeviceID: h.DeviceID, Site: h.Site, Start: e.Timestamp, Expected: h.InMaintenance(e.Timestamp)}
+			}
+		case "power_on":
+			if current != nil {
+				end := e.Timestamp
+				current.End = &end
+				outages = append(outages, *current)
+				current = nil
+			}
+		}
+	}
+	if current != nil {
+		outages = append(outages, *current)
+	}
+	return outages
+}
@@ -0,0 +1,65 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindOutages(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+	priorOff := from.Add(-10 * time.Minute)
+
+	// 期間前から続く停電、重複した power_off、復旧しない停電
+	events := []Event{
+		{EventType: "power_on", Timestamp: from.Add(5 * time.Minute)},
+		{EventType: "power_off", Timestamp: from.Add(30 * time.Minute)},
+		{EventType: "power_off", Timestamp: from.Add(35 * time.Minute)},
+		{EventType: "power_on", Timestamp: from.Add(50 * time.Minute)},
+		{EventType: "power_off", Timestamp: from.Add(90 * time.Minute)},
+	}
+	h := DeviceHistory{DeviceID: "device-001", Site: "tokyo-office", PriorPowerState: "power_off", PriorPowerStateAt: &priorOff, Events: events}
+
+	outages := FindOutages(h, from, to)
+
+	assert.Len(t, outages, 3)
+	assert.Equal(t, priorOff, outages[0].Start)
+	assert.Equal(t, from.Add(5*time.Minute), *outages[0].End)
+	assert.Equal(t, from.Add(30*time.Minute), outages[1].Start)
+	assert.Equal(t, from.Add(50*time.Minute), *outages[1].End)
+	assert.Equal(t, from.Add(90*time.Minute), outages[2].Start)
+	assert.Nil(t, outages[2].End)
+	assert.Equal(t, "tokyo-office", outages[2].Site)
+}
+
+func TestFindOutages_UnknownStart(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_off"}
+
+	outages := FindOutages(h, from, from.Add(time.Hour))
+
+	assert.Len(t, outages, 1)
+	assert.Equal(t, from, outages[0].Start)
+	assert.Nil(t, outages[0].End)
+}
+
+func TestFindOutages_Expected(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	events := []Event{
+		{EventType: "power_off", Timestamp: from.Add(10 * time.Minute)},
+		{EventType: "power_on", Timestamp: from.Add(20 * time.Minute)},
+		{EventType: "power_off", Timestamp: from.Add(40 * time.Minute)},
+	}
+	maintenance := []Period{{Start: from.Add(5 * time.Minute), End: from.Add(15 * time.Minute)}}
+	h := DeviceHistory{DeviceID: "device-001", PriorPowerState: "power_on", Events: events, Maintenance: maintenance}
+
+	outages := FindOutages(h, from, to)
+
+	assert.Len(t, outages, 2)
+	assert.True(t, outages[0].Expected)
+	assert.False(t, outages[1].Expected)
+}
@@ -0,0 +1,43 @@
+package analysis
+
+import "time"
+
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (p Period) Duration() time.Duration {
+	return p.End.Sub(p.Start)
+}
+
+// SilentPeriods returns the stretches within [from, to) longer than after in
+// which the device sent nothing. A silence that started before from (per
+// LastSeenBefore) is clipped to from, and one still going at to ends at to.
+func SilentPeriods(h DeviceHistory, from, to time.Time, after time.Duration) []Period {
+	var periods []Period
+	last := from
+	if h.LastSeenBefore != nil && h.LastSeenBefore.After(from.Add(-after)) {
+		last = *h.LastSeenBefore
+	}
+
+	add := func(end time.Time) {
+		if end.Sub(last) > after {
+			start := last
+			if start.Before(from) {
+				start = from
+			}
+			periods = append(periods, Period{Start: start, End: end})
+		}
+	}
+
+	for _, e := range h.Events {
+		if e.Timestamp.Before(from) || !e.Timestamp.Before(to) {
+			continue
+		}
+		add(e.Timestamp)
+		last = e.Timestamp
+	}
+	add(to)
+	return periods
+}
@@ -0,0 +1,36 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSilentPeriods(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+	before := from.Add(-20 * time.Minute)
+
+	// 期間前から沈黙 → 30分報告 → 20分沈黙 → 10分報告 → 最後まで沈黙
+	events := heartbeat("device-001", from.Add(10*time.Minute), 30)
+	events = append(events, heartbeat("device-001", from.Add(60*time.Minute), 10)...)
+	h := DeviceHistory{DeviceID: "device-001", LastSeenBefore: &before, Events: events}
+
+	periods := SilentPeriods(h, from, to, 5*time.Minute)
+
+	assert.Equal(t, []Period{
+		{Start: from, End: from.Add(10 * time.Minute)},
+		{Start: from.Add(39 * time.Minute), End: from.Add(60 * time.Minute)},
+		{Start: from.Add(69 * time.Minute), End: to},
+	}, periods)
+	assert.Equal(t, 21*time.Minute, periods[1].Duration())
+}
+
+func TestSilentPeriods_AlwaysReporting(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := from.Add(-time.Minute)
+	h := DeviceHistory{DeviceID: "device-001", LastSeenBefore: &before, Events: heartbeat("device-001", from, 60)}
+
+	assert.Empty(t, SilentPeriods(h, from, from.Add(time.Hour), 5*time.Minute))
+}
@@ -0,0 +1,194 @@
+package apiv2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// recorder holds back the response of the wrapped handler so that Adapt can
+// rewrite it. Headers go straight to the underlying writer.
+type recorder struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int)              { r.status = code }
+func (r *recorder) WriteHeaderNow()                   {}
+func (r *recorder) Write(b []byte) (int, error)       { return r.body.Write(b) }
+func (r *recorder) WriteString(s string) (int, error) { return r.body.WriteString(s) }
+func (r *recorder) Status() int                       { return r.status }
+func (r *recorder) Size() int                         { return r.body.Len() }
+func (r *recorder) Written() bool                     { return r.body.Len() > 0 }
+func (r *recorder) Flush()                            {}
+
+// Page is the requested page of a list.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+const (
+	// pageKey holds the Page of a list route in the gin context.
+	pageKey = "apiv2.page"
+	// pageAppliedKey is set once the handler has read the page.
+	pageAppliedKey = "apiv2.pageApplied"
+	// codeKey holds the problem code a handler gave its error response.
+	codeKey = "apiv2.code"
+)
+
+// ParsePage reads the limit and offset query parameters.
+func ParsePage(c *gin.Context) (Page, error) {
+	page := Page{Limit: DefaultLimit}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Page{}, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		page.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Page{}, fmt.Errorf("offset must be a non-negative integer")
+		}
+		page.Offset = n
+	}
+	return page, nil
+}
+
+// PageFrom returns the page requested from a list route under /api/v2; ok is
+// false elsewhere. A handler that reads it must skip Offset items itself and
+// return at most Limit+1, the extra item telling AdaptList that there is a
+// next page. Lists of handlers that do not read it are paged in memory.
+func PageFrom(c *gin.Context) (page Page, ok bool) {
+	v, ok := c.Get(pageKey)
+	if !ok {
+		return Page{}, false
+	}
+	c.Set(pageAppliedKey, true)
+	return v.(Page), true
+}
+
+// SetCode sets the code of the problem an error response becomes under
+// /api/v2, in place of the generic code of its status. The /api response
+// body is unchanged.
+func SetCode(c *gin.Context, code string) {
+	c.Set(codeKey, code)
+}
+
+// Adapt serves an /api handler under /api/v2. JSON responses are rewritten:
+// errors ({"error": "..."} and any other members) become problems, with the
+// code from SetCode or else the generic one of the status, and other bodies
+// are wrapped in an Envelope. Other content types (firmware
+// binaries, CSV reports) are passed through unchanged.
+func Adapt(h gin.HandlerFunc) gin.HandlerFunc {
+	return adapt(h, false)
+}
+
+// AdaptList is Adapt for routes returning a list, which are paginated with
+// the limit and offset query parameters (see PageFrom).
+func AdaptList(h gin.HandlerFunc) gin.HandlerFunc {
+	return adapt(h, true)
+}
+
+func adapt(h gin.HandlerFunc, list bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var page *Page
+		if list {
+			p, err := ParsePage(c)
+			if err != nil {
+				Abort(c, http.StatusBadRequest, "", err.Error())
+				return
+			}
+			page = &p
+			c.Set(pageKey, p)
+		}
+
+		rec := &recorder{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = rec
+		func() {
+			defer func() { c.Writer = rec.ResponseWriter }()
+			h(c)
+		}()
+
+		if !strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "application/json") || len(bytes.TrimSpace(rec.body.Bytes())) == 0 {
+			c.Writer.WriteHeader(rec.status)
+			c.Writer.Write(rec.body.Bytes())
+			return
+		}
+		if rec.status >= http.StatusBadRequest {
+			WriteProblem(c, problemFromBody(c, rec.status, rec.body.Bytes()))
+			return
+		}
+		envelope, err := envelopeFromBody(rec.body.Bytes(), page, c.GetBool(pageAppliedKey))
+		if err != nil {
+			WriteProblem(c, internalError(c, http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.JSON(rec.status, envelope)
+	}
+}
+
+func problemFromBody(c *gin.Context, status int, body []byte) Problem {
+	var members map[string]interface{}
+	json.Unmarshal(body, &members)
+	detail, _ := members["error"].(string)
+	if status >= http.StatusInternalServerError {
+		return internalError(c, status, detail)
+	}
+
+	p := NewProblem(status, c.GetString(codeKey), detail)
+	delete(members, "error")
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return p
+}
+
+// envelopeFromBody wraps a handler's response. Lists are paginated unless
+// page is nil; applied means the handler already skipped page.Offset items.
+func envelopeFromBody(body []byte, page *Page, applied bool) (Envelope, error) {
+	trimmed := bytes.TrimSpace(body)
+	if bytes.Equal(trimmed, []byte("null")) {
+		// A nil slice from the handler is an empty list.
+		trimmed = []byte("[]")
+	}
+	switch {
+	case trimmed[0] == '[':
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return Envelope{}, err
+		}
+		if page == nil {
+			return Envelope{Data: items}, nil
+		}
+		meta := &Meta{Limit: page.Limit, Offset: page.Offset}
+		if !applied {
+			if page.Offset < len(items) {
+				items = items[page.Offset:]
+			} else {
+				items = items[:0]
+			}
+		}
+		if len(items) > page.Limit {
+			items = items[:page.Limit]
+			meta.HasMore = true
+		}
+		meta.Count = len(items)
+		return Envelope{Data: items, Meta: meta}, nil
+	default:
+		return Envelope{Data: json.RawMessage(trimmed)}, nil
+	}
+}
@@ -0,0 +1,206 @@
+package apiv2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(method, target string, register func(r *gin.Engine)) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	register(r)
+	r.NoRoute(NoRoute)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, target, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdaptList(t *testing.T) {
+	var page Page
+	var paged bool
+	list := func(c *gin.Context) {
+		page, paged = PageFrom(c)
+		c.JSON(http.StatusOK, []int{2, 3, 4})
+	}
+
+	// リクエスト実行
+	w := serve("GET", "/api/v2/items?limit=2&offset=1", func(r *gin.Engine) { r.GET("/api/v2/items", AdaptList(list)) })
+
+	// アサーション（ハンドラーはページを読み、limit+1 件を返す。クエリは書き換えない）
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, paged)
+	assert.Equal(t, Page{Limit: 2, Offset: 1}, page)
+	assert.JSONEq(t, `{"data": [2, 3], "meta": {"limit": 2, "offset": 1, "count": 2, "has_more": true}}`, w.Body.String())
+}
+
+func TestAdaptList_InMemory(t *testing.T) {
+	// ページを読まないハンドラーの一覧はメモリ上で切り出す
+	list := func(c *gin.Context) { c.JSON(http.StatusOK, []int{1, 2, 3, 4, 5}) }
+
+	w := serve("GET", "/api/v2/items?limit=2&offset=1", func(r *gin.Engine) { r.GET("/api/v2/items", AdaptList(list)) })
+	assert.JSONEq(t, `{"data": [2, 3], "meta": {"limit": 2, "offset": 1, "count": 2, "has_more": true}}`, w.Body.String())
+
+	// 最後のページ
+	w = serve("GET", "/api/v2/items?offset=3", func(r *gin.Engine) { r.GET("/api/v2/items", AdaptList(list)) })
+	assert.JSONEq(t, `{"data": [4, 5], "meta": {"limit": 100, "offset": 3, "count": 2, "has_more": false}}`, w.Body.String())
+}
+
+func TestAdapt_NotPaged(t *testing.T) {
+	var paged bool
+	var limit string
+	handler := func(c *gin.Context) {
+		_, paged = PageFrom(c)
+		limit = c.Query("limit")
+		c.JSON(http.StatusOK, []int{1, 2, 3})
+	}
+
+	// 一覧以外のルートはページングせず、limit もそのまま渡す
+	w := serve("GET", "/api/v2/report?limit=5000", func(r *gin.Engine) { r.GET("/api/v2/report", Adapt(handler)) })
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, paged)
+	assert.Equal(t, "5000", limit)
+	assert.JSONEq(t, `{"data": [1, 2, 3]}`, w.Body.String())
+}
+
+func TestAdaptList_NullList(t *testing.T) {
+	var items []string
+	w := serve("GET", "/api/v2/items", func(r *gin.Engine) {
+		r.GET("/api/v2/items", AdaptList(func(c *gin.Context) { c.JSON(http.StatusOK, items) }))
+	})
+
+	// アサーション（null ではなく空の配列）
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data": [], "meta": {"limit": 100, "offset": 0, "count": 0, "has_more": false}}`, w.Body.String())
+}
+
+func TestAdapt_Object(t *testing.T) {
+	w := serve("POST", "/api/v2/items", func(r *gin.Engine) {
+		r.POST("/api/v2/items", Adapt(func(c *gin.Context) { c.JSON(http.StatusCreated, gin.H{"id": 1}) }))
+	})
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"data": {"id": 1}}`, w.Body.String())
+}
+
+func TestAdapt_Problem(t *testing.T) {
+	w := serve("POST", "/api/v2/power-events", func(r *gin.Engine) {
+		r.POST("/api/v2/power-events", Adapt(func(c *gin.Context) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid payload", "event_type": "door_state"})
+		}))
+	})
+
+	// アサーション（他のメンバーは拡張メンバーとして残す）
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:powerlogger:problem:validation_failed",
+		"title": "Unprocessable Entity",
+		"status": 422,
+		"code": "validation_failed",
+		"detail": "invalid payload",
+		"instance": "/api/v2/power-events",
+		"event_type": "door_state"
+	}`, w.Body.String())
+}
+
+func TestAdapt_ProblemCode(t *testing.T) {
+	w := serve("GET", "/api/v2/devices/unknown", func(r *gin.Engine) {
+		r.GET("/api/v2/devices/unknown", Adapt(func(c *gin.Context) {
+			SetCode(c, "device_not_found")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		}))
+	})
+
+	// アサーション（ハンドラーのコードを優先する）
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{
+		"type": "urn:powerlogger:problem:device_not_found",
+		"title": "Not Found",
+		"status": 404,
+		"code": "device_not_found",
+		"detail": "Device not found",
+		"instance": "/api/v2/devices/unknown"
+	}`, w.Body.String())
+}
+
+func TestAbort(t *testing.T) {
+	w := serve("GET", "/api/v2/incidents/1", func(r *gin.Engine) {
+		r.GET("/api/v2/incidents/1", func(c *gin.Context) {
+			Abort(c, http.StatusConflict, "incident_state_conflict", "Incident is resolved")
+		})
+	})
+
+	// アサーション
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var p map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "incident_state_conflict", p["code"])
+	assert.Equal(t, "urn:powerlogger:problem:incident_state_conflict", p["type"])
+}
+
+func TestAdapt_InternalErrorHidesDetail(t *testing.T) {
+	w := serve("GET", "/api/v2/items", func(r *gin.Engine) {
+		r.GET("/api/v2/items", Adapt(func(c *gin.Context) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": `pq: relation "items" does not exist`})
+		}))
+	})
+
+	// アサーション（DBのエラーは返さない）
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var p map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "internal_error", p["code"])
+	assert.NotContains(t, w.Body.String(), "pq:")
+}
+
+func TestAdaptList_InvalidPage(t *testing.T) {
+	called := false
+	for _, q := range []string{"limit=0", "limit=1001", "limit=x", "offset=-1"} {
+		w := serve("GET", "/api/v2/items?"+q, func(r *gin.Engine) {
+			r.GET("/api/v2/items", AdaptList(func(c *gin.Context) { called = true }))
+		})
+
+		// アサーション
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_request"`, q)
+	}
+	assert.False(t, called)
+}
+
+func TestAdapt_PassThrough(t *testing.T) {
+	w := serve("GET", "/api/v2/firmware/binary", func(r *gin.Engine) {
+		r.GET("/api/v2/firmware/binary", Adapt(func(c *gin.Context) {
+			c.Header("X-Checksum-SHA256", "abc")
+			c.Data(http.StatusOK, "application/octet-stream", []byte{1, 2, 3})
+		}))
+	})
+
+	// アサーション（JSON 以外はそのまま返す）
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "abc", w.Header().Get("X-Checksum-SHA256"))
+	assert.Equal(t, []byte{1, 2, 3}, w.Body.Bytes())
+}
+
+func TestNoRoute(t *testing.T) {
+	w := serve("GET", "/api/v2/nothing", func(r *gin.Engine) {})
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"not_found"`)
+
+	// v2 以外は gin の既定の 404
+	w = serve("GET", "/api/nothing", func(r *gin.Engine) {})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "404 page not found", w.Body.String())
+}
@@ -0,0 +1,141 @@
+// Package apiv2 implements the response conventions of /api/v2 on top of the
+// /api handlers: successful responses are wrapped in an Envelope, lists are
+// paginated and never null, and errors are RFC 7807 problem details with a
+// stable code.
+package apiv2
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix is prepended to the code to form the problem type URI.
+const problemTypePrefix = "urn:powerlogger:problem:"
+
+// Envelope is the body of every successful v2 response.
+type Envelope struct {
+	Data interface{} `json:"data"`
+	// Meta is set for lists.
+	Meta *Meta `json:"meta,omitempty"`
+}
+
+// Meta describes the page of a list.
+type Meta struct {
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	Count   int  `json:"count"`
+	HasMore bool `json:"has_more"`
+}
+
+// Problem is an RFC 7807 problem details object. Code is stable across
+// releases and is what clients should match on; Detail is for humans.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions are additional members, e.g. the reason an event was
+	// rejected by its schema.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	b, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return b, err
+	}
+	out := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		out[k] = v
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range members {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+// Error codes by HTTP status, for errors whose handler gives no code of its
+// own.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "validation_failed",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "service_unavailable",
+}
+
+// ErrorCode returns the generic code for an error status.
+func ErrorCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// NewProblem returns the problem for status with the default title. An empty
+// code is replaced by the generic code of the status.
+func NewProblem(status int, code, detail string) Problem {
+	if code == "" {
+		code = ErrorCode(status)
+	}
+	return Problem{
+		Type:   problemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// WriteProblem writes p as application/problem+json and aborts the request.
+func WriteProblem(c *gin.Context, p Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.Render(p.Status, render.JSON{Data: p})
+	c.Abort()
+}
+
+// Abort writes the problem for status with code (or the generic code of the
+// status if empty) and detail.
+func Abort(c *gin.Context, status int, code, detail string) {
+	WriteProblem(c, NewProblem(status, code, detail))
+}
+
+// NoRoute answers unknown /api/v2 paths with a problem; other paths get
+// gin's default 404.
+func NoRoute(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/v2/") {
+		Abort(c, http.StatusNotFound, "", "no route for "+c.Request.Method+" "+c.Request.URL.Path)
+	}
+}
+
+// internalError hides the detail of a server error, which may come from the
+// database, and logs it instead.
+func internalError(c *gin.Context, status int, detail string) Problem {
+	if detail != "" {
+		log.Printf("%s %s: %d %s", c.Request.Method, c.Request.URL.Path, status, detail)
+	}
+	return NewProblem(status, "", "")
+}
@@ -0,0 +1,153 @@
+// Package client is a typed Go client for the /api/v2 power event, device
+// and stats endpoints (see /api/openapi.json for the full API).
+//
+//	c := client.New("http://localhost")
+//	devices, _, err := c.ListDevices(ctx, client.Page{Limit: 50})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client calls the API at BaseURL (the server root, without /api).
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// UserAgent is sent with every request. The server reads the device
+	// model and firmware version from it when an event does not carry them.
+	UserAgent string
+}
+
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Error is an error response (RFC 7807 problem details).
+type Error struct {
+	StatusCode int
+	// Code is stable and meant for matching, e.g. "device_not_found".
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Detail)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Code)
+}
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// Page selects a page of a list. Zero values use the server defaults.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+func (p Page) values() url.Values {
+	v := url.Values{}
+	if p.Limit > 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset > 0 {
+		v.Set("offset", strconv.Itoa(p.Offset))
+	}
+	return v
+}
+
+// Meta describes the page returned for a list.
+type Meta struct {
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	Count   int  `json:"count"`
+	HasMore bool `json:"has_more"`
+}
+
+// Next returns the page after the one described by m.
+func (m Meta) Next() Page {
+	return Page{Limit: m.Limit, Offset: m.Offset + m.Count}
+}
+
+type envelope struct {
+	Data json.RawMessage `json:"data"`
+	Meta *Meta           `json:"meta"`
+}
+
+// do sends a request to /api/v2+path and decodes the data of the response
+// into out (if not nil). It returns the page meta of lists.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*Meta, error) {
+	u := c.BaseURL + "/api/v2" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			apiErr.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return nil, fmt.Errorf("%s %s: decode data: %w", method, path, err)
+		}
+	}
+	return env.Meta, nil
+}
+
+func pageMeta(meta *Meta) Meta {
+	if meta == nil {
+		return Meta{}
+	}
+	return *meta
+}
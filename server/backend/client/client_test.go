@@ -0,0 +1,126 @@
+package client
+
+import (
+	"backend/apiv2"
+	"backend/handlers"
+	"backend/openapi"
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// testServer serves the v2 routes the client uses with the real handlers.
+func testServer(t *testing.T, db *sql.DB) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v2 := router.Group("/api/v2")
+	devices := handlers.NewDeviceHandler(db)
+	powerEvents := handlers.NewPowerEventHandler(db)
+	v2.GET("/devices", apiv2.AdaptList(devices.GetDevices))
+	v2.GET("/devices/:deviceId", apiv2.Adapt(devices.GetDeviceByID))
+	v2.GET("/power-events/stats", apiv2.Adapt(powerEvents.GetEventStats))
+
+	// クライアントの呼ぶパスは仕様に含まれている
+	for _, r := range router.Routes() {
+		assert.Contains(t, openapi.Spec().Paths, openapi.OpenAPIPath(r.Path))
+	}
+	return httptest.NewServer(router)
+}
+
+func TestListDevices(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "name", "description", "model", "firmware_version", "site", "group", "offline_since", "last_seen", "created_at", "updated_at"}).
+		AddRow("device-001", "M5StickC Device 1", "Test device", "M5StickCPlus2", "1.0.0", "tokyo-office", "", nil, now, now, now).
+		AddRow("device-002", "M5StickC Device 2", "Another test device", "M5StickCPlus2", "1.0.0", "tokyo-office", "", nil, now, now, now)
+	// ページは SQL で取り出す（次のページの有無を知るため1件多く）
+	mock.ExpectQuery("SELECT (.+) FROM devices ORDER BY created_at DESC LIMIT \\$1 OFFSET \\$2").
+		WithArgs(2, 0).
+		WillReturnRows(rows)
+
+	server := testServer(t, db)
+	defer server.Close()
+
+	// クライアント実行
+	devices, meta, err := New(server.URL).ListDevices(context.Background(), Page{Limit: 1})
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "device-001", devices[0].ID)
+	assert.Equal(t, "tokyo-office", devices[0].Site)
+	assert.True(t, meta.HasMore)
+	assert.Equal(t, Page{Limit: 1, Offset: 1}, meta.Next())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDevice_NotFound(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	server := testServer(t, db)
+	defer server.Close()
+
+	// クライアント実行
+	device, err := New(server.URL).GetDevice(context.Background(), "unknown")
+
+	// アサーション
+	assert.Nil(t, device)
+	assert.True(t, IsNotFound(err))
+	assert.EqualError(t, err, "404 device_not_found: Device not found")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEventStats(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	oldest := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(100))
+	mock.ExpectQuery("SELECT MIN\\(timestamp\\) FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(oldest))
+	mock.ExpectQuery("SELECT MAX\\(timestamp\\) FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(oldest))
+	for _, n := range []int{10, 40, 80} {
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events WHERE timestamp >= \\$1").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+	}
+
+	server := testServer(t, db)
+	defer server.Close()
+
+	// クライアント実行
+	stats, err := New(server.URL).GetEventStats(context.Background())
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, 100, stats.TotalCount)
+	assert.True(t, oldest.Equal(*stats.OldestEvent))
+	assert.Equal(t, 20, stats.CountOlderThan90Days)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
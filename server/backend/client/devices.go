@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"backend/analysis"
+	"backend/models"
+)
+
+func (c *Client) ListDevices(ctx context.Context, page Page) ([]models.Device, Meta, error) {
+	var devices []models.Device
+	meta, err := c.do(ctx, "GET", "/devices", page.values(), nil, &devices)
+	return devices, pageMeta(meta), err
+}
+
+func (c *Client) GetDevice(ctx context.Context, id string) (*models.Device, error) {
+	var device models.Device
+	if _, err := c.do(ctx, "GET", "/devices/"+url.PathEscape(id), nil, nil, &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// UpdateDevice sets the name and description; site and group are only
+// changed when set.
+func (c *Client) UpdateDevice(ctx context.Context, id string, req models.DeviceUpdateRequest) error {
+	_, err := c.do(ctx, "PUT", "/devices/"+url.PathEscape(id), nil, req, nil)
+	return err
+}
+
+// DeleteDevice deletes a device and its events.
+func (c *Client) DeleteDevice(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", "/devices/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+// MergeDevice moves the history of req.From into the device id; req.From
+// becomes an alias of it.
+func (c *Client) MergeDevice(ctx context.Context, id string, req models.DeviceMergeRequest) (*models.DeviceMergeResult, error) {
+	var result models.DeviceMergeResult
+	if _, err := c.do(ctx, "POST", "/devices/"+url.PathEscape(id)+"/merge", nil, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetDeviceHealth(ctx context.Context, id string) (*models.DeviceHealth, error) {
+	var health models.DeviceHealth
+	if _, err := c.do(ctx, "GET", "/devices/"+url.PathEscape(id)+"/health", nil, nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// GetDeviceBattery analyzes the battery over the last days (0 for the server
+// default).
+func (c *Client) GetDeviceBattery(ctx context.Context, id string, days int) (*analysis.BatteryReport, error) {
+	query := url.Values{}
+	if days > 0 {
+		query.Set("days", strconv.Itoa(days))
+	}
+	var report analysis.BatteryReport
+	if _, err := c.do(ctx, "GET", "/devices/"+url.PathEscape(id)+"/battery", query, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
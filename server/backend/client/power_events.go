@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"backend/models"
+)
+
+// CreatePowerEvent records an event. Warnings are returned when the event
+// type's schema is in warn mode and the payload did not match.
+func (c *Client) CreatePowerEvent(ctx context.Context, req models.PowerEventRequest) ([]string, error) {
+	var created struct {
+		Warnings []string `json:"warnings"`
+	}
+	if _, err := c.do(ctx, "POST", "/power-events", nil, req, &created); err != nil {
+		return nil, err
+	}
+	return created.Warnings, nil
+}
+
+// ListPowerEvents returns a page of events, newest first.
+func (c *Client) ListPowerEvents(ctx context.Context, page Page) ([]models.PowerEvent, Meta, error) {
+	var events []models.PowerEvent
+	meta, err := c.do(ctx, "GET", "/power-events", page.values(), nil, &events)
+	return events, pageMeta(meta), err
+}
+
+func (c *Client) GetPowerEvent(ctx context.Context, id int) (*models.PowerEvent, error) {
+	var event models.PowerEvent
+	if _, err := c.do(ctx, "GET", "/power-events/"+strconv.Itoa(id), nil, nil, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// SearchOptions narrow SearchPowerEvents. Zero times are not sent.
+type SearchOptions struct {
+	From time.Time
+	To   time.Time
+	Page Page
+}
+
+// SearchPowerEvents runs a search query such as
+// "battery_percentage<20 AND timeout", newest first.
+func (c *Client) SearchPowerEvents(ctx context.Context, q string, opts SearchOptions) ([]models.PowerEvent, Meta, error) {
+	query := opts.Page.values()
+	query.Set("q", q)
+	if !opts.From.IsZero() {
+		query.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", opts.To.Format(time.RFC3339))
+	}
+	var events []models.PowerEvent
+	meta, err := c.do(ctx, "GET", "/power-events/search", query, nil, &events)
+	return events, pageMeta(meta), err
+}
+
+// GetDeviceTimeline returns the events and annotations of a device, newest
+// first.
+func (c *Client) GetDeviceTimeline(ctx context.Context, deviceID string, page Page) ([]models.TimelineItem, Meta, error) {
+	var items []models.TimelineItem
+	meta, err := c.do(ctx, "GET", "/power-events/device/"+url.PathEscape(deviceID)+"/timeline", page.values(), nil, &items)
+	return items, pageMeta(meta), err
+}
+
+func (c *Client) GetEventStats(ctx context.Context) (*models.EventStats, error) {
+	var stats models.EventStats
+	if _, err := c.do(ctx, "GET", "/power-events/stats", nil, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// DeleteOldEvents deletes the events older than the given number of days and
+// returns how many were deleted.
+func (c *Client) DeleteOldEvents(ctx context.Context, olderThanDays int) (int64, error) {
+	var result struct {
+		DeletedCount int64 `json:"deleted_count"`
+	}
+	body := map[string]int{"older_than_days": olderThanDays}
+	if _, err := c.do(ctx, "DELETE", "/power-events/cleanup", nil, body, &result); err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"backend/credentials"
+	"backend/store"
+)
+
+// runCleanup deletes old events like DELETE /api/power-events/cleanup.
+func runCleanup(e *env, args []string) error {
+	fs := newFlags("cleanup")
+	days := fs.Int("days", 0, "delete events older than this many days")
+	dryRun := fs.Bool("dry-run", false, "only count the events")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *days < 1 {
+		return errUsage
+	}
+
+	cutoff := store.EventsCutoff(e.now, *days)
+	count, err := store.CountEventsBefore(e.db, cutoff)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(e.out, "Would delete %d events before %s\n", count, cutoff.Format("2006-01-02 15:04:05"))
+		return nil
+	}
+	deleted, err := store.DeleteEventsBefore(e.db, cutoff)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Deleted %d events before %s\n", deleted, cutoff.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+func runExport(e *env, args []string) (err error) {
+	fs := newFlags("export")
+	output := fs.String("o", "-", "output file")
+	var filter store.ExportFilter
+	var from, to timeFlag
+	fs.StringVar(&filter.DeviceID, "device", "", "only this device")
+	fs.Var(&from, "from", "only events at or after this time")
+	fs.Var(&to, "to", "only events before this time")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+	filter.From, filter.To = from.t, to.t
+
+	out := bufio.NewWriter(e.out)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = bufio.NewWriter(f)
+	}
+	devices, events, err := store.Export(e.db, out, filter)
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d devices and %d events\n", devices, events)
+	return nil
+}
+
+func runImport(e *env, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	var in io.Reader = e.in
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	result, err := store.Import(e.db, in)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Imported %d devices and %d events (%d already present)\n", result.Devices, result.Events, result.Skipped)
+	if result.Events > 0 {
+		fmt.Fprintln(e.out, "Run \"recompute\" to update incidents and heap analysis")
+	}
+	return nil
+}
+
+func runDevice(e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch sub, rest := args[0], args[1:]; {
+	case sub == "list" && len(rest) == 0:
+		devices, err := store.ListDevices(e.db, 0, 0)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(e.out)
+		fmt.Fprintf(w, "%-24s %-24s %-16s %-10s %s\n", "ID", "NAME", "SITE", "FIRMWARE", "LAST SEEN")
+		for _, d := range devices {
+			fmt.Fprintf(w, "%-24s %-24s %-16s %-10s %s\n", d.ID, d.Name, d.Site, d.FirmwareVersion, d.LastSeen.Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+
+	case sub == "rename" && len(rest) >= 2:
+		name := strings.Join(rest[1:], " ")
+		if err := notFound(store.RenameDevice(e.db, rest[0], name), rest[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "Renamed %s to %q\n", rest[0], name)
+		return nil
+
+	case sub == "delete" && len(rest) == 1:
+		if err := notFound(store.DeleteDevice(e.db, rest[0]), rest[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "Deleted %s and its events\n", rest[0])
+		return nil
+
+	case sub == "merge" && len(rest) >= 2:
+		result, err := store.MergeDevices(e.db, rest[0], rest[1], e.actor, strings.Join(rest[2:], " "))
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("device %s or %s not found", rest[0], rest[1])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "Merged %s into %s (%d events moved); aliases: %s\n",
+			result.MergedFrom, result.DeviceID, result.MovedEvents, strings.Join(result.Aliases, ", "))
+		return nil
+
+	case sub == "rotate-key" && len(rest) == 1:
+		exists, err := store.DeviceExists(e.db, rest[0])
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return notFound(sql.ErrNoRows, rest[0])
+		}
+		key, err := credentials.NewStore(e.db).Rotate(rest[0])
+		if err != nil {
+			return err
+		}
+		// The key cannot be shown again, so it goes to stdout on its own.
+		fmt.Fprintln(e.out, key)
+		return nil
+	}
+	return errUsage
+}
+
+// runUser manages the embedded MQTT broker's logins for integrations; the
+// HTTP API itself has no user accounts.
+func runUser(e *env, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	users := credentials.NewStore(e.db)
+	switch name := args[1]; args[0] {
+	case "create":
+		// デバイスIDと同じ名前にすると、そのデバイスが接続できなくなる
+		exists, err := store.DeviceExists(e.db, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%s is a device id; choose another user name", name)
+		}
+		password, err := users.CreateUser(name)
+		if err != nil {
+			return err
+		}
+		// The password cannot be shown again, so it goes to stdout on its own.
+		fmt.Fprintln(e.out, password)
+		return nil
+
+	case "delete":
+		deleted, err := users.DeleteUser(name)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return fmt.Errorf("user %s not found", name)
+		}
+		fmt.Fprintf(e.out, "Deleted user %s\n", name)
+		return nil
+	}
+	return errUsage
+}
+
+func notFound(err error, deviceID string) error {
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+// Command powerlogger-admin runs operational tasks directly against the
+// database, using the same configuration (DB_* and the server's environment
+// variables) and store layer as the server.
+//
+//	go run ./cmd/powerlogger-admin cleanup -days 90 -dry-run
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"backend/config"
+	"backend/db"
+)
+
+// env is what a command runs with.
+type env struct {
+	db  *sql.DB
+	cfg config.Config
+	in  io.Reader
+	out io.Writer
+	now time.Time
+	// actor is recorded in the device audit log.
+	actor string
+}
+
+type command struct {
+	usage   string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"migrate":   {"migrate", "apply pending schema migrations", runMigrate},
+	"cleanup":   {"cleanup -days N [-dry-run]", "delete events older than N days", runCleanup},
+	"export":    {"export [-o file] [-device id] [-from t] [-to t]", "write devices and events as JSON Lines", runExport},
+	"import":    {"import [file]", "read an export (default: stdin)", runImport},
+	"device":    {"device list | rename <id> <name> | delete <id> | merge <from> <into> [comment] | rotate-key <id>", "manage devices", runDevice},
+	"user":      {"user create <name> | delete <name>", "manage MQTT broker logins with access to all topics", runUser},
+	"recompute": {"recompute [-from t] [-outages] [-rollups]", "rebuild incidents, last_seen and heap analysis from events", runRecompute},
+}
+
+// errUsage makes main print the usage of the command.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	actor := os.Getenv("USER")
+	if actor == "" {
+		actor = "powerlogger-admin"
+	}
+	e := &env{db: database, cfg: config.Load(), in: os.Stdin, out: os.Stdout, now: time.Now(), actor: actor}
+	if err := cmd.run(e, os.Args[2:]); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "usage: powerlogger-admin %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: powerlogger-admin <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+// newFlags returns a flag set that reports errors instead of exiting.
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// timeFlag is a flag taking RFC3339 or YYYY-MM-DD, like the API's from/to.
+type timeFlag struct{ t time.Time }
+
+func (f *timeFlag) String() string {
+	if f.t.IsZero() {
+		return ""
+	}
+	return f.t.Format(time.RFC3339)
+}
+
+func (f *timeFlag) Set(value string) error {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("invalid time %q", value)
+		}
+	}
+	f.t = t
+	return nil
+}
+
+func runMigrate(e *env, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	applied, err := db.Migrate(e.db)
+	if err != nil {
+		return err
+	}
+	// Recorded versions alone do not prove the schema is complete.
+	if err := db.CheckSchema(e.db); err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(e.out, "Schema is up to date")
+	}
+	for _, version := range applied {
+		fmt.Fprintf(e.out, "Applied migration %s\n", version)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEnv(t *testing.T) (*env, sqlmock.Sqlmock, *bytes.Buffer) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	var out bytes.Buffer
+	cfg := config.Config{IncidentWindow: time.Minute, IncidentMinDevices: 2}
+	return &env{db: db, cfg: cfg, out: &out, now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}, mock, &out
+}
+
+func TestCleanup_DryRun(t *testing.T) {
+	e, mock, out := testEnv(t)
+
+	// ドライランでは件数だけ数えて削除しない
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events WHERE timestamp < \\$1").
+		WithArgs(time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+	err := runCleanup(e, []string{"-days", "90", "-dry-run"})
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, "Would delete 5 events before 2024-03-03 12:00:00\n", out.String())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanup_InvalidDays(t *testing.T) {
+	e, mock, _ := testEnv(t)
+
+	// API と同じく1日以上が必要
+	assert.Equal(t, errUsage, runCleanup(e, []string{"-days", "0"}))
+	assert.Equal(t, errUsage, runCleanup(e, nil))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDevice_Rename(t *testing.T) {
+	e, mock, out := testEnv(t)
+
+	mock.ExpectExec("UPDATE devices SET name = \\$1, updated_at = \\$2 WHERE id = \\$3").
+		WithArgs("Kitchen shelf", sqlmock.AnyArg(), "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE devices SET name = \\$1, updated_at = \\$2 WHERE id = \\$3").
+		WithArgs("Kitchen", sqlmock.AnyArg(), "unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// 名前は残りの引数をつなげたもの
+	assert.NoError(t, runDevice(e, []string{"rename", "device-001", "Kitchen", "shelf"}))
+	assert.Equal(t, "Renamed device-001 to \"Kitchen shelf\"\n", out.String())
+
+	assert.EqualError(t, runDevice(e, []string{"rename", "unknown", "Kitchen"}), "device unknown not found")
+	assert.Equal(t, errUsage, runDevice(e, []string{"rename", "device-001"}))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDevice_RotateKey_NotFound(t *testing.T) {
+	e, mock, _ := testEnv(t)
+
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM devices WHERE id = \\$1\\)").
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	assert.EqualError(t, runDevice(e, []string{"rotate-key", "unknown"}), "device unknown not found")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUser_Create(t *testing.T) {
+	e, mock, out := testEnv(t)
+
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM devices WHERE id = \\$1\\)").
+		WithArgs("homeassistant").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("INSERT INTO mqtt_users").
+		WithArgs("homeassistant", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// 生成したパスワードだけを標準出力に表示する
+	assert.NoError(t, runUser(e, []string{"create", "homeassistant"}))
+	assert.Len(t, strings.TrimSpace(out.String()), 64)
+
+	// デバイスIDと同じ名前のユーザーは作らない
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM devices WHERE id = \\$1\\)").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	assert.EqualError(t, runUser(e, []string{"create", "device-001"}), "device-001 is a device id; choose another user name")
+
+	assert.Equal(t, errUsage, runUser(e, []string{"create"}))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrate_IncompleteSchema(t *testing.T) {
+	e, mock, out := testEnv(t)
+
+	// マイグレーションが適用済みでも、列が足りなければ失敗にする
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, version := range []string{"000_schema_upgrade", "001_event_data_columns", "002_device_aliases", "003_mqtt_users", "004_webhook_skip_muted", "005_event_data_index_ops"} {
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(version).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+	}
+	mock.ExpectQuery("SELECT table_name, column_name FROM information_schema.columns").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name"}).AddRow("devices", "id"))
+
+	err := runMigrate(e, nil)
+
+	// アサーション
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "schema is missing")
+	assert.Empty(t, out.String())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecompute_Outages(t *testing.T) {
+	e, mock, out := testEnv(t)
+
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := from.Add(time.Hour)
+	mock.ExpectQuery("SELECT device_id, event_type, timestamp, expected FROM power_events").
+		WithArgs(from).
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "event_type", "timestamp", "expected"}).
+			AddRow("device-001", "power_off", at, true).
+			AddRow("device-001", "power_on", at.Add(time.Minute), false))
+	mock.ExpectExec("DELETE FROM incidents WHERE started_at >= \\$1").
+		WithArgs(from).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// 計画的な power_off はインシデントにしない（power_on だけ再生する）
+	mock.ExpectExec("UPDATE incident_devices SET power_on_at = \\$1").
+		WithArgs(at.Add(time.Minute), "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := runRecompute(e, []string{"-outages", "-from", "2024-05-01"})
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, "Rebuilt incidents since 2024-05-01 00:00:00 from 2 events\n", out.String())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"backend/alerts"
+	"backend/analysis"
+	"backend/correlation"
+	"backend/health"
+	"backend/maintenance"
+)
+
+// runRecompute rebuilds the data the server derives from events as they
+// arrive, e.g. after an import or a change of INCIDENT_* settings.
+func runRecompute(e *env, args []string) error {
+	fs := newFlags("recompute")
+	from := timeFlag{e.now.AddDate(0, 0, -30)}
+	fs.Var(&from, "from", "rebuild incidents that started at or after this time (default: 30 days ago)")
+	outages := fs.Bool("outages", false, "rebuild incidents from power_off/power_on events")
+	rollups := fs.Bool("rollups", false, "update devices.last_seen and the heap analysis")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+	if !*outages && !*rollups {
+		*outages, *rollups = true, true
+	}
+
+	if *outages {
+		n, err := recomputeIncidents(e, from.t)
+		if err != nil {
+			return fmt.Errorf("incidents: %w", err)
+		}
+		fmt.Fprintf(e.out, "Rebuilt incidents since %s from %d events\n", from.t.Format("2006-01-02 15:04:05"), n)
+	}
+	if *rollups {
+		if err := recomputeRollups(e); err != nil {
+			return fmt.Errorf("rollups: %w", err)
+		}
+		fmt.Fprintln(e.out, "Updated last_seen and heap analysis")
+	}
+	return nil
+}
+
+// recomputeIncidents deletes the incidents that started since from (with
+// their triage history) and replays the power events through the correlator
+// as the ingest pipeline does: planned power_off events open no incident.
+func recomputeIncidents(e *env, from time.Time) (int, error) {
+	rows, err := e.db.Query(`
+		SELECT device_id, event_type, timestamp, expected FROM power_events
+		WHERE timestamp >= $1 AND event_type IN ('power_off', 'power_on')
+		ORDER BY timestamp, id`, from)
+	if err != nil {
+		return 0, err
+	}
+	type event struct {
+		deviceID, eventType string
+		at                  time.Time
+		expected            bool
+	}
+	var events []event
+	for rows.Next() {
+		var ev event
+		if err := rows.Scan(&ev.deviceID, &ev.eventType, &ev.at, &ev.expected); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, ev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := e.db.Exec("DELETE FROM incidents WHERE started_at >= $1", from); err != nil {
+		return 0, err
+	}
+	correlator := correlation.NewCorrelator(e.db, e.cfg.IncidentWindow, e.cfg.IncidentMinDevices)
+	for _, ev := range events {
+		if ev.expected && ev.eventType == "power_off" {
+			continue
+		}
+		if err := correlator.HandleEvent(ev.deviceID, ev.eventType, ev.at); err != nil {
+			return 0, fmt.Errorf("%s %s at %s: %w", ev.deviceID, ev.eventType, ev.at.Format(time.RFC3339), err)
+		}
+	}
+	return len(events), nil
+}
+
+// recomputeRollups sets each device's last_seen to its newest event and runs
+// the heap analysis once, as the server's background job does.
+func recomputeRollups(e *env) error {
+	_, err := e.db.Exec(`
+		UPDATE devices SET last_seen = latest.at
+		FROM (SELECT device_id, MAX(timestamp) AS at FROM power_events GROUP BY device_id) latest
+		WHERE devices.id = latest.device_id`)
+	if err != nil {
+		return err
+	}
+
+	alertManager := alerts.NewManager(e.db)
+	alertManager.SetMuter(maintenance.NewSchedule(e.db))
+	return health.NewHeapAnalyzer(e.db, alertManager, analysis.DefaultHeapOptions()).RunOnce(e.now)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"backend/models"
+)
+
+// Profile holds the knobs shared by every simulated device.
+type Profile struct {
+	// StatusInterval is the periodic_status interval
+	// (PERIODIC_EVENT_INTERVAL_MS on the real firmware).
+	StatusInterval time.Duration
+	// OutagesPerDay and RebootsPerDay are mean rates; the times in between
+	// are exponentially distributed.
+	OutagesPerDay float64
+	RebootsPerDay float64
+	// OutageDuration is the mean length of a mains outage.
+	OutageDuration time.Duration
+	// DrainPerHour and ChargePerHour are battery percentage points lost on
+	// battery and gained on mains.
+	DrainPerHour  float64
+	ChargePerHour float64
+	// MaxClockSkew bounds the per-device offset of the client timestamp.
+	MaxClockSkew time.Duration
+	// Prefix is prepended to the device ids, like DEVICE_ID_PREFIX.
+	Prefix string
+}
+
+// DefaultProfile matches the M5StickC Plus2 firmware defaults.
+var DefaultProfile = Profile{
+	StatusInterval: time.Minute,
+	OutagesPerDay:  2,
+	RebootsPerDay:  0.5,
+	OutageDuration: 20 * time.Minute,
+	DrainPerHour:   60,
+	ChargePerHour:  40,
+	MaxClockSkew:   90 * time.Second,
+	Prefix:         "SIM_",
+}
+
+const (
+	firmwareVersion  = "1.0.0"
+	deviceModel      = "M5StickCPlus2"
+	batteryLowLevel  = 20 // BATTERY_LOW_THRESHOLD
+	baseHeap         = 180000
+	minRSSI, maxRSSI = -100, -30
+)
+
+// Event is a request a device sends at a simulated time.
+type Event struct {
+	At      time.Time                `json:"at"`
+	Request models.PowerEventRequest `json:"request"`
+}
+
+// Device is one simulated M5Stick. All randomness comes from its own
+// generator, so a device's events depend only on the seed and its index.
+type Device struct {
+	ID      string
+	profile Profile
+	rng     *rand.Rand
+
+	bootAt time.Time
+	// The client clock is off by skew after each boot's time sync and then
+	// drifts by driftPPM.
+	skew     time.Duration
+	driftPPM float64
+	rssiBase float64
+	// heapLeak is bytes lost per hour since boot; most devices do not leak.
+	heapLeak float64
+
+	battery   float64
+	updatedAt time.Time
+	onBattery bool
+	dead      bool
+	lowSent   bool
+
+	nextStatus time.Time
+	nextOutage time.Time
+	outageEnd  time.Time
+	nextReboot time.Time
+}
+
+// NewDevice creates the index-th device of a run. It boots somewhere within
+// the first status interval after start.
+func NewDevice(seed int64, index int, profile Profile, start time.Time) *Device {
+	rng := rand.New(rand.NewSource(seed*1000003 + int64(index)))
+	d := &Device{
+		ID:       fmt.Sprintf("%s%08X", profile.Prefix, rng.Uint32()),
+		profile:  profile,
+		rng:      rng,
+		rssiBase: -55 - rng.Float64()*30,
+		battery:  60 + rng.Float64()*40,
+	}
+	if profile.MaxClockSkew > 0 {
+		d.skew = time.Duration((rng.Float64()*2 - 1) * float64(profile.MaxClockSkew))
+	}
+	d.driftPPM = (rng.Float64()*2 - 1) * 200
+	if rng.Float64() < 0.25 {
+		d.heapLeak = 200 + rng.Float64()*1800
+	}
+	boot := start.Add(time.Duration(rng.Int63n(int64(profile.StatusInterval))))
+	d.updatedAt = boot
+	d.nextStatus = boot
+	d.nextOutage = boot.Add(d.exp(profile.OutagesPerDay))
+	d.nextReboot = boot.Add(d.exp(profile.RebootsPerDay))
+	return d
+}
+
+// exp returns an exponentially distributed wait for a rate per day, or a
+// wait longer than any run when the rate is zero.
+func (d *Device) exp(perDay float64) time.Duration {
+	if perDay <= 0 {
+		return 100 * 365 * 24 * time.Hour
+	}
+	return time.Duration(d.rng.ExpFloat64() / perDay * float64(24*time.Hour))
+}
+
+// Next returns the simulated time of the device's next action.
+func (d *Device) Next() time.Time {
+	next := d.nextStatus
+	for _, t := range []time.Time{d.nextOutage, d.outageEnd, d.nextReboot} {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
+
+// Step performs the device's next action and returns the events it sends.
+// Before the first step the device has not booted yet.
+func (d *Device) Step() []Event {
+	now := d.Next()
+	d.updateBattery(now)
+
+	switch {
+	case d.bootAt.IsZero():
+		d.boot(now)
+		d.nextStatus = now.Add(d.profile.StatusInterval)
+		return []Event{d.event(now, "power_on", "Device booted")}
+
+	case !d.outageEnd.IsZero() && !now.Before(d.outageEnd):
+		d.outageEnd = time.Time{}
+		d.onBattery = false
+		d.nextOutage = now.Add(d.exp(d.profile.OutagesPerDay))
+		if d.dead {
+			// A device that ran flat boots again when power returns.
+			d.dead = false
+			d.boot(now)
+			d.nextStatus = now.Add(d.profile.StatusInterval)
+			return []Event{d.event(now, "power_on", "Device booted")}
+		}
+		return []Event{d.event(now, "power_on", "Mains power restored")}
+
+	case d.dead:
+		// Nothing runs until power comes back.
+		d.nextStatus = d.outageEnd
+		d.nextReboot = d.outageEnd.Add(d.exp(d.profile.RebootsPerDay))
+		return nil
+
+	case now.Equal(d.nextOutage):
+		d.onBattery = true
+		d.outageEnd = now.Add(time.Duration(d.rng.ExpFloat64() * float64(d.profile.OutageDuration)))
+		d.nextOutage = time.Time{}
+		return []Event{d.event(now, "power_off", "Mains power lost")}
+
+	case now.Equal(d.nextReboot):
+		// A crash: the error may or may not reach the server before reset.
+		var events []Event
+		if d.rng.Float64() < 0.5 {
+			events = append(events, d.event(now, "system_error", "Watchdog timeout"))
+		}
+		boot := now.Add(time.Duration(2+d.rng.Intn(8)) * time.Second)
+		d.boot(boot)
+		d.nextStatus = boot.Add(d.profile.StatusInterval)
+		d.nextReboot = boot.Add(d.exp(d.profile.RebootsPerDay))
+		return append(events, d.event(boot, "power_on", "Device booted"))
+	}
+
+	// Periodic status, jittered by a few hundred milliseconds like the
+	// firmware's loop.
+	d.nextStatus = now.Add(d.profile.StatusInterval + time.Duration(d.rng.Intn(500))*time.Millisecond)
+	var events []Event
+	if d.onBattery && math.Round(d.battery) < batteryLowLevel && !d.lowSent {
+		d.lowSent = true
+		events = append(events, d.event(now, "battery_low", "Battery low"))
+	}
+	if d.rng.Float64() < 0.01 {
+		events = append(events, d.event(now, "wifi_reconnected", "WiFi reconnected"))
+	}
+	return append(events, d.event(now, "periodic_status", "Periodic status"))
+}
+
+func (d *Device) boot(at time.Time) {
+	d.bootAt = at
+	if d.nextReboot.Before(at) {
+		d.nextReboot = at.Add(d.exp(d.profile.RebootsPerDay))
+	}
+}
+
+// updateBattery drains on battery and charges on mains up to now. A device
+// that runs flat stays off until the outage ends.
+func (d *Device) updateBattery(now time.Time) {
+	hours := now.Sub(d.updatedAt).Hours()
+	d.updatedAt = now
+	if hours <= 0 {
+		return
+	}
+	if d.onBattery {
+		d.battery -= d.profile.DrainPerHour * hours
+		if d.battery <= 0 {
+			d.battery = 0
+			d.dead = true
+		}
+		return
+	}
+	d.battery = math.Min(100, d.battery+d.profile.ChargePerHour*hours)
+	if d.battery >= batteryLowLevel {
+		d.lowSent = false
+	}
+}
+
+func (d *Device) event(at time.Time, eventType, message string) Event {
+	rssi := int(math.Round(d.rssiBase + d.rng.NormFloat64()*4))
+	if rssi < minRSSI {
+		rssi = minRSSI
+	}
+	if rssi > maxRSSI {
+		rssi = maxRSSI
+	}
+	uptime := at.Sub(d.bootAt)
+	heap := baseHeap - d.heapLeak*uptime.Hours() + d.rng.NormFloat64()*800
+	battery := int(math.Round(d.battery))
+	return Event{
+		At: at,
+		Request: models.PowerEventRequest{
+			DeviceID:           d.ID,
+			Timestamp:          at.Add(d.skew + time.Duration(float64(uptime)*d.driftPPM/1e6)).UTC(),
+			UptimeMs:           uptime.Milliseconds(),
+			EventType:          eventType,
+			Message:            message,
+			BatteryPercentage:  battery,
+			BatteryVoltage:     math.Round((3.3+0.9*float64(battery)/100)*100) / 100,
+			WiFiSignalStrength: rssi,
+			FreeHeap:           int64(math.Max(20000, heap)),
+			FirmwareVersion:    firmwareVersion,
+			Model:              deviceModel,
+		},
+	}
+}
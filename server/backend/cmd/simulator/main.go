@@ -0,0 +1,242 @@
+// Command simulator emulates M5StickC Plus2 devices and posts their events to
+// the backend, for load tests and demos without hardware. Runs are
+// deterministic: the same -seed, -devices, -start and profile flags produce
+// the same events.
+//
+//	go run ./cmd/simulator -url http://localhost:8080 -devices 20 -speed 60
+//
+// The server stamps events with the time it receives them; the simulated time
+// is sent as the client timestamp (with the device's clock skew). Use -speed 1
+// for a realistic timeline and -speed 0 to send as fast as possible.
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/client"
+)
+
+func main() {
+	profile := DefaultProfile
+	url := flag.String("url", "http://localhost:8080", "backend base URL")
+	devices := flag.Int("devices", 10, "number of simulated devices")
+	seed := flag.Int64("seed", 1, "random seed")
+	startFlag := flag.String("start", "", "simulated start time (RFC3339, default now)")
+	duration := flag.Duration("duration", 24*time.Hour, "simulated duration")
+	speed := flag.Float64("speed", 1, "simulated seconds per real second (0 = no waiting)")
+	workers := flag.Int("concurrency", 4, "concurrent HTTP senders")
+	dryRun := flag.Bool("dry-run", false, "print events as JSON lines instead of posting them")
+	flag.DurationVar(&profile.StatusInterval, "interval", profile.StatusInterval, "periodic_status interval")
+	flag.Float64Var(&profile.OutagesPerDay, "outages-per-day", profile.OutagesPerDay, "mean mains outages per device and day")
+	flag.DurationVar(&profile.OutageDuration, "outage-duration", profile.OutageDuration, "mean outage length")
+	flag.Float64Var(&profile.RebootsPerDay, "reboots-per-day", profile.RebootsPerDay, "mean crashes per device and day")
+	flag.Float64Var(&profile.DrainPerHour, "drain-per-hour", profile.DrainPerHour, "battery percent lost per hour on battery")
+	flag.Float64Var(&profile.ChargePerHour, "charge-per-hour", profile.ChargePerHour, "battery percent gained per hour on mains")
+	flag.DurationVar(&profile.MaxClockSkew, "clock-skew", profile.MaxClockSkew, "maximum client clock offset")
+	flag.StringVar(&profile.Prefix, "prefix", profile.Prefix, "device id prefix")
+	flag.Parse()
+
+	if *devices <= 0 || profile.StatusInterval <= 0 || *speed < 0 || *workers <= 0 {
+		log.Fatal("-devices, -interval and -concurrency must be positive and -speed not negative")
+	}
+	start := time.Now().Truncate(time.Second)
+	if *startFlag != "" {
+		t, err := time.Parse(time.RFC3339, *startFlag)
+		if err != nil {
+			log.Fatalf("Invalid -start: %v", err)
+		}
+		start = t
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	sims := make([]*Device, *devices)
+	for i := range sims {
+		sims[i] = NewDevice(*seed, i, profile, start)
+	}
+
+	var out sender
+	if *dryRun {
+		out = newPrinter()
+	} else {
+		c := client.New(*url)
+		c.UserAgent = deviceModel + "/" + firmwareVersion
+		out = newPoster(ctx, c, *workers)
+	}
+
+	clock := newPacer(start, *speed)
+	n := Simulate(sims, start.Add(*duration), func(index int, e Event) bool {
+		if !clock.wait(ctx, e.At) {
+			return false
+		}
+		out.send(index, e)
+		return true
+	})
+	sent, failed := out.close()
+	log.Printf("Simulated %d devices: %d events generated, %d sent, %d failed", len(sims), n, sent, failed)
+}
+
+// Simulate steps the devices in simulated-time order until end and passes
+// each event to emit, stopping early when emit returns false. Ties are
+// broken by device index, so the order is deterministic. It returns the
+// number of events emitted.
+func Simulate(devices []*Device, end time.Time, emit func(index int, e Event) bool) int {
+	q := make(deviceQueue, len(devices))
+	for i, d := range devices {
+		q[i] = queued{index: i, device: d}
+	}
+	heap.Init(&q)
+
+	n := 0
+	for q.Len() > 0 {
+		next := q[0]
+		if next.device.Next().After(end) {
+			break
+		}
+		for _, e := range next.device.Step() {
+			if !emit(next.index, e) {
+				return n
+			}
+			n++
+		}
+		heap.Fix(&q, 0)
+	}
+	return n
+}
+
+type queued struct {
+	index  int
+	device *Device
+}
+
+type deviceQueue []queued
+
+func (q deviceQueue) Len() int { return len(q) }
+func (q deviceQueue) Less(i, j int) bool {
+	a, b := q[i].device.Next(), q[j].device.Next()
+	if a.Equal(b) {
+		return q[i].index < q[j].index
+	}
+	return a.Before(b)
+}
+func (q deviceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *deviceQueue) Push(x interface{}) { *q = append(*q, x.(queued)) }
+func (q *deviceQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// pacer maps simulated time to wall-clock time at a fixed speed.
+type pacer struct {
+	simStart  time.Time
+	wallStart time.Time
+	speed     float64
+}
+
+func newPacer(simStart time.Time, speed float64) *pacer {
+	return &pacer{simStart: simStart, wallStart: time.Now(), speed: speed}
+}
+
+// wait sleeps until the wall-clock time of at. It returns false when ctx is
+// done.
+func (p *pacer) wait(ctx context.Context, at time.Time) bool {
+	if p.speed == 0 {
+		return ctx.Err() == nil
+	}
+	due := p.wallStart.Add(time.Duration(float64(at.Sub(p.simStart)) / p.speed))
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type sender interface {
+	send(index int, e Event)
+	close() (sent, failed int64)
+}
+
+type printer struct {
+	enc *json.Encoder
+	n   int64
+}
+
+func newPrinter() *printer {
+	return &printer{enc: json.NewEncoder(os.Stdout)}
+}
+
+func (p *printer) send(_ int, e Event) {
+	if err := p.enc.Encode(e); err != nil {
+		log.Fatalf("Failed to write event: %v", err)
+	}
+	p.n++
+}
+
+func (p *printer) close() (int64, int64) { return p.n, 0 }
+
+// poster sends events over HTTP. A device's events always go to the same
+// worker so they arrive in order.
+type poster struct {
+	ctx          context.Context
+	client       *client.Client
+	queues       []chan Event
+	wg           sync.WaitGroup
+	sent, failed int64
+}
+
+func newPoster(ctx context.Context, c *client.Client, workers int) *poster {
+	p := &poster{ctx: ctx, client: c, queues: make([]chan Event, workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan Event, 64)
+		p.wg.Add(1)
+		go p.run(p.queues[i])
+	}
+	return p
+}
+
+func (p *poster) run(queue chan Event) {
+	defer p.wg.Done()
+	for e := range queue {
+		if _, err := p.client.CreatePowerEvent(p.ctx, e.Request); err != nil {
+			atomic.AddInt64(&p.failed, 1)
+			log.Printf("Failed to post %s for %s: %v", e.Request.EventType, e.Request.DeviceID, err)
+			continue
+		}
+		atomic.AddInt64(&p.sent, 1)
+	}
+}
+
+func (p *poster) send(index int, e Event) {
+	p.queues[index%len(p.queues)] <- e
+}
+
+func (p *poster) close() (int64, int64) {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+	return p.sent, p.failed
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\nEmulates M5StickC Plus2 devices posting power events.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
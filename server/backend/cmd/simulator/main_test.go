@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func run(seed int64, n int, profile Profile, d time.Duration) []Event {
+	devices := make([]*Device, n)
+	for i := range devices {
+		devices[i] = NewDevice(seed, i, profile, testStart)
+	}
+	var events []Event
+	Simulate(devices, testStart.Add(d), func(_ int, e Event) bool {
+		events = append(events, e)
+		return true
+	})
+	return events
+}
+
+func TestSimulate_Deterministic(t *testing.T) {
+	a, err := json.Marshal(run(42, 5, DefaultProfile, 24*time.Hour))
+	assert.NoError(t, err)
+	b, err := json.Marshal(run(42, 5, DefaultProfile, 24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, string(a), string(b))
+
+	// シードが違えば結果も変わる
+	c, err := json.Marshal(run(43, 5, DefaultProfile, 24*time.Hour))
+	assert.NoError(t, err)
+	assert.NotEqual(t, string(a), string(c))
+
+	// デバイスを増やしても既存デバイスのイベントは変わらない
+	alone := run(42, 1, DefaultProfile, 24*time.Hour)
+	var first []Event
+	for _, e := range run(42, 5, DefaultProfile, 24*time.Hour) {
+		if e.Request.DeviceID == alone[0].Request.DeviceID {
+			first = append(first, e)
+		}
+	}
+	assert.Equal(t, alone, first)
+}
+
+func TestSimulate_PeriodicStatus(t *testing.T) {
+	profile := DefaultProfile
+	profile.OutagesPerDay = 0
+	profile.RebootsPerDay = 0
+	profile.MaxClockSkew = 0
+	events := run(1, 1, profile, time.Hour)
+
+	// 起動時に power_on、その後は約1分ごとに periodic_status
+	assert.Equal(t, "power_on", events[0].Request.EventType)
+	assert.Equal(t, int64(0), events[0].Request.UptimeMs)
+	statuses := 0
+	for i, e := range events[1:] {
+		if e.Request.EventType != "periodic_status" {
+			continue
+		}
+		statuses++
+		assert.True(t, e.At.After(events[i].At))
+		assert.GreaterOrEqual(t, e.Request.WiFiSignalStrength, minRSSI)
+		assert.LessOrEqual(t, e.Request.WiFiSignalStrength, maxRSSI)
+	}
+	assert.InDelta(t, 59, statuses, 1)
+
+	// 時刻のずれは起動からの経過でわずかに増える
+	last := events[len(events)-1]
+	assert.InDelta(t, 0, last.Request.Timestamp.Sub(last.At).Seconds(), 1)
+	assert.Equal(t, last.At.Sub(events[0].At).Milliseconds(), last.Request.UptimeMs)
+}
+
+func TestSimulate_OutageDrainsBattery(t *testing.T) {
+	profile := DefaultProfile
+	profile.OutagesPerDay = 24
+	profile.OutageDuration = 3 * time.Hour
+	profile.RebootsPerDay = 0
+	events := run(7, 1, profile, 48*time.Hour)
+
+	// 停電中は電池が減り、20% を下回ると battery_low、空になると止まって給電で再起動する
+	var sawOff, sawLow, sawDeadBoot bool
+	onBattery := false
+	prev := 0
+	for _, e := range events {
+		r := e.Request
+		switch {
+		case r.EventType == "power_off":
+			sawOff = true
+			onBattery = true
+		case r.EventType == "power_on":
+			if onBattery && r.UptimeMs == 0 && r.Message == "Device booted" {
+				sawDeadBoot = true
+			}
+			onBattery = false
+		case r.EventType == "battery_low":
+			sawLow = true
+			assert.True(t, onBattery)
+			assert.Less(t, r.BatteryPercentage, 20)
+		case onBattery && r.EventType == "periodic_status":
+			assert.LessOrEqual(t, r.BatteryPercentage, prev)
+		}
+		prev = r.BatteryPercentage
+	}
+	assert.True(t, sawOff)
+	assert.True(t, sawLow)
+	assert.True(t, sawDeadBoot)
+}
+
+func TestSimulate_RebootResetsUptime(t *testing.T) {
+	profile := DefaultProfile
+	profile.OutagesPerDay = 0
+	profile.RebootsPerDay = 24
+	events := run(3, 1, profile, 24*time.Hour)
+
+	boots := 0
+	var prev int64
+	for _, e := range events {
+		if e.Request.EventType == "power_on" {
+			boots++
+			assert.Less(t, e.Request.UptimeMs, prev+1)
+		} else {
+			assert.GreaterOrEqual(t, e.Request.UptimeMs, prev)
+		}
+		prev = e.Request.UptimeMs
+	}
+	assert.Greater(t, boots, 5)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// 同一サイトの電源断を1つのインシデントにまとめる時間窓
+	IncidentWindow time.Duration
+	// サイト停電と判定する最小デバイス数
+	IncidentMinDevices int
+	// この回数を超えて時間窓内に再起動したデバイスをクラッシュループとみなす
+	CrashLoopReboots int
+	CrashLoopWindow  time.Duration
+	// free_heap のリーク判定を実行する間隔
+	HeapAnalysisInterval time.Duration
+	// スキーマに合わないイベントの扱い（reject または warn）
+	EventValidationMode string
+	// MQTT ブローカー（空なら MQTT での受信は無効）
+	MQTTBrokerURL   string
+	MQTTClientID    string
+	MQTTUsername    string
+	MQTTPassword    string
+	MQTTTopicPrefix string
+	// 組み込み MQTT ブローカー（空なら起動しない）
+	MQTTBrokerListen string
+	// 組み込みブローカーに全トピック権限で接続するサービス用ログイン
+	MQTTServiceUsername string
+	MQTTServicePassword string
+	// Home Assistant の MQTT discovery
+	HADiscoveryEnabled bool
+	HADiscoveryPrefix  string
+	// InfluxDB 互換の書き込みエンドポイント（空ならエクスポートは無効）
+	InfluxWriteURL      string
+	InfluxToken         string
+	InfluxBatchSize     int
+	InfluxFlushInterval time.Duration
+	// 送信に失敗したバッチの退避先と容量上限
+	InfluxBufferDir      string
+	InfluxBufferMaxBytes int64
+	// Webhook 配信の最大試行回数（超えたら dead）とタイムアウト
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+	// メール通知（SMTP_HOST が空なら無効）
+	SMTPHost             string
+	SMTPPort             int
+	SMTPUsername         string
+	SMTPPassword         string
+	SMTPFrom             string
+	NotifyEmailTo        []string
+	NotifyEmailImmediate bool
+	// 日次ダイジェストを送る時刻（負の値で無効）
+	NotifyDigestHour    int
+	NotifyTimezone      string
+	NotifyTemplateDir   string
+	BatteryMailCooldown time.Duration
+	NotifyOfflineAfter  time.Duration
+}
+
+func Load() Config {
+	return Config{
+		IncidentWindow:       time.Duration(getInt("INCIDENT_WINDOW_SECONDS", 60)) * time.Second,
+		IncidentMinDevices:   getInt("INCIDENT_MIN_DEVICES", 2),
+		CrashLoopReboots:     getInt("CRASH_LOOP_REBOOTS", 3),
+		CrashLoopWindow:      time.Duration(getInt("CRASH_LOOP_WINDOW_MINUTES", 60)) * time.Minute,
+		HeapAnalysisInterval: time.Duration(getInt("HEAP_ANALYSIS_INTERVAL_MINUTES", 60)) * time.Minute,
+		EventValidationMode:  getString("EVENT_VALIDATION_MODE", "warn"),
+		MQTTBrokerURL:        os.Getenv("MQTT_BROKER_URL"),
+		MQTTClientID:         getString("MQTT_CLIENT_ID", "powerlogger-backend"),
+		MQTTUsername:         os.Getenv("MQTT_USERNAME"),
+		MQTTPassword:         os.Getenv("MQTT_PASSWORD"),
+		MQTTTopicPrefix:      getString("MQTT_TOPIC_PREFIX", "powerlogger"),
+		MQTTBrokerListen:     os.Getenv("MQTT_BROKER_LISTEN"),
+		MQTTServiceUsername:  os.Getenv("MQTT_SERVICE_USERNAME"),
+		MQTTServicePassword:  os.Getenv("MQTT_SERVICE_PASSWORD"),
+		HADiscoveryEnabled:   os.Getenv("HA_DISCOVERY_ENABLED") == "true",
+		HADiscoveryPrefix:    getString("HA_DISCOVERY_PREFIX", "homeassistant"),
+		InfluxWriteURL:       os.Getenv("INFLUX_WRITE_URL"),
+		InfluxToken:          os.Getenv("INFLUX_TOKEN"),
+		InfluxBatchSize:      getInt("INFLUX_BATCH_SIZE", 500),
+		InfluxFlushInterval:  time.Duration(getInt("INFLUX_FLUSH_INTERVAL_SECONDS", 10)) * time.Second,
+		InfluxBufferDir:      getString("INFLUX_BUFFER_DIR", "/var/lib/powerlogger/influx-buffer"),
+		InfluxBufferMaxBytes: int64(getInt("INFLUX_BUFFER_MAX_MB", 100)) << 20,
+		WebhookMaxAttempts:   getInt("WEBHOOK_MAX_ATTEMPTS", 10),
+		WebhookTimeout:       time.Duration(getInt("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+		SMTPHost:             os.Getenv("SMTP_HOST"),
+		SMTPPort:             getInt("SMTP_PORT", 587),
+		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:             getString("SMTP_FROM", "powerlogger@localhost"),
+		NotifyEmailTo:        getList("NOTIFY_EMAIL_TO"),
+		NotifyEmailImmediate: getString("NOTIFY_EMAIL_IMMEDIATE", "true") == "true",
+		NotifyDigestHour:     getInt("NOTIFY_DIGEST_HOUR", 8),
+		NotifyTimezone:       getString("NOTIFY_TIMEZONE", "Asia/Tokyo"),
+		NotifyTemplateDir:    os.Getenv("NOTIFY_TEMPLATE_DIR"),
+		BatteryMailCooldown:  time.Duration(getInt("NOTIFY_BATTERY_COOLDOWN_MINUTES", 60)) * time.Minute,
+		NotifyOfflineAfter:   time.Duration(getInt("NOTIFY_OFFLINE_MINUTES", 10)) * time.Minute,
+	}
+}
+
+// getList splits a comma-separated value, dropping empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func getString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Setenv("INCIDENT_WINDOW_SECONDS", "")
+	t.Setenv("INCIDENT_MIN_DEVICES", "")
+
+	cfg := Load()
+	assert.Equal(t, time.Minute, cfg.IncidentWindow)
+	assert.Equal(t, 2, cfg.IncidentMinDevices)
+	assert.Equal(t, 3, cfg.CrashLoopReboots)
+	assert.Equal(t, time.Hour, cfg.CrashLoopWindow)
+	assert.Equal(t, time.Hour, cfg.HeapAnalysisInterval)
+	assert.Equal(t, "warn", cfg.EventValidationMode)
+	assert.Equal(t, "", cfg.MQTTBrokerURL)
+	assert.Equal(t, "powerlogger", cfg.MQTTTopicPrefix)
+	assert.False(t, cfg.HADiscoveryEnabled)
+	assert.Equal(t, "homeassistant", cfg.HADiscoveryPrefix)
+	assert.Equal(t, "", cfg.InfluxWriteURL)
+	assert.Equal(t, 500, cfg.InfluxBatchSize)
+	assert.Equal(t, 10*time.Second, cfg.InfluxFlushInterval)
+	assert.Equal(t, int64(100<<20), cfg.InfluxBufferMaxBytes)
+	assert.Equal(t, 10, cfg.WebhookMaxAttempts)
+	assert.Equal(t, 10*time.Second, cfg.WebhookTimeout)
+	assert.Equal(t, "", cfg.SMTPHost)
+	assert.Equal(t, 587, cfg.SMTPPort)
+	assert.True(t, cfg.NotifyEmailImmediate)
+	assert.Equal(t, 8, cfg.NotifyDigestHour)
+	assert.Equal(t, "Asia/Tokyo", cfg.NotifyTimezone)
+}
+
+func TestLoad_FromEnv(t *testing.T) {
+	t.Setenv("INCIDENT_WINDOW_SECONDS", "120")
+	t.Setenv("INCIDENT_MIN_DEVICES", "3")
+
+	cfg := Load()
+	assert.Equal(t, 2*time.Minute, cfg.IncidentWindow)
+	assert.Equal(t, 3, cfg.IncidentMinDevices)
+}
+
+func TestLoad_EmailRecipients(t *testing.T) {
+	t.Setenv("NOTIFY_EMAIL_TO", "facilities@example.com, ,oncall@example.com")
+
+	cfg := Load()
+	assert.Equal(t, []string{"facilities@example.com", "oncall@example.com"}, cfg.NotifyEmailTo)
+}
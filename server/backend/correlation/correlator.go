@@ -0,0 +1,157 @@
+// Package correlation groups near-simultaneous power_off events from devices
+// at the same site (or group) into a single incident, so that a mains outage
+// is reported once instead of once per device.
+package correlation
+
+import (
+	"backend/models"
+	"database/sql"
+	"time"
+)
+
+type Correlator struct {
+	db         *sql.DB
+	window     time.Duration
+	minDevices int
+}
+
+func NewCorrelator(db *sql.DB, window time.Duration, minDevices int) *Correlator {
+	return &Correlator{db: db, window: window, minDevices: minDevices}
+}
+
+// scopeFor returns the correlation scope of a device: its site, else its
+// group, else the device itself (which can only ever be a device fault).
+func scopeFor(deviceID, site, group string) (scopeType, scopeKey string) {
+	switch {
+	case site != "":
+		return "site", site
+	case group != "":
+		return "group", group
+	default:
+		return "device", deviceID
+	}
+}
+
+func (c *Correlator) HandleEvent(deviceID, eventType string, at time.Time) error {
+	switch eventType {
+	case "power_off":
+		return c.handlePowerOff(deviceID, at)
+	case "power_on":
+		return c.handlePowerOn(deviceID, at)
+	}
+	return nil
+}
+
+func (c *Correlator) handlePowerOff(deviceID string, at time.Time) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var site, group string
+	err = tx.QueryRow("SELECT COALESCE(site, ''), COALESCE(device_group, '') FROM devices WHERE id = $1", deviceID).Scan(&site, &group)
+	if err != nil {
+		return err
+	}
+	scopeType, scopeKey := scopeFor(deviceID, site, group)
+
+	// 同じスコープへの同時書き込みでインシデントが分裂しないようにロック
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", scopeType+":"+scopeKey); err != nil {
+		return err
+	}
+
+	var incidentID int
+	err = tx.QueryRow(`
+		SELECT id FROM incidents
+		WHERE scope_type = $1 AND scope_key = $2 AND resolved_at IS NULL AND started_at >= $3
+		ORDER BY started_at DESC LIMIT 1`,
+		scopeType, scopeKey, at.Add(-c.window),
+	).Scan(&incidentID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`
+			WITH created AS (
+				INSERT INTO incidents (scope_type, scope_key, classification, device_count, started_at, last_event_at)
+				VALUES ($1, $2, $3, 0, $4, $4)
+				RETURNING id
+			)
+			INSERT INTO incident_history (incident_id, action, actor, created_at)
+			SELECT id, '`+models.IncidentActionOpened+`', 'system', $4 FROM created
+			RETURNING incident_id`,
+			scopeType, scopeKey, models.IncidentDeviceFault, at,
+		).Scan(&incidentID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 復旧済みのデバイスが再び落ちた場合は未復旧に戻し、全台復旧まで解決させない
+	_, err = tx.Exec(`
+		WITH added AS (
+			INSERT INTO incident_devices (incident_id, device_id, power_off_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (incident_id, device_id) DO UPDATE SET power_on_at = NULL
+				WHERE incident_devices.power_on_at IS NOT NULL
+			RETURNING incident_id, device_id
+		)
+		INSERT INTO incident_history (incident_id, action, actor, device_id, created_at)
+		SELECT incident_id, '`+models.IncidentActionDeviceDown+`', 'system', device_id, $3 FROM added`,
+		incidentID, deviceID, at,
+	)
+	if err != nil {
+		return err
+	}
+
+	// デバイス単位のスコープはサイト停電に昇格させない
+	minDevices := c.minDevices
+	if scopeType == "device" {
+		minDevices = 0
+	}
+	_, err = tx.Exec(`
+		UPDATE incidents SET
+			device_count = counts.n,
+			last_event_at = $2,
+			classification = CASE WHEN $3 > 0 AND counts.n >= $3 THEN $4 ELSE $5 END
+		FROM (SELECT COUNT(*) AS n FROM incident_devices WHERE incident_id = $1) counts
+		WHERE id = $1`,
+		incidentID, at, minDevices, models.IncidentSiteOutage, models.IncidentDeviceFault,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *Correlator) handlePowerOn(deviceID string, at time.Time) error {
+	result, err := c.db.Exec(`
+		WITH restored AS (
+			UPDATE incident_devices SET power_on_at = $1 WHERE device_id = $2 AND power_on_at IS NULL
+			RETURNING incident_id
+		)
+		INSERT INTO incident_history (incident_id, action, actor, device_id, created_at)
+		SELECT incident_id, '`+models.IncidentActionDeviceRestored+`', 'system', $2, $1 FROM restored`,
+		at, deviceID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	// 全デバイスが復旧したインシデントを解決済みにする（確認済みのものも含む）
+	_, err = c.db.Exec(`
+		WITH resolved AS (
+			UPDATE incidents SET resolved_at = $1, status = '`+models.IncidentResolved+`'
+			WHERE resolved_at IS NULL
+				AND id IN (SELECT incident_id FROM incident_devices WHERE device_id = $2)
+				AND NOT EXISTS (SELECT 1 FROM incident_devices WHERE incident_id = incidents.id AND power_on_at IS NULL)
+			RETURNING id
+		)
+		INSERT INTO incident_history (incident_id, action, actor, comment, created_at)
+		SELECT id, '`+models.IncidentActionResolved+`', 'system', 'All devices restored', $1 FROM resolved`,
+		at, deviceID,
+	)
+	return err
+}
@@ -0,0 +1,216 @@
+package correlation
+
+import (
+	"backend/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeFor(t *testing.T) {
+	scopeType, scopeKey := scopeFor("device-001", "tokyo-office", "rack-a")
+	assert.Equal(t, "site", scopeType)
+	assert.Equal(t, "tokyo-office", scopeKey)
+
+	scopeType, scopeKey = scopeFor("device-001", "", "rack-a")
+	assert.Equal(t, "group", scopeType)
+	assert.Equal(t, "rack-a", scopeKey)
+
+	scopeType, scopeKey = scopeFor("device-001", "", "")
+	assert.Equal(t, "device", scopeType)
+	assert.Equal(t, "device-001", scopeKey)
+}
+
+func TestHandleEvent_PowerOffCreatesIncident(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"site", "device_group"}).AddRow("tokyo-office", ""))
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs("site:tokyo-office").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// 時間窓内に未解決のインシデントがない
+	mock.ExpectQuery("SELECT id FROM incidents").
+		WithArgs("site", "tokyo-office", now.Add(-time.Minute)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("INSERT INTO incidents").
+		WithArgs("site", "tokyo-office", models.IncidentDeviceFault, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectExec("INSERT INTO incident_devices").
+		WithArgs(10, "device-001", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE incidents SET").
+		WithArgs(10, now, 2, models.IncidentSiteOutage, models.IncidentDeviceFault).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	correlator := NewCorrelator(db, time.Minute, 2)
+	assert.NoError(t, correlator.HandleEvent("device-001", "power_off", now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleEvent_PowerOffJoinsOpenIncident(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
+		WithArgs("device-002").
+		WillReturnRows(sqlmock.NewRows([]string{"site", "device_group"}).AddRow("tokyo-office", ""))
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs("site:tokyo-office").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// 既存のインシデントに追加される
+	mock.ExpectQuery("SELECT id FROM incidents").
+		WithArgs("site", "tokyo-office", now.Add(-time.Minute)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectExec("INSERT INTO incident_devices").
+		WithArgs(10, "device-002", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE incidents SET").
+		WithArgs(10, now, 2, models.IncidentSiteOutage, models.IncidentDeviceFault).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	correlator := NewCorrelator(db, time.Minute, 2)
+	assert.NoError(t, correlator.HandleEvent("device-002", "power_off", now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleEvent_DeviceFlapsWithinIncident(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	correlator := NewCorrelator(db, time.Minute, 2)
+
+	// 一度復旧したが、他のデバイスがまだ停電中なので解決しない
+	mock.ExpectExec("UPDATE incident_devices SET power_on_at = \\$1").
+		WithArgs(now, "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE incidents SET resolved_at = \\$1").
+		WithArgs(now, "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, correlator.HandleEvent("device-001", "power_on", now))
+
+	// 再び落ちたら未復旧に戻す
+	again := now.Add(10 * time.Second)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"site", "device_group"}).AddRow("tokyo-office", ""))
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs("site:tokyo-office").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id FROM incidents").
+		WithArgs("site", "tokyo-office", again.Add(-time.Minute)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectExec("INSERT INTO incident_devices (.+) ON CONFLICT \\(incident_id, device_id\\) DO UPDATE SET power_on_at = NULL WHERE incident_devices.power_on_at IS NOT NULL").
+		WithArgs(10, "device-001", again).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE incidents SET").
+		WithArgs(10, again, 2, models.IncidentSiteOutage, models.IncidentDeviceFault).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, correlator.HandleEvent("device-001", "power_off", again))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleEvent_PowerOffWithoutSiteIsDeviceFault(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"site", "device_group"}).AddRow("", ""))
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs("device:device-001").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id FROM incidents").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("INSERT INTO incidents").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectExec("INSERT INTO incident_devices").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// デバイス単位ではサイト停電に昇格しない
+	mock.ExpectExec("UPDATE incidents SET").
+		WithArgs(11, now, 0, models.IncidentSiteOutage, models.IncidentDeviceFault).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	correlator := NewCorrelator(db, time.Minute, 2)
+	assert.NoError(t, correlator.HandleEvent("device-001", "power_off", now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleEvent_PowerOnResolvesIncident(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectExec("UPDATE incident_devices SET power_on_at = \\$1").
+		WithArgs(now, "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 解決と同時に履歴へ記録する
+	mock.ExpectExec("UPDATE incidents SET resolved_at = \\$1, status = 'resolved'(.+)INSERT INTO incident_history").
+		WithArgs(now, "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	correlator := NewCorrelator(db, time.Minute, 2)
+	assert.NoError(t, correlator.HandleEvent("device-001", "power_on", now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleEvent_PowerOnWithoutIncident(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 該当する停電がなければ解決処理は行わない
+	mock.ExpectExec("UPDATE incident_devices SET power_on_at = \\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	correlator := NewCorrelator(db, time.Minute, 2)
+	assert.NoError(t, correlator.HandleEvent("device-001", "power_on", time.Now()))
+	assert.NoError(t, correlator.HandleEvent("device-001", "periodic_status", time.Now()))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,84 @@
+// Package credentials manages the per-device keys devices use to
+// authenticate to the embedded MQTT broker. Only a SHA-256 hash of each key
+// is stored; the key itself is shown once when it is issued.
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Hash returns the stored form of a device key.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new random key. Keys are 256-bit random values, so a
+// plain hash is enough to store them.
+func Generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Rotate issues a new key for the device, replacing any previous one.
+func (s *Store) Rotate(deviceID string) (string, error) {
+	key, err := Generate()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = s.db.Exec(`
+		INSERT INTO device_credentials (device_id, key_hash, created_at, rotated_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (device_id) DO UPDATE SET key_hash = $2, rotated_at = $3`,
+		deviceID, Hash(key), now,
+	)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Revoke removes the device's key. It reports whether a key existed.
+func (s *Store) Revoke(deviceID string) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM device_credentials WHERE device_id = $1", deviceID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Verify reports whether key is the device's current key. The old id of a
+// merged device is checked against the key of the device it was merged into.
+func (s *Store) Verify(deviceID, key string) (bool, error) {
+	var stored string
+	err := s.db.QueryRow(`
+		SELECT key_hash FROM device_credentials
+		WHERE device_id = COALESCE((SELECT device_id FROM device_aliases WHERE alias_id = $1), $1)`,
+		deviceID,
+	).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(Hash(key))) == 1, nil
+}
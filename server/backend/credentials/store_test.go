@@ -0,0 +1,59 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateAndVerify(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO device_credentials").
+		WithArgs("device-001", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	store := NewStore(db)
+	key, err := store.Rotate("device-001")
+	assert.NoError(t, err)
+	assert.Len(t, key, 64)
+
+	mock.ExpectQuery("SELECT key_hash FROM device_credentials WHERE device_id = COALESCE\\(\\(SELECT device_id FROM device_aliases WHERE alias_id = \\$1\\), \\$1\\)").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}).AddRow(Hash(key)))
+	ok, err := store.Verify("device-001", key)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	mock.ExpectQuery("SELECT key_hash FROM device_credentials WHERE device_id = COALESCE\\(\\(SELECT device_id FROM device_aliases WHERE alias_id = \\$1\\), \\$1\\)").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}).AddRow(Hash(key)))
+	ok, err = store.Verify("device-001", "wrong-key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerify_NoCredentials(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT key_hash FROM device_credentials WHERE device_id = COALESCE\\(\\(SELECT device_id FROM device_aliases WHERE alias_id = \\$1\\), \\$1\\)").
+		WithArgs("device-009").
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}))
+
+	ok, err := NewStore(db).Verify("device-009", "anything")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrUserExists is returned when creating a user whose name is taken.
+var ErrUserExists = errors.New("user already exists")
+
+// CreateUser adds a broker login with access to all topics and returns its
+// generated password.
+func (s *Store) CreateUser(username string) (string, error) {
+	password, err := Generate()
+	if err != nil {
+		return "", err
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO mqtt_users (username, password_hash, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO NOTHING`,
+		username, Hash(password), time.Now(),
+	)
+	if err != nil {
+		return "", err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrUserExists
+	}
+	return password, nil
+}
+
+// DeleteUser removes a broker login. It reports whether the user existed.
+func (s *Store) DeleteUser(username string) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM mqtt_users WHERE username = $1", username)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// VerifyUser reports whether username is a broker login and, if so, whether
+// password is its password.
+func (s *Store) VerifyUser(username, password string) (found, ok bool, err error) {
+	var stored string
+	err = s.db.QueryRow("SELECT password_hash FROM mqtt_users WHERE username = $1", username).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, subtle.ConstantTimeCompare([]byte(stored), []byte(Hash(password))) == 1, nil
+}
@@ -0,0 +1,69 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndVerifyUser(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO mqtt_users").
+		WithArgs("homeassistant", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	store := NewStore(db)
+	password, err := store.CreateUser("homeassistant")
+	assert.NoError(t, err)
+	assert.Len(t, password, 64)
+
+	mock.ExpectQuery("SELECT password_hash FROM mqtt_users WHERE username = \\$1").
+		WithArgs("homeassistant").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(Hash(password)))
+	found, ok, err := store.VerifyUser("homeassistant", password)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, ok)
+
+	mock.ExpectQuery("SELECT password_hash FROM mqtt_users WHERE username = \\$1").
+		WithArgs("homeassistant").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(Hash(password)))
+	found, ok, err = store.VerifyUser("homeassistant", "wrong")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.False(t, ok)
+
+	// ユーザーでなければデバイスとして認証する
+	mock.ExpectQuery("SELECT password_hash FROM mqtt_users WHERE username = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}))
+	found, _, err = store.VerifyUser("device-001", "anything")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateUser_Exists(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 既存のユーザーのパスワードは上書きしない
+	mock.ExpectExec("INSERT INTO mqtt_users").
+		WithArgs("homeassistant", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = NewStore(db).CreateUser("homeassistant")
+	assert.Equal(t, ErrUserExists, err)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
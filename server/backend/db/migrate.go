@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock is the advisory lock key that serializes migrations when
+// several instances start at once.
+const migrationLock = 4761
+
+// Migrate brings an existing database up to the schema in db/init.sql by
+// applying the files in migrations/ that have not run yet, in name order and
+// each in its own transaction. It returns the versions it applied.
+//
+// init.sql already contains every migration and is only run for a fresh
+// database, so migrations must also be safe to apply on top of it.
+func Migrate(db *sql.DB) ([]string, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version VARCHAR(255) PRIMARY KEY,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return nil, err
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var applied []string
+	for _, name := range names {
+		version := strings.TrimSuffix(path.Base(name), ".sql")
+		ok, err := applyMigration(db, version, name)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, version)
+		}
+	}
+	return applied, nil
+}
+
+func applyMigration(db *sql.DB, version, name string) (bool, error) {
+	body, err := migrations.ReadFile(name)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return false, err
+	}
+	var done bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&done); err != nil {
+		return false, err
+	}
+	if done {
+		return false, nil
+	}
+	if _, err := tx.Exec(string(body)); err != nil {
+		return false, fmt.Errorf("migration %s: %w", version, err)
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
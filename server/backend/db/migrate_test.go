@@ -0,0 +1,284 @@
+package db
+
+import (
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM schema_migrations WHERE version = \\$1\\)").
+		WithArgs("000_schema_upgrade").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("ALTER TABLE devices").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs("000_schema_upgrade").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM schema_migrations WHERE version = \\$1\\)").
+		WithArgs("001_event_data_columns").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("ALTER TABLE power_events").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs("001_event_data_columns").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM schema_migrations WHERE version = \\$1\\)").
+		WithArgs("002_device_aliases").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS device_aliases").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs("002_device_aliases").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM schema_migrations WHERE version = \\$1\\)").
+		WithArgs("003_mqtt_users").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS mqtt_users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs("003_mqtt_users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM schema_migrations WHERE version = \\$1\\)").
+		WithArgs("004_webhook_skip_muted").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("ALTER TABLE webhooks").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs("004_webhook_skip_muted").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM schema_migrations WHERE version = \\$1\\)").
+		WithArgs("005_event_data_index_ops").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("DROP INDEX IF EXISTS idx_power_events_data").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs("005_event_data_index_ops").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// 実行
+	applied, err := Migrate(db)
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"000_schema_upgrade", "001_event_data_columns", "002_device_aliases", "003_mqtt_users", "004_webhook_skip_muted", "005_event_data_index_ops"}, applied)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrate_AlreadyApplied(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 適用済みのマイグレーションは実行しない
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, version := range []string{"000_schema_upgrade", "001_event_data_columns", "002_device_aliases", "003_mqtt_users", "004_webhook_skip_muted", "005_event_data_index_ops"} {
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(version).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+	}
+
+	// 実行
+	applied, err := Migrate(db)
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// schema is the tables (with the definition of each column) and indexes
+// that a series of SQL scripts creates.
+type schema struct {
+	tables  map[string]map[string]string
+	indexes map[string]string
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) \((.*)\)$`)
+	alterTablePattern  = regexp.MustCompile(`^ALTER TABLE (\w+) (.*)$`)
+	addColumnPattern   = regexp.MustCompile(`^ADD COLUMN IF NOT EXISTS (\w+) (.*)$`)
+	createIndexPattern = regexp.MustCompile(`^CREATE INDEX IF NOT EXISTS (\w+) (ON .*)$`)
+	dropIndexPattern   = regexp.MustCompile(`^DROP INDEX IF EXISTS (\w+)$`)
+)
+
+// apply records the schema changes of script. Every CREATE and ADD COLUMN
+// must be conditional, as migrations also run on top of init.sql.
+func (s *schema) apply(t *testing.T, name, script string) {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if i := strings.Index(line, "--"); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+	for _, stmt := range strings.Split(strings.Join(lines, " "), ";") {
+		stmt = strings.Join(strings.Fields(stmt), " ")
+		switch {
+		case createTablePattern.MatchString(stmt):
+			m := createTablePattern.FindStringSubmatch(stmt)
+			if _, ok := s.tables[m[1]]; ok {
+				continue
+			}
+			columns := map[string]string{}
+			for _, def := range splitTopLevel(m[2]) {
+				name, rest, _ := strings.Cut(def, " ")
+				switch name {
+				case "PRIMARY", "FOREIGN", "UNIQUE", "CHECK", "CONSTRAINT":
+					continue
+				}
+				columns[name] = rest
+			}
+			s.tables[m[1]] = columns
+		case alterTablePattern.MatchString(stmt):
+			m := alterTablePattern.FindStringSubmatch(stmt)
+			columns, ok := s.tables[m[1]]
+			if !ok {
+				t.Errorf("%s: ALTER TABLE of missing table %s", name, m[1])
+				continue
+			}
+			for _, action := range splitTopLevel(m[2]) {
+				add := addColumnPattern.FindStringSubmatch(action)
+				if add == nil {
+					t.Errorf("%s: unexpected ALTER TABLE %s %s", name, m[1], action)
+					continue
+				}
+				if _, ok := columns[add[1]]; !ok {
+					columns[add[1]] = add[2]
+				}
+			}
+		case createIndexPattern.MatchString(stmt):
+			m := createIndexPattern.FindStringSubmatch(stmt)
+			if _, ok := s.indexes[m[1]]; !ok {
+				s.indexes[m[1]] = m[2]
+			}
+		case dropIndexPattern.MatchString(stmt):
+			delete(s.indexes, dropIndexPattern.FindStringSubmatch(stmt)[1])
+		case strings.HasPrefix(stmt, "CREATE"), strings.HasPrefix(stmt, "ALTER"), strings.HasPrefix(stmt, "DROP"):
+			t.Errorf("%s: unsupported statement %q", name, stmt)
+		}
+	}
+}
+
+// splitTopLevel splits s at the commas that are not inside parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+func loadSchema(t *testing.T, files ...string) *schema {
+	s := &schema{tables: map[string]map[string]string{}, indexes: map[string]string{}}
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		s.apply(t, file, string(body))
+	}
+	return s
+}
+
+func (s *schema) migrate(t *testing.T) {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	assert.NoError(t, err)
+	sort.Strings(names)
+	for _, name := range names {
+		body, err := migrations.ReadFile(name)
+		assert.NoError(t, err)
+		s.apply(t, name, string(body))
+	}
+}
+
+func TestMigrations_MatchInitSQL(t *testing.T) {
+	want := loadSchema(t, "../../db/init.sql")
+
+	// 最初のリリースのDBをマイグレーションすると init.sql と同じスキーマになる
+	upgraded := loadSchema(t, "testdata/baseline.sql")
+	upgraded.migrate(t)
+	assert.Equal(t, want.tables, upgraded.tables)
+	assert.Equal(t, want.indexes, upgraded.indexes)
+
+	// init.sql で作ったDBにマイグレーションを適用しても変わらない
+	fresh := loadSchema(t, "../../db/init.sql")
+	fresh.migrate(t)
+	assert.Equal(t, want.tables, fresh.tables)
+	assert.Equal(t, want.indexes, fresh.indexes)
+}
+
+func TestSchemaColumns_MatchInitSQL(t *testing.T) {
+	want := loadSchema(t, "../../db/init.sql")
+
+	// CheckSchema が確認する列は init.sql と同じ
+	got := map[string]map[string]string{}
+	for table, columns := range schemaColumns {
+		got[table] = map[string]string{}
+		for _, column := range columns {
+			got[table][column] = want.tables[table][column]
+		}
+	}
+	assert.Equal(t, want.tables, got)
+}
+
+func TestCheckSchema(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"table_name", "column_name"})
+	for table, columns := range schemaColumns {
+		for _, column := range columns {
+			if table == "devices" && column == "site" || table == "alerts" {
+				continue
+			}
+			rows.AddRow(table, column)
+		}
+	}
+	mock.ExpectQuery("SELECT table_name, column_name FROM information_schema.columns").WillReturnRows(rows)
+
+	// 実行
+	err = CheckSchema(db)
+
+	// アサーション
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "devices.site")
+	assert.Contains(t, err.Error(), "alerts.alert_type")
+	assert.NotContains(t, err.Error(), "devices.name")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
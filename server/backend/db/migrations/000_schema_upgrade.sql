@@ -0,0 +1,199 @@
+-- Columns, tables and indexes added to db/init.sql before migrations were
+-- introduced. Databases created from the first release have only items,
+-- devices and power_events; this brings them up to the schema the later
+-- migrations build on. Everything is conditional so that it is a no-op on a
+-- database created from the current init.sql.
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS model VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS firmware_version VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS site VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS device_group VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS crash_loop_since TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS offline_since TIMESTAMP;
+
+ALTER TABLE power_events
+    ADD COLUMN IF NOT EXISTS expected BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS device_firmware_history (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL,
+    firmware_version VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS firmware_releases (
+    id SERIAL PRIMARY KEY,
+    version VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    binary_data BYTEA NOT NULL,
+    rollout_percentage INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percentage BETWEEN 0 AND 100),
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (model, version)
+);
+
+CREATE TABLE IF NOT EXISTS incidents (
+    id SERIAL PRIMARY KEY,
+    scope_type VARCHAR(20) NOT NULL,
+    scope_key VARCHAR(255) NOT NULL,
+    classification VARCHAR(50) NOT NULL,
+    device_count INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    last_event_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    assignee VARCHAR(255),
+    root_cause VARCHAR(50) CHECK (root_cause IN ('utility_outage', 'breaker_trip', 'unplugged', 'device_fault')),
+    acknowledged_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS incident_devices (
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    power_off_at TIMESTAMP NOT NULL,
+    power_on_at TIMESTAMP,
+    PRIMARY KEY (incident_id, device_id)
+);
+
+CREATE TABLE IF NOT EXISTS incident_history (
+    id SERIAL PRIMARY KEY,
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    action VARCHAR(30) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    device_id VARCHAR(255),
+    value VARCHAR(255),
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    alert_type VARCHAR(50) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_heap_analysis (
+    device_id VARCHAR(255) PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    analyzed_at TIMESTAMP NOT NULL,
+    session_started_at TIMESTAMP NOT NULL,
+    samples INTEGER NOT NULL,
+    current_free_heap BIGINT NOT NULL,
+    slope_bytes_per_hour DOUBLE PRECISION,
+    r_squared DOUBLE PRECISION,
+    leak_suspected BOOLEAN NOT NULL DEFAULT FALSE,
+    projected_exhaustion_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_credentials (
+    device_id VARCHAR(255) PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    key_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rotated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS event_types (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    schema JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    secret VARCHAR(255) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    device_ids TEXT[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempted_at TIMESTAMP NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    duration_ms INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    scope_type VARCHAR(20) NOT NULL CHECK (scope_type IN ('device', 'group', 'site')),
+    scope_key VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    recurrence VARCHAR(20) NOT NULL DEFAULT 'none' CHECK (recurrence IN ('none', 'daily', 'weekly')),
+    recurrence_until TIMESTAMP,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE TABLE IF NOT EXISTS silences (
+    id SERIAL PRIMARY KEY,
+    scope_type VARCHAR(20) NOT NULL CHECK (scope_type IN ('device', 'group', 'site')),
+    scope_key VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    starts_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_annotations (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    author VARCHAR(255) NOT NULL,
+    text TEXT NOT NULL,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at IS NULL OR ends_at >= starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_power_events_device_timestamp ON power_events(device_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_power_events_data ON power_events USING GIN (data jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_devices_site ON devices(site);
+CREATE INDEX IF NOT EXISTS idx_alerts_device_open ON alerts(device_id, alert_type) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_incidents_scope ON incidents(scope_type, scope_key, started_at);
+CREATE INDEX IF NOT EXISTS idx_incidents_status ON incidents(status, started_at);
+CREATE INDEX IF NOT EXISTS idx_incident_history_incident_id ON incident_history(incident_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_incident_devices_device_id ON incident_devices(device_id) WHERE power_on_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_device_firmware_history_device_id ON device_firmware_history(device_id, seen_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id);
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_scope ON maintenance_windows(scope_type, scope_key);
+CREATE INDEX IF NOT EXISTS idx_silences_scope ON silences(scope_type, scope_key, expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_annotations_device_id ON device_annotations(device_id, starts_at);
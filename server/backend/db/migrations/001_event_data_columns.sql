@@ -0,0 +1,39 @@
+-- Typed columns for the payload fields the firmware sends, which used to be
+-- stored only inside the data JSONB. Keys that move to a column are removed
+-- from data; values of an unexpected type are left where they are.
+ALTER TABLE power_events
+    ADD COLUMN IF NOT EXISTS client_timestamp TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS uptime_ms BIGINT,
+    ADD COLUMN IF NOT EXISTS message TEXT,
+    ADD COLUMN IF NOT EXISTS battery_percentage INTEGER,
+    ADD COLUMN IF NOT EXISTS battery_voltage DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS wifi_signal_strength INTEGER,
+    ADD COLUMN IF NOT EXISTS free_heap BIGINT;
+
+UPDATE power_events SET
+    -- the zero time was written when the device sent no timestamp
+    client_timestamp = CASE
+        WHEN data->>'client_timestamp' ~ '^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}' AND data->>'client_timestamp' NOT LIKE '0001-%'
+        THEN (data->>'client_timestamp')::timestamptz AT TIME ZONE 'UTC' END,
+    uptime_ms = CASE WHEN jsonb_typeof(data->'uptime_ms') = 'number' THEN round((data->>'uptime_ms')::numeric)::bigint END,
+    message = CASE WHEN jsonb_typeof(data->'message') = 'string' THEN data->>'message' END,
+    battery_percentage = CASE WHEN jsonb_typeof(data->'battery_percentage') = 'number' THEN round((data->>'battery_percentage')::numeric)::integer END,
+    battery_voltage = CASE WHEN jsonb_typeof(data->'battery_voltage') = 'number' THEN (data->>'battery_voltage')::double precision END,
+    wifi_signal_strength = CASE WHEN jsonb_typeof(data->'wifi_signal_strength') = 'number' THEN round((data->>'wifi_signal_strength')::numeric)::integer END,
+    free_heap = CASE WHEN jsonb_typeof(data->'free_heap') = 'number' THEN round((data->>'free_heap')::numeric)::bigint END,
+    data = NULLIF(data - array_remove(ARRAY[
+        CASE WHEN data->>'client_timestamp' ~ '^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}' THEN 'client_timestamp' END,
+        CASE WHEN jsonb_typeof(data->'uptime_ms') = 'number' THEN 'uptime_ms' END,
+        CASE WHEN jsonb_typeof(data->'message') = 'string' THEN 'message' END,
+        CASE WHEN jsonb_typeof(data->'battery_percentage') = 'number' THEN 'battery_percentage' END,
+        CASE WHEN jsonb_typeof(data->'battery_voltage') = 'number' THEN 'battery_voltage' END,
+        CASE WHEN jsonb_typeof(data->'wifi_signal_strength') = 'number' THEN 'wifi_signal_strength' END,
+        CASE WHEN jsonb_typeof(data->'free_heap') = 'number' THEN 'free_heap' END
+    ], NULL), '{}'::jsonb)
+WHERE data ?| ARRAY['client_timestamp', 'uptime_ms', 'message', 'battery_percentage', 'battery_voltage', 'wifi_signal_strength', 'free_heap'];
+
+-- The message search index moves from data->>'message' to the column
+DROP INDEX IF EXISTS idx_power_events_message_fts;
+CREATE INDEX IF NOT EXISTS idx_power_events_message_tsv ON power_events USING GIN (to_tsvector('simple', COALESCE(message, '')));
+CREATE INDEX IF NOT EXISTS idx_power_events_battery_percentage ON power_events(battery_percentage);
+CREATE INDEX IF NOT EXISTS idx_power_events_wifi_signal_strength ON power_events(wifi_signal_strength);
@@ -0,0 +1,22 @@
+-- Old device ids kept when a device is merged into another, so that events
+-- still sent under the old id are stored under the merged device.
+CREATE TABLE IF NOT EXISTS device_aliases (
+    alias_id VARCHAR(255) PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_aliases_device_id ON device_aliases(device_id);
+
+-- Audit trail of device administration (merges). Not tied to the devices
+-- table so that entries outlive deleted devices.
+CREATE TABLE IF NOT EXISTS device_audit_log (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    details JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_audit_log_device_id ON device_audit_log(device_id, created_at);
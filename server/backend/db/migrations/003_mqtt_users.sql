@@ -0,0 +1,7 @@
+-- Logins for the embedded MQTT broker with access to all topics, for
+-- integrations such as Home Assistant (SHA-256 of the generated password).
+CREATE TABLE IF NOT EXISTS mqtt_users (
+    username VARCHAR(255) PRIMARY KEY,
+    password_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- Events during maintenance or a silence are delivered to webhooks, marked
+-- as expected/silenced in the payload, unless the webhook opts out.
+ALTER TABLE webhooks
+    ADD COLUMN IF NOT EXISTS skip_muted BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+-- The data index was built with jsonb_path_ops, which only supports @>.
+-- The default jsonb_ops also covers the key-exists operator (?) that search
+-- uses for != predicates on data fields.
+DROP INDEX IF EXISTS idx_power_events_data;
+CREATE INDEX IF NOT EXISTS idx_power_events_data ON power_events USING GIN (data);
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// schemaColumns lists the columns of every table in db/init.sql, which
+// Migrate must have produced (kept in sync with init.sql by the tests).
+var schemaColumns = map[string][]string{
+	"items":                     {"id", "name", "description", "created_at"},
+	"devices":                   {"id", "name", "description", "model", "firmware_version", "site", "device_group", "crash_loop_since", "offline_since", "last_seen", "created_at", "updated_at"},
+	"power_events":              {"id", "device_id", "event_type", "timestamp", "client_timestamp", "uptime_ms", "message", "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap", "data", "expected", "created_at"},
+	"device_firmware_history":   {"id", "device_id", "firmware_version", "model", "seen_at"},
+	"firmware_releases":         {"id", "version", "model", "checksum", "size", "binary_data", "rollout_percentage", "notes", "created_at"},
+	"incidents":                 {"id", "scope_type", "scope_key", "classification", "device_count", "started_at", "last_event_at", "resolved_at", "status", "assignee", "root_cause", "acknowledged_at", "created_at"},
+	"incident_devices":          {"incident_id", "device_id", "power_off_at", "power_on_at"},
+	"incident_history":          {"id", "incident_id", "action", "actor", "device_id", "value", "comment", "created_at"},
+	"alerts":                    {"id", "device_id", "alert_type", "severity", "message", "created_at", "resolved_at"},
+	"device_heap_analysis":      {"device_id", "analyzed_at", "session_started_at", "samples", "current_free_heap", "slope_bytes_per_hour", "r_squared", "leak_suspected", "projected_exhaustion_at"},
+	"device_credentials":        {"device_id", "key_hash", "created_at", "rotated_at"},
+	"mqtt_users":                {"username", "password_hash", "created_at"},
+	"event_types":               {"name", "description", "schema", "created_at", "updated_at"},
+	"webhooks":                  {"id", "url", "description", "secret", "event_types", "device_ids", "enabled", "skip_muted", "created_at", "updated_at"},
+	"webhook_deliveries":        {"id", "webhook_id", "event_type", "device_id", "payload", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"},
+	"webhook_delivery_attempts": {"id", "delivery_id", "attempted_at", "status_code", "error", "duration_ms"},
+	"maintenance_windows":       {"id", "name", "scope_type", "scope_key", "starts_at", "ends_at", "recurrence", "recurrence_until", "reason", "created_at"},
+	"silences":                  {"id", "scope_type", "scope_key", "reason", "created_by", "starts_at", "expires_at", "created_at"},
+	"device_annotations":        {"id", "device_id", "starts_at", "ends_at", "author", "text", "tags", "created_at", "updated_at"},
+	"device_aliases":            {"alias_id", "device_id", "created_at"},
+	"device_audit_log":          {"id", "device_id", "action", "actor", "details", "created_at"},
+}
+
+// CheckSchema returns an error naming the tables and columns of db/init.sql
+// that the database lacks, e.g. because a migration is missing.
+func CheckSchema(db *sql.DB) error {
+	rows, err := db.Query("SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = current_schema()")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	present := map[string]bool{}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return err
+		}
+		present[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for table, columns := range schemaColumns {
+		for _, column := range columns {
+			if !present[table+"."+column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("schema is missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package eventtypes
+
+import (
+	"backend/models"
+	"encoding/json"
+)
+
+// payloadProperties are the fields the firmware sends with every event
+// (PowerLogger::logPowerEvent).
+const payloadProperties = `{
+	"device_id": {"type": "string", "minLength": 1, "maxLength": 255},
+	"event_type": {"type": "string", "maxLength": 50},
+	"timestamp": {"type": "string", "format": "date-time"},
+	"uptime_ms": {"type": "integer", "minimum": 0},
+	"message": {"type": "string", "maxLength": 1000},
+	"battery_percentage": {"type": "integer", "minimum": 0, "maximum": 100},
+	"battery_voltage": {"type": "number", "minimum": 0, "maximum": 5},
+	"wifi_signal_strength": {"type": "integer", "minimum": -127, "maximum": 0},
+	"free_heap": {"type": "integer", "minimum": 0},
+	"firmware_version": {"type": "string", "maxLength": 50},
+	"model": {"type": "string", "maxLength": 100}
+}`
+
+func payloadSchema(required ...string) json.RawMessage {
+	if required == nil {
+		required = []string{}
+	}
+	req, _ := json.Marshal(required)
+	return json.RawMessage(`{"type": "object", "properties": ` + payloadProperties + `, "required": ` + string(req) + `}`)
+}
+
+// builtinTypes mirror the firmware's PowerEventType enum and the "unknown"
+// type createEventJson falls back to, plus the reboot events recorded by the
+// server's reboot detector.
+var builtinTypes = []models.EventType{
+	{Name: "power_on", Description: "Mains power restored or device booted", Schema: payloadSchema()},
+	{Name: "power_off", Description: "Mains power lost, device running on battery", Schema: payloadSchema()},
+	{Name: "battery_low", Description: "Battery below the firmware threshold", Schema: payloadSchema("battery_percentage")},
+	{Name: "system_error", Description: "Firmware reported an error", Schema: payloadSchema("message")},
+	{Name: "wifi_reconnected", Description: "Device reconnected to WiFi", Schema: payloadSchema()},
+	{Name: "periodic_status", Description: "Periodic heartbeat with device metrics",
+		Schema: payloadSchema("uptime_ms", "battery_percentage", "wifi_signal_strength", "free_heap")},
+	{Name: "unknown", Description: "Event the firmware could not name", Schema: payloadSchema()},
+	{Name: "reboot", Description: "Reboot detected from an uptime_ms reset", Schema: payloadSchema(), ServerOnly: true},
+}
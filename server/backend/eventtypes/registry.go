@@ -0,0 +1,232 @@
+// Package eventtypes holds the registry of known event types and validates
+// ingested payloads against each type's JSON Schema.
+package eventtypes
+
+import (
+	"backend/models"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+type Mode string
+
+const (
+	// ModeReject refuses events that fail validation.
+	ModeReject Mode = "reject"
+	// ModeWarn stores them anyway and reports the problems back.
+	ModeWarn Mode = "warn"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeReject, ModeWarn:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("invalid event validation mode: %q (want reject or warn)", s)
+}
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// ValidName reports whether name is usable as an event type: lower-case
+// snake_case, at most 50 characters.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+const (
+	ReasonUnknownType    = "unknown_event_type"
+	ReasonServerOnly     = "server_only_event_type"
+	ReasonSchemaMismatch = "schema_mismatch"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	EventType string       `json:"event_type"`
+	Reason    string       `json:"reason"`
+	Details   []FieldError `json:"details,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	switch e.Reason {
+	case ReasonUnknownType:
+		return fmt.Sprintf("Unknown event type: %s", e.EventType)
+	case ReasonServerOnly:
+		return fmt.Sprintf("Event type %s is generated by the server and cannot be submitted", e.EventType)
+	}
+	msgs := make([]string, len(e.Details))
+	for i, d := range e.Details {
+		msgs[i] = d.Field + ": " + d.Message
+	}
+	return fmt.Sprintf("Payload does not match schema for %s: %s", e.EventType, strings.Join(msgs, "; "))
+}
+
+type entry struct {
+	def    models.EventType
+	schema *jsonschema.Schema
+}
+
+type Registry struct {
+	mu    sync.RWMutex
+	mode  Mode
+	types map[string]entry
+}
+
+// NewRegistry returns a registry holding the built-in types. Custom types
+// are added with Load and Put.
+func NewRegistry(mode Mode) *Registry {
+	r := &Registry{mode: mode, types: map[string]entry{}}
+	for _, def := range builtinTypes {
+		schema, err := Compile(def.Name, def.Schema)
+		if err != nil {
+			panic(fmt.Sprintf("built-in event type %s: %v", def.Name, err))
+		}
+		def.BuiltIn = true
+		r.types[def.Name] = entry{def: def, schema: schema}
+	}
+	return r
+}
+
+func (r *Registry) Mode() Mode {
+	return r.mode
+}
+
+// Load adds the custom types stored in event_types. A type whose schema no
+// longer compiles is skipped with a log message.
+func (r *Registry) Load(db *sql.DB) error {
+	rows, err := db.Query("SELECT name, description, schema, created_at, updated_at FROM event_types")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var def models.EventType
+		var schema []byte
+		if err := rows.Scan(&def.Name, &def.Description, &schema, &def.CreatedAt, &def.UpdatedAt); err != nil {
+			return err
+		}
+		def.Schema = schema
+		compiled, err := Compile(def.Name, def.Schema)
+		if err != nil {
+			log.Printf("Skipping event type %s: %v", def.Name, err)
+			continue
+		}
+		r.Put(def, compiled)
+	}
+	return rows.Err()
+}
+
+// Compile parses a JSON Schema (draft 2020-12 unless $schema says otherwise).
+func Compile(name string, schema json.RawMessage) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	url := "event-types/" + name + ".json"
+	if err := c.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, err
+	}
+	return c.Compile(url)
+}
+
+// Put adds or replaces a custom type. Built-in types cannot be replaced.
+func (r *Registry) Put(def models.EventType, schema *jsonschema.Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.types[def.Name]; ok && existing.def.BuiltIn {
+		return
+	}
+	def.BuiltIn, def.ServerOnly = false, false
+	r.types[def.Name] = entry{def: def, schema: schema}
+}
+
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.types[name]; ok && !existing.def.BuiltIn {
+		delete(r.types, name)
+	}
+}
+
+func (r *Registry) Get(name string) (models.EventType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.types[name]
+	return e.def, ok
+}
+
+// List returns built-in types first, then custom types, each sorted by name.
+func (r *Registry) List() []models.EventType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]models.EventType, 0, len(r.types))
+	for _, e := range r.types {
+		types = append(types, e.def)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].BuiltIn != types[j].BuiltIn {
+			return types[i].BuiltIn
+		}
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// Validate checks an ingested request body against its event type. It
+// returns nil when the event is acceptable.
+func (r *Registry) Validate(eventType string, body []byte) *ValidationError {
+	r.mu.RLock()
+	e, ok := r.types[eventType]
+	r.mu.RUnlock()
+
+	if !ok {
+		return &ValidationError{EventType: eventType, Reason: ReasonUnknownType}
+	}
+	if e.def.ServerOnly {
+		return &ValidationError{EventType: eventType, Reason: ReasonServerOnly}
+	}
+
+	var payload interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return &ValidationError{EventType: eventType, Reason: ReasonSchemaMismatch,
+			Details: []FieldError{{Field: "/", Message: err.Error()}}}
+	}
+	err := e.schema.Validate(payload)
+	if err == nil {
+		return nil
+	}
+	verr := &ValidationError{EventType: eventType, Reason: ReasonSchemaMismatch}
+	if ve, ok := err.(*jsonschema.ValidationError); ok {
+		collectLeaves(ve, &verr.Details)
+	} else {
+		verr.Details = []FieldError{{Field: "/", Message: err.Error()}}
+	}
+	return verr
+}
+
+func collectLeaves(ve *jsonschema.ValidationError, out *[]FieldError) {
+	if len(ve.Causes) == 0 {
+		field := ve.InstanceLocation
+		if field == "" {
+			field = "/"
+		}
+		*out = append(*out, FieldError{Field: field, Message: ve.Message})
+		return
+	}
+	for _, cause := range ve.Causes {
+		collectLeaves(cause, out)
+	}
+}
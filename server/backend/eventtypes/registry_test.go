@@ -0,0 +1,128 @@
+package eventtypes
+
+import (
+	"backend/models"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_BuiltIn(t *testing.T) {
+	r := NewRegistry(ModeReject)
+
+	body := []byte(`{"device_id": "device-001", "event_type": "periodic_status", "uptime_ms": 60000,
+		"battery_percentage": 85, "battery_voltage": 4.1, "wifi_signal_strength": -60, "free_heap": 120000}`)
+	assert.Nil(t, r.Validate("periodic_status", body))
+}
+
+func TestValidate_FirmwareTypes(t *testing.T) {
+	r := NewRegistry(ModeReject)
+
+	// 標準ファームウェアが送る種別はすべて reject モードでも受け付ける
+	for _, eventType := range []string{"power_on", "power_off", "battery_low", "system_error", "wifi_reconnected", "periodic_status", "unknown"} {
+		body := []byte(`{"device_id": "device-001", "event_type": "` + eventType + `", "uptime_ms": 60000, "message": "",
+			"battery_percentage": 85, "battery_voltage": 4.1, "wifi_signal_strength": -60, "free_heap": 120000}`)
+		assert.Nil(t, r.Validate(eventType, body), eventType)
+	}
+}
+
+func TestValidate_UnknownType(t *testing.T) {
+	r := NewRegistry(ModeReject)
+
+	verr := r.Validate("poweroff", []byte(`{"device_id": "device-001", "event_type": "poweroff"}`))
+	assert.NotNil(t, verr)
+	assert.Equal(t, ReasonUnknownType, verr.Reason)
+	assert.Equal(t, "Unknown event type: poweroff", verr.Error())
+}
+
+func TestValidate_ServerOnlyType(t *testing.T) {
+	r := NewRegistry(ModeReject)
+
+	verr := r.Validate("reboot", []byte(`{"device_id": "device-001", "event_type": "reboot"}`))
+	assert.NotNil(t, verr)
+	assert.Equal(t, ReasonServerOnly, verr.Reason)
+}
+
+func TestValidate_SchemaMismatch(t *testing.T) {
+	r := NewRegistry(ModeReject)
+
+	body := []byte(`{"device_id": "device-001", "event_type": "battery_low", "battery_voltage": 12.5}`)
+	verr := r.Validate("battery_low", body)
+	assert.NotNil(t, verr)
+	assert.Equal(t, ReasonSchemaMismatch, verr.Reason)
+
+	fields := map[string]bool{}
+	for _, d := range verr.Details {
+		fields[d.Field] = true
+	}
+	assert.True(t, fields["/"], "missing battery_percentage is reported on the root")
+	assert.True(t, fields["/battery_voltage"])
+}
+
+func TestPutAndRemove(t *testing.T) {
+	r := NewRegistry(ModeWarn)
+
+	schema := json.RawMessage(`{"type": "object", "required": ["door"], "properties": {"door": {"enum": ["open", "closed"]}}}`)
+	compiled, err := Compile("door_state", schema)
+	assert.NoError(t, err)
+	r.Put(models.EventType{Name: "door_state", Schema: schema}, compiled)
+
+	assert.Nil(t, r.Validate("door_state", []byte(`{"door": "open"}`)))
+	assert.NotNil(t, r.Validate("door_state", []byte(`{"door": "ajar"}`)))
+
+	// 組み込み型は上書き・削除できない
+	r.Put(models.EventType{Name: "power_on", Schema: schema}, compiled)
+	r.Remove("power_on")
+	def, ok := r.Get("power_on")
+	assert.True(t, ok)
+	assert.True(t, def.BuiltIn)
+
+	r.Remove("door_state")
+	_, ok = r.Get("door_state")
+	assert.False(t, ok)
+}
+
+func TestCompile_InvalidSchema(t *testing.T) {
+	_, err := Compile("broken", json.RawMessage(`{"type": "no-such-type"}`))
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT name, description, schema, created_at, updated_at FROM event_types").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "description", "schema", "created_at", "updated_at"}).
+			AddRow("door_state", "Door sensor", `{"type": "object"}`, now, now).
+			AddRow("broken", "", `{"type": 1}`, now, now))
+
+	r := NewRegistry(ModeReject)
+	assert.NoError(t, r.Load(db))
+
+	_, ok := r.Get("door_state")
+	assert.True(t, ok)
+	_, ok = r.Get("broken")
+	assert.False(t, ok)
+
+	list := r.List()
+	assert.Equal(t, "battery_low", list[0].Name)
+	assert.Equal(t, "door_state", list[len(list)-1].Name)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeWarn, mode)
+
+	_, err = ParseMode("ignore")
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AlertHandler struct {
+	db *sql.DB
+}
+
+func NewAlertHandler(db *sql.DB) *AlertHandler {
+	return &AlertHandler{db: db}
+}
+
+func (h *AlertHandler) GetAlerts(c *gin.Context) {
+	var conditions []string
+	var args []interface{}
+
+	switch c.Query("status") {
+	case "":
+	case "open":
+		conditions = append(conditions, "resolved_at IS NULL")
+	case "resolved":
+		conditions = append(conditions, "resolved_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open or resolved"})
+		return
+	}
+	if v := c.Query("device_id"); v != "" {
+		args = append(args, v)
+		conditions = append(conditions, fmt.Sprintf("device_id = $%d", len(args)))
+	}
+	if v := c.Query("type"); v != "" {
+		args = append(args, v)
+		conditions = append(conditions, fmt.Sprintf("alert_type = $%d", len(args)))
+	}
+
+	query := "SELECT id, device_id, alert_type, severity, message, created_at, resolved_at FROM alerts"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	page, args := pageClause(c, args)
+	if page == "" {
+		page = " LIMIT 100"
+	}
+	query += " ORDER BY created_at DESC" + page
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+	defer rows.Close()
+
+	var alerts []models.Alert
+	for rows.Next() {
+		var alert models.Alert
+		err := rows.Scan(&alert.ID, &alert.DeviceID, &alert.AlertType, &alert.Severity, &alert.Message, &alert.CreatedAt, &alert.ResolvedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan alert"})
+			return
+		}
+		alerts = append(alerts, alert)
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"backend/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAlerts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "device_id", "alert_type", "severity", "message", "created_at", "resolved_at"}).
+		AddRow(1, "device-001", models.AlertCrashLoop, "critical", "Device rebooted 4 times within 1h0m0s", now, nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM alerts WHERE resolved_at IS NULL AND device_id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(rows)
+
+	// ハンドラー作成
+	handler := NewAlertHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/alerts?status=open&device_id=device-001", nil)
+
+	// ハンドラー実行
+	handler.GetAlerts(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var alerts []models.Alert
+	err = json.Unmarshal(w.Body.Bytes(), &alerts)
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, models.AlertCrashLoop, alerts[0].AlertType)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAlerts_InvalidStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewAlertHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/alerts?status=closed", nil)
+
+	// ハンドラー実行
+	handler.GetAlerts(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type AnnotationHandler struct {
+	db *sql.DB
+}
+
+func NewAnnotationHandler(db *sql.DB) *AnnotationHandler {
+	return &AnnotationHandler{db: db}
+}
+
+const annotationColumns = "id, device_id, starts_at, ends_at, author, text, tags, created_at, updated_at"
+
+func scanAnnotation(row rowScanner, a *models.Annotation) error {
+	return row.Scan(&a.ID, &a.DeviceID, &a.StartsAt, &a.EndsAt, &a.Author, &a.Text, pq.Array(&a.Tags), &a.CreatedAt, &a.UpdatedAt)
+}
+
+// loadAnnotations returns a device's annotations, newest first, at most
+// limit of them unless limit is 0.
+func loadAnnotations(db *sql.DB, deviceID string, limit int) ([]models.Annotation, error) {
+	query, args := "SELECT "+annotationColumns+" FROM device_annotations WHERE device_id = $1 ORDER BY starts_at DESC, id DESC", []interface{}{deviceID}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var annotations []models.Annotation
+	for rows.Next() {
+		var a models.Annotation
+		if err := scanAnnotation(rows, &a); err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+func bindAnnotationRequest(c *gin.Context) (*models.AnnotationRequest, bool) {
+	var req models.AnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if req.EndsAt != nil && req.EndsAt.Before(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must not be before starts_at"})
+		return nil, false
+	}
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+	return &req, true
+}
+
+func parseAnnotationID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid annotation ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetAnnotations lists a device's annotations, optionally those carrying a
+// tag or overlapping from/to.
+func (h *AnnotationHandler) GetAnnotations(c *gin.Context) {
+	args := []interface{}{c.Param("deviceId")}
+	conditions := []string{"device_id = $1"}
+	addCondition := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+	if v := c.Query("tag"); v != "" {
+		addCondition("$%d = ANY(tags)", v)
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + v})
+			return
+		}
+		addCondition("COALESCE(ends_at, starts_at) >= $%d", t)
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + v})
+			return
+		}
+		addCondition("starts_at < $%d", t)
+	}
+
+	page, args := pageClause(c, args)
+	rows, err := h.db.Query("SELECT "+annotationColumns+" FROM device_annotations WHERE "+strings.Join(conditions, " AND ")+" ORDER BY starts_at DESC, id DESC"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotations"})
+		return
+	}
+	defer rows.Close()
+
+	annotations := []models.Annotation{}
+	for rows.Next() {
+		var a models.Annotation
+		if err := scanAnnotation(rows, &a); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan annotation"})
+			return
+		}
+		annotations = append(annotations, a)
+	}
+
+	c.JSON(http.StatusOK, annotations)
+}
+
+func (h *AnnotationHandler) GetAnnotationByID(c *gin.Context) {
+	id, ok := parseAnnotationID(c)
+	if !ok {
+		return
+	}
+
+	var a models.Annotation
+	err := scanAnnotation(h.db.QueryRow("SELECT "+annotationColumns+" FROM device_annotations WHERE id = $1 AND device_id = $2", id, c.Param("deviceId")), &a)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "annotation_not_found", "Annotation not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *AnnotationHandler) CreateAnnotation(c *gin.Context) {
+	req, ok := bindAnnotationRequest(c)
+	if !ok {
+		return
+	}
+
+	var a models.Annotation
+	err := scanAnnotation(h.db.QueryRow(`
+		INSERT INTO device_annotations (device_id, starts_at, ends_at, author, text, tags)
+		SELECT id, $2, $3, $4, $5, $6 FROM devices WHERE id = $1
+		RETURNING `+annotationColumns,
+		c.Param("deviceId"), req.StartsAt, req.EndsAt, req.Author, req.Text, pq.Array(req.Tags),
+	), &a)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create annotation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+func (h *AnnotationHandler) UpdateAnnotation(c *gin.Context) {
+	id, ok := parseAnnotationID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAnnotationRequest(c)
+	if !ok {
+		return
+	}
+
+	var a models.Annotation
+	err := scanAnnotation(h.db.QueryRow(`
+		UPDATE device_annotations SET starts_at = $1, ends_at = $2, author = $3, text = $4, tags = $5, updated_at = $6
+		WHERE id = $7 AND device_id = $8
+		RETURNING `+annotationColumns,
+		req.StartsAt, req.EndsAt, req.Author, req.Text, pq.Array(req.Tags), time.Now(), id, c.Param("deviceId"),
+	), &a)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "annotation_not_found", "Annotation not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update annotation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *AnnotationHandler) DeleteAnnotation(c *gin.Context) {
+	id, ok := parseAnnotationID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM device_annotations WHERE id = $1 AND device_id = $2", id, c.Param("deviceId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete annotation"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "annotation_not_found", "Annotation not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Annotation deleted successfully"})
+}
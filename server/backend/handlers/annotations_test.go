@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"backend/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func annotationRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "device_id", "starts_at", "ends_at", "author", "text", "tags", "created_at", "updated_at"})
+}
+
+func TestCreateAnnotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	mock.ExpectQuery("INSERT INTO device_annotations (.+) FROM devices WHERE id = \\$1").
+		WithArgs("device-001", start, &end, "tanaka", "分電盤の交換", sqlmock.AnyArg()).
+		WillReturnRows(annotationRows().
+			AddRow(1, "device-001", start, end, "tanaka", "分電盤の交換", "{electrical}", start, start))
+
+	// ハンドラー作成
+	handler := NewAnnotationHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+	c.Request = httptest.NewRequest("POST", "/api/devices/device-001/annotations", strings.NewReader(
+		`{"starts_at": "2024-01-10T09:00:00Z", "ends_at": "2024-01-10T11:00:00Z", "author": "tanaka", "text": "分電盤の交換", "tags": ["electrical"]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateAnnotation(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response models.Annotation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.ID)
+	assert.Equal(t, []string{"electrical"}, response.Tags)
+	assert.Equal(t, end, *response.EndsAt)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAnnotation_DeviceNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("INSERT INTO device_annotations").
+		WillReturnRows(annotationRows())
+
+	// ハンドラー作成
+	handler := NewAnnotationHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "deviceId", Value: "unknown"}}
+	c.Request = httptest.NewRequest("POST", "/api/devices/unknown/annotations", strings.NewReader(
+		`{"starts_at": "2024-01-10T09:00:00Z", "author": "tanaka", "text": "メモ"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateAnnotation(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAnnotation_EndBeforeStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewAnnotationHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+	c.Request = httptest.NewRequest("POST", "/api/devices/device-001/annotations", strings.NewReader(
+		`{"starts_at": "2024-01-10T09:00:00Z", "ends_at": "2024-01-10T08:00:00Z", "author": "tanaka", "text": "逆順"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateAnnotation(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAnnotations_Filters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM device_annotations WHERE device_id = \\$1 AND \\$2 = ANY\\(tags\\) AND COALESCE\\(ends_at, starts_at\\) >= \\$3 ORDER BY starts_at DESC").
+		WithArgs("device-001", "breaker", from).
+		WillReturnRows(annotationRows().
+			AddRow(2, "device-001", now, nil, "suzuki", "ブレーカー落ち", "{breaker}", now, now))
+
+	// ハンドラー作成
+	handler := NewAnnotationHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+	c.Request, _ = http.NewRequest("GET", "/api/devices/device-001/annotations?tag=breaker&from=2024-01-01T00:00:00Z", nil)
+
+	// ハンドラー実行
+	handler.GetAnnotations(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []models.Annotation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.Nil(t, response[0].EndsAt)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAnnotation_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 別デバイスの注釈は削除できない
+	mock.ExpectExec("DELETE FROM device_annotations WHERE id = \\$1 AND device_id = \\$2").
+		WithArgs(7, "device-002").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// ハンドラー作成
+	handler := NewAnnotationHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-002"}, {Key: "id", Value: "7"}}
+	c.Request, _ = http.NewRequest("DELETE", "/api/devices/device-002/annotations/7", nil)
+
+	// ハンドラー実行
+	handler.DeleteAnnotation(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"backend/analysis"
+	"backend/health"
+	"backend/models"
+	"backend/store"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// デバイスの報告が途絶えたとみなすまでの時間（periodic_status は1分間隔）
+const deviceOfflineAfter = 5 * time.Minute
+
+func (h *DeviceHandler) deviceExists(deviceID string) (bool, error) {
+	return store.DeviceExists(h.db, deviceID)
+}
+
+// parseDays reads the "days" query parameter used by the analytics endpoints.
+func parseDays(c *gin.Context, fallback int) (int, bool) {
+	v := c.Query("days")
+	if v == "" {
+		return fallback, true
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > 365 {
+		return 0, false
+	}
+	return days, true
+}
+
+func (h *DeviceHandler) GetDeviceBattery(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+
+	days, ok := parseDays(c, 90)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+		return
+	}
+
+	exists, err := h.deviceExists(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device"})
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
+		return
+	}
+
+	now := time.Now()
+	events, err := health.LoadDeviceEvents(h.db, deviceID, now.AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load power events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis.AnalyzeBattery(deviceID, events, now, deviceOfflineAfter))
+}
+
+func (h *DeviceHandler) GetDeviceHealth(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+
+	result := models.DeviceHealth{DeviceID: deviceID, RecentReboots: []models.RebootRecord{}}
+	err := h.db.QueryRow("SELECT crash_loop_since FROM devices WHERE id = $1", deviceID).Scan(&result.CrashLoopSince)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device"})
+		return
+	}
+	result.CrashLooping = result.CrashLoopSince != nil
+
+	now := time.Now()
+	rows, err := h.db.Query("SELECT timestamp, data FROM power_events WHERE device_id = $1 AND event_type = $2 AND timestamp >= $3 ORDER BY timestamp DESC",
+		deviceID, health.EventTypeReboot, now.AddDate(0, 0, -7))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reboots"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.RebootRecord
+		var data []byte
+		if err := rows.Scan(&record.BootAt, &data); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan reboot"})
+			return
+		}
+		var details struct {
+			PreviousUptimeMs int64  `json:"previous_uptime_ms"`
+			TriggerEventType string `json:"trigger_event_type"`
+			CleanBoot        bool   `json:"clean_boot"`
+		}
+		if len(data) > 0 {
+			json.Unmarshal(data, &details)
+		}
+		record.PreviousUptimeMs = details.PreviousUptimeMs
+		record.TriggerEventType = details.TriggerEventType
+		record.CleanBoot = details.CleanBoot
+
+		if record.BootAt.After(now.Add(-24 * time.Hour)) {
+			result.RebootsLast24h++
+		}
+		result.RebootsLast7d++
+		result.RecentReboots = append(result.RecentReboots, record)
+	}
+	if len(result.RecentReboots) > 0 {
+		result.LastRebootAt = &result.RecentReboots[0].BootAt
+	}
+
+	heap, err := scanHeapStatus(h.db.QueryRow(heapStatusQuery+" WHERE device_id = $1", deviceID))
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch heap analysis"})
+		return
+	}
+	result.Heap = heap
+
+	c.JSON(http.StatusOK, result)
+}
+
+const heapStatusQuery = `SELECT device_id, analyzed_at, session_started_at, samples, current_free_heap,
+	slope_bytes_per_hour, r_squared, leak_suspected, projected_exhaustion_at FROM device_heap_analysis`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHeapStatus(row rowScanner) (*models.HeapStatus, error) {
+	var s models.HeapStatus
+	err := row.Scan(&s.DeviceID, &s.AnalyzedAt, &s.SessionStartedAt, &s.Samples, &s.CurrentFreeHeap,
+		&s.SlopeBytesPerHour, &s.RSquared, &s.LeakSuspected, &s.ProjectedExhaustionAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (h *DeviceHandler) GetHeapAnalysis(c *gin.Context) {
+	query := heapStatusQuery
+	if c.Query("leak_suspected") == "true" {
+		query += " WHERE leak_suspected"
+	}
+	page, args := pageClause(c, nil)
+	query += " ORDER BY projected_exhaustion_at NULLS LAST, device_id" + page
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch heap analysis"})
+		return
+	}
+	defer rows.Close()
+
+	statuses := []models.HeapStatus{}
+	for rows.Next() {
+		s, err := scanHeapStatus(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan heap analysis"})
+			return
+		}
+		statuses = append(statuses, *s)
+	}
+
+	c.JSON(http.StatusOK, statuses)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"backend/analysis"
+	"backend/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDeviceBattery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM devices WHERE id = \\$1\\)").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	// 20分前に停電し、毎分1%ずつ減っている
+	start := time.Now().Add(-20 * time.Minute)
+	rows := sqlmock.NewRows(append([]string{"event_type", "timestamp"}, eventDataColumnNames...))
+	for i := 0; i <= 20; i++ {
+		eventType := "periodic_status"
+		if i == 0 {
+			eventType = "power_off"
+		}
+		rows.AddRow(eventType, start.Add(time.Duration(i)*time.Minute), nil, nil, nil, 80-i, 3.9, nil, nil, nil)
+	}
+	mock.ExpectQuery("SELECT event_type, timestamp, (.+) FROM power_events WHERE device_id = \\$1").
+		WithArgs("device-001", sqlmock.AnyArg(), "reboot").
+		WillReturnRows(rows)
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/devices/device-001/battery", nil)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+
+	// ハンドラー実行
+	handler.GetDeviceBattery(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report analysis.BatteryReport
+	err = json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(t, err)
+	assert.True(t, report.OnBattery)
+	assert.Len(t, report.Sessions, 1)
+	assert.InDelta(t, 60, *report.Sessions[0].RatePctPerHour, 1e-6)
+	// 残り60%を60%/hで消費 → 約1時間
+	assert.InDelta(t, 3600, *report.EstimatedRemainingSeconds, 1)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDeviceBattery_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM devices WHERE id = \\$1\\)").
+		WithArgs("nonexistent-device").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/devices/nonexistent-device/battery", nil)
+	c.Params = gin.Params{{Key: "deviceId", Value: "nonexistent-device"}}
+
+	// ハンドラー実行
+	handler.GetDeviceBattery(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDeviceHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	now := time.Now()
+	mock.ExpectQuery("SELECT crash_loop_since FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"crash_loop_since"}).AddRow(now.Add(-10 * time.Minute)))
+
+	mock.ExpectQuery("SELECT timestamp, data FROM power_events WHERE device_id = \\$1 AND event_type = \\$2").
+		WithArgs("device-001", "reboot", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp", "data"}).
+			AddRow(now.Add(-5*time.Minute), `{"previous_uptime_ms": 20000, "trigger_event_type": "periodic_status", "clean_boot": false}`).
+			AddRow(now.Add(-48*time.Hour), `{"previous_uptime_ms": 86400000, "trigger_event_type": "power_on", "clean_boot": true}`))
+
+	mock.ExpectQuery("SELECT (.+) FROM device_heap_analysis WHERE device_id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "analyzed_at", "session_started_at", "samples", "current_free_heap",
+			"slope_bytes_per_hour", "r_squared", "leak_suspected", "projected_exhaustion_at"}).
+			AddRow("device-001", now, now.Add(-5*time.Minute), 5, 90000, nil, nil, false, nil))
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/devices/device-001/health", nil)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+
+	// ハンドラー実行
+	handler.GetDeviceHealth(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result models.DeviceHealth
+	err = json.Unmarshal(w.Body.Bytes(), &result)
+	assert.NoError(t, err)
+	assert.True(t, result.CrashLooping)
+	assert.Equal(t, 1, result.RebootsLast24h)
+	assert.Equal(t, 2, result.RebootsLast7d)
+	assert.False(t, result.RecentReboots[0].CleanBoot)
+	assert.Equal(t, int64(20000), result.RecentReboots[0].PreviousUptimeMs)
+	assert.NotNil(t, result.Heap)
+	assert.False(t, result.Heap.LeakSuspected)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetHeapAnalysis(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	now := time.Now()
+	exhaustion := now.Add(40 * time.Hour)
+	mock.ExpectQuery("SELECT (.+) FROM device_heap_analysis WHERE leak_suspected ORDER BY").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "analyzed_at", "session_started_at", "samples", "current_free_heap",
+			"slope_bytes_per_hour", "r_squared", "leak_suspected", "projected_exhaustion_at"}).
+			AddRow("device-001", now, now.Add(-6*time.Hour), 360, 54000, -1000.0, 0.98, true, exhaustion))
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/health/heap?leak_suspected=true", nil)
+
+	// ハンドラー実行
+	handler.GetHeapAnalysis(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var statuses []models.HeapStatus
+	err = json.Unmarshal(w.Body.Bytes(), &statuses)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.True(t, statuses[0].LeakSuspected)
+	assert.InDelta(t, -1000, *statuses[0].SlopeBytesPerHour, 1e-9)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
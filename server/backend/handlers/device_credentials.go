@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"backend/credentials"
+	"backend/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RotateDeviceCredentials issues a new MQTT key for the device. Any previous
+// key stops working immediately.
+func (h *DeviceHandler) RotateDeviceCredentials(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+
+	exists, err := h.deviceExists(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device"})
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
+		return
+	}
+
+	key, err := credentials.NewStore(h.db).Rotate(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue device credentials"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.DeviceCredentials{
+		DeviceID:  deviceID,
+		Username:  deviceID,
+		Key:       key,
+		RotatedAt: time.Now(),
+	})
+}
+
+func (h *DeviceHandler) RevokeDeviceCredentials(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+
+	revoked, err := credentials.NewStore(h.db).Revoke(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device credentials"})
+		return
+	}
+	if !revoked {
+		respondError(c, http.StatusNotFound, "credentials_not_found", "Device credentials not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device credentials revoked successfully"})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"backend/credentials"
+	"backend/models"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateDeviceCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var storedHash string
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT INTO device_credentials").
+		WithArgs("device-001", hashCapture{&storedHash}, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/devices/device-001/credentials", nil)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+
+	// ハンドラー実行
+	handler.RotateDeviceCredentials(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var creds models.DeviceCredentials
+	err = json.Unmarshal(w.Body.Bytes(), &creds)
+	assert.NoError(t, err)
+	assert.Equal(t, "device-001", creds.Username)
+	assert.Equal(t, credentials.Hash(creds.Key), storedHash, "only the hash of the returned key is stored")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeDeviceCredentials_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM device_credentials WHERE device_id = \\$1").
+		WithArgs("device-009").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("DELETE", "/api/devices/device-009/credentials", nil)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-009"}}
+
+	// ハンドラー実行
+	handler.RevokeDeviceCredentials(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// hashCapture は引数の値を記録する sqlmock.Argument
+type hashCapture struct {
+	value *string
+}
+
+func (h hashCapture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*h.value = s
+	return ok
+}
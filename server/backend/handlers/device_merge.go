@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/store"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergeDevice moves all history of another device id into this device, e.g.
+// after a reflash changed the chip-based id. The old id becomes an alias, so
+// events still sent under it are stored here.
+func (h *DeviceHandler) MergeDevice(c *gin.Context) {
+	var req models.DeviceMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := store.MergeDevices(h.db, req.From, c.Param("deviceId"), req.Actor, req.Comment)
+	switch {
+	case err == store.ErrSameDevice:
+		respondError(c, http.StatusBadRequest, "same_device", err.Error())
+		return
+	case err == sql.ErrNoRows:
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *DeviceHandler) GetDeviceAliases(c *gin.Context) {
+	aliases, err := store.DeviceAliases(h.db, c.Param("deviceId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device aliases"})
+		return
+	}
+	c.JSON(http.StatusOK, aliases)
+}
+
+// GetDeviceAudit lists the administrative changes to a device, newest first.
+func (h *DeviceHandler) GetDeviceAudit(c *gin.Context) {
+	limit, offset := pageBounds(c)
+	entries, err := store.DeviceAuditLog(h.db, c.Param("deviceId"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeDevice_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM").
+		WithArgs("unknown", "device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	// ハンドラー作成
+	handler := NewDeviceHandler(db)
+
+	// リクエスト作成
+	body, _ := json.Marshal(map[string]string{"from": "unknown"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/devices/device-001/merge", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+
+	// ハンドラー実行
+	handler.MergeDevice(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeDevice_InvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	handler := NewDeviceHandler(db)
+	for _, body := range []string{`{}`, `{"from": "device-001"}`} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/api/devices/device-001/merge", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+
+		// from がない、または自分自身への統合は 400
+		handler.MergeDevice(c)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"backend/models"
+	"backend/store"
 	"database/sql"
 	"net/http"
 	"time"
@@ -18,23 +19,12 @@ func NewDeviceHandler(db *sql.DB) *DeviceHandler {
 }
 
 func (h *DeviceHandler) GetDevices(c *gin.Context) {
-	rows, err := h.db.Query("SELECT id, name, description, last_seen, created_at, updated_at FROM devices ORDER BY created_at DESC")
+	limit, offset := pageBounds(c)
+	devices, err := store.ListDevices(h.db, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
 		return
 	}
-	defer rows.Close()
-
-	var devices []models.Device
-	for rows.Next() {
-		var device models.Device
-		err := rows.Scan(&device.ID, &device.Name, &device.Description, &device.LastSeen, &device.CreatedAt, &device.UpdatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan device"})
-			return
-		}
-		devices = append(devices, device)
-	}
 
 	c.JSON(http.StatusOK, devices)
 }
@@ -43,11 +33,11 @@ func (h *DeviceHandler) GetDeviceByID(c *gin.Context) {
 	deviceID := c.Param("deviceId")
 
 	var device models.Device
-	err := h.db.QueryRow("SELECT id, name, description, last_seen, created_at, updated_at FROM devices WHERE id = $1", deviceID).
-		Scan(&device.ID, &device.Name, &device.Description, &device.LastSeen, &device.CreatedAt, &device.UpdatedAt)
+	err := h.db.QueryRow("SELECT id, name, description, COALESCE(model, ''), COALESCE(firmware_version, ''), COALESCE(site, ''), COALESCE(device_group, ''), offline_since, last_seen, created_at, updated_at FROM devices WHERE id = $1", deviceID).
+		Scan(&device.ID, &device.Name, &device.Description, &device.Model, &device.FirmwareVersion, &device.Site, &device.Group, &device.OfflineSince, &device.LastSeen, &device.CreatedAt, &device.UpdatedAt)
 	
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
 		return
 	}
 	if err != nil {
@@ -67,9 +57,10 @@ func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 		return
 	}
 
+	// site/group は指定された場合のみ更新
 	result, err := h.db.Exec(
-		"UPDATE devices SET name = $1, description = $2, updated_at = $3 WHERE id = $4",
-		req.Name, req.Description, time.Now(), deviceID,
+		"UPDATE devices SET name = $1, description = $2, site = COALESCE($3, site), device_group = COALESCE($4, device_group), updated_at = $5 WHERE id = $6",
+		req.Name, req.Description, req.Site, req.Group, time.Now(), deviceID,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
@@ -83,7 +74,7 @@ func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 	}
 
 	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
 		return
 	}
 
@@ -93,30 +84,16 @@ func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
 	deviceID := c.Param("deviceId")
 
-	// 関連する電源イベントを削除
-	_, err := h.db.Exec("DELETE FROM power_events WHERE device_id = $1", deviceID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete related power events"})
+	// 関連する電源イベントごと削除
+	err := store.DeleteDevice(h.db, deviceID)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "device_not_found", "Device not found")
 		return
 	}
-
-	// デバイスを削除
-	result, err := h.db.Exec("DELETE FROM devices WHERE id = $1", deviceID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
-		return
-	}
-
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
 }
\ No newline at end of file
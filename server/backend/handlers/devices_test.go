@@ -24,9 +24,9 @@ func TestGetDevices(t *testing.T) {
 
 	// テストデータ
 	now := time.Now()
-	rows := sqlmock.NewRows([]string{"id", "name", "description", "last_seen", "created_at", "updated_at"}).
-		AddRow("device-001", "M5StickC Device 1", "Test device", now, now, now).
-		AddRow("device-002", "M5StickC Device 2", "Another test device", now, now, now)
+	rows := sqlmock.NewRows([]string{"id", "name", "description", "model", "firmware_version", "site", "group", "offline_since", "last_seen", "created_at", "updated_at"}).
+		AddRow("device-001", "M5StickC Device 1", "Test device", "M5StickCPlus2", "1.0.0", "tokyo-office", "", nil, now, now, now).
+		AddRow("device-002", "M5StickC Device 2", "Another test device", "M5StickCPlus2", "1.0.0", "tokyo-office", "", nil, now, now, now)
 
 	mock.ExpectQuery("SELECT (.+) FROM devices ORDER BY created_at DESC").
 		WillReturnRows(rows)
@@ -66,8 +66,8 @@ func TestGetDeviceByID(t *testing.T) {
 
 	// テストデータ
 	now := time.Now()
-	rows := sqlmock.NewRows([]string{"id", "name", "description", "last_seen", "created_at", "updated_at"}).
-		AddRow("device-001", "M5StickC Device 1", "Test device", now, now, now)
+	rows := sqlmock.NewRows([]string{"id", "name", "description", "model", "firmware_version", "site", "group", "offline_since", "last_seen", "created_at", "updated_at"}).
+		AddRow("device-001", "M5StickC Device 1", "Test device", "M5StickCPlus2", "1.0.0", "tokyo-office", "", nil, now, now, now)
 
 	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
 		WithArgs("device-001").
@@ -93,6 +93,9 @@ func TestGetDeviceByID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "device-001", device.ID)
 	assert.Equal(t, "M5StickC Device 1", device.Name)
+	assert.Equal(t, "M5StickCPlus2", device.Model)
+	assert.Equal(t, "1.0.0", device.FirmwareVersion)
+	assert.Equal(t, "tokyo-office", device.Site)
 
 	// モックの期待値を満たしたか確認
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -107,13 +110,15 @@ func TestUpdateDevice(t *testing.T) {
 	defer db.Close()
 
 	// テストデータ
+	site := "tokyo-office"
 	req := models.DeviceUpdateRequest{
 		Name:        "Updated Device Name",
 		Description: "Updated description",
+		Site:        &site,
 	}
 
-	mock.ExpectExec("UPDATE devices SET name = \\$1, description = \\$2, updated_at = \\$3 WHERE id = \\$4").
-		WithArgs(req.Name, req.Description, sqlmock.AnyArg(), "device-001").
+	mock.ExpectExec("UPDATE devices SET name = \\$1, description = \\$2, site = COALESCE\\(\\$3, site\\), device_group = COALESCE\\(\\$4, device_group\\), updated_at = \\$5 WHERE id = \\$6").
+		WithArgs(req.Name, req.Description, req.Site, req.Group, sqlmock.AnyArg(), "device-001").
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	// ハンドラー作成
@@ -194,7 +199,7 @@ func TestGetDeviceByID_NotFound(t *testing.T) {
 
 	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1").
 		WithArgs("nonexistent-device").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "last_seen", "created_at", "updated_at"}))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "model", "firmware_version", "site", "group", "offline_since", "last_seen", "created_at", "updated_at"}))
 
 	// ハンドラー作成
 	handler := NewDeviceHandler(db)
@@ -258,8 +263,8 @@ func TestUpdateDevice_NotFound(t *testing.T) {
 	}
 
 	// 0行が更新された場合（デバイスが見つからない）
-	mock.ExpectExec("UPDATE devices SET name = \\$1, description = \\$2, updated_at = \\$3 WHERE id = \\$4").
-		WithArgs(req.Name, req.Description, sqlmock.AnyArg(), "nonexistent-device").
+	mock.ExpectExec("UPDATE devices SET name = \\$1, description = \\$2, site = COALESCE\\(\\$3, site\\), device_group = COALESCE\\(\\$4, device_group\\), updated_at = \\$5 WHERE id = \\$6").
+		WithArgs(req.Name, req.Description, nil, nil, sqlmock.AnyArg(), "nonexistent-device").
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	// ハンドラー作成
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"backend/apiv2"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError writes an {"error": message} response whose /api/v2 problem
+// has the given code.
+func respondError(c *gin.Context, status int, code, message string) {
+	apiv2.SetCode(c, code)
+	c.JSON(status, gin.H{"error": message})
+}
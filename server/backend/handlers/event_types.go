@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"backend/eventtypes"
+	"backend/models"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type EventTypeHandler struct {
+	db       *sql.DB
+	registry *eventtypes.Registry
+}
+
+func NewEventTypeHandler(db *sql.DB, registry *eventtypes.Registry) *EventTypeHandler {
+	return &EventTypeHandler{db: db, registry: registry}
+}
+
+func (h *EventTypeHandler) GetEventTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, h.registry.List())
+}
+
+func (h *EventTypeHandler) GetEventType(c *gin.Context) {
+	def, ok := h.registry.Get(c.Param("name"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "event_type_not_found", "Event type not found")
+		return
+	}
+	c.JSON(http.StatusOK, def)
+}
+
+func (h *EventTypeHandler) CreateEventType(c *gin.Context) {
+	var req models.EventTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !eventtypes.ValidName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be lower-case snake_case, at most 50 characters"})
+		return
+	}
+	if _, ok := h.registry.Get(req.Name); ok {
+		respondError(c, http.StatusConflict, "event_type_exists", "Event type already exists")
+		return
+	}
+	schema, err := eventtypes.Compile(req.Name, req.Schema)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, "invalid_schema", "Invalid JSON Schema: " + err.Error())
+		return
+	}
+
+	def := models.EventType{Name: req.Name, Description: req.Description, Schema: req.Schema}
+	err = h.db.QueryRow(`
+		INSERT INTO event_types (name, description, schema) VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at`,
+		def.Name, def.Description, string(def.Schema),
+	).Scan(&def.CreatedAt, &def.UpdatedAt)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		respondError(c, http.StatusConflict, "event_type_exists", "Event type already exists")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event type"})
+		return
+	}
+
+	h.registry.Put(def, schema)
+	c.JSON(http.StatusCreated, def)
+}
+
+func (h *EventTypeHandler) UpdateEventType(c *gin.Context) {
+	name := c.Param("name")
+
+	var req models.EventTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if existing, ok := h.registry.Get(name); ok && existing.BuiltIn {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in event types cannot be modified"})
+		return
+	}
+	schema, err := eventtypes.Compile(name, req.Schema)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, "invalid_schema", "Invalid JSON Schema: " + err.Error())
+		return
+	}
+
+	def := models.EventType{Name: name, Description: req.Description, Schema: req.Schema}
+	err = h.db.QueryRow(`
+		UPDATE event_types SET description = $1, schema = $2, updated_at = $3 WHERE name = $4
+		RETURNING created_at, updated_at`,
+		def.Description, string(def.Schema), time.Now(), name,
+	).Scan(&def.CreatedAt, &def.UpdatedAt)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "event_type_not_found", "Event type not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event type"})
+		return
+	}
+
+	h.registry.Put(def, schema)
+	c.JSON(http.StatusOK, def)
+}
+
+func (h *EventTypeHandler) DeleteEventType(c *gin.Context) {
+	name := c.Param("name")
+	if existing, ok := h.registry.Get(name); ok && existing.BuiltIn {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in event types cannot be deleted"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM event_types WHERE name = $1", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event type"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "event_type_not_found", "Event type not found")
+		return
+	}
+
+	h.registry.Remove(name)
+	c.JSON(http.StatusOK, gin.H{"message": "Event type deleted successfully"})
+}
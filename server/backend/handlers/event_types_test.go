@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"backend/eventtypes"
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateEventType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	schema := `{"type": "object", "required": ["door"], "properties": {"door": {"enum": ["open", "closed"]}}}`
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO event_types").
+		WithArgs("door_state", "Door sensor", schema).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+
+	// ハンドラー作成
+	registry := eventtypes.NewRegistry(eventtypes.ModeReject)
+	handler := NewEventTypeHandler(db, registry)
+
+	// リクエスト作成
+	body := `{"name": "door_state", "description": "Door sensor", "schema": ` + schema + `}`
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/event-types", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateEventType(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Nil(t, registry.Validate("door_state", []byte(`{"door": "open"}`)))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEventType_InvalidSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// ハンドラー作成
+	handler := NewEventTypeHandler(nil, eventtypes.NewRegistry(eventtypes.ModeReject))
+
+	// リクエスト作成
+	body := `{"name": "door_state", "schema": {"type": "door"}}`
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/event-types", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateEventType(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestCreateEventType_BuiltInConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// ハンドラー作成
+	handler := NewEventTypeHandler(nil, eventtypes.NewRegistry(eventtypes.ModeReject))
+
+	// リクエスト作成
+	body := `{"name": "power_on", "schema": {"type": "object"}}`
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/event-types", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateEventType(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestGetEventTypes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// ハンドラー作成
+	handler := NewEventTypeHandler(nil, eventtypes.NewRegistry(eventtypes.ModeReject))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/event-types", nil)
+
+	// ハンドラー実行
+	handler.GetEventTypes(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var types []models.EventType
+	err := json.Unmarshal(w.Body.Bytes(), &types)
+	assert.NoError(t, err)
+	assert.Len(t, types, 8)
+	for _, et := range types {
+		assert.True(t, et.BuiltIn)
+	}
+}
+
+func TestDeleteEventType_BuiltIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// ハンドラー作成
+	handler := NewEventTypeHandler(nil, eventtypes.NewRegistry(eventtypes.ModeReject))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("DELETE", "/api/event-types/power_off", nil)
+	c.Params = gin.Params{{Key: "name", Value: "power_off"}}
+
+	// ハンドラー実行
+	handler.DeleteEventType(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestDeleteEventType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM event_types WHERE name = \\$1").
+		WithArgs("door_state").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// ハンドラー作成
+	handler := NewEventTypeHandler(db, eventtypes.NewRegistry(eventtypes.ModeReject))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("DELETE", "/api/event-types/door_state", nil)
+	c.Params = gin.Params{{Key: "name", Value: "door_state"}}
+
+	// ハンドラー実行
+	handler.DeleteEventType(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"backend/influx"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler struct {
+	influx *influx.Exporter
+}
+
+// NewExportHandler takes the InfluxDB exporter, which is nil when no write
+// endpoint is configured.
+func NewExportHandler(exporter *influx.Exporter) *ExportHandler {
+	return &ExportHandler{influx: exporter}
+}
+
+// BackfillInflux re-exports stored events within from/to (default: the last
+// 30 days) in the background.
+func (h *ExportHandler) BackfillInflux(c *gin.Context) {
+	if h.influx == nil {
+		respondError(c, http.StatusServiceUnavailable, "export_not_configured", "InfluxDB export is not configured")
+		return
+	}
+
+	from, to, err := parsePeriod(c, 30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.influx.StartBackfill(from, to) {
+		respondError(c, http.StatusConflict, "backfill_running", "Backfill already running")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "started", "from": from, "to": to})
+}
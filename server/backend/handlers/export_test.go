@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"backend/influx"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillInflux_NotConfigured(t *testing.T) {
+	// ハンドラー作成
+	handler := NewExportHandler(nil)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/export/influx/backfill", nil)
+
+	// ハンドラー実行
+	handler.BackfillInflux(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestBackfillInflux(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pe.id, pe.device_id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "device_id", "site", "event_type", "timestamp", "data"})).
+		WillDelayFor(50 * time.Millisecond)
+
+	buffer, err := influx.NewBuffer(t.TempDir(), 0)
+	assert.NoError(t, err)
+	handler := NewExportHandler(influx.NewExporter(db, buffer, influx.Options{URL: "http://127.0.0.1:0/write"}))
+
+	request := func() int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/export/influx/backfill?from=2024-01-01&to=2024-01-02", nil)
+		handler.BackfillInflux(c)
+		return w.Code
+	}
+
+	// 実行中の二重起動は 409
+	assert.Equal(t, http.StatusAccepted, request())
+	assert.Equal(t, http.StatusConflict, request())
+
+	// モックの期待値を満たしたか確認
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, 5*time.Second, 10*time.Millisecond)
+}
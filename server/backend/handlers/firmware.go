@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"backend/models"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ファームウェアは "M5StickCPlus2/1.0.0" 形式のUser-Agentを送信する
+var userAgentPattern = regexp.MustCompile(`^([A-Za-z0-9_.-]+)/([0-9][0-9A-Za-z.+-]*)$`)
+
+type FirmwareHandler struct {
+	db *sql.DB
+}
+
+func NewFirmwareHandler(db *sql.DB) *FirmwareHandler {
+	return &FirmwareHandler{db: db}
+}
+
+func parseUserAgent(userAgent string) (model, version string) {
+	m := userAgentPattern.FindStringSubmatch(strings.TrimSpace(userAgent))
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// compareVersions compares dotted version strings numerically, e.g. "1.10.0" > "1.9.2".
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.SplitN(a, "-", 2)[0], ".")
+	bs := strings.Split(strings.SplitN(b, "-", 2)[0], ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// inRollout deterministically buckets a device into 0-99 per release, so the
+// same device stays in or out of a rollout as the percentage is raised.
+func inRollout(deviceID, version string, percentage int) bool {
+	h := fnv.New32a()
+	h.Write([]byte(deviceID + "@" + version))
+	return int(h.Sum32()%100) < percentage
+}
+
+func (h *FirmwareHandler) GetDeviceFirmwareHistory(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+
+	page, args := pageClause(c, []interface{}{deviceID})
+	rows, err := h.db.Query("SELECT id, device_id, firmware_version, model, seen_at FROM device_firmware_history WHERE device_id = $1 ORDER BY seen_at DESC, id DESC"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch firmware history"})
+		return
+	}
+	defer rows.Close()
+
+	var history []models.FirmwareHistoryEntry
+	for rows.Next() {
+		var entry models.FirmwareHistoryEntry
+		err := rows.Scan(&entry.ID, &entry.DeviceID, &entry.FirmwareVersion, &entry.Model, &entry.SeenAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan firmware history"})
+			return
+		}
+		history = append(history, entry)
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+func (h *FirmwareHandler) CreateRelease(c *gin.Context) {
+	version := strings.TrimSpace(c.PostForm("version"))
+	model := strings.TrimSpace(c.PostForm("model"))
+	if version == "" || model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version and model are required"})
+		return
+	}
+
+	rollout := 0
+	if v := c.PostForm("rollout_percentage"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 0 || p > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rollout_percentage must be between 0 and 100"})
+			return
+		}
+		rollout = p
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Firmware binary is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read firmware binary"})
+		return
+	}
+	defer file.Close()
+
+	binary, err := io.ReadAll(file)
+	if err != nil || len(binary) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read firmware binary"})
+		return
+	}
+
+	sum := sha256.Sum256(binary)
+	release := models.FirmwareRelease{
+		Version:           version,
+		Model:             model,
+		Checksum:          hex.EncodeToString(sum[:]),
+		Size:              int64(len(binary)),
+		RolloutPercentage: rollout,
+		Notes:             c.PostForm("notes"),
+	}
+
+	err = h.db.QueryRow(`
+		INSERT INTO firmware_releases (version, model, checksum, size, binary_data, rollout_percentage, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		release.Version, release.Model, release.Checksum, release.Size, binary, release.RolloutPercentage, release.Notes,
+	).Scan(&release.ID, &release.CreatedAt)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		respondError(c, http.StatusConflict, "release_exists", "Release already exists for this model and version")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create firmware release"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, release)
+}
+
+func (h *FirmwareHandler) GetReleases(c *gin.Context) {
+	query := "SELECT id, version, model, checksum, size, rollout_percentage, COALESCE(notes, ''), created_at FROM firmware_releases"
+	var args []interface{}
+	if model := c.Query("model"); model != "" {
+		query += " WHERE model = $1"
+		args = append(args, model)
+	}
+	page, args := pageClause(c, args)
+	query += " ORDER BY created_at DESC" + page
+
+	releases, err := h.queryReleases(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch firmware releases"})
+		return
+	}
+
+	c.JSON(http.StatusOK, releases)
+}
+
+func (h *FirmwareHandler) GetReleaseByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var release models.FirmwareRelease
+	err = h.db.QueryRow("SELECT id, version, model, checksum, size, rollout_percentage, COALESCE(notes, ''), created_at FROM firmware_releases WHERE id = $1", id).
+		Scan(&release.ID, &release.Version, &release.Model, &release.Checksum, &release.Size, &release.RolloutPercentage, &release.Notes, &release.CreatedAt)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "release_not_found", "Firmware release not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch firmware release"})
+		return
+	}
+
+	c.JSON(http.StatusOK, release)
+}
+
+func (h *FirmwareHandler) DownloadRelease(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var version, model, checksum string
+	var binary []byte
+	err = h.db.QueryRow("SELECT version, model, checksum, binary_data FROM firmware_releases WHERE id = $1", id).
+		Scan(&version, &model, &checksum, &binary)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "release_not_found", "Firmware release not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch firmware binary"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.bin"`, model, version))
+	c.Header("X-Checksum-SHA256", checksum)
+	c.Data(http.StatusOK, "application/octet-stream", binary)
+}
+
+func (h *FirmwareHandler) UpdateRollout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req models.RolloutUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.db.Exec("UPDATE firmware_releases SET rollout_percentage = $1 WHERE id = $2", *req.RolloutPercentage, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rollout"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "release_not_found", "Firmware release not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rollout updated successfully"})
+}
+
+func (h *FirmwareHandler) DeleteRelease(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM firmware_releases WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete firmware release"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "release_not_found", "Firmware release not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Firmware release deleted successfully"})
+}
+
+// CheckUpdate is polled by devices. It accepts the same headers the firmware
+// sends on POST (User-Agent, X-Device-ID); query parameters take precedence.
+func (h *FirmwareHandler) CheckUpdate(c *gin.Context) {
+	model, version := parseUserAgent(c.GetHeader("User-Agent"))
+	if v := c.Query("model"); v != "" {
+		model = v
+	}
+	if v := c.Query("version"); v != "" {
+		version = v
+	}
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		deviceID = c.GetHeader("X-Device-ID")
+	}
+
+	if deviceID == "" || model == "" || version == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id, model and version are required"})
+		return
+	}
+
+	releases, err := h.queryReleases("SELECT id, version, model, checksum, size, rollout_percentage, COALESCE(notes, ''), created_at FROM firmware_releases WHERE model = $1 AND rollout_percentage > 0", model)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch firmware releases"})
+		return
+	}
+
+	response := models.FirmwareCheckResponse{CurrentVersion: version}
+	var best *models.FirmwareRelease
+	for i := range releases {
+		r := &releases[i]
+		if compareVersions(r.Version, version) <= 0 || !inRollout(deviceID, r.Version, r.RolloutPercentage) {
+			continue
+		}
+		if best == nil || compareVersions(r.Version, best.Version) > 0 {
+			best = r
+		}
+	}
+	if best != nil {
+		response.UpdateAvailable = true
+		response.Version = best.Version
+		response.Checksum = best.Checksum
+		response.Size = best.Size
+		response.URL = fmt.Sprintf("/api/firmware/releases/%d/binary", best.ID)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *FirmwareHandler) queryReleases(query string, args ...interface{}) ([]models.FirmwareRelease, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var releases []models.FirmwareRelease
+	for rows.Next() {
+		var r models.FirmwareRelease
+		err := rows.Scan(&r.ID, &r.Version, &r.Model, &r.Checksum, &r.Size, &r.RolloutPercentage, &r.Notes, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return releases, rows.Err()
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"backend/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	model, version := parseUserAgent("M5StickCPlus2/1.0.0")
+	assert.Equal(t, "M5StickCPlus2", model)
+	assert.Equal(t, "1.0.0", version)
+
+	// ブラウザのUser-Agentはファームウェアとして扱わない
+	model, version = parseUserAgent("Mozilla/5.0 (X11; Linux x86_64)")
+	assert.Empty(t, model)
+	assert.Empty(t, version)
+
+	model, version = parseUserAgent("")
+	assert.Empty(t, model)
+	assert.Empty(t, version)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.0.0", "1.0.0"))
+	assert.Equal(t, 1, compareVersions("1.10.0", "1.9.2"))
+	assert.Equal(t, -1, compareVersions("1.0", "1.0.1"))
+	assert.Equal(t, 1, compareVersions("2.0.0-rc1", "1.9.9"))
+}
+
+func TestInRollout(t *testing.T) {
+	assert.False(t, inRollout("device-001", "1.1.0", 0))
+	assert.True(t, inRollout("device-001", "1.1.0", 100))
+
+	// 同じデバイスとバージョンでは常に同じ結果になる
+	assert.Equal(t, inRollout("device-001", "1.1.0", 50), inRollout("device-001", "1.1.0", 50))
+}
+
+func TestCreatePowerEvent_RecordsFirmwareFromUserAgent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WithArgs("device-001", "device-001", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "M5StickCPlus2", "1.0.0").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// ファームウェア履歴を記録
+	mock.ExpectExec("INSERT INTO device_firmware_history").
+		WithArgs("device-001", "1.0.0", "M5StickCPlus2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec("INSERT INTO power_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// ハンドラー作成
+	handler := NewPowerEventHandler(db)
+
+	// リクエスト作成
+	body, _ := json.Marshal(map[string]interface{}{"device_id": "device-001", "event_type": "power_on"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/power-events", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Set("User-Agent", "M5StickCPlus2/1.0.0")
+
+	// ハンドラー実行
+	handler.CreatePowerEvent(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDeviceFirmwareHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "device_id", "firmware_version", "model", "seen_at"}).
+		AddRow(2, "device-001", "1.1.0", "M5StickCPlus2", now).
+		AddRow(1, "device-001", "1.0.0", "M5StickCPlus2", now.Add(-24*time.Hour))
+
+	mock.ExpectQuery("SELECT (.+) FROM device_firmware_history WHERE device_id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(rows)
+
+	// ハンドラー作成
+	handler := NewFirmwareHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/devices/device-001/firmware-history", nil)
+	c.Params = gin.Params{{Key: "deviceId", Value: "device-001"}}
+
+	// ハンドラー実行
+	handler.GetDeviceFirmwareHistory(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var history []models.FirmwareHistoryEntry
+	err = json.Unmarshal(w.Body.Bytes(), &history)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "1.1.0", history[0].FirmwareVersion)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateRelease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	binary := []byte("firmware-binary")
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+
+	mock.ExpectQuery("INSERT INTO firmware_releases").
+		WithArgs("1.1.0", "M5StickCPlus2", checksum, int64(len(binary)), binary, 25, "bug fixes").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+	// ハンドラー作成
+	handler := NewFirmwareHandler(db)
+
+	// マルチパートリクエスト作成
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", "1.1.0")
+	writer.WriteField("model", "M5StickCPlus2")
+	writer.WriteField("rollout_percentage", "25")
+	writer.WriteField("notes", "bug fixes")
+	part, _ := writer.CreateFormFile("file", "firmware.bin")
+	part.Write(binary)
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/firmware/releases", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// ハンドラー実行
+	handler.CreateRelease(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var release models.FirmwareRelease
+	err = json.Unmarshal(w.Body.Bytes(), &release)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, release.ID)
+	assert.Equal(t, checksum, release.Checksum)
+	assert.Equal(t, 25, release.RolloutPercentage)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateRelease_MissingFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewFirmwareHandler(db)
+
+	// ファイルなしのリクエスト作成
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("version", "1.1.0")
+	writer.WriteField("model", "M5StickCPlus2")
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/firmware/releases", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// ハンドラー実行
+	handler.CreateRelease(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ（全台配布のリリースと、配布対象外の古いリリース）
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "version", "model", "checksum", "size", "rollout_percentage", "notes", "created_at"}).
+		AddRow(3, "1.2.0", "M5StickCPlus2", "abc", 1024, 100, "", now).
+		AddRow(2, "0.9.0", "M5StickCPlus2", "def", 1024, 100, "", now)
+
+	mock.ExpectQuery("SELECT (.+) FROM firmware_releases WHERE model = \\$1").
+		WithArgs("M5StickCPlus2").
+		WillReturnRows(rows)
+
+	// ハンドラー作成
+	handler := NewFirmwareHandler(db)
+
+	// デバイスと同じヘッダーでリクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/firmware/check", nil)
+	c.Request.Header.Set("User-Agent", "M5StickCPlus2/1.0.0")
+	c.Request.Header.Set("X-Device-ID", "device-001")
+
+	// ハンドラー実行
+	handler.CheckUpdate(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.FirmwareCheckResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.True(t, response.UpdateAvailable)
+	assert.Equal(t, "1.2.0", response.Version)
+	assert.Equal(t, "/api/firmware/releases/3/binary", response.URL)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUpdate_MissingDevice(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewFirmwareHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/firmware/check", nil)
+	c.Request.Header.Set("User-Agent", "M5StickCPlus2/1.0.0")
+
+	// ハンドラー実行
+	handler.CheckUpdate(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"backend/analysis"
+	"backend/maintenance"
+	"backend/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GrafanaHandler implements the Grafana JSON datasource protocol (search,
+// query, annotations) on top of power_events.
+type GrafanaHandler struct {
+	db *sql.DB
+}
+
+func NewGrafanaHandler(db *sql.DB) *GrafanaHandler {
+	return &GrafanaHandler{db: db}
+}
+
+const grafanaEventCount = "event_count"
+
+// Numeric data fields offered by search. Any other numeric field name can
+// still be queried.
+var grafanaMetrics = []string{grafanaEventCount, "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap", "uptime_ms"}
+
+// grafanaColumnMetrics have typed power_events columns; other metrics are
+// read from the data column.
+var grafanaColumnMetrics = map[string]bool{
+	"battery_percentage": true, "battery_voltage": true, "wifi_signal_strength": true, "free_heap": true, "uptime_ms": true,
+}
+
+var grafanaMetricName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// TestConnection answers the datasource's "Save & test".
+func (h *GrafanaHandler) TestConnection(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Search lists metrics, or device IDs and sites for the "devices" and
+// "sites" variable queries.
+func (h *GrafanaHandler) Search(c *gin.Context) {
+	var req models.GrafanaSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var query string
+	switch req.Target {
+	case "devices":
+		query = "SELECT id FROM devices ORDER BY id"
+	case "sites":
+		query = "SELECT DISTINCT site FROM devices WHERE site IS NOT NULL AND site <> '' ORDER BY site"
+	default:
+		metrics := []string{}
+		for _, m := range grafanaMetrics {
+			if strings.Contains(m, req.Target) {
+				metrics = append(metrics, m)
+			}
+		}
+		c.JSON(http.StatusOK, metrics)
+		return
+	}
+
+	rows, err := h.db.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan search result"})
+			return
+		}
+		values = append(values, v)
+	}
+	c.JSON(http.StatusOK, values)
+}
+
+// parseGrafanaTarget splits "metric" or "metric:device_id" and merges the
+// payload filter.
+func parseGrafanaTarget(t models.GrafanaTarget) (string, models.GrafanaTargetFilter, error) {
+	var filter models.GrafanaTargetFilter
+	if len(t.Payload) > 0 && t.Payload[0] == '{' {
+		if err := json.Unmarshal(t.Payload, &filter); err != nil {
+			return "", filter, fmt.Errorf("invalid payload for %s: %v", t.Target, err)
+		}
+	}
+
+	metric := t.Target
+	if i := strings.Index(metric, ":"); i >= 0 {
+		metric, filter.DeviceID = metric[:i], metric[i+1:]
+	}
+	if !grafanaMetricName.MatchString(metric) {
+		return "", filter, fmt.Errorf("invalid metric: %s", t.Target)
+	}
+	return metric, filter, nil
+}
+
+// grafanaInterval is the bucket width in seconds: the panel's interval, but
+// never more points than maxDataPoints and never below one second.
+func grafanaInterval(req models.GrafanaQueryRequest) float64 {
+	interval := float64(req.IntervalMs) / 1000
+	if req.MaxDataPoints > 0 {
+		if min := req.Range.To.Sub(req.Range.From).Seconds() / float64(req.MaxDataPoints); min > interval {
+			interval = min
+		}
+	}
+	return math.Max(math.Ceil(interval), 1)
+}
+
+type grafanaPoint struct {
+	deviceID string
+	bucket   float64
+	value    float64
+}
+
+// Query returns one series per device for each target, averaged per bucket
+// (event_count counts events), or a table when the target type is "table".
+func (h *GrafanaHandler) Query(c *gin.Context) {
+	var req models.GrafanaQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Range.From.Before(req.Range.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "range.from must be before range.to"})
+		return
+	}
+	interval := grafanaInterval(req)
+
+	results := []interface{}{}
+	for _, target := range req.Targets {
+		if target.Target == "" {
+			continue
+		}
+		metric, filter, err := parseGrafanaTarget(target)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		points, err := h.queryMetric(metric, filter, req.Range, interval)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query metric"})
+			return
+		}
+
+		if target.Type == "table" {
+			table := models.GrafanaTable{
+				Type:    "table",
+				Columns: []models.GrafanaColumn{{Text: "Time", Type: "time"}, {Text: "device_id", Type: "string"}, {Text: metric, Type: "number"}},
+				Rows:    [][]interface{}{},
+			}
+			for _, p := range points {
+				table.Rows = append(table.Rows, []interface{}{p.bucket * 1000, p.deviceID, p.value})
+			}
+			results = append(results, table)
+			continue
+		}
+
+		var series *models.GrafanaTimeSeries
+		for _, p := range points {
+			name := p.deviceID + " " + metric
+			if series == nil || series.Target != name {
+				results = append(results, &models.GrafanaTimeSeries{Target: name, Datapoints: [][2]float64{}})
+				series = results[len(results)-1].(*models.GrafanaTimeSeries)
+			}
+			series.Datapoints = append(series.Datapoints, [2]float64{p.value, p.bucket * 1000})
+		}
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+func (h *GrafanaHandler) queryMetric(metric string, filter models.GrafanaTargetFilter, r models.GrafanaRange, interval float64) ([]grafanaPoint, error) {
+	args := []interface{}{interval, r.From, r.To}
+	value := "COUNT(*)"
+	conditions := []string{"timestamp >= $2", "timestamp < $3"}
+	addCondition := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	switch {
+	case metric == grafanaEventCount:
+	case grafanaColumnMetrics[metric]:
+		// 既知の項目は型付きの列（メトリクス名は固定のリストから）
+		value = "AVG(" + metric + "::double precision)"
+		conditions = append(conditions, metric+" IS NOT NULL")
+	default:
+		args = append(args, metric)
+		n := len(args)
+		value = fmt.Sprintf("AVG((data->>$%d)::double precision)", n)
+		conditions = append(conditions, fmt.Sprintf("jsonb_typeof(data->$%d) = 'number'", n))
+	}
+	if filter.DeviceID != "" {
+		addCondition("device_id = $%d", filter.DeviceID)
+	}
+	if filter.Site != "" {
+		addCondition("device_id IN (SELECT id FROM devices WHERE site = $%d)", filter.Site)
+	}
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+
+	rows, err := h.db.Query(`
+		SELECT device_id, floor(extract(epoch FROM timestamp) / $1) * $1 AS bucket, `+value+`
+		FROM power_events
+		WHERE `+strings.Join(conditions, " AND ")+`
+		GROUP BY device_id, bucket
+		ORDER BY device_id, bucket`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []grafanaPoint
+	for rows.Next() {
+		var p grafanaPoint
+		if err := rows.Scan(&p.deviceID, &p.bucket, &p.value); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// parseAnnotationQuery reads "site=<site> device_id=<id>" filters from the
+// annotation's query text.
+func parseAnnotationQuery(query string) (models.GrafanaTargetFilter, error) {
+	var filter models.GrafanaTargetFilter
+	for _, part := range strings.Fields(query) {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return filter, fmt.Errorf("invalid annotation filter: %s", part)
+		}
+		switch key {
+		case "site":
+			filter.Site = value
+		case "device_id", "device":
+			filter.DeviceID = value
+		default:
+			return filter, fmt.Errorf("unknown annotation filter: %s", key)
+		}
+	}
+	return filter, nil
+}
+
+// Annotations returns power outages (power_off until the next power_on)
+// overlapping the range. Outages still in progress end at the range end, and
+// ones that began during maintenance are tagged "maintenance".
+func (h *GrafanaHandler) Annotations(c *gin.Context) {
+	var req models.GrafanaAnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Range.From.Before(req.Range.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "range.from must be before range.to"})
+		return
+	}
+	filter, err := parseAnnotationQuery(req.Annotation.Query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	histories, err := h.loadPowerHistories(filter, req.Range.From, req.Range.To)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch power events"})
+		return
+	}
+	if len(histories) > 0 {
+		windows, err := maintenance.LoadWindows(h.db, req.Range.From, req.Range.To)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch maintenance windows"})
+			return
+		}
+		maintenance.Attach(histories, windows, req.Range.From, req.Range.To)
+	}
+
+	annotations := []models.GrafanaAnnotation{}
+	for _, history := range histories {
+		for _, o := range analysis.FindOutages(history, req.Range.From, req.Range.To) {
+			end, text := req.Range.To, "Power not restored"
+			if o.End != nil {
+				end = *o.End
+				text = "Power restored after " + end.Sub(o.Start).Round(time.Second).String()
+			}
+			title, tags := "Power outage: "+o.DeviceID, []string{"outage", o.DeviceID}
+			if o.Site != "" {
+				tags = append(tags, o.Site)
+			}
+			if o.Expected {
+				title, tags = "Planned outage: "+o.DeviceID, append(tags, "maintenance")
+			}
+			annotations = append(annotations, models.GrafanaAnnotation{
+				Annotation: req.Annotation,
+				Time:       o.Start.UnixMilli(),
+				TimeEnd:    end.UnixMilli(),
+				Title:      title,
+				Text:       text,
+				Tags:       tags,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, annotations)
+}
+
+// loadPowerHistories loads only power_on/power_off events, with each device's
+// power state (and when it was reported) just before from.
+func (h *GrafanaHandler) loadPowerHistories(filter models.GrafanaTargetFilter, from, to time.Time) ([]analysis.DeviceHistory, error) {
+	args := []interface{}{from}
+	var conditions []string
+	addCondition := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.DeviceID != "" {
+		addCondition("d.id = $%d", filter.DeviceID)
+	}
+	if filter.Site != "" {
+		addCondition("d.site = $%d", filter.Site)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := h.db.Query(`
+		SELECT d.id, COALESCE(d.site, ''), COALESCE(d.device_group, ''), COALESCE(p.event_type, ''), p.timestamp
+		FROM devices d
+		LEFT JOIN LATERAL (
+			SELECT event_type, timestamp FROM power_events
+			WHERE device_id = d.id AND timestamp < $1 AND event_type IN ('power_on', 'power_off')
+			ORDER BY timestamp DESC LIMIT 1
+		) p ON true`+where+`
+		ORDER BY d.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var histories []analysis.DeviceHistory
+	index := map[string]int{}
+	for rows.Next() {
+		var h analysis.DeviceHistory
+		if err := rows.Scan(&h.DeviceID, &h.Site, &h.Group, &h.PriorPowerState, &h.PriorPowerStateAt); err != nil {
+			return nil, err
+		}
+		index[h.DeviceID] = len(histories)
+		histories = append(histories, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(histories) == 0 {
+		return nil, nil
+	}
+
+	eventRows, err := h.db.Query(`
+		SELECT device_id, event_type, timestamp FROM power_events
+		WHERE timestamp >= $1 AND timestamp < $2 AND event_type IN ('power_on', 'power_off')
+		ORDER BY device_id, timestamp`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer eventRows.Close()
+
+	for eventRows.Next() {
+		var e analysis.Event
+		if err := eventRows.Scan(&e.DeviceID, &e.EventType, &e.Timestamp); err != nil {
+			return nil, err
+		}
+		if i, ok := index[e.DeviceID]; ok {
+			histories[i].Events = append(histories[i].Events, e)
+		}
+	}
+	return histories, eventRows.Err()
+}
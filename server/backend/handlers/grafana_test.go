@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func grafanaRequest(handler gin.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler(c)
+	return w
+}
+
+func TestGrafanaSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT DISTINCT site FROM devices").
+		WillReturnRows(sqlmock.NewRows([]string{"site"}).AddRow("osaka-office").AddRow("tokyo-office"))
+
+	// ハンドラー作成
+	handler := NewGrafanaHandler(db)
+
+	// メトリクス一覧
+	w := grafanaRequest(handler.Search, "/api/grafana/search", `{"target": "battery"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `["battery_percentage", "battery_voltage"]`, w.Body.String())
+
+	// 変数用のサイト一覧
+	w = grafanaRequest(handler.Search, "/api/grafana/search", `{"target": "sites"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `["osaka-office", "tokyo-office"]`, w.Body.String())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGrafanaQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	bucket := float64(from.Unix())
+
+	// 1時間を最大12点 → 300秒のバケット（既知の項目は型付きの列から）
+	mock.ExpectQuery("SELECT device_id, floor\\(extract\\(epoch FROM timestamp\\) / \\$1\\) \\* \\$1 AS bucket, AVG\\(battery_percentage::double precision\\)(.+)battery_percentage IS NOT NULL").
+		WithArgs(300.0, from, to, "tokyo-office").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "bucket", "value"}).
+			AddRow("device-001", bucket, 85.0).
+			AddRow("device-001", bucket+300, 84.5).
+			AddRow("device-002", bucket, 60.0))
+	mock.ExpectQuery("SELECT device_id, (.+) COUNT\\(\\*\\)").
+		WithArgs(300.0, from, to, "device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "bucket", "value"}).
+			AddRow("device-001", bucket, 5.0))
+
+	// ハンドラー作成
+	handler := NewGrafanaHandler(db)
+
+	// リクエスト作成
+	body := `{
+		"range": {"from": "2024-01-01T00:00:00Z", "to": "2024-01-01T01:00:00Z"},
+		"intervalMs": 60000,
+		"maxDataPoints": 12,
+		"targets": [
+			{"target": "battery_percentage", "refId": "A", "payload": {"site": "tokyo-office"}},
+			{"target": "event_count:device-001", "refId": "B", "type": "table"}
+		]
+	}`
+	w := grafanaRequest(handler.Query, "/api/grafana/query", body)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 3)
+	assert.Equal(t, "device-001 battery_percentage", response[0]["target"])
+	assert.Equal(t, []interface{}{85.0, bucket * 1000}, response[0]["datapoints"].([]interface{})[0])
+	assert.Len(t, response[0]["datapoints"], 2)
+	assert.Equal(t, "device-002 battery_percentage", response[1]["target"])
+	assert.Equal(t, "table", response[2]["type"])
+	assert.Equal(t, []interface{}{bucket * 1000, "device-001", 5.0}, response[2]["rows"].([]interface{})[0])
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGrafanaQuery_DataFieldMetric(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	// 列のない項目は data から読む（項目名は引数で渡す）
+	mock.ExpectQuery("AVG\\(\\(data->>\\$4\\)::double precision\\)(.+)jsonb_typeof\\(data->\\$4\\) = 'number'").
+		WithArgs(60.0, from, to, "previous_uptime_ms").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "bucket", "value"}))
+
+	// ハンドラー作成
+	handler := NewGrafanaHandler(db)
+
+	// リクエスト作成
+	body := `{
+		"range": {"from": "2024-01-01T00:00:00Z", "to": "2024-01-01T01:00:00Z"},
+		"intervalMs": 60000,
+		"targets": [{"target": "previous_uptime_ms", "refId": "A"}]
+	}`
+	w := grafanaRequest(handler.Query, "/api/grafana/query", body)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGrafanaQuery_InvalidMetric(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewGrafanaHandler(db)
+
+	body := `{"range": {"from": "2024-01-01T00:00:00Z", "to": "2024-01-01T01:00:00Z"}, "targets": [{"target": "data'); DROP TABLE devices; --"}]}`
+	w := grafanaRequest(handler.Query, "/api/grafana/query", body)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGrafanaAnnotations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	priorOff := from.Add(-10 * time.Minute)
+
+	mock.ExpectQuery("SELECT d.id, COALESCE\\(d.site, ''\\), COALESCE\\(d.device_group, ''\\), COALESCE\\(p.event_type, ''\\), p.timestamp").
+		WithArgs(from, "tokyo-office").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "site", "device_group", "event_type", "timestamp"}).
+			AddRow("device-001", "tokyo-office", "", "power_on", from.Add(-time.Hour)).
+			AddRow("device-002", "tokyo-office", "", "power_off", priorOff).
+			AddRow("device-003", "tokyo-office", "rack-a", "power_on", from.Add(-time.Hour)))
+	mock.ExpectQuery("SELECT device_id, event_type, timestamp FROM power_events").
+		WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "event_type", "timestamp"}).
+			AddRow("device-001", "power_off", from.Add(10*time.Minute)).
+			AddRow("device-001", "power_on", from.Add(25*time.Minute)).
+			AddRow("device-003", "power_off", from.Add(40*time.Minute)).
+			AddRow("device-003", "power_on", from.Add(45*time.Minute)))
+	// rack-a は 35分〜50分がメンテナンス
+	mock.ExpectQuery("SELECT (.+) FROM maintenance_windows").
+		WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "scope_type", "scope_key", "starts_at", "ends_at", "recurrence", "recurrence_until", "reason", "created_at"}).
+			AddRow(1, "ラック入れ替え", "group", "rack-a", from.Add(35*time.Minute), from.Add(50*time.Minute), "none", nil, "", from))
+
+	// ハンドラー作成
+	handler := NewGrafanaHandler(db)
+
+	// リクエスト作成
+	body := `{"range": {"from": "2024-01-01T00:00:00Z", "to": "2024-01-01T01:00:00Z"}, "annotation": {"name": "outages", "enable": true, "query": "site=tokyo-office"}}`
+	w := grafanaRequest(handler.Annotations, "/api/grafana/annotations", body)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 3)
+	assert.Equal(t, "Power outage: device-001", response[0]["title"])
+	assert.Equal(t, float64(from.Add(10*time.Minute).UnixMilli()), response[0]["time"])
+	assert.Equal(t, float64(from.Add(25*time.Minute).UnixMilli()), response[0]["timeEnd"])
+	assert.Equal(t, "Power restored after 15m0s", response[0]["text"])
+	assert.Equal(t, []interface{}{"outage", "device-001", "tokyo-office"}, response[0]["tags"])
+
+	// 期間前から続いて復旧していない停電
+	assert.Equal(t, float64(priorOff.UnixMilli()), response[1]["time"])
+	assert.Equal(t, float64(to.UnixMilli()), response[1]["timeEnd"])
+	assert.Equal(t, "Power not restored", response[1]["text"])
+
+	// メンテナンス中の停電はラベルを付ける
+	assert.Equal(t, "Planned outage: device-003", response[2]["title"])
+	assert.Equal(t, []interface{}{"outage", "device-003", "tokyo-office", "maintenance"}, response[2]["tags"])
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
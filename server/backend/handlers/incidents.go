@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IncidentHandler struct {
+	db *sql.DB
+}
+
+func NewIncidentHandler(db *sql.DB) *IncidentHandler {
+	return &IncidentHandler{db: db}
+}
+
+const incidentColumns = "id, scope_type, scope_key, classification, device_count, started_at, last_event_at, resolved_at, status, assignee, root_cause, acknowledged_at"
+
+func scanIncident(row rowScanner, incident *models.Incident) error {
+	return row.Scan(&incident.ID, &incident.ScopeType, &incident.ScopeKey, &incident.Classification, &incident.DeviceCount,
+		&incident.StartedAt, &incident.LastEventAt, &incident.ResolvedAt, &incident.Status, &incident.Assignee, &incident.RootCause,
+		&incident.AcknowledgedAt)
+}
+
+const incidentHistoryColumns = "id, incident_id, action, actor, device_id, value, comment, created_at"
+
+func scanIncidentHistory(row rowScanner, entry *models.IncidentHistoryEntry) error {
+	return row.Scan(&entry.ID, &entry.IncidentID, &entry.Action, &entry.Actor, &entry.DeviceID, &entry.Value, &entry.Comment, &entry.CreatedAt)
+}
+
+func validRootCause(v string) bool {
+	switch v {
+	case models.RootCauseUtilityOutage, models.RootCauseBreakerTrip, models.RootCauseUnplugged, models.RootCauseDeviceFault:
+		return true
+	}
+	return false
+}
+
+func parseIncidentID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *IncidentHandler) GetIncidents(c *gin.Context) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	switch status := c.Query("status"); status {
+	case "":
+	case models.IncidentOpen, models.IncidentAcknowledged, models.IncidentResolved:
+		addCondition("status = $%d", status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, acknowledged or resolved"})
+		return
+	}
+	if v := c.Query("classification"); v != "" {
+		addCondition("classification = $%d", v)
+	}
+	if v := c.Query("site"); v != "" {
+		addCondition("scope_type = 'site' AND scope_key = $%d", v)
+	}
+	if v := c.Query("group"); v != "" {
+		addCondition("scope_type = 'group' AND scope_key = $%d", v)
+	}
+	if v := c.Query("root_cause"); v != "" {
+		addCondition("root_cause = $%d", v)
+	}
+	if v := c.Query("assignee"); v != "" {
+		addCondition("assignee = $%d", v)
+	}
+
+	query := "SELECT " + incidentColumns + " FROM incidents"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	page, args := pageClause(c, args)
+	if page == "" {
+		page = " LIMIT 100"
+	}
+	query += " ORDER BY started_at DESC" + page
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incidents"})
+		return
+	}
+	defer rows.Close()
+
+	var incidents []models.Incident
+	for rows.Next() {
+		var incident models.Incident
+		if err := scanIncident(rows, &incident); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan incident"})
+			return
+		}
+		incidents = append(incidents, incident)
+	}
+
+	c.JSON(http.StatusOK, incidents)
+}
+
+// respondIncident writes the incident with its devices, or 404.
+func (h *IncidentHandler) respondIncident(c *gin.Context, id int, status int) {
+	var incident models.Incident
+	err := scanIncident(h.db.QueryRow("SELECT "+incidentColumns+" FROM incidents WHERE id = $1", id), &incident)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "incident_not_found", "Incident not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+
+	rows, err := h.db.Query("SELECT incident_id, device_id, power_off_at, power_on_at FROM incident_devices WHERE incident_id = $1 ORDER BY power_off_at", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident devices"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var device models.IncidentDevice
+		if err := rows.Scan(&device.IncidentID, &device.DeviceID, &device.PowerOffAt, &device.PowerOnAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan incident device"})
+			return
+		}
+		incident.Devices = append(incident.Devices, device)
+	}
+
+	c.JSON(status, incident)
+}
+
+func (h *IncidentHandler) GetIncidentByID(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	h.respondIncident(c, id, http.StatusOK)
+}
+
+// finishTransition responds to a guarded status change: the updated
+// incident when a row changed, otherwise 404 or 409 with the current status.
+func (h *IncidentHandler) finishTransition(c *gin.Context, id int, result sql.Result, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update incident"})
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		var status string
+		err := h.db.QueryRow("SELECT status FROM incidents WHERE id = $1", id).Scan(&status)
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "incident_not_found", "Incident not found")
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+			return
+		}
+		respondError(c, http.StatusConflict, "incident_state_conflict", "Incident is " + status)
+		return
+	}
+	h.respondIncident(c, id, http.StatusOK)
+}
+
+// AcknowledgeIncident moves an open incident to acknowledged, optionally
+// assigning it.
+func (h *IncidentHandler) AcknowledgeIncident(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	var req models.IncidentAcknowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		WITH updated AS (
+			UPDATE incidents SET status = '`+models.IncidentAcknowledged+`', acknowledged_at = $2,
+				assignee = COALESCE(NULLIF($3, ''), assignee)
+			WHERE id = $1 AND status = '`+models.IncidentOpen+`'
+			RETURNING id
+		)
+		INSERT INTO incident_history (incident_id, action, actor, value, created_at)
+		SELECT id, '`+models.IncidentActionAcknowledged+`', $4, NULLIF($3, ''), $2 FROM updated`,
+		id, time.Now(), req.Assignee, req.Actor,
+	)
+	h.finishTransition(c, id, result, err)
+}
+
+// ResolveIncident closes an incident by hand, e.g. when a device will not
+// come back. The root cause can be set at the same time.
+func (h *IncidentHandler) ResolveIncident(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	var req models.IncidentResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RootCause != "" && !validRootCause(req.RootCause) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "root_cause must be utility_outage, breaker_trip, unplugged or device_fault"})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		WITH updated AS (
+			UPDATE incidents SET status = '`+models.IncidentResolved+`', resolved_at = $2,
+				root_cause = COALESCE(NULLIF($3, ''), root_cause)
+			WHERE id = $1 AND status <> '`+models.IncidentResolved+`'
+			RETURNING id
+		)
+		INSERT INTO incident_history (incident_id, action, actor, value, comment, created_at)
+		SELECT id, '`+models.IncidentActionResolved+`', $4, NULLIF($3, ''), $5, $2 FROM updated`,
+		id, time.Now(), req.RootCause, req.Actor, req.Comment,
+	)
+	h.finishTransition(c, id, result, err)
+}
+
+// ReopenIncident returns a resolved incident to acknowledged, or to open if
+// nobody had acknowledged it.
+func (h *IncidentHandler) ReopenIncident(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	var req models.IncidentReopenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		WITH updated AS (
+			UPDATE incidents SET resolved_at = NULL,
+				status = CASE WHEN acknowledged_at IS NULL THEN '`+models.IncidentOpen+`' ELSE '`+models.IncidentAcknowledged+`' END
+			WHERE id = $1 AND status = '`+models.IncidentResolved+`'
+			RETURNING id
+		)
+		INSERT INTO incident_history (incident_id, action, actor, comment, created_at)
+		SELECT id, '`+models.IncidentActionReopened+`', $2, $3, $4 FROM updated`,
+		id, req.Actor, req.Comment, time.Now(),
+	)
+	h.finishTransition(c, id, result, err)
+}
+
+// UpdateIncident sets the assignee and/or root cause. Each change is
+// recorded in the history.
+func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	var req models.IncidentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RootCause != nil && *req.RootCause != "" && !validRootCause(*req.RootCause) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "root_cause must be utility_outage, breaker_trip, unplugged or device_fault"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update incident"})
+		return
+	}
+	defer tx.Rollback()
+
+	var assignee, rootCause sql.NullString
+	err = tx.QueryRow("SELECT assignee, root_cause FROM incidents WHERE id = $1 FOR UPDATE", id).Scan(&assignee, &rootCause)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "incident_not_found", "Incident not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+
+	now := time.Now()
+	changes := []struct {
+		column  string
+		action  string
+		current sql.NullString
+		value   *string
+	}{
+		{"assignee", models.IncidentActionAssigned, assignee, req.Assignee},
+		{"root_cause", models.IncidentActionRootCause, rootCause, req.RootCause},
+	}
+	for _, change := range changes {
+		if change.value == nil || *change.value == change.current.String {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE incidents SET "+change.column+" = NULLIF($1, '') WHERE id = $2", *change.value, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update incident"})
+			return
+		}
+		_, err := tx.Exec("INSERT INTO incident_history (incident_id, action, actor, value, created_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5)",
+			id, change.action, req.Actor, *change.value, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record incident history"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update incident"})
+		return
+	}
+	h.respondIncident(c, id, http.StatusOK)
+}
+
+func (h *IncidentHandler) AddIncidentComment(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	var req models.IncidentCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entry models.IncidentHistoryEntry
+	err := scanIncidentHistory(h.db.QueryRow(`
+		INSERT INTO incident_history (incident_id, action, actor, comment, created_at)
+		SELECT id, '`+models.IncidentActionCommented+`', $2, $3, $4 FROM incidents WHERE id = $1
+		RETURNING `+incidentHistoryColumns,
+		id, req.Author, req.Body, time.Now(),
+	), &entry)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "incident_not_found", "Incident not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetIncidentHistory is the incident's timeline, oldest first.
+func (h *IncidentHandler) GetIncidentHistory(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM incidents WHERE id = $1)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, "incident_not_found", "Incident not found")
+		return
+	}
+
+	page, args := pageClause(c, []interface{}{id})
+	rows, err := h.db.Query("SELECT "+incidentHistoryColumns+" FROM incident_history WHERE incident_id = $1 ORDER BY created_at, id"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident history"})
+		return
+	}
+	defer rows.Close()
+
+	history := []models.IncidentHistoryEntry{}
+	for rows.Next() {
+		var entry models.IncidentHistoryEntry
+		if err := scanIncidentHistory(rows, &entry); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan incident history"})
+			return
+		}
+		history = append(history, entry)
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetIncidentSummary groups incidents started in the period by scope and
+// root cause, with downtime and mean times to acknowledge and resolve.
+// Unresolved incidents count their downtime up to now.
+func (h *IncidentHandler) GetIncidentSummary(c *gin.Context) {
+	from, to, err := parsePeriod(c, 30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	args := []interface{}{from, to, time.Now()}
+	where := "started_at >= $1 AND started_at < $2"
+	if v := c.Query("site"); v != "" {
+		args = append(args, v)
+		where += fmt.Sprintf(" AND scope_type = 'site' AND scope_key = $%d", len(args))
+	}
+
+	rows, err := h.db.Query(`
+		SELECT scope_type, scope_key, COALESCE(root_cause, ''), COUNT(*),
+			COUNT(*) FILTER (WHERE status <> '`+models.IncidentResolved+`'),
+			COALESCE(SUM(EXTRACT(EPOCH FROM (COALESCE(resolved_at, $3) - started_at))), 0),
+			AVG(EXTRACT(EPOCH FROM (acknowledged_at - started_at))),
+			AVG(EXTRACT(EPOCH FROM (resolved_at - started_at)))
+		FROM incidents
+		WHERE `+where+`
+		GROUP BY scope_type, scope_key, COALESCE(root_cause, '')
+		ORDER BY scope_type, scope_key, COALESCE(root_cause, '')`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize incidents"})
+		return
+	}
+	defer rows.Close()
+
+	summaries := []models.IncidentSummary{}
+	for rows.Next() {
+		var s models.IncidentSummary
+		if err := rows.Scan(&s.ScopeType, &s.ScopeKey, &s.RootCause, &s.Count, &s.OpenCount, &s.DowntimeSeconds,
+			&s.MeanTimeToAckSeconds, &s.MeanTimeToResolveSeconds); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan incident summary"})
+			return
+		}
+		summaries = append(summaries, s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "summaries": summaries})
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"backend/correlation"
+	"backend/ingest"
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var incidentRowColumns = []string{"id", "scope_type", "scope_key", "classification", "device_count", "started_at", "last_event_at", "resolved_at",
+	"status", "assignee", "root_cause", "acknowledged_at"}
+
+func TestGetIncidents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	now := time.Now()
+	rows := sqlmock.NewRows(incidentRowColumns).
+		AddRow(1, "site", "tokyo-office", models.IncidentSiteOutage, 20, now, now.Add(30*time.Second), nil, "open", nil, nil, nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM incidents WHERE status = \\$1 AND scope_type = 'site' AND scope_key = \\$2").
+		WithArgs("open", "tokyo-office").
+		WillReturnRows(rows)
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/incidents?status=open&site=tokyo-office", nil)
+
+	// ハンドラー実行
+	handler.GetIncidents(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var incidents []models.Incident
+	err = json.Unmarshal(w.Body.Bytes(), &incidents)
+	assert.NoError(t, err)
+	assert.Len(t, incidents, 1)
+	assert.Equal(t, models.IncidentSiteOutage, incidents[0].Classification)
+	assert.Equal(t, 20, incidents[0].DeviceCount)
+	assert.Nil(t, incidents[0].ResolvedAt)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetIncidents_InvalidStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/incidents?status=unknown", nil)
+
+	// ハンドラー実行
+	handler.GetIncidents(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetIncidentByID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM incidents WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(incidentRowColumns).
+			AddRow(1, "site", "tokyo-office", models.IncidentSiteOutage, 2, now, now.Add(10*time.Second), now.Add(time.Hour),
+				"resolved", "tanaka", models.RootCauseUtilityOutage, now.Add(5*time.Minute)))
+
+	mock.ExpectQuery("SELECT (.+) FROM incident_devices WHERE incident_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"incident_id", "device_id", "power_off_at", "power_on_at"}).
+			AddRow(1, "device-001", now, now.Add(time.Hour)).
+			AddRow(1, "device-002", now.Add(10*time.Second), now.Add(time.Hour)))
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/incidents/1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	// ハンドラー実行
+	handler.GetIncidentByID(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var incident models.Incident
+	err = json.Unmarshal(w.Body.Bytes(), &incident)
+	assert.NoError(t, err)
+	assert.Len(t, incident.Devices, 2)
+	assert.Equal(t, "device-002", incident.Devices[1].DeviceID)
+	assert.NotNil(t, incident.ResolvedAt)
+	assert.Equal(t, models.IncidentResolved, incident.Status)
+	assert.Equal(t, models.RootCauseUtilityOutage, *incident.RootCause)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetIncidentByID_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM incidents WHERE id = \\$1").
+		WithArgs(999).
+		WillReturnRows(sqlmock.NewRows(incidentRowColumns))
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/incidents/999", nil)
+	c.Params = gin.Params{{Key: "id", Value: "999"}}
+
+	// ハンドラー実行
+	handler.GetIncidentByID(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePowerEvent_CorrelationFailureStillStoresEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// インシデント集約が失敗してもイベントは受け付ける
+	mock.ExpectBegin().WillReturnError(errors.New("connection reset"))
+
+	// ハンドラー作成
+	handler := NewPowerEventHandler(db, WithPipeline(ingest.NewPipeline(db, ingest.WithCorrelator(correlation.NewCorrelator(db, time.Minute, 2)))))
+
+	// リクエスト作成
+	body, _ := json.Marshal(map[string]interface{}{"device_id": "device-001", "event_type": "power_off"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/power-events", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreatePowerEvent(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 更新後に返すインシデント詳細の問い合わせ
+func expectIncidentDetail(mock sqlmock.Sqlmock, id int, status, assignee string) {
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM incidents WHERE id = \\$1").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(incidentRowColumns).
+			AddRow(id, "site", "tokyo-office", models.IncidentSiteOutage, 2, now, now, nil, status, assignee, nil, now))
+	mock.ExpectQuery("SELECT (.+) FROM incident_devices WHERE incident_id = \\$1").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"incident_id", "device_id", "power_off_at", "power_on_at"}))
+}
+
+func incidentRequest(method, path, id, body string) (*httptest.ResponseRecorder, *gin.Context) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(method, path, bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	return w, c
+}
+
+func TestAcknowledgeIncident(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE incidents SET status = 'acknowledged'(.+)WHERE id = \\$1 AND status = 'open'(.+)INSERT INTO incident_history").
+		WithArgs(1, sqlmock.AnyArg(), "tanaka", "suzuki").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectIncidentDetail(mock, 1, models.IncidentAcknowledged, "tanaka")
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w, c := incidentRequest("POST", "/api/incidents/1/acknowledge", "1", `{"actor": "suzuki", "assignee": "tanaka"}`)
+
+	// ハンドラー実行
+	handler.AcknowledgeIncident(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var incident models.Incident
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &incident))
+	assert.Equal(t, models.IncidentAcknowledged, incident.Status)
+	assert.Equal(t, "tanaka", *incident.Assignee)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAcknowledgeIncident_AlreadyResolved(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE incidents SET status = 'acknowledged'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT status FROM incidents WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.IncidentResolved))
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w, c := incidentRequest("POST", "/api/incidents/1/acknowledge", "1", `{"actor": "suzuki"}`)
+
+	// ハンドラー実行
+	handler.AcknowledgeIncident(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveIncident_InvalidRootCause(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w, c := incidentRequest("POST", "/api/incidents/1/resolve", "1", `{"actor": "suzuki", "root_cause": "cosmic_rays"}`)
+
+	// ハンドラー実行
+	handler.ResolveIncident(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateIncident_RecordsChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 担当者は変わらず、原因だけが記録される
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT assignee, root_cause FROM incidents WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"assignee", "root_cause"}).AddRow("tanaka", nil))
+	mock.ExpectExec("UPDATE incidents SET root_cause = NULLIF\\(\\$1, ''\\) WHERE id = \\$2").
+		WithArgs(models.RootCauseBreakerTrip, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO incident_history").
+		WithArgs(1, models.IncidentActionRootCause, "suzuki", models.RootCauseBreakerTrip, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectIncidentDetail(mock, 1, models.IncidentAcknowledged, "tanaka")
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w, c := incidentRequest("PUT", "/api/incidents/1", "1", `{"actor": "suzuki", "assignee": "tanaka", "root_cause": "breaker_trip"}`)
+
+	// ハンドラー実行
+	handler.UpdateIncident(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetIncidentHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT (.+) FROM incident_history WHERE incident_id = \\$1 ORDER BY created_at, id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "incident_id", "action", "actor", "device_id", "value", "comment", "created_at"}).
+			AddRow(1, 1, models.IncidentActionOpened, "system", nil, nil, "", now).
+			AddRow(2, 1, models.IncidentActionDeviceDown, "system", "device-001", nil, "", now).
+			AddRow(3, 1, models.IncidentActionCommented, "suzuki", nil, nil, "分電盤のブレーカーが落ちていた", now.Add(time.Minute)))
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w, c := incidentRequest("GET", "/api/incidents/1/history", "1", "")
+
+	// ハンドラー実行
+	handler.GetIncidentHistory(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []models.IncidentHistoryEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 3)
+	assert.Equal(t, "device-001", *history[1].DeviceID)
+	assert.Equal(t, "分電盤のブレーカーが落ちていた", history[2].Comment)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddIncidentComment_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("INSERT INTO incident_history").
+		WithArgs(999, "suzuki", "確認中", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "incident_id", "action", "actor", "device_id", "value", "comment", "created_at"}))
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w, c := incidentRequest("POST", "/api/incidents/999/comments", "999", `{"author": "suzuki", "body": "確認中"}`)
+
+	// ハンドラー実行
+	handler.AddIncidentComment(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetIncidentSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT scope_type, scope_key, COALESCE\\(root_cause, ''\\), COUNT\\(\\*\\)(.+)FROM incidents(.+)GROUP BY").
+		WithArgs(from, to, sqlmock.AnyArg(), "tokyo-office").
+		WillReturnRows(sqlmock.NewRows([]string{"scope_type", "scope_key", "root_cause", "count", "open_count", "downtime", "mtta", "mttr"}).
+			AddRow("site", "tokyo-office", "", 1, 1, 600.0, nil, nil).
+			AddRow("site", "tokyo-office", models.RootCauseBreakerTrip, 3, 0, 5400.0, 120.0, 1800.0))
+
+	// ハンドラー作成
+	handler := NewIncidentHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/incidents/summary?from=2024-01-01&to=2024-02-01&site=tokyo-office", nil)
+
+	// ハンドラー実行
+	handler.GetIncidentSummary(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Summaries []models.IncidentSummary `json:"summaries"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Summaries, 2)
+	assert.Nil(t, response.Summaries[0].MeanTimeToAckSeconds)
+	assert.Equal(t, 3, response.Summaries[1].Count)
+	assert.InDelta(t, 1800, *response.Summaries[1].MeanTimeToResolveSeconds, 0.001)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"backend/maintenance"
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MaintenanceHandler struct {
+	db *sql.DB
+}
+
+func NewMaintenanceHandler(db *sql.DB) *MaintenanceHandler {
+	return &MaintenanceHandler{db: db}
+}
+
+func parseMaintenanceWindowID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid maintenance window ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetMaintenanceWindows lists windows, optionally only those covering now
+// (active=true) or those with a given scope.
+func (h *MaintenanceHandler) GetMaintenanceWindows(c *gin.Context) {
+	args := []interface{}{}
+	var conditions []string
+	addCondition := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+	if v := c.Query("scope_type"); v != "" {
+		addCondition("scope_type = $%d", v)
+	}
+	if v := c.Query("scope_key"); v != "" {
+		addCondition("scope_key = $%d", v)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page, args := pageClause(c, args)
+	rows, err := h.db.Query("SELECT "+maintenance.WindowColumns+" FROM maintenance_windows"+where+" ORDER BY starts_at DESC"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch maintenance windows"})
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	activeOnly := c.Query("active") == "true"
+	windows := []models.MaintenanceWindow{}
+	for rows.Next() {
+		var w models.MaintenanceWindow
+		if err := maintenance.ScanWindow(rows, &w); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan maintenance window"})
+			return
+		}
+		w.Active = maintenance.ActiveAt(w, now)
+		if activeOnly && !w.Active {
+			continue
+		}
+		windows = append(windows, w)
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+func (h *MaintenanceHandler) GetMaintenanceWindowByID(c *gin.Context) {
+	id, ok := parseMaintenanceWindowID(c)
+	if !ok {
+		return
+	}
+
+	var w models.MaintenanceWindow
+	err := maintenance.ScanWindow(h.db.QueryRow("SELECT "+maintenance.WindowColumns+" FROM maintenance_windows WHERE id = $1", id), &w)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "maintenance_window_not_found", "Maintenance window not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch maintenance window"})
+		return
+	}
+	w.Active = maintenance.ActiveAt(w, time.Now())
+
+	c.JSON(http.StatusOK, w)
+}
+
+func bindMaintenanceWindowRequest(c *gin.Context) (*models.MaintenanceWindowRequest, bool) {
+	var req models.MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := maintenance.Validate(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+func (h *MaintenanceHandler) CreateMaintenanceWindow(c *gin.Context) {
+	req, ok := bindMaintenanceWindowRequest(c)
+	if !ok {
+		return
+	}
+
+	var w models.MaintenanceWindow
+	err := maintenance.ScanWindow(h.db.QueryRow(`
+		INSERT INTO maintenance_windows (name, scope_type, scope_key, starts_at, ends_at, recurrence, recurrence_until, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+maintenance.WindowColumns,
+		req.Name, req.ScopeType, req.ScopeKey, req.StartsAt, req.EndsAt, req.Recurrence, req.RecurrenceUntil, req.Reason,
+	), &w)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create maintenance window"})
+		return
+	}
+	w.Active = maintenance.ActiveAt(w, time.Now())
+
+	c.JSON(http.StatusCreated, w)
+}
+
+func (h *MaintenanceHandler) UpdateMaintenanceWindow(c *gin.Context) {
+	id, ok := parseMaintenanceWindowID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindMaintenanceWindowRequest(c)
+	if !ok {
+		return
+	}
+
+	var w models.MaintenanceWindow
+	err := maintenance.ScanWindow(h.db.QueryRow(`
+		UPDATE maintenance_windows SET name = $1, scope_type = $2, scope_key = $3, starts_at = $4, ends_at = $5,
+			recurrence = $6, recurrence_until = $7, reason = $8
+		WHERE id = $9
+		RETURNING `+maintenance.WindowColumns,
+		req.Name, req.ScopeType, req.ScopeKey, req.StartsAt, req.EndsAt, req.Recurrence, req.RecurrenceUntil, req.Reason, id,
+	), &w)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "maintenance_window_not_found", "Maintenance window not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update maintenance window"})
+		return
+	}
+	w.Active = maintenance.ActiveAt(w, time.Now())
+
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *MaintenanceHandler) DeleteMaintenanceWindow(c *gin.Context) {
+	id, ok := parseMaintenanceWindowID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM maintenance_windows WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete maintenance window"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "maintenance_window_not_found", "Maintenance window not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Maintenance window deleted successfully"})
+}
+
+const silenceColumns = "id, scope_type, scope_key, reason, created_by, starts_at, expires_at, created_at"
+
+func scanSilence(row rowScanner, s *models.Silence) error {
+	return row.Scan(&s.ID, &s.ScopeType, &s.ScopeKey, &s.Reason, &s.CreatedBy, &s.StartsAt, &s.ExpiresAt, &s.CreatedAt)
+}
+
+// GetSilences lists unexpired silences, or all of them with expired=true.
+func (h *MaintenanceHandler) GetSilences(c *gin.Context) {
+	query := "SELECT " + silenceColumns + " FROM silences"
+	args := []interface{}{}
+	if c.Query("expired") != "true" {
+		query += " WHERE expires_at > $1"
+		args = append(args, time.Now())
+	}
+
+	page, args := pageClause(c, args)
+	rows, err := h.db.Query(query+" ORDER BY expires_at DESC"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch silences"})
+		return
+	}
+	defer rows.Close()
+
+	silences := []models.Silence{}
+	for rows.Next() {
+		var s models.Silence
+		if err := scanSilence(rows, &s); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan silence"})
+			return
+		}
+		silences = append(silences, s)
+	}
+
+	c.JSON(http.StatusOK, silences)
+}
+
+// CreateSilence mutes notifications for a scope from now until expires_at,
+// or for duration_minutes.
+func (h *MaintenanceHandler) CreateSilence(c *gin.Context) {
+	var req models.SilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := maintenance.ValidateScope(req.ScopeType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	var expiresAt time.Time
+	switch {
+	case req.ExpiresAt != nil && req.DurationMinutes == 0:
+		expiresAt = *req.ExpiresAt
+	case req.ExpiresAt == nil && req.DurationMinutes > 0:
+		expiresAt = now.Add(time.Duration(req.DurationMinutes) * time.Minute)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either expires_at or a positive duration_minutes is required"})
+		return
+	}
+	if !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	var s models.Silence
+	err := scanSilence(h.db.QueryRow(`
+		INSERT INTO silences (scope_type, scope_key, reason, created_by, starts_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+silenceColumns,
+		req.ScopeType, req.ScopeKey, req.Reason, req.CreatedBy, now, expiresAt,
+	), &s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create silence"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
+
+// ExpireSilence ends a silence now. The record is kept for the history.
+func (h *MaintenanceHandler) ExpireSilence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid silence ID"})
+		return
+	}
+
+	now := time.Now()
+	result, err := h.db.Exec("UPDATE silences SET expires_at = $1 WHERE id = $2 AND expires_at > $1", now, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire silence"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "silence_not_found", "Active silence not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Silence expired"})
+}
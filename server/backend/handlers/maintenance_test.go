@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"backend/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMaintenanceWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	start := time.Date(2024, 1, 3, 22, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	mock.ExpectQuery("INSERT INTO maintenance_windows").
+		WithArgs("週次点検", "site", "tokyo-office", start, end, "weekly", nil, "").
+		WillReturnRows(maintenanceWindowRows().
+			AddRow(1, "週次点検", "site", "tokyo-office", start, end, "weekly", nil, "", start))
+
+	// ハンドラー作成
+	handler := NewMaintenanceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/maintenance-windows", strings.NewReader(
+		`{"name": "週次点検", "scope_type": "site", "scope_key": "tokyo-office", "starts_at": "2024-01-03T22:00:00Z", "ends_at": "2024-01-04T02:00:00Z", "recurrence": "weekly"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateMaintenanceWindow(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response models.MaintenanceWindow
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.ID)
+	assert.Equal(t, "weekly", response.Recurrence)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateMaintenanceWindow_InvalidScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewMaintenanceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/maintenance-windows", strings.NewReader(
+		`{"name": "移設", "scope_type": "building", "scope_key": "a", "starts_at": "2024-01-03T22:00:00Z", "ends_at": "2024-01-04T02:00:00Z"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateMaintenanceWindow(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMaintenanceWindows_Active(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM maintenance_windows WHERE scope_key = \\$1 ORDER BY starts_at DESC").
+		WithArgs("device-001").
+		WillReturnRows(maintenanceWindowRows().
+			AddRow(1, "移設", "device", "device-001", now.Add(-time.Hour), now.Add(time.Hour), "none", nil, "", now).
+			AddRow(2, "前回の移設", "device", "device-001", now.Add(-48*time.Hour), now.Add(-47*time.Hour), "none", nil, "", now))
+
+	// ハンドラー作成
+	handler := NewMaintenanceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/maintenance-windows?scope_key=device-001&active=true", nil)
+
+	// ハンドラー実行
+	handler.GetMaintenanceWindows(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []models.MaintenanceWindow
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.Equal(t, 1, response[0].ID)
+	assert.True(t, response[0].Active)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateSilence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO silences").
+		WithArgs("device", "device-001", "配線工事", "tanaka", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scope_type", "scope_key", "reason", "created_by", "starts_at", "expires_at", "created_at"}).
+			AddRow(1, "device", "device-001", "配線工事", "tanaka", now, now.Add(2*time.Hour), now))
+
+	// ハンドラー作成
+	handler := NewMaintenanceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/silences", strings.NewReader(
+		`{"scope_type": "device", "scope_key": "device-001", "reason": "配線工事", "created_by": "tanaka", "duration_minutes": 120}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateSilence(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateSilence_RequiresExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewMaintenanceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/silences", strings.NewReader(`{"scope_type": "site", "scope_key": "tokyo-office"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateSilence(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpireSilence_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE silences SET expires_at = \\$1 WHERE id = \\$2 AND expires_at > \\$1").
+		WithArgs(sqlmock.AnyArg(), 99).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// ハンドラー作成
+	handler := NewMaintenanceHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "99"}}
+	c.Request, _ = http.NewRequest("DELETE", "/api/silences/99", nil)
+
+	// ハンドラー実行
+	handler.ExpireSilence(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"backend/apiv2"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageClause returns the LIMIT and OFFSET of the requested /api/v2 page for
+// a list query taking args, and args with theirs appended. It asks for one
+// row more than the page so that apiv2 can tell whether there is a next page.
+// Under /api lists are not paged and the clause is empty.
+func pageClause(c *gin.Context, args []interface{}) (string, []interface{}) {
+	limit, offset := pageBounds(c)
+	if limit == 0 {
+		return "", args
+	}
+	args = append(args, limit, offset)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args
+}
+
+// pageBounds is pageClause for the store functions: the number of rows to
+// fetch and to skip, or 0, 0 for all rows.
+func pageBounds(c *gin.Context) (limit, offset int) {
+	page, ok := apiv2.PageFrom(c)
+	if !ok {
+		return 0, 0
+	}
+	return page.Limit + 1, page.Offset
+}
@@ -1,76 +1,104 @@
 package handlers
 
 import (
+	"backend/apiv2"
+	"backend/eventtypes"
+	"backend/ingest"
 	"backend/models"
+	"backend/store"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type PowerEventHandler struct {
-	db *sql.DB
+	db       *sql.DB
+	pipeline *ingest.Pipeline
 }
 
-func NewPowerEventHandler(db *sql.DB) *PowerEventHandler {
-	return &PowerEventHandler{db: db}
+type PowerEventHandlerOption func(*PowerEventHandler)
+
+// WithPipeline sets the ingest pipeline shared with the other ingest paths.
+// Without it events are stored with no validation or post-insert hooks.
+func WithPipeline(pipeline *ingest.Pipeline) PowerEventHandlerOption {
+	return func(h *PowerEventHandler) {
+		h.pipeline = pipeline
+	}
+}
+
+const powerEventColumns = "id, device_id, event_type, timestamp, created_at, expected, " + models.EventDataColumns
+
+func scanPowerEvent(row rowScanner, e *models.PowerEvent) error {
+	dest := append([]interface{}{&e.ID, &e.DeviceID, &e.EventType, &e.Timestamp, &e.CreatedAt, &e.Expected}, e.Data.ScanFields()...)
+	return row.Scan(dest...)
+}
+
+func NewPowerEventHandler(db *sql.DB, opts ...PowerEventHandlerOption) *PowerEventHandler {
+	h := &PowerEventHandler{db: db, pipeline: ingest.NewPipeline(db)}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *PowerEventHandler) CreatePowerEvent(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var req models.PowerEventRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := binding.JSON.BindBody(body, &req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create data JSON from the request fields
-	dataJSON := map[string]interface{}{
-		"client_timestamp":     req.Timestamp,
-		"uptime_ms":            req.UptimeMs,
-		"message":              req.Message,
-		"battery_percentage":   req.BatteryPercentage,
-		"battery_voltage":      req.BatteryVoltage,
-		"wifi_signal_strength": req.WiFiSignalStrength,
-		"free_heap":            req.FreeHeap,
+	// ファームウェア情報はペイロード優先、なければUser-Agentから取得
+	model, firmwareVersion := parseUserAgent(c.GetHeader("User-Agent"))
+	if req.Model == "" {
+		req.Model = model
 	}
-
-	dataBytes, err := json.Marshal(dataJSON)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal data JSON"})
-		return
+	if req.FirmwareVersion == "" {
+		req.FirmwareVersion = firmwareVersion
 	}
 
-	// デバイスの最終接続時刻を更新（UPSERT）
-	_, err = h.db.Exec(`
-		INSERT INTO devices (id, name, description, last_seen, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) 
-		DO UPDATE SET last_seen = $4, updated_at = $6`,
-		req.DeviceID, req.DeviceID, "", time.Now(), time.Now(), time.Now(),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+	result, err := h.pipeline.Ingest(req, body)
+	var verr *eventtypes.ValidationError
+	var ierr *ingest.Error
+	switch {
+	case errors.As(err, &verr):
+		apiv2.SetCode(c, "invalid_event")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      verr.Error(),
+			"event_type": verr.EventType,
+			"reason":     verr.Reason,
+			"details":    verr.Details,
+		})
 		return
-	}
-
-	// 電源イベントを挿入 (Use server timestamp)
-	_, err = h.db.Exec(
-		"INSERT INTO power_events (device_id, event_type, data, timestamp) VALUES ($1, $2, $3, $4)",
-		req.DeviceID, req.EventType, string(dataBytes), time.Now(),
-	)
-	if err != nil {
+	case errors.As(err, &ierr):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ierr.Message})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create power event"})
 		return
 	}
 
+	if len(result.Warnings) > 0 {
+		c.JSON(http.StatusCreated, gin.H{"message": "Power event created successfully", "warnings": result.Warnings})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"message": "Power event created successfully"})
 }
 
 func (h *PowerEventHandler) GetPowerEvents(c *gin.Context) {
-	rows, err := h.db.Query("SELECT id, device_id, event_type, timestamp, data, created_at FROM power_events ORDER BY timestamp DESC")
+	page, args := pageClause(c, nil)
+	rows, err := h.db.Query("SELECT "+powerEventColumns+" FROM power_events ORDER BY timestamp DESC"+page, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch power events"})
 		return
@@ -80,7 +108,7 @@ func (h *PowerEventHandler) GetPowerEvents(c *gin.Context) {
 	var events []models.PowerEvent
 	for rows.Next() {
 		var event models.PowerEvent
-		err := rows.Scan(&event.ID, &event.DeviceID, &event.EventType, &event.Timestamp, &event.Data, &event.CreatedAt)
+		err := scanPowerEvent(rows, &event)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan power event"})
 			return
@@ -100,11 +128,10 @@ func (h *PowerEventHandler) GetPowerEventByID(c *gin.Context) {
 	}
 
 	var event models.PowerEvent
-	err = h.db.QueryRow("SELECT id, device_id, event_type, timestamp, data, created_at FROM power_events WHERE id = $1", id).
-		Scan(&event.ID, &event.DeviceID, &event.EventType, &event.Timestamp, &event.Data, &event.CreatedAt)
+	err = scanPowerEvent(h.db.QueryRow("SELECT "+powerEventColumns+" FROM power_events WHERE id = $1", id), &event)
 	
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Power event not found"})
+		respondError(c, http.StatusNotFound, "power_event_not_found", "Power event not found")
 		return
 	}
 	if err != nil {
@@ -118,7 +145,15 @@ func (h *PowerEventHandler) GetPowerEventByID(c *gin.Context) {
 func (h *PowerEventHandler) GetDeviceTimeline(c *gin.Context) {
 	deviceID := c.Param("deviceId")
 
-	rows, err := h.db.Query("SELECT id, device_id, event_type, timestamp, data, created_at FROM power_events WHERE device_id = $1 ORDER BY timestamp DESC", deviceID)
+	// 注釈と合わせて並べるため、ページまでの件数を両方から取り出してから切り出す
+	page, paged := apiv2.PageFrom(c)
+	query, args, limit := "SELECT "+powerEventColumns+" FROM power_events WHERE device_id = $1 ORDER BY timestamp DESC", []interface{}{deviceID}, 0
+	if paged {
+		limit = page.Offset + page.Limit + 1
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device timeline"})
 		return
@@ -128,7 +163,7 @@ func (h *PowerEventHandler) GetDeviceTimeline(c *gin.Context) {
 	var events []models.PowerEvent
 	for rows.Next() {
 		var event models.PowerEvent
-		err := rows.Scan(&event.ID, &event.DeviceID, &event.EventType, &event.Timestamp, &event.Data, &event.CreatedAt)
+		err := scanPowerEvent(rows, &event)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan power event"})
 			return
@@ -136,7 +171,35 @@ func (h *PowerEventHandler) GetDeviceTimeline(c *gin.Context) {
 		events = append(events, event)
 	}
 
-	c.JSON(http.StatusOK, events)
+	annotations, err := loadAnnotations(h.db, deviceID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotations"})
+		return
+	}
+
+	// イベントと注釈を時刻の新しい順にまとめる
+	timeline := make([]models.TimelineItem, 0, len(events)+len(annotations))
+	for i := range events {
+		timeline = append(timeline, models.TimelineItem{Type: models.TimelineEvent, Event: &events[i]})
+	}
+	for i := range annotations {
+		timeline = append(timeline, models.TimelineItem{Type: models.TimelineAnnotation, Annotation: &annotations[i]})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].Time().After(timeline[j].Time())
+	})
+	if paged {
+		if page.Offset < len(timeline) {
+			timeline = timeline[page.Offset:]
+		} else {
+			timeline = timeline[:0]
+		}
+		if len(timeline) > page.Limit+1 {
+			timeline = timeline[:page.Limit+1]
+		}
+	}
+
+	c.JSON(http.StatusOK, timeline)
 }
 
 func (h *PowerEventHandler) DeleteOldEvents(c *gin.Context) {
@@ -150,29 +213,21 @@ func (h *PowerEventHandler) DeleteOldEvents(c *gin.Context) {
 	}
 
 	// Calculate the cutoff date
-	cutoffDate := time.Now().AddDate(0, 0, -req.OlderThanDays)
+	cutoffDate := store.EventsCutoff(time.Now(), req.OlderThanDays)
 	
 	// First, get the count of events to be deleted
-	var count int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM power_events WHERE timestamp < $1", cutoffDate).Scan(&count)
-	if err != nil {
+	if _, err := store.CountEventsBefore(h.db, cutoffDate); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count events to delete"})
 		return
 	}
 	
 	// Delete the old events
-	result, err := h.db.Exec("DELETE FROM power_events WHERE timestamp < $1", cutoffDate)
+	rowsAffected, err := store.DeleteEventsBefore(h.db, cutoffDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete old events"})
 		return
 	}
 	
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows count"})
-		return
-	}
-	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Old events deleted successfully",
 		"deleted_count": rowsAffected,
@@ -217,14 +272,14 @@ func (h *PowerEventHandler) GetEventStats(c *gin.Context) {
 	h.db.QueryRow("SELECT COUNT(*) FROM power_events WHERE timestamp >= $1", cutoff30Days).Scan(&countLast30Days)
 	h.db.QueryRow("SELECT COUNT(*) FROM power_events WHERE timestamp >= $1", cutoff90Days).Scan(&countLast90Days)
 	
-	stats := gin.H{
-		"total_count": totalCount,
-		"oldest_event": oldestTimestamp,
-		"newest_event": newestTimestamp,
-		"count_last_7_days": countLast7Days,
-		"count_last_30_days": countLast30Days,
-		"count_last_90_days": countLast90Days,
-		"count_older_than_90_days": totalCount - countLast90Days,
+	stats := models.EventStats{
+		TotalCount: totalCount,
+		OldestEvent: oldestTimestamp,
+		NewestEvent: newestTimestamp,
+		CountLast7Days: countLast7Days,
+		CountLast30Days: countLast30Days,
+		CountLast90Days: countLast90Days,
+		CountOlderThan90Days: totalCount - countLast90Days,
 	}
 	
 	c.JSON(http.StatusOK, stats)
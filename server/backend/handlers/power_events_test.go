@@ -1,6 +1,11 @@
 package handlers
 
 import (
+	"backend/alerts"
+	"backend/apiv2"
+	"backend/eventtypes"
+	"backend/health"
+	"backend/ingest"
 	"backend/models"
 	"bytes"
 	"encoding/json"
@@ -14,6 +19,14 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// eventDataColumnNames は models.EventDataColumns の列名
+var eventDataColumnNames = []string{"client_timestamp", "uptime_ms", "message", "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap", "data"}
+
+// powerEventRows は powerEventColumns の順の列を持つ空の結果を返す
+func powerEventRows() *sqlmock.Rows {
+	return sqlmock.NewRows(append([]string{"id", "device_id", "event_type", "timestamp", "created_at", "expected"}, eventDataColumnNames...))
+}
+
 func TestCreatePowerEvent(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -35,27 +48,15 @@ func TestCreatePowerEvent(t *testing.T) {
 		FreeHeap:           100000,
 	}
 
-	// リクエストデータをJSONに変換
-	dataJSON := map[string]interface{}{
-		"client_timestamp":     req.Timestamp,
-		"uptime_ms":            req.UptimeMs,
-		"message":              req.Message,
-		"battery_percentage":   req.BatteryPercentage,
-		"battery_voltage":      req.BatteryVoltage,
-		"wifi_signal_strength": req.WiFiSignalStrength,
-		"free_heap":            req.FreeHeap,
-	}
-	data, err := json.Marshal(dataJSON)
-	assert.NoError(t, err)
-
 	// デバイスの最終接続時刻を更新（UPSERT）
 	mock.ExpectExec("INSERT INTO devices").
-		WithArgs(req.DeviceID, req.DeviceID, "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(req.DeviceID, req.DeviceID, "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	// 電源イベントを挿入
+	// 電源イベントを挿入（ペイロードは型付きの列へ）
 	mock.ExpectExec("INSERT INTO power_events").
-		WithArgs(req.DeviceID, req.EventType, string(data), sqlmock.AnyArg()).
+		WithArgs(req.DeviceID, req.EventType, sqlmock.AnyArg(), false, req.Timestamp.UTC(), req.UptimeMs, req.Message,
+			req.BatteryPercentage, req.BatteryVoltage, req.WiFiSignalStrength, req.FreeHeap).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// ハンドラー作成
@@ -93,31 +94,9 @@ func TestGetPowerEvents(t *testing.T) {
 
 	// テストデータ
 	now := time.Now()
-	dataJSON1 := map[string]interface{}{
-		"client_timestamp":     now,
-		"uptime_ms":            1000,
-		"message":              "Device powered on",
-		"battery_percentage":   80,
-		"battery_voltage":      3.3,
-		"wifi_signal_strength": -50,
-		"free_heap":            100000,
-	}
-	data1, _ := json.Marshal(dataJSON1)
-
-	dataJSON2 := map[string]interface{}{
-		"client_timestamp":     now,
-		"uptime_ms":            2000,
-		"message":              "Device powered off",
-		"battery_percentage":   75,
-		"battery_voltage":      3.2,
-		"wifi_signal_strength": -55,
-		"free_heap":            95000,
-	}
-	data2, _ := json.Marshal(dataJSON2)
-
-	rows := sqlmock.NewRows([]string{"id", "device_id", "event_type", "timestamp", "data", "created_at"}).
-		AddRow(1, "device-001", "power_on", now, string(data1), now).
-		AddRow(2, "device-001", "power_off", now, string(data2), now)
+	rows := powerEventRows().
+		AddRow(1, "device-001", "power_on", now, now, false, now, 1000, "Device powered on", 80, 3.3, -50, 100000, nil).
+		AddRow(2, "device-001", "power_off", now, now, true, now, 2000, "Device powered off", 75, 3.2, -55, 95000, nil)
 
 	mock.ExpectQuery("SELECT (.+) FROM power_events ORDER BY timestamp DESC").
 		WillReturnRows(rows)
@@ -142,6 +121,17 @@ func TestGetPowerEvents(t *testing.T) {
 	assert.Len(t, events, 2)
 	assert.Equal(t, "device-001", events[0].DeviceID)
 	assert.Equal(t, "power_on", events[0].EventType)
+	assert.False(t, events[0].Expected)
+	assert.True(t, events[1].Expected)
+	assert.Equal(t, 80, *events[0].Data.BatteryPercentage)
+
+	// data は文字列ではなく JSON オブジェクトとして返す
+	var raw []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	data, ok := raw[1]["data"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, 75.0, data["battery_percentage"])
+	assert.Equal(t, "Device powered off", data["message"])
 
 	// モックの期待値を満たしたか確認
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -155,21 +145,10 @@ func TestGetPowerEventByID(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	// テストデータ
+	// テストデータ（再起動の詳細など列のない項目は data 列から）
 	now := time.Now()
-	dataJSON := map[string]interface{}{
-		"client_timestamp":     now,
-		"uptime_ms":            1000,
-		"message":              "Device powered on",
-		"battery_percentage":   80,
-		"battery_voltage":      3.3,
-		"wifi_signal_strength": -50,
-		"free_heap":            100000,
-	}
-	data, _ := json.Marshal(dataJSON)
-
-	rows := sqlmock.NewRows([]string{"id", "device_id", "event_type", "timestamp", "data", "created_at"}).
-		AddRow(1, "device-001", "power_on", now, string(data), now)
+	rows := powerEventRows().
+		AddRow(1, "device-001", "power_on", now, now, false, nil, 1000, "Device powered on", 80, 3.3, -50, 100000, `{"clean_boot": true}`)
 
 	mock.ExpectQuery("SELECT (.+) FROM power_events WHERE id = \\$1").
 		WithArgs(1).
@@ -196,6 +175,9 @@ func TestGetPowerEventByID(t *testing.T) {
 	assert.Equal(t, 1, event.ID)
 	assert.Equal(t, "device-001", event.DeviceID)
 	assert.Equal(t, "power_on", event.EventType)
+	assert.Nil(t, event.Data.ClientTimestamp)
+	assert.Equal(t, int64(100000), *event.Data.FreeHeap)
+	assert.Equal(t, models.JSONObject{"clean_boot": true}, event.Data.Extra)
 
 	// モックの期待値を満たしたか確認
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -211,36 +193,20 @@ func TestGetDeviceTimeline(t *testing.T) {
 
 	// テストデータ
 	now := time.Now()
-	dataJSON1 := map[string]interface{}{
-		"client_timestamp":     now,
-		"uptime_ms":            1000,
-		"message":              "Device powered on",
-		"battery_percentage":   80,
-		"battery_voltage":      3.3,
-		"wifi_signal_strength": -50,
-		"free_heap":            100000,
-	}
-	data1, _ := json.Marshal(dataJSON1)
-
-	dataJSON2 := map[string]interface{}{
-		"client_timestamp":     now.Add(-time.Hour),
-		"uptime_ms":            2000,
-		"message":              "Device powered off",
-		"battery_percentage":   75,
-		"battery_voltage":      3.2,
-		"wifi_signal_strength": -55,
-		"free_heap":            95000,
-	}
-	data2, _ := json.Marshal(dataJSON2)
-
-	rows := sqlmock.NewRows([]string{"id", "device_id", "event_type", "timestamp", "data", "created_at"}).
-		AddRow(1, "device-001", "power_on", now, string(data1), now).
-		AddRow(2, "device-001", "power_off", now.Add(-time.Hour), string(data2), now.Add(-time.Hour))
+	rows := powerEventRows().
+		AddRow(1, "device-001", "power_on", now, now, false, now, 1000, "Device powered on", 80, 3.3, -50, 100000, nil).
+		AddRow(2, "device-001", "power_off", now.Add(-time.Hour), now.Add(-time.Hour), false, now.Add(-time.Hour), 2000, "Device powered off", 75, 3.2, -55, 95000, nil)
 
 	mock.ExpectQuery("SELECT (.+) FROM power_events WHERE device_id = \\$1 ORDER BY timestamp DESC").
 		WithArgs("device-001").
 		WillReturnRows(rows)
 
+	// 停電中の注釈（2件のイベントの間に並ぶ）
+	mock.ExpectQuery("SELECT (.+) FROM device_annotations WHERE device_id = \\$1 ORDER BY starts_at DESC").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "device_id", "starts_at", "ends_at", "author", "text", "tags", "created_at", "updated_at"}).
+			AddRow(5, "device-001", now.Add(-30*time.Minute), nil, "tanaka", "ブレーカーを戻した", "{breaker,onsite}", now, now))
+
 	// ハンドラー作成
 	handler := NewPowerEventHandler(db)
 
@@ -256,11 +222,66 @@ func TestGetDeviceTimeline(t *testing.T) {
 	// アサーション
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var events []models.PowerEvent
-	err = json.Unmarshal(w.Body.Bytes(), &events)
+	var timeline []models.TimelineItem
+	err = json.Unmarshal(w.Body.Bytes(), &timeline)
 	assert.NoError(t, err)
-	assert.Len(t, events, 2)
-	assert.Equal(t, "device-001", events[0].DeviceID)
+	assert.Len(t, timeline, 3)
+	assert.Equal(t, models.TimelineEvent, timeline[0].Type)
+	assert.Equal(t, "device-001", timeline[0].Event.DeviceID)
+	assert.Equal(t, models.TimelineAnnotation, timeline[1].Type)
+	assert.Equal(t, "ブレーカーを戻した", timeline[1].Annotation.Text)
+	assert.Equal(t, []string{"breaker", "onsite"}, timeline[1].Annotation.Tags)
+	assert.Equal(t, models.TimelineEvent, timeline[2].Type)
+	assert.Equal(t, "power_off", timeline[2].Event.EventType)
+
+	// type 判別子がフラットに付与されている
+	var raw []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	assert.Equal(t, "annotation", raw[1]["type"])
+	assert.Equal(t, "tanaka", raw[1]["author"])
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDeviceTimeline_Page(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	// offset+limit+1 件までを両方から取り出し、合わせて並べてから切り出す
+	mock.ExpectQuery("SELECT (.+) FROM power_events WHERE device_id = \\$1 ORDER BY timestamp DESC LIMIT \\$2").
+		WithArgs("device-001", 3).
+		WillReturnRows(powerEventRows().
+			AddRow(1, "device-001", "power_on", now, now, false, now, 1000, "", 80, 3.3, -50, 100000, nil).
+			AddRow(2, "device-001", "power_off", now.Add(-time.Hour), now.Add(-time.Hour), false, now.Add(-time.Hour), 2000, "", 75, 3.2, -55, 95000, nil))
+	mock.ExpectQuery("SELECT (.+) FROM device_annotations WHERE device_id = \\$1 ORDER BY starts_at DESC, id DESC LIMIT \\$2").
+		WithArgs("device-001", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "device_id", "starts_at", "ends_at", "author", "text", "tags", "created_at", "updated_at"}).
+			AddRow(5, "device-001", now.Add(-30*time.Minute), nil, "tanaka", "ブレーカーを戻した", "{}", now, now))
+
+	router := gin.New()
+	router.GET("/api/v2/power-events/device/:deviceId/timeline", apiv2.AdaptList(NewPowerEventHandler(db).GetDeviceTimeline))
+
+	// リクエスト実行（2件目から1件）
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v2/power-events/device/device-001/timeline?limit=1&offset=1", nil)
+	router.ServeHTTP(w, req)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data []map[string]interface{} `json:"data"`
+		Meta apiv2.Meta               `json:"meta"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 1)
+	assert.Equal(t, "annotation", body.Data[0]["type"])
+	assert.Equal(t, apiv2.Meta{Limit: 1, Offset: 1, Count: 1, HasMore: true}, body.Meta)
 
 	// モックの期待値を満たしたか確認
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -303,7 +324,7 @@ func TestGetPowerEventByID_NotFound(t *testing.T) {
 
 	mock.ExpectQuery("SELECT (.+) FROM power_events WHERE id = \\$1").
 		WithArgs(999).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "device_id", "event_type", "timestamp", "data", "created_at"}))
+		WillReturnRows(powerEventRows())
 
 	// ハンドラー作成
 	handler := NewPowerEventHandler(db)
@@ -562,4 +583,125 @@ func TestGetEventStats_NoEvents(t *testing.T) {
 
 	// モックの期待値を満たしたか確認
 	assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
+func TestCreatePowerEvent_DetectsReboot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// 直前のイベントより uptime_ms が小さい → 再起動イベントを記録してから本イベントを挿入
+	mock.ExpectQuery("SELECT uptime_ms FROM power_events").
+		WithArgs("device-001", "reboot").
+		WillReturnRows(sqlmock.NewRows([]string{"uptime_ms"}).AddRow(7200000))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "reboot", sqlmock.AnyArg(), 4000, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "periodic_status", sqlmock.AnyArg(), false, nil, 4000, "", 0, 0.0, 0, 0).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	// ハンドラー作成
+	detector := health.NewRebootDetector(db, alerts.NewManager(db), 3, time.Hour)
+	handler := NewPowerEventHandler(db, WithPipeline(ingest.NewPipeline(db, ingest.WithRebootDetector(detector))))
+
+	// リクエスト作成
+	body, _ := json.Marshal(map[string]interface{}{"device_id": "device-001", "event_type": "periodic_status", "uptime_ms": 4000})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/power-events", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreatePowerEvent(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePowerEvent_RejectsUnknownEventType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewPowerEventHandler(db, WithPipeline(ingest.NewPipeline(db, ingest.WithEventTypes(eventtypes.NewRegistry(eventtypes.ModeReject)))))
+
+	// リクエスト作成
+	body, _ := json.Marshal(map[string]interface{}{"device_id": "device-001", "event_type": "poweroff"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/power-events", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreatePowerEvent(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var response map[string]interface{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown_event_type", response["reason"])
+	assert.Equal(t, "Unknown event type: poweroff", response["error"])
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePowerEvent_WarnsOnSchemaMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "battery_low", sqlmock.AnyArg(), false, nil, 0, "", 150, 0.0, 0, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// ハンドラー作成
+	handler := NewPowerEventHandler(db, WithPipeline(ingest.NewPipeline(db, ingest.WithEventTypes(eventtypes.NewRegistry(eventtypes.ModeWarn)))))
+
+	// リクエスト作成（battery_percentage が範囲外）
+	body, _ := json.Marshal(map[string]interface{}{"device_id": "device-001", "event_type": "battery_low", "battery_percentage": 150})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/api/power-events", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreatePowerEvent(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Warnings []eventtypes.ValidationError `json:"warnings"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Warnings, 1)
+	assert.Equal(t, "schema_mismatch", response.Warnings[0].Reason)
+	assert.Equal(t, "/battery_percentage", response.Warnings[0].Details[0].Field)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"backend/analysis"
+	"backend/health"
+	"backend/maintenance"
+	"backend/models"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReportHandler struct {
+	db *sql.DB
+}
+
+func NewReportHandler(db *sql.DB) *ReportHandler {
+	return &ReportHandler{db: db}
+}
+
+type AvailabilityReport struct {
+	From    time.Time               `json:"from"`
+	To      time.Time               `json:"to"`
+	Fleet   analysis.Availability   `json:"fleet"`
+	Sites   []analysis.Availability `json:"sites"`
+	Groups  []analysis.Availability `json:"groups"`
+	Devices []analysis.Availability `json:"devices"`
+}
+
+type ConnectivityReport struct {
+	From  time.Time               `json:"from"`
+	To    time.Time               `json:"to"`
+	Fleet analysis.Connectivity   `json:"fleet"`
+	Sites []analysis.Connectivity `json:"sites"`
+	// Worst connectivity first.
+	Devices []analysis.Connectivity `json:"devices"`
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parsePeriod reads from/to query parameters (RFC3339 or YYYY-MM-DD),
+// defaulting to the last defaultDays days. The end is capped at now.
+func parsePeriod(c *gin.Context, defaultDays int) (time.Time, time.Time, error) {
+	now := time.Now()
+	to := now
+	if v := c.Query("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %s", v)
+		}
+		to = t
+	}
+	if to.After(now) {
+		to = now
+	}
+
+	from := to.AddDate(0, 0, -defaultDays)
+	if v := c.Query("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %s", v)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// loadDeviceHistories loads every device with its state just before from and
+// its events within [from, to). withData also decodes each event's data JSON.
+// Detected reboots are left out: they are dated at the boot time, which the
+// server did not see, and would end the gaps the device was silent.
+func loadDeviceHistories(db *sql.DB, from, to time.Time, withData bool) ([]analysis.DeviceHistory, error) {
+	rows, err := db.Query(`
+		SELECT d.id, COALESCE(d.site, ''), COALESCE(d.device_group, ''),
+			COALESCE((SELECT p.event_type FROM power_events p
+				WHERE p.device_id = d.id AND p.timestamp < $1 AND p.event_type IN ('power_on', 'power_off')
+				ORDER BY p.timestamp DESC LIMIT 1), ''),
+			(SELECT MAX(p.timestamp) FROM power_events p WHERE p.device_id = d.id AND p.timestamp < $1 AND p.event_type <> $2)
+		FROM devices d ORDER BY d.id`, from, health.EventTypeReboot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var histories []analysis.DeviceHistory
+	index := map[string]int{}
+	for rows.Next() {
+		var h analysis.DeviceHistory
+		if err := rows.Scan(&h.DeviceID, &h.Site, &h.Group, &h.PriorPowerState, &h.LastSeenBefore); err != nil {
+			return nil, err
+		}
+		index[h.DeviceID] = len(histories)
+		histories = append(histories, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	columns := "device_id, event_type, timestamp"
+	if withData {
+		columns += ", " + models.EventDataColumns
+	}
+	eventRows, err := db.Query("SELECT "+columns+" FROM power_events WHERE timestamp >= $1 AND timestamp < $2 AND event_type <> $3 ORDER BY device_id, timestamp", from, to, health.EventTypeReboot)
+	if err != nil {
+		return nil, err
+	}
+	defer eventRows.Close()
+
+	for eventRows.Next() {
+		var e analysis.Event
+		if withData {
+			var data models.EventData
+			if err := eventRows.Scan(append([]interface{}{&e.DeviceID, &e.EventType, &e.Timestamp}, data.ScanFields()...)...); err != nil {
+				return nil, err
+			}
+			e.SetData(data)
+		} else if err := eventRows.Scan(&e.DeviceID, &e.EventType, &e.Timestamp); err != nil {
+			return nil, err
+		}
+		if i, ok := index[e.DeviceID]; ok {
+			histories[i].Events = append(histories[i].Events, e)
+		}
+	}
+	return histories, eventRows.Err()
+}
+
+func buildAvailabilityReport(histories []analysis.DeviceHistory, from, to time.Time, offlineAfter time.Duration) AvailabilityReport {
+	report := AvailabilityReport{
+		From:    from,
+		To:      to,
+		Sites:   []analysis.Availability{},
+		Groups:  []analysis.Availability{},
+		Devices: []analysis.Availability{},
+	}
+
+	sites := map[string][]analysis.Availability{}
+	groups := map[string][]analysis.Availability{}
+	for _, h := range histories {
+		a := analysis.ComputeAvailability(h, from, to, offlineAfter)
+		report.Devices = append(report.Devices, a)
+		if h.Site != "" {
+			sites[h.Site] = append(sites[h.Site], a)
+		}
+		if h.Group != "" {
+			groups[h.Group] = append(groups[h.Group], a)
+		}
+	}
+
+	report.Fleet = analysis.Aggregate("fleet", "all", report.Devices)
+	report.Sites = aggregateByKey("site", sites)
+	report.Groups = aggregateByKey("group", groups)
+	return report
+}
+
+func aggregateByKey(scope string, rows map[string][]analysis.Availability) []analysis.Availability {
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []analysis.Availability{}
+	for _, k := range keys {
+		result = append(result, analysis.Aggregate(scope, k, rows[k]))
+	}
+	return result
+}
+
+func (h *ReportHandler) GetAvailabilityReport(c *gin.Context) {
+	from, to, err := parsePeriod(c, 30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	offlineAfter := 5 * time.Minute
+	if v := c.Query("offline_after_minutes"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offline_after_minutes must be a positive integer"})
+			return
+		}
+		offlineAfter = time.Duration(minutes) * time.Minute
+	}
+
+	histories, err := loadDeviceHistories(h.db, from, to, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load power events"})
+		return
+	}
+	// メンテナンス中の時間は稼働率の計算から除外する
+	windows, err := maintenance.LoadWindows(h.db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load maintenance windows"})
+		return
+	}
+	maintenance.Attach(histories, windows, from, to)
+
+	report := buildAvailabilityReport(histories, from, to, offlineAfter)
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, report)
+	case "csv":
+		writeAvailabilityCSV(c, report)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+	}
+}
+
+func writeAvailabilityCSV(c *gin.Context, report AvailabilityReport) {
+	filename := fmt.Sprintf("availability-%s-%s.csv", report.From.Format("20060102"), report.To.Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"scope", "key", "device_count", "period_seconds", "up_seconds", "outage_seconds", "unknown_seconds",
+		"availability_pct", "coverage_pct", "outage_count", "longest_outage_seconds", "mtbf_seconds", "mttr_seconds",
+		"maintenance_seconds", "expected_outage_count"})
+
+	rows := append([]analysis.Availability{report.Fleet}, report.Sites...)
+	rows = append(rows, report.Groups...)
+	rows = append(rows, report.Devices...)
+	for _, r := range rows {
+		w.Write([]string{
+			r.Scope, r.Key, strconv.Itoa(r.DeviceCount),
+			formatFloat(r.PeriodSeconds), formatFloat(r.UpSeconds), formatFloat(r.OutageSeconds), formatFloat(r.UnknownSeconds),
+			formatOptional(r.AvailabilityPct), formatFloat(r.CoveragePct), strconv.Itoa(r.OutageCount),
+			formatFloat(r.LongestOutageSeconds), formatOptional(r.MTBFSeconds), formatOptional(r.MTTRSeconds),
+			formatFloat(r.MaintenanceSeconds), strconv.Itoa(r.ExpectedOutageCount),
+		})
+	}
+	w.Flush()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
+
+func (h *ReportHandler) GetConnectivityReport(c *gin.Context) {
+	from, to, err := parsePeriod(c, 7)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := analysis.DefaultConnectivityOptions()
+	if v := c.Query("gap_minutes"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gap_minutes must be a positive integer"})
+			return
+		}
+		opts.GapAfter = time.Duration(minutes) * time.Minute
+	}
+	if v := c.Query("low_rssi"); v != "" {
+		rssi, err := strconv.Atoi(v)
+		if err != nil || rssi >= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "low_rssi must be a negative integer (dBm)"})
+			return
+		}
+		opts.LowRSSI = rssi
+	}
+	switch c.DefaultQuery("bucket", "day") {
+	case "hour":
+		opts.Bucket = time.Hour
+	case "day":
+		opts.Bucket = 24 * time.Hour
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bucket must be hour or day"})
+		return
+	}
+
+	histories, err := loadDeviceHistories(h.db, from, to, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load power events"})
+		return
+	}
+
+	report := buildConnectivityReport(histories, from, to, opts, c.Query("site"))
+	c.JSON(http.StatusOK, report)
+}
+
+func buildConnectivityReport(histories []analysis.DeviceHistory, from, to time.Time, opts analysis.ConnectivityOptions, site string) ConnectivityReport {
+	report := ConnectivityReport{
+		From:    from,
+		To:      to,
+		Sites:   []analysis.Connectivity{},
+		Devices: []analysis.Connectivity{},
+	}
+
+	sites := map[string][]analysis.Connectivity{}
+	for _, h := range histories {
+		if site != "" && h.Site != site {
+			continue
+		}
+		row := analysis.ComputeConnectivity(h, from, to, opts)
+		report.Devices = append(report.Devices, row)
+		if h.Site != "" {
+			sites[h.Site] = append(sites[h.Site], row)
+		}
+	}
+
+	report.Fleet = analysis.AggregateConnectivity("fleet", "all", report.Devices)
+	keys := make([]string, 0, len(sites))
+	for k := range sites {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		report.Sites = append(report.Sites, analysis.AggregateConnectivity("site", k, sites[k]))
+	}
+
+	analysis.RankConnectivity(report.Devices)
+	return report
+}
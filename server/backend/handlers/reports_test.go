@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectAvailabilityQueries(mock sqlmock.Sqlmock, from time.Time) {
+	before := from.Add(-30 * time.Second)
+	mock.ExpectQuery("SELECT (.+) FROM devices d ORDER BY d.id").
+		WithArgs(from, "reboot").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "site", "device_group", "prior_state", "last_seen_before"}).
+			AddRow("device-001", "tokyo-office", "", "power_on", before).
+			AddRow("device-002", "tokyo-office", "rack-a", "power_on", before))
+
+	// device-002 は30分停電
+	rows := sqlmock.NewRows([]string{"device_id", "event_type", "timestamp"})
+	for i := 0; i < 60; i++ {
+		rows.AddRow("device-001", "periodic_status", from.Add(time.Duration(i)*time.Minute))
+	}
+	for i := 0; i < 60; i++ {
+		eventType := "periodic_status"
+		switch i {
+		case 0:
+			eventType = "power_off"
+		case 30:
+			eventType = "power_on"
+		}
+		rows.AddRow("device-002", eventType, from.Add(time.Duration(i)*time.Minute))
+	}
+	mock.ExpectQuery("SELECT device_id, event_type, timestamp FROM power_events WHERE timestamp >= \\$1 AND timestamp < \\$2").
+		WithArgs(from, from.Add(time.Hour), "reboot").
+		WillReturnRows(rows)
+}
+
+func expectMaintenanceWindows(mock sqlmock.Sqlmock, from time.Time, rows *sqlmock.Rows) {
+	mock.ExpectQuery("SELECT (.+) FROM maintenance_windows").
+		WithArgs(from, from.Add(time.Hour)).
+		WillReturnRows(rows)
+}
+
+func maintenanceWindowRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "scope_type", "scope_key", "starts_at", "ends_at", "recurrence", "recurrence_until", "reason", "created_at"})
+}
+
+func TestGetAvailabilityReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectAvailabilityQueries(mock, from)
+	expectMaintenanceWindows(mock, from, maintenanceWindowRows())
+
+	// ハンドラー作成
+	handler := NewReportHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reports/availability?from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z", nil)
+
+	// ハンドラー実行
+	handler.GetAvailabilityReport(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report AvailabilityReport
+	err = json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(t, err)
+	assert.Len(t, report.Devices, 2)
+	assert.Len(t, report.Sites, 1)
+	assert.Len(t, report.Groups, 1)
+	assert.Equal(t, "tokyo-office", report.Sites[0].Key)
+	assert.Equal(t, 1, report.Sites[0].OutageCount)
+	assert.InDelta(t, 1800, report.Devices[1].OutageSeconds, 0.001)
+	assert.InDelta(t, 75, *report.Fleet.AvailabilityPct, 0.001)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAvailabilityReport_Maintenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// rack-a（device-002）の停電は計画メンテナンス中
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectAvailabilityQueries(mock, from)
+	expectMaintenanceWindows(mock, from, maintenanceWindowRows().
+		AddRow(1, "電気工事", "group", "rack-a", from, from.Add(30*time.Minute), "none", nil, "", from))
+
+	// ハンドラー作成
+	handler := NewReportHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reports/availability?from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z", nil)
+
+	// ハンドラー実行
+	handler.GetAvailabilityReport(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report AvailabilityReport
+	err = json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, report.Devices[1].OutageSeconds)
+	assert.InDelta(t, 1800, report.Devices[1].MaintenanceSeconds, 0.001)
+	assert.Equal(t, 0, report.Fleet.OutageCount)
+	assert.Equal(t, 1, report.Fleet.ExpectedOutageCount)
+	assert.InDelta(t, 100, *report.Fleet.AvailabilityPct, 0.001)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAvailabilityReport_CSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectAvailabilityQueries(mock, from)
+	expectMaintenanceWindows(mock, from, maintenanceWindowRows())
+
+	// ハンドラー作成
+	handler := NewReportHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reports/availability?from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z&format=csv", nil)
+
+	// ハンドラー実行
+	handler.GetAvailabilityReport(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	// ヘッダー + fleet + site + group + 2デバイス
+	assert.Len(t, records, 6)
+	assert.Equal(t, "scope", records[0][0])
+	assert.Equal(t, "fleet", records[1][0])
+	assert.Equal(t, "75.000", records[1][7])
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAvailabilityReport_InvalidPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewReportHandler(db)
+
+	// fromがtoより後
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reports/availability?from=2024-02-01&to=2024-01-01", nil)
+
+	// ハンドラー実行
+	handler.GetAvailabilityReport(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetConnectivityReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// テストデータ
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := from.Add(-30 * time.Second)
+	mock.ExpectQuery("SELECT (.+) FROM devices d ORDER BY d.id").
+		WithArgs(from, "reboot").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "site", "device_group", "prior_state", "last_seen_before"}).
+			AddRow("device-001", "tokyo-office", "", "power_on", before).
+			AddRow("device-002", "tokyo-office", "", "power_on", before).
+			AddRow("device-003", "osaka-office", "", "power_on", before))
+
+	// device-002 は電波が弱く、10分間の欠落のあと再接続
+	rows := sqlmock.NewRows(append([]string{"device_id", "event_type", "timestamp"}, eventDataColumnNames...))
+	for i := 0; i < 60; i++ {
+		rows.AddRow("device-001", "periodic_status", from.Add(time.Duration(i)*time.Minute), nil, nil, nil, nil, nil, -52, nil, nil)
+	}
+	for i := 0; i < 60; i++ {
+		if i >= 20 && i < 30 {
+			continue
+		}
+		eventType := "periodic_status"
+		if i == 30 {
+			eventType = "wifi_reconnected"
+		}
+		rows.AddRow("device-002", eventType, from.Add(time.Duration(i)*time.Minute), nil, nil, nil, nil, nil, -81, nil, nil)
+	}
+	mock.ExpectQuery("SELECT device_id, event_type, timestamp, (.+) FROM power_events WHERE timestamp >= \\$1 AND timestamp < \\$2").
+		WithArgs(from, from.Add(time.Hour), "reboot").
+		WillReturnRows(rows)
+
+	// ハンドラー作成
+	handler := NewReportHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reports/connectivity?from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z&site=tokyo-office&bucket=hour", nil)
+
+	// ハンドラー実行
+	handler.GetConnectivityReport(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report ConnectivityReport
+	err = json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(t, err)
+	assert.Len(t, report.Devices, 2)
+	assert.Equal(t, "device-002", report.Devices[0].Key)
+	assert.Equal(t, 1, report.Devices[0].Rank)
+	assert.Equal(t, 1, report.Devices[0].Reconnects)
+	assert.Equal(t, 1, report.Devices[0].DeliveryGaps)
+	assert.Equal(t, 1, report.Devices[0].GapsAfterLowRSSI)
+	assert.Len(t, report.Sites, 1)
+	assert.Equal(t, 110, report.Sites[0].Samples)
+	assert.Equal(t, 50, report.Sites[0].Distribution.Poor)
+	assert.Len(t, report.Fleet.Series, 1)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetConnectivityReport_InvalidBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// ハンドラー作成
+	handler := NewReportHandler(nil)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/reports/connectivity?bucket=week", nil)
+
+	// ハンドラー実行
+	handler.GetConnectivityReport(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
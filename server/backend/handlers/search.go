@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/search"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchPowerEvents finds events by full-text search on the message and
+// predicates on event fields (see package search for the syntax), newest
+// first. from/to narrow the time range.
+func (h *PowerEventHandler) SearchPowerEvents(c *gin.Context) {
+	query, err := search.Parse(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid q: " + err.Error()})
+		return
+	}
+
+	var args []interface{}
+	var conditions []string
+	for _, param := range []struct{ name, cond string }{{"from", "timestamp >= $%d"}, {"to", "timestamp < $%d"}} {
+		v := c.Query(param.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s: %s", param.name, v)})
+			return
+		}
+		args = append(args, t)
+		conditions = append(conditions, fmt.Sprintf(param.cond, len(args)))
+	}
+	queryConditions, args := query.Where(args)
+	conditions = append(conditions, queryConditions...)
+
+	// /api/v2 はページで、/api は limit で件数を絞る
+	page, args := pageClause(c, args)
+	if page == "" {
+		limit := 100
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+				return
+			}
+			limit = n
+		}
+		args = append(args, limit)
+		page = fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := h.db.Query("SELECT "+powerEventColumns+" FROM power_events WHERE "+strings.Join(conditions, " AND ")+" ORDER BY timestamp DESC"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search power events"})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.PowerEvent{}
+	for rows.Next() {
+		var event models.PowerEvent
+		if err := scanPowerEvent(rows, &event); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan power event"})
+			return
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, events)
+}
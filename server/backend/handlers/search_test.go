@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"backend/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchPowerEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM power_events WHERE timestamp >= \\$1 AND "+
+		"to_tsvector\\('simple', COALESCE\\(message, ''\\)\\) @@ plainto_tsquery\\('simple', \\$2\\) AND "+
+		"battery_percentage < \\$3 "+
+		"ORDER BY timestamp DESC LIMIT \\$4").
+		WithArgs(from, "timeout", 20.0, 50).
+		WillReturnRows(powerEventRows().
+			AddRow(3, "device-001", "system_error", now, now, false, nil, 5000, "HTTP timeout", 15, nil, nil, nil, nil))
+
+	// ハンドラー作成
+	handler := NewPowerEventHandler(db)
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/power-events/search?q=timeout+AND+battery_percentage%3C20&from=2024-01-01&limit=50", nil)
+
+	// ハンドラー実行
+	handler.SearchPowerEvents(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events []models.PowerEvent
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	assert.Len(t, events, 1)
+	assert.Equal(t, "system_error", events[0].EventType)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchPowerEvents_InvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewPowerEventHandler(db)
+
+	for _, q := range []string{"", "battery_percentage%3C", "x%3D1%3B+DROP+TABLE+power_events--%3C1"} {
+		// リクエスト作成
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/power-events/search?q="+q, nil)
+
+		// ハンドラー実行
+		handler.SearchPowerEvents(c)
+
+		// アサーション
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+	}
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"backend/credentials"
+	"backend/models"
+	"backend/webhooks"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type WebhookHandler struct {
+	db         *sql.DB
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhookHandler(db *sql.DB, dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{db: db, dispatcher: dispatcher}
+}
+
+const webhookColumns = "id, url, description, event_types, device_ids, enabled, skip_muted, created_at, updated_at"
+
+func scanWebhook(row rowScanner, w *models.Webhook) error {
+	return row.Scan(&w.ID, &w.URL, &w.Description, pq.Array(&w.EventTypes), pq.Array(&w.DeviceIDs), &w.Enabled, &w.SkipMuted, &w.CreatedAt, &w.UpdatedAt)
+}
+
+func validateWebhookRequest(req *models.WebhookRequest) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if req.EventTypes == nil {
+		req.EventTypes = []string{}
+	}
+	if req.DeviceIDs == nil {
+		req.DeviceIDs = []string{}
+	}
+	return nil
+}
+
+func parseWebhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	page, args := pageClause(c, nil)
+	rows, err := h.db.Query("SELECT "+webhookColumns+" FROM webhooks ORDER BY id"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+	defer rows.Close()
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan webhook"})
+			return
+		}
+		hooks = append(hooks, w)
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+func (h *WebhookHandler) GetWebhookByID(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	var w models.Webhook
+	err := scanWebhook(h.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id), &w)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+// CreateWebhook registers a subscription. The signing secret is generated
+// unless given, and is only returned in this response.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Secret == "" {
+		secret, err := credentials.Generate()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+			return
+		}
+		req.Secret = secret
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	var w models.Webhook
+	err := scanWebhook(h.db.QueryRow(`
+		INSERT INTO webhooks (url, description, secret, event_types, device_ids, enabled, skip_muted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+webhookColumns,
+		req.URL, req.Description, req.Secret, pq.Array(req.EventTypes), pq.Array(req.DeviceIDs), enabled, req.SkipMuted,
+	), &w)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	w.Secret = req.Secret
+	c.JSON(http.StatusCreated, w)
+}
+
+// UpdateWebhook replaces the subscription's settings. An empty secret keeps
+// the current one.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	var w models.Webhook
+	err := scanWebhook(h.db.QueryRow(`
+		UPDATE webhooks SET url = $1, description = $2, secret = COALESCE(NULLIF($3, ''), secret),
+			event_types = $4, device_ids = $5, enabled = $6, skip_muted = $7, updated_at = $8
+		WHERE id = $9
+		RETURNING `+webhookColumns,
+		req.URL, req.Description, req.Secret, pq.Array(req.EventTypes), pq.Array(req.DeviceIDs), enabled, req.SkipMuted, time.Now(), id,
+	), &w)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+	if rowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+const webhookDeliveryColumns = "id, webhook_id, event_type, device_id, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at"
+
+func scanWebhookDelivery(row rowScanner, d *models.WebhookDelivery) error {
+	return row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.DeviceID, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+}
+
+// GetWebhookDeliveries is the delivery log of a webhook, newest first,
+// optionally filtered by status (pending, delivered or dead).
+func (h *WebhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	conditions := []string{"webhook_id = $1"}
+	args := []interface{}{id}
+	switch status := c.Query("status"); status {
+	case "":
+	case models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead:
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or dead"})
+		return
+	}
+
+	// /api/v2 はページで、/api は limit で件数を絞る
+	page, args := pageClause(c, args)
+	if page == "" {
+		limit := 100
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+				return
+			}
+			limit = n
+		}
+		args = append(args, limit)
+		page = fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := h.db.Query("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE "+strings.Join(conditions, " AND ")+" ORDER BY id DESC"+page, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook deliveries"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan webhook delivery"})
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// GetWebhookDelivery returns one delivery with its payload and every attempt.
+func (h *WebhookHandler) GetWebhookDelivery(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	var d models.WebhookDelivery
+	var payload []byte
+	row := h.db.QueryRow("SELECT "+webhookDeliveryColumns+", payload FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2", deliveryID, id)
+	err = row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.DeviceID, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt, &payload)
+	if err == sql.ErrNoRows {
+		respondError(c, http.StatusNotFound, "delivery_not_found", "Webhook delivery not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook delivery"})
+		return
+	}
+	d.Payload = payload
+
+	rows, err := h.db.Query("SELECT attempted_at, status_code, error, duration_ms FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY attempted_at", deliveryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch delivery attempts"})
+		return
+	}
+	defer rows.Close()
+
+	d.AttemptLog = []models.WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var a models.WebhookDeliveryAttempt
+		if err := rows.Scan(&a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan delivery attempt"})
+			return
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+
+	c.JSON(http.StatusOK, d)
+}
+
+// RedeliverWebhook re-queues a delivery, including dead or already delivered
+// ones, for immediate sending.
+func (h *WebhookHandler) RedeliverWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	queued, err := h.dispatcher.Redeliver(id, deliveryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver webhook"})
+		return
+	}
+	if !queued {
+		respondError(c, http.StatusNotFound, "delivery_not_found", "Webhook delivery not found")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/webhooks"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var webhookRowColumns = []string{"id", "url", "description", "event_types", "device_ids", "enabled", "skip_muted", "created_at", "updated_at"}
+
+func TestCreateWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO webhooks").
+		WithArgs("https://bms.example.com/hooks/power", "BMS", sqlmock.AnyArg(), "{\"power_off\"}", "{}", true, true).
+		WillReturnRows(sqlmock.NewRows(webhookRowColumns).
+			AddRow(1, "https://bms.example.com/hooks/power", "BMS", "{power_off}", "{}", true, true, now, now))
+
+	// ハンドラー作成
+	handler := NewWebhookHandler(db, webhooks.NewDispatcher(db, webhooks.DefaultOptions()))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/webhooks", strings.NewReader(`{"url": "https://bms.example.com/hooks/power", "description": "BMS", "event_types": ["power_off"], "skip_muted": true}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateWebhook(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response models.Webhook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.ID)
+	assert.Equal(t, []string{"power_off"}, response.EventTypes)
+	assert.Equal(t, []string{}, response.DeviceIDs)
+	assert.True(t, response.SkipMuted)
+	// シークレットは作成時のみ返す
+	assert.Len(t, response.Secret, 64)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateWebhook_InvalidURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// ハンドラー作成
+	handler := NewWebhookHandler(db, webhooks.NewDispatcher(db, webhooks.DefaultOptions()))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/webhooks", strings.NewReader(`{"url": "ftp://bms.example.com"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.CreateWebhook(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateWebhook_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE webhooks SET url = \\$1").
+		WithArgs("https://bms.example.com/hooks", "", "", "{}", "{}", false, false, sqlmock.AnyArg(), 99).
+		WillReturnRows(sqlmock.NewRows(webhookRowColumns))
+
+	// ハンドラー作成
+	handler := NewWebhookHandler(db, webhooks.NewDispatcher(db, webhooks.DefaultOptions()))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "99"}}
+	c.Request = httptest.NewRequest("PUT", "/api/webhooks/99", strings.NewReader(`{"url": "https://bms.example.com/hooks", "enabled": false}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// ハンドラー実行
+	handler.UpdateWebhook(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetWebhookDeliveries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM webhook_deliveries WHERE webhook_id = \\$1 AND status = \\$2 ORDER BY id DESC LIMIT \\$3").
+		WithArgs(1, "dead", 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_type", "device_id", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"}).
+			AddRow(7, 1, "power_off", "device-001", "dead", 10, now, 502, "unexpected status 502", now, nil))
+
+	// ハンドラー作成
+	handler := NewWebhookHandler(db, webhooks.NewDispatcher(db, webhooks.DefaultOptions()))
+
+	// リクエスト作成
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Request = httptest.NewRequest("GET", "/api/webhooks/1/deliveries?status=dead", nil)
+
+	// ハンドラー実行
+	handler.GetWebhookDeliveries(c)
+
+	// アサーション
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []models.WebhookDelivery
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.Equal(t, "dead", response[0].Status)
+	assert.Equal(t, 502, *response[0].LastStatusCode)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = 0").
+		WithArgs(models.WebhookDeliveryPending, sqlmock.AnyArg(), int64(7), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = 0").
+		WithArgs(models.WebhookDeliveryPending, sqlmock.AnyArg(), int64(8), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// ハンドラー作成
+	handler := NewWebhookHandler(db, webhooks.NewDispatcher(db, webhooks.DefaultOptions()))
+
+	redeliver := func(deliveryID string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "deliveryId", Value: deliveryID}}
+		c.Request = httptest.NewRequest("POST", "/api/webhooks/1/deliveries/"+deliveryID+"/redeliver", nil)
+		handler.RedeliverWebhook(c)
+		return w.Code
+	}
+
+	// アサーション
+	assert.Equal(t, http.StatusAccepted, redeliver("7"))
+	assert.Equal(t, http.StatusNotFound, redeliver("8"))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
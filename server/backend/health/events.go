@@ -0,0 +1,31 @@
+package health
+
+import (
+	"backend/analysis"
+	"backend/models"
+	"database/sql"
+	"time"
+)
+
+// LoadDeviceEvents loads a device's events since the given time, oldest first,
+// with their data. Detected reboots are left out: they carry the uptime and a
+// message but no readings, and are dated at the boot time.
+func LoadDeviceEvents(db *sql.DB, deviceID string, since time.Time) ([]analysis.Event, error) {
+	rows, err := db.Query("SELECT event_type, timestamp, "+models.EventDataColumns+" FROM power_events WHERE device_id = $1 AND timestamp >= $2 AND event_type <> $3 ORDER BY timestamp", deviceID, since, EventTypeReboot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []analysis.Event
+	for rows.Next() {
+		e := analysis.Event{DeviceID: deviceID}
+		var data models.EventData
+		if err := rows.Scan(append([]interface{}{&e.EventType, &e.Timestamp}, data.ScanFields()...)...); err != nil {
+			return nil, err
+		}
+		e.SetData(data)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
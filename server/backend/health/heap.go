@@ -0,0 +1,107 @@
+package health
+
+import (
+	"backend/alerts"
+	"backend/analysis"
+	"backend/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// HeapAnalyzer periodically fits free_heap trends for recently active devices
+// and stores the current boot session's result in device_heap_analysis.
+type HeapAnalyzer struct {
+	db       *sql.DB
+	alerts   *alerts.Manager
+	opts     analysis.HeapOptions
+	lookback time.Duration
+}
+
+func NewHeapAnalyzer(db *sql.DB, alertManager *alerts.Manager, opts analysis.HeapOptions) *HeapAnalyzer {
+	return &HeapAnalyzer{db: db, alerts: alertManager, opts: opts, lookback: 7 * 24 * time.Hour}
+}
+
+func (a *HeapAnalyzer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.RunOnce(time.Now()); err != nil {
+			log.Printf("Heap analysis failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *HeapAnalyzer) RunOnce(now time.Time) error {
+	rows, err := a.db.Query("SELECT id FROM devices WHERE last_seen >= $1 ORDER BY id", now.Add(-a.lookback))
+	if err != nil {
+		return err
+	}
+	var deviceIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range deviceIDs {
+		if err := a.AnalyzeDevice(id, now); err != nil {
+			log.Printf("Heap analysis failed for device %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (a *HeapAnalyzer) AnalyzeDevice(deviceID string, now time.Time) error {
+	events, err := LoadDeviceEvents(a.db, deviceID, now.Add(-a.lookback))
+	if err != nil {
+		return err
+	}
+	sessions := analysis.AnalyzeHeap(events, a.opts)
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	// 判定対象は現在の起動セッション
+	s := sessions[len(sessions)-1]
+	_, err = a.db.Exec(`
+		INSERT INTO device_heap_analysis (device_id, analyzed_at, session_started_at, samples, current_free_heap,
+			slope_bytes_per_hour, r_squared, leak_suspected, projected_exhaustion_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (device_id) DO UPDATE SET
+			analyzed_at = $2, session_started_at = $3, samples = $4, current_free_heap = $5,
+			slope_bytes_per_hour = $6, r_squared = $7, leak_suspected = $8, projected_exhaustion_at = $9`,
+		deviceID, now, s.StartedAt, s.Samples, s.LastFreeHeap, s.SlopeBytesPerHour, s.RSquared, s.LeakSuspected, s.ProjectedExhaustionAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if !s.LeakSuspected {
+		return a.alerts.Resolve(deviceID, models.AlertMemoryLeak, now)
+	}
+	_, err = a.alerts.Raise(models.Alert{
+		DeviceID:  deviceID,
+		AlertType: models.AlertMemoryLeak,
+		Severity:  "warning",
+		Message: fmt.Sprintf("Free heap declining %.0f bytes/hour, exhaustion projected at %s",
+			-*s.SlopeBytesPerHour, s.ProjectedExhaustionAt.Format(time.RFC3339)),
+		CreatedAt: now,
+	})
+	return err
+}
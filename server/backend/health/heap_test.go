@@ -0,0 +1,97 @@
+package health
+
+import (
+	"backend/alerts"
+	"backend/analysis"
+	"backend/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventRows は LoadDeviceEvents が読む列を持つ空の結果を返す
+func eventRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"event_type", "timestamp",
+		"client_timestamp", "uptime_ms", "message", "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap", "data"})
+}
+
+// 1時間に rate バイトずつ free_heap が変化する6時間分のイベント
+func heapRows(start time.Time, rate float64) *sqlmock.Rows {
+	rows := eventRows()
+	for i := 0; i < 360; i++ {
+		rows.AddRow("periodic_status", start.Add(time.Duration(i)*time.Minute),
+			nil, (i+1)*60000, nil, nil, nil, nil, int(60000+rate*float64(i)/60), nil)
+	}
+	return rows
+}
+
+func TestAnalyzeDevice_LeakRaisesAlert(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT event_type, timestamp, (.+) FROM power_events WHERE device_id = \\$1").
+		WithArgs("device-001", now.Add(-7*24*time.Hour), EventTypeReboot).
+		WillReturnRows(heapRows(now.Add(-6*time.Hour), -1000))
+	mock.ExpectExec("INSERT INTO device_heap_analysis").
+		WithArgs("device-001", now, sqlmock.AnyArg(), 360, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO alerts").
+		WithArgs("device-001", models.AlertMemoryLeak, "warning", sqlmock.AnyArg(), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	analyzer := NewHeapAnalyzer(db, alerts.NewManager(db), analysis.DefaultHeapOptions())
+	assert.NoError(t, analyzer.AnalyzeDevice("device-001", now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAnalyzeDevice_StableResolvesAlert(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT event_type, timestamp, (.+) FROM power_events WHERE device_id = \\$1").
+		WillReturnRows(heapRows(now.Add(-6*time.Hour), 0))
+	mock.ExpectExec("INSERT INTO device_heap_analysis").
+		WithArgs("device-001", now, sqlmock.AnyArg(), 360, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE alerts SET resolved_at = \\$1").
+		WithArgs(now, "device-001", models.AlertMemoryLeak).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	analyzer := NewHeapAnalyzer(db, alerts.NewManager(db), analysis.DefaultHeapOptions())
+	assert.NoError(t, analyzer.AnalyzeDevice("device-001", now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunOnce(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id FROM devices WHERE last_seen >= \\$1").
+		WithArgs(now.Add(-7 * 24 * time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("device-001"))
+
+	// free_heap のデータがなければ何も保存しない
+	mock.ExpectQuery("SELECT event_type, timestamp, (.+) FROM power_events WHERE device_id = \\$1").
+		WillReturnRows(eventRows())
+
+	analyzer := NewHeapAnalyzer(db, alerts.NewManager(db), analysis.DefaultHeapOptions())
+	assert.NoError(t, analyzer.RunOnce(now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,110 @@
+// Package health derives device health from the event stream: reboots and
+// crash loops detected on ingest, and free_heap trends analysed periodically.
+package health
+
+import (
+	"backend/alerts"
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const EventTypeReboot = "reboot"
+
+type RebootDetector struct {
+	db        *sql.DB
+	alerts    *alerts.Manager
+	threshold int
+	window    time.Duration
+}
+
+// NewRebootDetector flags a device as crash-looping when it reboots more than
+// threshold times within window.
+func NewRebootDetector(db *sql.DB, alertManager *alerts.Manager, threshold int, window time.Duration) *RebootDetector {
+	return &RebootDetector{db: db, alerts: alertManager, threshold: threshold, window: window}
+}
+
+// Check must run before the new event is stored, so that the latest stored
+// event is the previous one. A drop in uptime_ms means the device restarted
+// in between, whether or not it sent a power_on.
+func (d *RebootDetector) Check(deviceID, eventType string, uptimeMs int64, at time.Time) error {
+	var previous sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT uptime_ms FROM power_events
+		WHERE device_id = $1 AND event_type <> $2
+		ORDER BY timestamp DESC LIMIT 1`,
+		deviceID, EventTypeReboot,
+	).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if uptimeMs > 0 && previous.Valid && previous.Int64 > 0 && uptimeMs < previous.Int64 {
+		return d.recordReboot(deviceID, eventType, uptimeMs, previous.Int64, at)
+	}
+	return d.clearCrashLoop(deviceID, at)
+}
+
+func (d *RebootDetector) recordReboot(deviceID, eventType string, uptimeMs, previousUptimeMs int64, at time.Time) error {
+	bootTime := at.Add(-time.Duration(uptimeMs) * time.Millisecond)
+	// 再起動の詳細は型付きの列にない項目なので data に入れる
+	message := fmt.Sprintf("Reboot detected (uptime reset from %d ms to %d ms)", previousUptimeMs, uptimeMs)
+	details := models.JSONObject{
+		"previous_uptime_ms": previousUptimeMs,
+		"trigger_event_type": eventType,
+		"clean_boot":         eventType == "power_on",
+	}
+
+	_, err := d.db.Exec(
+		"INSERT INTO power_events (device_id, event_type, message, uptime_ms, data, timestamp) VALUES ($1, $2, $3, $4, $5, $6)",
+		deviceID, EventTypeReboot, message, uptimeMs, details, bootTime,
+	)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = d.db.QueryRow("SELECT COUNT(*) FROM power_events WHERE device_id = $1 AND event_type = $2 AND timestamp >= $3",
+		deviceID, EventTypeReboot, at.Add(-d.window)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count <= d.threshold {
+		return nil
+	}
+
+	result, err := d.db.Exec("UPDATE devices SET crash_loop_since = $1 WHERE id = $2 AND crash_loop_since IS NULL", at, deviceID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	_, err = d.alerts.Raise(models.Alert{
+		DeviceID:  deviceID,
+		AlertType: models.AlertCrashLoop,
+		Severity:  "critical",
+		Message:   fmt.Sprintf("Device rebooted %d times within %s", count, d.window),
+		CreatedAt: at,
+	})
+	return err
+}
+
+// clearCrashLoop lifts the flag once no reboot has happened for a full window.
+func (d *RebootDetector) clearCrashLoop(deviceID string, at time.Time) error {
+	result, err := d.db.Exec(`
+		UPDATE devices SET crash_loop_since = NULL
+		WHERE id = $1 AND crash_loop_since IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM power_events WHERE device_id = $1 AND event_type = $2 AND timestamp >= $3)`,
+		deviceID, EventTypeReboot, at.Add(-d.window),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	return d.alerts.Resolve(deviceID, models.AlertCrashLoop, at)
+}
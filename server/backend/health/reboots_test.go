@@ -0,0 +1,113 @@
+package health
+
+import (
+	"backend/alerts"
+	"backend/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck_NoReset(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT uptime_ms FROM power_events").
+		WithArgs("device-001", EventTypeReboot).
+		WillReturnRows(sqlmock.NewRows([]string{"uptime_ms"}).AddRow(60000))
+
+	// 再起動がなければクラッシュループの解除のみ確認
+	mock.ExpectExec("UPDATE devices SET crash_loop_since = NULL").
+		WithArgs("device-001", EventTypeReboot, now.Add(-time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	detector := NewRebootDetector(db, alerts.NewManager(db), 3, time.Hour)
+	assert.NoError(t, detector.Check("device-001", "periodic_status", 120000, now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheck_ResetRecordsReboot(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT uptime_ms FROM power_events").
+		WithArgs("device-001", EventTypeReboot).
+		WillReturnRows(sqlmock.NewRows([]string{"uptime_ms"}).AddRow(3600000))
+
+	// 起動時刻は現在時刻 - uptime_ms
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", EventTypeReboot, sqlmock.AnyArg(), 5000, sqlmock.AnyArg(), now.Add(-5*time.Second)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events WHERE device_id = \\$1 AND event_type = \\$2").
+		WithArgs("device-001", EventTypeReboot, now.Add(-time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	detector := NewRebootDetector(db, alerts.NewManager(db), 3, time.Hour)
+	assert.NoError(t, detector.Check("device-001", "system_error", 5000, now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheck_CrashLoopRaisesAlert(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT uptime_ms FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"uptime_ms"}).AddRow(20000))
+	mock.ExpectExec("INSERT INTO power_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// 時間窓内に4回目の再起動
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectExec("UPDATE devices SET crash_loop_since = \\$1").
+		WithArgs(now, "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO alerts").
+		WithArgs("device-001", models.AlertCrashLoop, "critical", sqlmock.AnyArg(), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	detector := NewRebootDetector(db, alerts.NewManager(db), 3, time.Hour)
+	assert.NoError(t, detector.Check("device-001", "power_on", 3000, now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheck_CrashLoopClears(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT uptime_ms FROM power_events").
+		WillReturnRows(sqlmock.NewRows([]string{"uptime_ms"}).AddRow(3500000))
+
+	// 時間窓内に再起動がなくなったらフラグを解除してアラートを解決
+	mock.ExpectExec("UPDATE devices SET crash_loop_since = NULL").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE alerts SET resolved_at = \\$1").
+		WithArgs(now, "device-001", models.AlertCrashLoop).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	detector := NewRebootDetector(db, alerts.NewManager(db), 3, time.Hour)
+	assert.NoError(t, detector.Check("device-001", "periodic_status", 3600000, now))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,336 @@
+// Package homeassistant announces devices to Home Assistant via MQTT
+// discovery and publishes their state after each stored event.
+package homeassistant
+
+import (
+	"backend/ingest"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"regexp"
+	"time"
+)
+
+// MessagePublisher is the MQTT connection discovery messages go out on:
+// the external broker client or the embedded broker.
+type MessagePublisher interface {
+	Publish(topic string, payload []byte, retain bool) error
+}
+
+type Options struct {
+	// Home Assistant's discovery prefix, "homeassistant" by default.
+	DiscoveryPrefix string
+	// Prefix of the device topics; state goes to <prefix>/<device_id>/state.
+	TopicPrefix string
+}
+
+// State is the retained JSON payload on each device's state topic.
+type State struct {
+	Mains              string    `json:"mains"`
+	Connectivity       string    `json:"connectivity"`
+	BatteryPercentage  *int      `json:"battery_percentage,omitempty"`
+	BatteryVoltage     *float64  `json:"battery_voltage,omitempty"`
+	WiFiSignalStrength *int      `json:"wifi_signal_strength,omitempty"`
+	LastEvent          string    `json:"last_event,omitempty"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type device struct {
+	ID              string
+	Name            string
+	Model           string
+	FirmwareVersion string
+}
+
+type update struct {
+	event  *ingest.StoredEvent
+	device string
+	online bool
+	at     time.Time
+}
+
+type Publisher struct {
+	db     *sql.DB
+	client MessagePublisher
+	opts   Options
+	queue  chan update
+
+	// Worker-owned: last published state and discovery config per device.
+	states  map[string]*State
+	configs map[string]string
+}
+
+func NewPublisher(db *sql.DB, client MessagePublisher, opts Options) *Publisher {
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = "homeassistant"
+	}
+	return &Publisher{
+		db:      db,
+		client:  client,
+		opts:    opts,
+		queue:   make(chan update, 256),
+		states:  map[string]*State{},
+		configs: map[string]string{},
+	}
+}
+
+// EventStored implements ingest.Listener. Updates are dropped when the
+// worker falls behind rather than slowing down ingest.
+func (p *Publisher) EventStored(e ingest.StoredEvent) {
+	p.enqueue(update{event: &e, device: e.DeviceID, at: e.ReceivedAt})
+}
+
+// ConnectionChanged implements ingest.ConnectionListener.
+func (p *Publisher) ConnectionChanged(deviceID string, online bool, at time.Time) {
+	p.enqueue(update{device: deviceID, online: online, at: at})
+}
+
+func (p *Publisher) enqueue(u update) {
+	select {
+	case p.queue <- u:
+	default:
+		log.Printf("Home Assistant update queue full, dropping update for device %s", u.device)
+	}
+}
+
+// Run announces every registered device, then publishes queued updates
+// until ctx is cancelled.
+func (p *Publisher) Run(ctx context.Context) {
+	if err := p.PublishAll(); err != nil {
+		log.Printf("Failed to publish Home Assistant discovery: %v", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-p.queue:
+			if err := p.apply(u); err != nil {
+				log.Printf("Failed to publish Home Assistant state for device %s: %v", u.device, err)
+			}
+		}
+	}
+}
+
+// PublishAll sends discovery configs for all devices in the registry.
+func (p *Publisher) PublishAll() error {
+	rows, err := p.db.Query("SELECT id, name, COALESCE(model, ''), COALESCE(firmware_version, '') FROM devices ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var devices []device
+	for rows.Next() {
+		var d device
+		if err := rows.Scan(&d.ID, &d.Name, &d.Model, &d.FirmwareVersion); err != nil {
+			rows.Close()
+			return err
+		}
+		devices = append(devices, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		if err := p.announce(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) apply(u update) error {
+	d, err := p.loadDevice(u.device)
+	if err != nil {
+		return err
+	}
+	// 名前やファームウェアが変わった場合も設定を送り直す
+	if err := p.announce(d); err != nil {
+		return err
+	}
+
+	state, err := p.state(u.device)
+	if err != nil {
+		return err
+	}
+	state.UpdatedAt = u.at
+	if u.event == nil {
+		state.Connectivity = onOff(u.online)
+	} else {
+		applyEvent(state, u.event)
+	}
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(p.stateTopic(u.device), payload, true)
+}
+
+func applyEvent(state *State, e *ingest.StoredEvent) {
+	state.Connectivity = "ON"
+	state.LastEvent = e.EventType
+	switch e.EventType {
+	case "power_on":
+		state.Mains = "ON"
+	case "power_off":
+		state.Mains = "OFF"
+	}
+
+	// 0 はファームウェアが値を送らなかったものとみなす
+	if e.BatteryPercentage > 0 || e.BatteryVoltage > 0 {
+		pct, volt := e.BatteryPercentage, e.BatteryVoltage
+		state.BatteryPercentage, state.BatteryVoltage = &pct, &volt
+	}
+	if e.WiFiSignalStrength < 0 {
+		rssi := e.WiFiSignalStrength
+		state.WiFiSignalStrength = &rssi
+	}
+}
+
+// state returns the cached state, seeding mains and connectivity from the
+// database the first time a device is seen.
+func (p *Publisher) state(deviceID string) (*State, error) {
+	if s, ok := p.states[deviceID]; ok {
+		return s, nil
+	}
+
+	s := &State{Mains: "ON", Connectivity: "ON"}
+	var lastPowerEvent sql.NullString
+	var offline bool
+	err := p.db.QueryRow(`
+		SELECT (SELECT event_type FROM power_events
+				WHERE device_id = $1 AND event_type IN ('power_on', 'power_off')
+				ORDER BY timestamp DESC LIMIT 1),
+			offline_since IS NOT NULL
+		FROM devices WHERE id = $1`, deviceID).Scan(&lastPowerEvent, &offline)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if lastPowerEvent.String == "power_off" {
+		s.Mains = "OFF"
+	}
+	if offline {
+		s.Connectivity = "OFF"
+	}
+	p.states[deviceID] = s
+	return s, nil
+}
+
+func (p *Publisher) loadDevice(deviceID string) (device, error) {
+	d := device{ID: deviceID}
+	err := p.db.QueryRow("SELECT name, COALESCE(model, ''), COALESCE(firmware_version, '') FROM devices WHERE id = $1", deviceID).
+		Scan(&d.Name, &d.Model, &d.FirmwareVersion)
+	return d, err
+}
+
+func (p *Publisher) stateTopic(deviceID string) string {
+	return p.opts.TopicPrefix + "/" + deviceID + "/state"
+}
+
+var unsafeObjectID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// nodeID is the device's ID in discovery topics, which only allow
+// [a-zA-Z0-9_-].
+func nodeID(deviceID string) string {
+	return "powerlogger_" + unsafeObjectID.ReplaceAllString(deviceID, "_")
+}
+
+type entity struct {
+	component string
+	objectID  string
+	config    map[string]interface{}
+}
+
+func (p *Publisher) entities(d device) []entity {
+	node := nodeID(d.ID)
+	haDevice := map[string]interface{}{
+		"identifiers":  []string{node},
+		"name":         d.Name,
+		"manufacturer": "M5Stack",
+	}
+	if d.Model != "" {
+		haDevice["model"] = d.Model
+	}
+	if d.FirmwareVersion != "" {
+		haDevice["sw_version"] = d.FirmwareVersion
+	}
+
+	base := func(objectID, name, template string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":           name,
+			"unique_id":      node + "_" + objectID,
+			"object_id":      node + "_" + objectID,
+			"state_topic":    p.stateTopic(d.ID),
+			"value_template": template,
+			"device":         haDevice,
+		}
+	}
+
+	mains := base("mains", "Mains power", "{{ value_json.mains }}")
+	mains["device_class"] = "power"
+
+	battery := base("battery", "Battery", "{{ value_json.battery_percentage }}")
+	battery["device_class"] = "battery"
+	battery["unit_of_measurement"] = "%"
+	battery["state_class"] = "measurement"
+
+	voltage := base("battery_voltage", "Battery voltage", "{{ value_json.battery_voltage }}")
+	voltage["device_class"] = "voltage"
+	voltage["unit_of_measurement"] = "V"
+	voltage["state_class"] = "measurement"
+
+	rssi := base("rssi", "WiFi signal", "{{ value_json.wifi_signal_strength }}")
+	rssi["device_class"] = "signal_strength"
+	rssi["unit_of_measurement"] = "dBm"
+	rssi["state_class"] = "measurement"
+	rssi["entity_category"] = "diagnostic"
+
+	connectivity := base("connectivity", "Connectivity", "{{ value_json.connectivity }}")
+	connectivity["device_class"] = "connectivity"
+	connectivity["entity_category"] = "diagnostic"
+
+	return []entity{
+		{"binary_sensor", "mains", mains},
+		{"sensor", "battery", battery},
+		{"sensor", "battery_voltage", voltage},
+		{"sensor", "rssi", rssi},
+		{"binary_sensor", "connectivity", connectivity},
+	}
+}
+
+// announce publishes the retained discovery configs for a device unless the
+// same configs were already sent.
+func (p *Publisher) announce(d device) error {
+	entities := p.entities(d)
+	payloads := make([][]byte, len(entities))
+	var all []byte
+	for i, e := range entities {
+		b, err := json.Marshal(e.config)
+		if err != nil {
+			return err
+		}
+		payloads[i] = b
+		all = append(all, b...)
+	}
+	if p.configs[d.ID] == string(all) {
+		return nil
+	}
+
+	for i, e := range entities {
+		topic := p.opts.DiscoveryPrefix + "/" + e.component + "/" + nodeID(d.ID) + "/" + e.objectID + "/config"
+		if err := p.client.Publish(topic, payloads[i], true); err != nil {
+			return err
+		}
+	}
+	p.configs[d.ID] = string(all)
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,130 @@
+package homeassistant
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+type fakeClient struct {
+	messages []message
+}
+
+func (f *fakeClient) Publish(topic string, payload []byte, retain bool) error {
+	f.messages = append(f.messages, message{topic, payload, retain})
+	return nil
+}
+
+func deviceRow(name, firmware string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"name", "model", "firmware_version"}).AddRow(name, "M5StickCPlus2", firmware)
+}
+
+func TestPublishAll(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, name, COALESCE\\(model, ''\\), COALESCE\\(firmware_version, ''\\) FROM devices").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "model", "firmware_version"}).
+			AddRow("device-001", "Office", "M5StickCPlus2", "1.2.0"))
+
+	client := &fakeClient{}
+	p := NewPublisher(db, client, Options{TopicPrefix: "powerlogger"})
+	assert.NoError(t, p.PublishAll())
+
+	// アサーション
+	assert.Len(t, client.messages, 5)
+	first := client.messages[0]
+	assert.Equal(t, "homeassistant/binary_sensor/powerlogger_device-001/mains/config", first.topic)
+	assert.True(t, first.retain)
+
+	var config map[string]interface{}
+	assert.NoError(t, json.Unmarshal(first.payload, &config))
+	assert.Equal(t, "powerlogger_device-001_mains", config["unique_id"])
+	assert.Equal(t, "power", config["device_class"])
+	assert.Equal(t, "powerlogger/device-001/state", config["state_topic"])
+	device := config["device"].(map[string]interface{})
+	assert.Equal(t, "Office", device["name"])
+	assert.Equal(t, "1.2.0", device["sw_version"])
+
+	rssi := client.messages[3]
+	assert.Equal(t, "homeassistant/sensor/powerlogger_device-001/rssi/config", rssi.topic)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApply_PublishesState(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT name, COALESCE\\(model, ''\\), COALESCE\\(firmware_version, ''\\) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(deviceRow("Office", "1.2.0"))
+	mock.ExpectQuery("SELECT \\(SELECT event_type FROM power_events").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"event_type", "offline"}).AddRow("power_on", false))
+	// 2回目は設定が変わっていないので state のみ
+	mock.ExpectQuery("SELECT name, COALESCE\\(model, ''\\), COALESCE\\(firmware_version, ''\\) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(deviceRow("Office", "1.2.0"))
+	// ファームウェア更新で設定を送り直す
+	mock.ExpectQuery("SELECT name, COALESCE\\(model, ''\\), COALESCE\\(firmware_version, ''\\) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(deviceRow("Office", "1.3.0"))
+
+	client := &fakeClient{}
+	p := NewPublisher(db, client, Options{TopicPrefix: "powerlogger"})
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	event := ingest.StoredEvent{
+		PowerEventRequest: models.PowerEventRequest{DeviceID: "device-001", EventType: "power_off", BatteryPercentage: 80, BatteryVoltage: 3.9, WiFiSignalStrength: -60},
+		ReceivedAt:        at,
+	}
+	assert.NoError(t, p.apply(update{event: &event, device: "device-001", at: at}))
+	assert.Len(t, client.messages, 6)
+
+	last := client.messages[5]
+	assert.Equal(t, "powerlogger/device-001/state", last.topic)
+	assert.True(t, last.retain)
+	var state State
+	assert.NoError(t, json.Unmarshal(last.payload, &state))
+	assert.Equal(t, "OFF", state.Mains)
+	assert.Equal(t, "ON", state.Connectivity)
+	assert.Equal(t, 80, *state.BatteryPercentage)
+	assert.Equal(t, -60, *state.WiFiSignalStrength)
+
+	assert.NoError(t, p.apply(update{device: "device-001", online: false, at: at.Add(time.Minute)}))
+	assert.Len(t, client.messages, 7)
+	assert.NoError(t, json.Unmarshal(client.messages[6].payload, &state))
+	assert.Equal(t, "OFF", state.Connectivity)
+	assert.Equal(t, "OFF", state.Mains)
+
+	assert.NoError(t, p.apply(update{device: "device-001", online: true, at: at.Add(2 * time.Minute)}))
+	assert.Len(t, client.messages, 13)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnqueue_DropsWhenFull(t *testing.T) {
+	p := NewPublisher(nil, &fakeClient{}, Options{TopicPrefix: "powerlogger"})
+	for i := 0; i < cap(p.queue)+10; i++ {
+		p.ConnectionChanged("device-001", true, time.Now())
+	}
+	assert.Len(t, p.queue, cap(p.queue))
+}
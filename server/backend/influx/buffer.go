@@ -0,0 +1,96 @@
+package influx
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buffer keeps batches that could not be written as files in a directory so
+// they survive restarts. When the directory grows past maxBytes the oldest
+// batches are dropped.
+type Buffer struct {
+	dir      string
+	maxBytes int64
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewBuffer(dir string, maxBytes int64) (*Buffer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Buffer{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Put stores a batch. The file is written under a temporary name and renamed
+// so a crash never leaves a partial batch behind.
+func (b *Buffer) Put(batch []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	name := fmt.Sprintf("%020d-%06d.lp", time.Now().UnixNano(), b.seq)
+	tmp := filepath.Join(b.dir, name+".tmp")
+	if err := os.WriteFile(tmp, batch, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(b.dir, name)); err != nil {
+		return err
+	}
+	return b.trim()
+}
+
+// Pending returns the buffered batch files, oldest first.
+func (b *Buffer) Pending() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".lp") {
+			files = append(files, filepath.Join(b.dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (b *Buffer) Remove(file string) error {
+	return os.Remove(file)
+}
+
+func (b *Buffer) trim() error {
+	if b.maxBytes <= 0 {
+		return nil
+	}
+	files, err := b.Pending()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		sizes[i] = info.Size()
+		total += sizes[i]
+	}
+	for i := 0; total > b.maxBytes && i < len(files)-1; i++ {
+		if err := os.Remove(files[i]); err != nil {
+			return err
+		}
+		total -= sizes[i]
+		log.Printf("InfluxDB buffer over limit, dropped oldest batch %s", files[i])
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package influx
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+type Options struct {
+	// Write endpoint, e.g. http://influxdb:8086/api/v2/write?org=o&bucket=b&precision=ns
+	// or VictoriaMetrics' http://victoria:8428/write.
+	URL string
+	// Sent as "Authorization: Token <token>" when set.
+	Token         string
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// writeError is a failed write. Retryable errors (network, 429, 5xx) are
+// kept in the buffer; anything else means the endpoint rejected the data
+// and resending it would fail the same way.
+type writeError struct {
+	status    int
+	retryable bool
+	err       error
+}
+
+func (e *writeError) Error() string {
+	if e.status != 0 {
+		return fmt.Sprintf("write endpoint returned %d: %v", e.status, e.err)
+	}
+	return e.err.Error()
+}
+
+type siteEntry struct {
+	site     string
+	loadedAt time.Time
+}
+
+const siteCacheTTL = 5 * time.Minute
+
+// Exporter converts stored events to line protocol and writes them in batches.
+type Exporter struct {
+	db     *sql.DB
+	opts   Options
+	client *http.Client
+	buffer *Buffer
+	queue  chan ingest.StoredEvent
+
+	// Worker-owned cache of each device's site tag.
+	sites map[string]siteEntry
+
+	backfilling atomic.Bool
+}
+
+func NewExporter(db *sql.DB, buffer *Buffer, opts Options) *Exporter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	return &Exporter{
+		db:     db,
+		opts:   opts,
+		client: &http.Client{Timeout: 30 * time.Second},
+		buffer: buffer,
+		queue:  make(chan ingest.StoredEvent, opts.BatchSize*10),
+		sites:  map[string]siteEntry{},
+	}
+}
+
+// EventStored implements ingest.Listener. If the worker has fallen this far
+// behind the event is dropped (it can be recovered with a backfill).
+func (e *Exporter) EventStored(ev ingest.StoredEvent) {
+	select {
+	case e.queue <- ev:
+	default:
+		log.Printf("InfluxDB export queue full, dropping event from device %s", ev.DeviceID)
+	}
+}
+
+// Run batches queued events until ctx is cancelled. A batch is written when
+// it reaches BatchSize or every FlushInterval; failed batches go to the disk
+// buffer and are retried, oldest first, before each new batch.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []byte
+	lines := 0
+	flush := func() {
+		e.flush(batch)
+		batch, lines = nil, 0
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if lines > 0 {
+				// 終了時は送信を待たずにバッファへ退避
+				if err := e.buffer.Put(batch); err != nil {
+					log.Printf("Failed to buffer InfluxDB batch: %v", err)
+				}
+			}
+			return
+		case ev := <-e.queue:
+			batch = e.point(ev).AppendLine(batch)
+			lines++
+			if lines >= e.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *Exporter) point(ev ingest.StoredEvent) Point {
+	return PointFromEvent(ev.DeviceID, e.site(ev.DeviceID), ev.EventType, ev.Data, ev.ReceivedAt)
+}
+
+func (e *Exporter) site(deviceID string) string {
+	if s, ok := e.sites[deviceID]; ok && time.Since(s.loadedAt) < siteCacheTTL {
+		return s.site
+	}
+	var site string
+	err := e.db.QueryRow("SELECT COALESCE(site, '') FROM devices WHERE id = $1", deviceID).Scan(&site)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to load site for device %s: %v", deviceID, err)
+	}
+	e.sites[deviceID] = siteEntry{site: site, loadedAt: time.Now()}
+	return site
+}
+
+// flush retries buffered batches and then writes batch. While older batches
+// are still failing the new one is buffered behind them.
+func (e *Exporter) flush(batch []byte) {
+	if !e.retryBuffered() {
+		if len(batch) > 0 {
+			if err := e.buffer.Put(batch); err != nil {
+				log.Printf("Failed to buffer InfluxDB batch: %v", err)
+			}
+		}
+		return
+	}
+	if len(batch) == 0 {
+		return
+	}
+	if err := e.write(batch); err != nil {
+		log.Printf("Failed to write to InfluxDB: %v", err)
+		if werr, ok := err.(*writeError); ok && werr.retryable {
+			if err := e.buffer.Put(batch); err != nil {
+				log.Printf("Failed to buffer InfluxDB batch: %v", err)
+			}
+		}
+	}
+}
+
+// retryBuffered writes buffered batches in order and reports whether the
+// buffer is now empty.
+func (e *Exporter) retryBuffered() bool {
+	files, err := e.buffer.Pending()
+	if err != nil {
+		log.Printf("Failed to read InfluxDB buffer: %v", err)
+		return false
+	}
+	for _, f := range files {
+		batch, err := os.ReadFile(f)
+		if err != nil {
+			log.Printf("Failed to read buffered batch %s: %v", f, err)
+			return false
+		}
+		if err := e.write(batch); err != nil {
+			if werr, ok := err.(*writeError); ok && werr.retryable {
+				return false
+			}
+			log.Printf("Dropping buffered batch %s rejected by InfluxDB: %v", f, err)
+		}
+		if err := e.buffer.Remove(f); err != nil {
+			log.Printf("Failed to remove buffered batch %s: %v", f, err)
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Exporter) write(batch []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.opts.URL, bytes.NewReader(batch))
+	if err != nil {
+		return &writeError{err: err}
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.opts.Token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return &writeError{retryable: true, err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &writeError{
+		status:    resp.StatusCode,
+		retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		err:       fmt.Errorf("%s", bytes.TrimSpace(body)),
+	}
+}
+
+// Backfill writes stored events within [from, to) in BatchSize pages and
+// returns how many were written. It stops at the first failed write, which
+// is returned rather than buffered.
+func (e *Exporter) Backfill(ctx context.Context, from, to time.Time) (int, error) {
+	written, lastID := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		rows, err := e.db.QueryContext(ctx, `
+			SELECT pe.id, pe.device_id, COALESCE(d.site, ''), pe.event_type, pe.timestamp, `+models.EventDataColumns+`
+			FROM power_events pe
+			JOIN devices d ON d.id = pe.device_id
+			WHERE pe.timestamp >= $1 AND pe.timestamp < $2 AND pe.id > $3
+			ORDER BY pe.id
+			LIMIT $4`, from, to, lastID, e.opts.BatchSize)
+		if err != nil {
+			return written, err
+		}
+
+		var batch []byte
+		n := 0
+		for rows.Next() {
+			var deviceID, site, eventType string
+			var at time.Time
+			var data models.EventData
+			if err := rows.Scan(append([]interface{}{&lastID, &deviceID, &site, &eventType, &at}, data.ScanFields()...)...); err != nil {
+				rows.Close()
+				return written, err
+			}
+			dataJSON, err := json.Marshal(data)
+			if err != nil {
+				rows.Close()
+				return written, err
+			}
+			batch = PointFromEvent(deviceID, site, eventType, dataJSON, at).AppendLine(batch)
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, nil
+		}
+
+		if err := e.write(batch); err != nil {
+			return written, err
+		}
+		written += n
+		if n < e.opts.BatchSize {
+			return written, nil
+		}
+	}
+}
+
+// StartBackfill runs Backfill in the background and reports false if one is
+// already running.
+func (e *Exporter) StartBackfill(from, to time.Time) bool {
+	if !e.backfilling.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer e.backfilling.Store(false)
+		n, err := e.Backfill(context.Background(), from, to)
+		if err != nil {
+			log.Printf("InfluxDB backfill stopped after %d events: %v", n, err)
+			return
+		}
+		log.Printf("InfluxDB backfill wrote %d events from %s to %s", n, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}()
+	return true
+}
@@ -0,0 +1,179 @@
+package influx
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEndpoint records written batches and fails with status while it is non-zero.
+type fakeEndpoint struct {
+	mu      sync.Mutex
+	status  int
+	batches []string
+	auth    string
+}
+
+func (f *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	f.batches = append(f.batches, string(body))
+	f.auth = r.Header.Get("Authorization")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeEndpoint) setStatus(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakeEndpoint) written() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.batches...)
+}
+
+func storedEvent(deviceID, eventType string) ingest.StoredEvent {
+	return ingest.StoredEvent{
+		PowerEventRequest: models.PowerEventRequest{DeviceID: deviceID, EventType: eventType},
+		ReceivedAt:        time.Unix(1704067200, 0),
+		Data:              []byte(`{"battery_percentage": 80}`),
+	}
+}
+
+func TestExporter_BuffersFailedBatchesAndRetries(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COALESCE\\(site, ''\\) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"site"}).AddRow("tokyo-office"))
+
+	endpoint := &fakeEndpoint{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	buffer, err := NewBuffer(t.TempDir(), 0)
+	assert.NoError(t, err)
+	exporter := NewExporter(db, buffer, Options{URL: server.URL, Token: "secret", BatchSize: 2, FlushInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.Run(ctx)
+
+	// 送信先が落ちている間はディスクに退避
+	exporter.EventStored(storedEvent("device-001", "power_on"))
+	exporter.EventStored(storedEvent("device-001", "power_off"))
+	assert.Eventually(t, func() bool {
+		files, _ := buffer.Pending()
+		return len(files) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// 復旧後は退避したバッチを先に送信
+	endpoint.setStatus(0)
+	exporter.EventStored(storedEvent("device-001", "battery_low"))
+	exporter.EventStored(storedEvent("device-001", "battery_low"))
+	assert.Eventually(t, func() bool { return len(endpoint.written()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	batches := endpoint.written()
+	assert.True(t, strings.HasPrefix(batches[0], "power_on,device_id=device-001,site=tokyo-office battery_percentage=80 "))
+	assert.Contains(t, batches[1], "battery_low,")
+	assert.Equal(t, "Token secret", endpoint.auth)
+	files, _ := buffer.Pending()
+	assert.Empty(t, files)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExporter_DropsRejectedBatch(t *testing.T) {
+	endpoint := &fakeEndpoint{status: http.StatusBadRequest}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	buffer, err := NewBuffer(t.TempDir(), 0)
+	assert.NoError(t, err)
+	exporter := NewExporter(nil, buffer, Options{URL: server.URL})
+
+	// 400 は再送しても通らないのでバッファしない
+	exporter.flush([]byte("power_on,device_id=device-001 count=1 1\n"))
+	files, _ := buffer.Pending()
+	assert.Empty(t, files)
+}
+
+func TestExporter_Backfill(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	columns := []string{"id", "device_id", "site", "event_type", "timestamp",
+		"client_timestamp", "uptime_ms", "message", "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap", "data"}
+	mock.ExpectQuery("SELECT pe.id, pe.device_id, COALESCE\\(d.site, ''\\), pe.event_type, pe.timestamp").
+		WithArgs(from, to, 0, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "device-001", "tokyo-office", "power_on", from, nil, nil, nil, 85, nil, nil, nil, nil).
+			AddRow(2, "device-002", "", "power_off", from.Add(time.Hour), nil, nil, nil, 70, nil, nil, nil, nil))
+	mock.ExpectQuery("SELECT pe.id, pe.device_id, COALESCE\\(d.site, ''\\), pe.event_type, pe.timestamp").
+		WithArgs(from, to, 2, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(5, "device-001", "tokyo-office", "reboot", from.Add(2*time.Hour), nil, nil, nil, nil, nil, nil, nil, nil))
+
+	endpoint := &fakeEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	buffer, err := NewBuffer(t.TempDir(), 0)
+	assert.NoError(t, err)
+	exporter := NewExporter(db, buffer, Options{URL: server.URL, BatchSize: 2})
+
+	n, err := exporter.Backfill(context.Background(), from, to)
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	batches := endpoint.written()
+	assert.Len(t, batches, 2)
+	assert.Equal(t, 2, strings.Count(batches[0], "\n"))
+	assert.Equal(t, "reboot,device_id=device-001,site=tokyo-office count=1 1704074400000000000\n", batches[1])
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuffer_TrimsOldestBatches(t *testing.T) {
+	dir := t.TempDir()
+	buffer, err := NewBuffer(dir, 10)
+	assert.NoError(t, err)
+
+	assert.NoError(t, buffer.Put([]byte("aaaaaa\n")))
+	assert.NoError(t, buffer.Put([]byte("bbbbbb\n")))
+
+	// 上限を超えたら古いバッチから削除
+	files, err := buffer.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	content, _ := os.ReadFile(files[0])
+	assert.Equal(t, "bbbbbb\n", string(content))
+}
@@ -0,0 +1,110 @@
+// Package influx exports power events to an InfluxDB-compatible HTTP write
+// endpoint in line protocol.
+package influx
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is one line of line protocol.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Time        time.Time
+}
+
+// PointFromEvent builds the point for a stored event: the event type is the
+// measurement, device_id and site are tags, and every numeric top-level key of
+// the data JSON becomes a float field. All numbers are written as floats so a
+// field never changes type between events. Events without numeric data get a
+// count=1 field, since a point needs at least one field.
+func PointFromEvent(deviceID, site, eventType string, data []byte, at time.Time) Point {
+	p := Point{
+		Measurement: eventType,
+		Tags:        map[string]string{"device_id": deviceID},
+		Fields:      map[string]float64{},
+		Time:        at,
+	}
+	if site != "" {
+		p.Tags["site"] = site
+	}
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if len(data) > 0 && dec.Decode(&values) == nil {
+		for k, v := range values {
+			n, ok := v.(json.Number)
+			if !ok {
+				continue
+			}
+			f, err := n.Float64()
+			if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				continue
+			}
+			p.Fields[k] = f
+		}
+	}
+	if len(p.Fields) == 0 {
+		p.Fields["count"] = 1
+	}
+	return p
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// AppendLine appends the point as one newline-terminated line with
+// nanosecond precision. Tags and fields are sorted by key.
+func (p Point) AppendLine(b []byte) []byte {
+	b = append(b, measurementEscaper.Replace(p.Measurement)...)
+
+	for _, k := range sortedKeys(p.Tags) {
+		// 空のタグ値は line protocol では書けない
+		if p.Tags[k] == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = append(b, keyEscaper.Replace(k)...)
+		b = append(b, '=')
+		b = append(b, keyEscaper.Replace(p.Tags[k])...)
+	}
+
+	fields := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for i, k := range fields {
+		if i == 0 {
+			b = append(b, ' ')
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, keyEscaper.Replace(k)...)
+		b = append(b, '=')
+		b = strconv.AppendFloat(b, p.Fields[k], 'f', -1, 64)
+	}
+
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, p.Time.UnixNano(), 10)
+	return append(b, '\n')
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
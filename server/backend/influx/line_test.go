@@ -0,0 +1,33 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPointFromEvent(t *testing.T) {
+	at := time.Unix(1704067200, 5).UTC()
+	data := []byte(`{"client_timestamp": "2024-01-01T00:00:00Z", "uptime_ms": 5000, "message": "ok", "battery_percentage": 85, "battery_voltage": 3.3, "wifi_signal_strength": -45}`)
+
+	p := PointFromEvent("device-001", "tokyo office", "power_on", data, at)
+
+	// アサーション
+	assert.Equal(t, "power_on", p.Measurement)
+	assert.Equal(t, map[string]float64{"uptime_ms": 5000, "battery_percentage": 85, "battery_voltage": 3.3, "wifi_signal_strength": -45}, p.Fields)
+	assert.Equal(t,
+		"power_on,device_id=device-001,site=tokyo\\ office battery_percentage=85,battery_voltage=3.3,uptime_ms=5000,wifi_signal_strength=-45 1704067200000000005\n",
+		string(p.AppendLine(nil)))
+}
+
+func TestPointFromEvent_NoNumericData(t *testing.T) {
+	at := time.Unix(1704067200, 0)
+
+	// 数値フィールドがない場合は count=1、空のサイトはタグにしない
+	p := PointFromEvent("device,001", "", "wifi reconnected", []byte(`{"message": "hi"}`), at)
+	assert.Equal(t, "wifi\\ reconnected,device_id=device\\,001 count=1 1704067200000000000\n", string(p.AppendLine(nil)))
+
+	p = PointFromEvent("device-001", "", "reboot", nil, at)
+	assert.Equal(t, map[string]float64{"count": 1}, p.Fields)
+}
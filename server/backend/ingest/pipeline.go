@@ -0,0 +1,285 @@
+// Package ingest stores incoming power events. HTTP and MQTT share one
+// Pipeline so that validation, device upsert and the post-insert hooks
+// (reboot detection, incident correlation) behave the same on both paths.
+package ingest
+
+import (
+	"backend/correlation"
+	"backend/eventtypes"
+	"backend/health"
+	"backend/maintenance"
+	"backend/models"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Error is a storage failure; Message is safe to return to the client.
+type Error struct {
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type Result struct {
+	ReceivedAt time.Time
+	// Validation problems of an event accepted in warn mode.
+	Warnings []*eventtypes.ValidationError
+}
+
+// StoredEvent is an event that has been accepted and written to power_events.
+type StoredEvent struct {
+	models.PowerEventRequest
+	ReceivedAt time.Time
+	// Data is the event's data object as the API returns it.
+	Data json.RawMessage
+	// Expected is set when the event arrived during a maintenance window of
+	// the device, Silenced when a silence covered it.
+	Expected bool
+	Silenced bool
+}
+
+// Muted reports whether notifications about the event should be held back.
+func (e StoredEvent) Muted() bool {
+	return e.Expected || e.Silenced
+}
+
+// Listener is notified after each event is stored. It is called on the
+// ingest path, so implementations must hand slow work (network calls) off
+// rather than block.
+type Listener interface {
+	EventStored(e StoredEvent)
+}
+
+// ConnectionListener is optionally implemented by listeners that also want
+// to know when a device's MQTT connection drops or comes back.
+type ConnectionListener interface {
+	ConnectionChanged(deviceID string, online bool, at time.Time)
+}
+
+type Pipeline struct {
+	db             *sql.DB
+	correlator     *correlation.Correlator
+	rebootDetector *health.RebootDetector
+	eventTypes     *eventtypes.Registry
+	maintenance    *maintenance.Schedule
+	resolveAliases bool
+	listeners      []Listener
+}
+
+type Option func(*Pipeline)
+
+// WithCorrelator enables grouping of power_off/power_on events into incidents on ingest.
+func WithCorrelator(correlator *correlation.Correlator) Option {
+	return func(p *Pipeline) {
+		p.correlator = correlator
+	}
+}
+
+// WithRebootDetector enables reboot and crash-loop detection from uptime_ms resets.
+func WithRebootDetector(detector *health.RebootDetector) Option {
+	return func(p *Pipeline) {
+		p.rebootDetector = detector
+	}
+}
+
+// WithEventTypes validates each event against its registered type before storing it.
+func WithEventTypes(registry *eventtypes.Registry) Option {
+	return func(p *Pipeline) {
+		p.eventTypes = registry
+	}
+}
+
+// WithMaintenance marks events inside maintenance windows as expected and
+// flags silenced ones for the listeners.
+func WithMaintenance(schedule *maintenance.Schedule) Option {
+	return func(p *Pipeline) {
+		p.maintenance = schedule
+	}
+}
+
+// WithDeviceAliases stores events sent under the old id of a merged device
+// under the device it was merged into.
+func WithDeviceAliases() Option {
+	return func(p *Pipeline) {
+		p.resolveAliases = true
+	}
+}
+
+func NewPipeline(db *sql.DB, opts ...Option) *Pipeline {
+	p := &Pipeline{db: db}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// AddListener registers l for stored events. Call it before ingesting starts.
+func (p *Pipeline) AddListener(l Listener) {
+	p.listeners = append(p.listeners, l)
+}
+
+const deviceUpsertConflict = `
+	ON CONFLICT (id)
+	DO UPDATE SET last_seen = $4, updated_at = $6, offline_since = NULL,
+		model = COALESCE(NULLIF($7, ''), devices.model),
+		firmware_version = COALESCE(NULLIF($8, ''), devices.firmware_version)`
+
+// Ingest validates and stores one event. body is the raw JSON the request was
+// decoded from and is what the event type schema is checked against. In
+// reject mode a failed validation is returned as *eventtypes.ValidationError;
+// storage failures are returned as *Error.
+func (p *Pipeline) Ingest(req models.PowerEventRequest, body []byte) (*Result, error) {
+	result := &Result{}
+
+	// 登録済みのイベント種別とスキーマで検証（warn モードでは保存して警告を返す）
+	if p.eventTypes != nil {
+		if verr := p.eventTypes.Validate(req.EventType, body); verr != nil {
+			if p.eventTypes.Mode() == eventtypes.ModeReject {
+				return nil, verr
+			}
+			log.Printf("Accepting invalid event from device %s: %v", req.DeviceID, verr)
+			result.Warnings = append(result.Warnings, verr)
+		}
+	}
+
+	// ペイロードの項目は型付きの列に保存する
+	data := models.NewEventData(req)
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, &Error{Message: "Failed to marshal data JSON", Err: err}
+	}
+
+	// デバイスの最終接続時刻を更新（UPSERT）
+	args := []interface{}{req.DeviceID, req.DeviceID, "", time.Now(), time.Now(), time.Now(), req.Model, req.FirmwareVersion}
+	if p.resolveAliases {
+		// 統合済みデバイスの旧IDで届いたイベントは統合先に保存する。別の文で
+		// 解決すると、その後にコミットされた統合で旧IDのデバイスが再作成されるため
+		// UPSERT の中で解決する
+		err = p.db.QueryRow(`
+			INSERT INTO devices (id, name, description, last_seen, created_at, updated_at, model, firmware_version)
+			SELECT COALESCE((SELECT device_id FROM device_aliases WHERE alias_id = $1), $1),
+				$2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, '')`+deviceUpsertConflict+`
+			RETURNING id`,
+			args...,
+		).Scan(&req.DeviceID)
+	} else {
+		_, err = p.db.Exec(`
+			INSERT INTO devices (id, name, description, last_seen, created_at, updated_at, model, firmware_version)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''))`+deviceUpsertConflict,
+			args...,
+		)
+	}
+	if err != nil {
+		return nil, &Error{Message: "Failed to update device", Err: err}
+	}
+
+	// ファームウェア履歴は付随情報なので、失敗してもイベントは保存する
+	if req.FirmwareVersion != "" {
+		if err := recordFirmwareHistory(p.db, req.DeviceID, req.FirmwareVersion, req.Model); err != nil {
+			log.Printf("Failed to record firmware history for device %s: %v", req.DeviceID, err)
+		}
+	}
+
+	now := time.Now()
+	result.ReceivedAt = now
+
+	// uptime_ms のリセットから再起動を検出（直前のイベントと比較するため挿入前に実行）
+	if p.rebootDetector != nil {
+		if err := p.rebootDetector.Check(req.DeviceID, req.EventType, req.UptimeMs, now); err != nil {
+			log.Printf("Failed to check reboot for device %s: %v", req.DeviceID, err)
+		}
+	}
+
+	// メンテナンス中のイベントも保存し、expected として区別する
+	var expected, silenced bool
+	if p.maintenance != nil {
+		if expected, err = p.maintenance.Expected(req.DeviceID, now); err != nil {
+			log.Printf("Failed to check maintenance windows for device %s: %v", req.DeviceID, err)
+		}
+		if silenced, err = p.maintenance.Silenced(req.DeviceID, now); err != nil {
+			log.Printf("Failed to check silences for device %s: %v", req.DeviceID, err)
+		}
+	}
+
+	// 電源イベントを挿入 (Use server timestamp)
+	_, err = p.db.Exec(`
+		INSERT INTO power_events (device_id, event_type, timestamp, expected, client_timestamp, uptime_ms, message,
+			battery_percentage, battery_voltage, wifi_signal_strength, free_heap)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		req.DeviceID, req.EventType, now, expected, data.ClientTimestamp, data.UptimeMs, data.Message,
+		data.BatteryPercentage, data.BatteryVoltage, data.WiFiSignalStrength, data.FreeHeap,
+	)
+	if err != nil {
+		return nil, &Error{Message: "Failed to create power event", Err: err}
+	}
+
+	// イベントは保存済みなので、インシデント集約の失敗はログのみ
+	// （計画的な power_off はインシデントにしない）
+	if p.correlator != nil && !(expected && req.EventType == "power_off") {
+		if err := p.correlator.HandleEvent(req.DeviceID, req.EventType, now); err != nil {
+			log.Printf("Failed to correlate power event for device %s: %v", req.DeviceID, err)
+		}
+	}
+
+	stored := StoredEvent{PowerEventRequest: req, ReceivedAt: now, Data: dataBytes, Expected: expected, Silenced: silenced}
+	for _, l := range p.listeners {
+		l.EventStored(stored)
+	}
+
+	return result, nil
+}
+
+// MarkOffline records that the device's connection dropped, e.g. from an MQTT
+// last-will message. The next ingested event clears it.
+func (p *Pipeline) MarkOffline(deviceID string, at time.Time) error {
+	_, err := p.db.Exec("UPDATE devices SET offline_since = $1 WHERE id = $2 AND offline_since IS NULL", at, deviceID)
+	if err != nil {
+		return err
+	}
+	p.notifyConnection(deviceID, false, at)
+	return nil
+}
+
+// MarkOnline clears the offline state when the device reconnects.
+func (p *Pipeline) MarkOnline(deviceID string, at time.Time) error {
+	_, err := p.db.Exec("UPDATE devices SET offline_since = NULL, last_seen = $1 WHERE id = $2", at, deviceID)
+	if err != nil {
+		return err
+	}
+	p.notifyConnection(deviceID, true, at)
+	return nil
+}
+
+func (p *Pipeline) notifyConnection(deviceID string, online bool, at time.Time) {
+	for _, l := range p.listeners {
+		if cl, ok := l.(ConnectionListener); ok {
+			cl.ConnectionChanged(deviceID, online, at)
+		}
+	}
+}
+
+func recordFirmwareHistory(db *sql.DB, deviceID, version, model string) error {
+	// 直前の記録と同じバージョン・モデルの場合は追加しない
+	_, err := db.Exec(`
+		INSERT INTO device_firmware_history (device_id, firmware_version, model, seen_at)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM (
+				SELECT firmware_version, model FROM device_firmware_history
+				WHERE device_id = $1 ORDER BY seen_at DESC, id DESC LIMIT 1
+			) latest
+			WHERE latest.firmware_version = $2 AND latest.model = $3
+		)`,
+		deviceID, version, model, time.Now(),
+	)
+	return err
+}
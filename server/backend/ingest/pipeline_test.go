@@ -0,0 +1,210 @@
+package ingest
+
+import (
+	"backend/eventtypes"
+	"backend/maintenance"
+	"backend/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngest(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WithArgs("device-001", "device-001", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "M5StickCPlus2", "1.2.0").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO device_firmware_history").
+		WithArgs("device-001", "1.2.0", "M5StickCPlus2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "power_on", sqlmock.AnyArg(), false, nil, 0, "", 0, 0.0, 0, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	p := NewPipeline(db)
+	req := models.PowerEventRequest{DeviceID: "device-001", EventType: "power_on", Model: "M5StickCPlus2", FirmwareVersion: "1.2.0"}
+	result, err := p.Ingest(req, []byte(`{"device_id": "device-001", "event_type": "power_on"}`))
+	assert.NoError(t, err)
+	assert.False(t, result.ReceivedAt.IsZero())
+	assert.Empty(t, result.Warnings)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIngest_DeviceAlias(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 統合済みの旧IDで届いたイベントは統合先のデバイスに保存する
+	// （統合と同時に受信しても旧IDのデバイスを再作成しないよう UPSERT の中で解決）
+	mock.ExpectQuery("INSERT INTO devices (.+) SELECT COALESCE\\(\\(SELECT device_id FROM device_aliases WHERE alias_id = \\$1\\), \\$1\\)(.+) RETURNING id").
+		WithArgs("M5S2_OLD", "M5S2_OLD", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("kitchen"))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("kitchen", "periodic_status", sqlmock.AnyArg(), false, nil, 0, "", 0, 0.0, 0, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	p := NewPipeline(db, WithDeviceAliases())
+	req := models.PowerEventRequest{DeviceID: "M5S2_OLD", EventType: "periodic_status"}
+	_, err = p.Ingest(req, []byte(`{"device_id": "M5S2_OLD", "event_type": "periodic_status"}`))
+	assert.NoError(t, err)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIngest_RejectMode(t *testing.T) {
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	p := NewPipeline(db, WithEventTypes(eventtypes.NewRegistry(eventtypes.ModeReject)))
+	req := models.PowerEventRequest{DeviceID: "device-001", EventType: "poweroff"}
+	_, err = p.Ingest(req, []byte(`{"device_id": "device-001", "event_type": "poweroff"}`))
+
+	var verr *eventtypes.ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, eventtypes.ReasonUnknownType, verr.Reason)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIngest_StorageError(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnError(errors.New("connection refused"))
+
+	p := NewPipeline(db)
+	_, err = p.Ingest(models.PowerEventRequest{DeviceID: "device-001", EventType: "power_on"}, []byte(`{}`))
+
+	var ierr *Error
+	assert.True(t, errors.As(err, &ierr))
+	assert.Equal(t, "Failed to update device", ierr.Message)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIngest_FirmwareHistoryError(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO device_firmware_history").
+		WillReturnError(errors.New("deadlock detected"))
+	// ファームウェア履歴の記録に失敗してもイベントは保存する
+	mock.ExpectExec("INSERT INTO power_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	p := NewPipeline(db)
+	req := models.PowerEventRequest{DeviceID: "device-001", EventType: "power_on", FirmwareVersion: "1.2.0"}
+	_, err = p.Ingest(req, []byte(`{}`))
+	assert.NoError(t, err)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type recordingListener struct {
+	events      []StoredEvent
+	connections []bool
+}
+
+func (l *recordingListener) EventStored(e StoredEvent) {
+	l.events = append(l.events, e)
+}
+
+func (l *recordingListener) ConnectionChanged(deviceID string, online bool, at time.Time) {
+	l.connections = append(l.connections, online)
+}
+
+func TestIngest_NotifiesListeners(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE devices SET offline_since = \\$1 WHERE id = \\$2").
+		WithArgs(sqlmock.AnyArg(), "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	listener := &recordingListener{}
+	p := NewPipeline(db)
+	p.AddListener(listener)
+
+	req := models.PowerEventRequest{DeviceID: "device-001", EventType: "power_off"}
+	result, err := p.Ingest(req, []byte(`{"device_id": "device-001", "event_type": "power_off"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, p.MarkOffline("device-001", time.Now()))
+
+	// アサーション
+	assert.Len(t, listener.events, 1)
+	assert.Equal(t, "power_off", listener.events[0].EventType)
+	assert.Equal(t, result.ReceivedAt, listener.events[0].ReceivedAt)
+	assert.Equal(t, []bool{false}, listener.connections)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIngest_MaintenanceWindow(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	windowRows := sqlmock.NewRows([]string{"id", "name", "scope_type", "scope_key", "starts_at", "ends_at", "recurrence", "recurrence_until", "reason", "created_at"}).
+		AddRow(1, "電気工事", "site", "tokyo-office", now.Add(-time.Hour), now.Add(time.Hour), "none", nil, "", now)
+
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("FROM maintenance_windows").
+		WithArgs("device-001", sqlmock.AnyArg()).
+		WillReturnRows(windowRows)
+	mock.ExpectQuery("FROM silences").
+		WithArgs("device-001", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "power_off", sqlmock.AnyArg(), true, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	listener := &recordingListener{}
+	p := NewPipeline(db, WithMaintenance(maintenance.NewSchedule(db)))
+	p.AddListener(listener)
+
+	req := models.PowerEventRequest{DeviceID: "device-001", EventType: "power_off"}
+	_, err = p.Ingest(req, []byte(`{"device_id": "device-001", "event_type": "power_off"}`))
+	assert.NoError(t, err)
+
+	// アサーション（保存はされ、通知は抑制される）
+	assert.Len(t, listener.events, 1)
+	assert.True(t, listener.events[0].Expected)
+	assert.True(t, listener.events[0].Muted())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,14 +1,31 @@
 package main
 
 import (
+    "backend/alerts"
+    "backend/analysis"
+    "backend/config"
+    "backend/correlation"
+    "backend/credentials"
     "backend/db"
+    "backend/eventtypes"
     "backend/handlers"
+    "backend/health"
+    "backend/homeassistant"
+    "backend/influx"
+    "backend/ingest"
+    "backend/maintenance"
+    "backend/mqtt"
+    "backend/notify"
+    "backend/webhooks"
+    "context"
     "log"
-
-    "github.com/gin-gonic/gin"
+    "time"
+    _ "time/tzdata"
 )
 
 func main() {
+    cfg := config.Load()
+
     // データベース接続
     database, err := db.Connect()
     if err != nil {
@@ -16,52 +33,173 @@ func main() {
     }
     defer database.Close()
 
-    // Ginルーター設定
-    router := gin.Default()
-    
-    // CORS設定
-    router.Use(func(c *gin.Context) {
-        c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-        c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-        
-        if c.Request.Method == "OPTIONS" {
-            c.AbortWithStatus(204)
-            return
-        }
-        
-        c.Next()
-    })
+    // スキーマのマイグレーション（init.sql より前に作られたDB向け）
+    applied, err := db.Migrate(database)
+    if err != nil {
+        log.Fatal("Failed to migrate database:", err)
+    }
+    for _, version := range applied {
+        log.Printf("Applied migration %s", version)
+    }
+    if err := db.CheckSchema(database); err != nil {
+        log.Fatal("Database schema is incomplete:", err)
+    }
+
+    // イベント種別レジストリ（組み込み型 + DBのカスタム型）
+    validationMode, err := eventtypes.ParseMode(cfg.EventValidationMode)
+    if err != nil {
+        log.Fatal(err)
+    }
+    eventTypes := eventtypes.NewRegistry(validationMode)
+    if err := eventTypes.Load(database); err != nil {
+        log.Printf("Failed to load custom event types: %v", err)
+    }
 
     // ハンドラー初期化
     itemHandler := handlers.NewItemHandler(database)
-    powerEventHandler := handlers.NewPowerEventHandler(database)
+    alertManager := alerts.NewManager(database)
+    schedule := maintenance.NewSchedule(database)
+    alertManager.SetMuter(schedule)
+    correlator := correlation.NewCorrelator(database, cfg.IncidentWindow, cfg.IncidentMinDevices)
+    rebootDetector := health.NewRebootDetector(database, alertManager, cfg.CrashLoopReboots, cfg.CrashLoopWindow)
+    pipeline := ingest.NewPipeline(database,
+        ingest.WithCorrelator(correlator),
+        ingest.WithRebootDetector(rebootDetector),
+        ingest.WithEventTypes(eventTypes),
+        ingest.WithMaintenance(schedule),
+        ingest.WithDeviceAliases(),
+    )
+    powerEventHandler := handlers.NewPowerEventHandler(database, handlers.WithPipeline(pipeline))
     deviceHandler := handlers.NewDeviceHandler(database)
+    firmwareHandler := handlers.NewFirmwareHandler(database)
+    incidentHandler := handlers.NewIncidentHandler(database)
+    reportHandler := handlers.NewReportHandler(database)
+    alertHandler := handlers.NewAlertHandler(database)
+    eventTypeHandler := handlers.NewEventTypeHandler(database, eventTypes)
+    grafanaHandler := handlers.NewGrafanaHandler(database)
+    maintenanceHandler := handlers.NewMaintenanceHandler(database)
+    annotationHandler := handlers.NewAnnotationHandler(database)
 
-    // ルート設定
-    api := router.Group("/api")
-    {
-        // Legacy API
-        v1 := api.Group("/v1")
-        {
-            v1.GET("/items", itemHandler.GetItems)
+    // バックグラウンドジョブ
+    heapAnalyzer := health.NewHeapAnalyzer(database, alertManager, analysis.DefaultHeapOptions())
+    go heapAnalyzer.Run(context.Background(), cfg.HeapAnalysisInterval)
+
+    // MQTT での受信（HTTP と同じ ingest パイプラインを使う）
+    subscriber := mqtt.NewSubscriber(mqtt.SubscriberOptions{
+        BrokerURL:   cfg.MQTTBrokerURL,
+        ClientID:    cfg.MQTTClientID,
+        Username:    cfg.MQTTUsername,
+        Password:    cfg.MQTTPassword,
+        TopicPrefix: cfg.MQTTTopicPrefix,
+    }, pipeline)
+    var mqttPublisher homeassistant.MessagePublisher = subscriber
+    if cfg.MQTTBrokerListen != "" {
+        broker, err := mqtt.NewBroker(mqtt.BrokerOptions{
+            Address:         cfg.MQTTBrokerListen,
+            TopicPrefix:     cfg.MQTTTopicPrefix,
+            ServiceUsername: cfg.MQTTServiceUsername,
+            ServicePassword: cfg.MQTTServicePassword,
+        }, credentials.NewStore(database), subscriber)
+        if err != nil {
+            log.Fatal("Failed to create MQTT broker:", err)
         }
+        if err := broker.Start(); err != nil {
+            log.Fatal("Failed to start MQTT broker:", err)
+        }
+        defer broker.Close()
+        mqttPublisher = broker
+    }
+    if cfg.MQTTBrokerURL != "" {
+        if err := subscriber.Start(); err != nil {
+            log.Printf("Failed to connect to MQTT broker: %v", err)
+        }
+        defer subscriber.Stop()
+    }
+
+    // Home Assistant へのデバイス公開
+    if cfg.HADiscoveryEnabled {
+        haPublisher := homeassistant.NewPublisher(database, mqttPublisher, homeassistant.Options{
+            DiscoveryPrefix: cfg.HADiscoveryPrefix,
+            TopicPrefix:     cfg.MQTTTopicPrefix,
+        })
+        pipeline.AddListener(haPublisher)
+        go haPublisher.Run(context.Background())
+    }
+
+    // InfluxDB へのエクスポート
+    var influxExporter *influx.Exporter
+    if cfg.InfluxWriteURL != "" {
+        buffer, err := influx.NewBuffer(cfg.InfluxBufferDir, cfg.InfluxBufferMaxBytes)
+        if err != nil {
+            log.Fatal("Failed to create InfluxDB buffer:", err)
+        }
+        influxExporter = influx.NewExporter(database, buffer, influx.Options{
+            URL:           cfg.InfluxWriteURL,
+            Token:         cfg.InfluxToken,
+            BatchSize:     cfg.InfluxBatchSize,
+            FlushInterval: cfg.InfluxFlushInterval,
+        })
+        pipeline.AddListener(influxExporter)
+        go influxExporter.Run(context.Background())
+    }
+    exportHandler := handlers.NewExportHandler(influxExporter)
 
-        // Power Events API
-        api.POST("/power-events", powerEventHandler.CreatePowerEvent)
-        api.GET("/power-events", powerEventHandler.GetPowerEvents)
-        api.GET("/power-events/:id", powerEventHandler.GetPowerEventByID)
-        api.GET("/power-events/device/:deviceId/timeline", powerEventHandler.GetDeviceTimeline)
-        api.GET("/power-events/stats", powerEventHandler.GetEventStats)
-        api.DELETE("/power-events/cleanup", powerEventHandler.DeleteOldEvents)
+    // Webhook 配信（受信処理とは別のゴルーチンで送信）
+    webhookOptions := webhooks.DefaultOptions()
+    webhookOptions.MaxAttempts = cfg.WebhookMaxAttempts
+    webhookOptions.Timeout = cfg.WebhookTimeout
+    webhookDispatcher := webhooks.NewDispatcher(database, webhookOptions)
+    pipeline.AddListener(webhookDispatcher)
+    go webhookDispatcher.Run(context.Background())
+    webhookHandler := handlers.NewWebhookHandler(database, webhookDispatcher)
 
-        // Device Management API
-        api.GET("/devices", deviceHandler.GetDevices)
-        api.GET("/devices/:deviceId", deviceHandler.GetDeviceByID)
-        api.PUT("/devices/:deviceId", deviceHandler.UpdateDevice)
-        api.DELETE("/devices/:deviceId", deviceHandler.DeleteDevice)
+    // メール通知（即時通知と日次ダイジェスト）
+    if cfg.SMTPHost != "" && len(cfg.NotifyEmailTo) > 0 {
+        location, err := time.LoadLocation(cfg.NotifyTimezone)
+        if err != nil {
+            log.Fatal("Invalid NOTIFY_TIMEZONE:", err)
+        }
+        templates, err := notify.LoadTemplates(cfg.NotifyTemplateDir, location)
+        if err != nil {
+            log.Fatal("Failed to load email templates:", err)
+        }
+        mailer := notify.NewMailer(notify.SMTPOptions{
+            Host:     cfg.SMTPHost,
+            Port:     cfg.SMTPPort,
+            Username: cfg.SMTPUsername,
+            Password: cfg.SMTPPassword,
+            From:     cfg.SMTPFrom,
+        })
+        emailNotifier := notify.NewEmailNotifier(database, mailer, templates, notify.EmailOptions{
+            To:              cfg.NotifyEmailTo,
+            Immediate:       cfg.NotifyEmailImmediate,
+            DigestHour:      cfg.NotifyDigestHour,
+            Location:        location,
+            BatteryCooldown: cfg.BatteryMailCooldown,
+            OfflineAfter:    cfg.NotifyOfflineAfter,
+        })
+        pipeline.AddListener(emailNotifier)
+        alertManager.AddNotifier(emailNotifier)
+        go emailNotifier.Run(context.Background())
     }
 
+    // ルート設定
+    router := setupRouter(routeHandlers{
+        Items:       itemHandler,
+        PowerEvents: powerEventHandler,
+        EventTypes:  eventTypeHandler,
+        Devices:     deviceHandler,
+        Firmware:    firmwareHandler,
+        Incidents:   incidentHandler,
+        Alerts:      alertHandler,
+        Reports:     reportHandler,
+        Export:      exportHandler,
+        Webhooks:    webhookHandler,
+        Maintenance: maintenanceHandler,
+        Grafana:     grafanaHandler,
+        Annotations: annotationHandler,
+    })
+
     // サーバー起動
     router.Run(":8080")
 }
\ No newline at end of file
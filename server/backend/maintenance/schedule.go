@@ -0,0 +1,105 @@
+package maintenance
+
+import (
+	"backend/models"
+	"database/sql"
+	"time"
+)
+
+// WindowColumns are the maintenance_windows columns read by ScanWindow.
+const WindowColumns = "id, name, scope_type, scope_key, starts_at, ends_at, recurrence, recurrence_until, reason, created_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func ScanWindow(row rowScanner, w *models.MaintenanceWindow) error {
+	return row.Scan(&w.ID, &w.Name, &w.ScopeType, &w.ScopeKey, &w.StartsAt, &w.EndsAt, &w.Recurrence, &w.RecurrenceUntil, &w.Reason, &w.CreatedAt)
+}
+
+// scopeMatch joins a scoped table (alias s) to the device d.
+const scopeMatch = `((s.scope_type = 'device' AND s.scope_key = d.id)
+	OR (s.scope_type = 'site' AND s.scope_key = d.site)
+	OR (s.scope_type = 'group' AND s.scope_key = d.device_group))`
+
+// Schedule answers maintenance and silence lookups on the ingest path.
+type Schedule struct {
+	db *sql.DB
+}
+
+func NewSchedule(db *sql.DB) *Schedule {
+	return &Schedule{db: db}
+}
+
+// Expected reports whether the device is inside a maintenance window at at.
+func (s *Schedule) Expected(deviceID string, at time.Time) (bool, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, s.name, s.scope_type, s.scope_key, s.starts_at, s.ends_at, s.recurrence, s.recurrence_until, s.reason, s.created_at
+		FROM maintenance_windows s JOIN devices d ON d.id = $1
+		WHERE `+scopeMatch+`
+			AND s.starts_at <= $2
+			AND (s.recurrence <> 'none' OR s.ends_at > $2)
+			AND (s.recurrence_until IS NULL OR s.recurrence_until > $2)`,
+		deviceID, at)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w models.MaintenanceWindow
+		if err := ScanWindow(rows, &w); err != nil {
+			return false, err
+		}
+		if ActiveAt(w, at) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// Silenced reports whether an unexpired silence covers the device at at.
+func (s *Schedule) Silenced(deviceID string, at time.Time) (bool, error) {
+	var silenced bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM silences s JOIN devices d ON d.id = $1
+			WHERE `+scopeMatch+` AND s.starts_at <= $2 AND s.expires_at > $2
+		)`, deviceID, at).Scan(&silenced)
+	return silenced, err
+}
+
+// Muted reports whether notifications about the device should be held back,
+// either because of maintenance or a silence.
+func (s *Schedule) Muted(deviceID string, at time.Time) (bool, error) {
+	expected, err := s.Expected(deviceID, at)
+	if err != nil || expected {
+		return expected, err
+	}
+	return s.Silenced(deviceID, at)
+}
+
+// LoadWindows returns every window that may have an occurrence within
+// [from, to).
+func LoadWindows(db *sql.DB, from, to time.Time) ([]models.MaintenanceWindow, error) {
+	rows, err := db.Query(`
+		SELECT `+WindowColumns+` FROM maintenance_windows
+		WHERE starts_at < $2
+			AND (recurrence <> 'none' OR ends_at > $1)
+			AND (recurrence_until IS NULL OR recurrence_until > $1)
+		ORDER BY id`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []models.MaintenanceWindow
+	for rows.Next() {
+		var w models.MaintenanceWindow
+		if err := ScanWindow(rows, &w); err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
@@ -0,0 +1,157 @@
+// Package maintenance decides whether a device is inside a planned
+// maintenance window (its events are expected) or covered by a silence (its
+// notifications are muted).
+package maintenance
+
+import (
+	"backend/analysis"
+	"backend/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func step(recurrence string) time.Duration {
+	switch recurrence {
+	case models.RecurrenceDaily:
+		return 24 * time.Hour
+	case models.RecurrenceWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Validate checks a window request and fills in the default recurrence.
+func Validate(req *models.MaintenanceWindowRequest) error {
+	if err := ValidateScope(req.ScopeType); err != nil {
+		return err
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	if req.Recurrence == "" {
+		req.Recurrence = models.RecurrenceNone
+	}
+	switch req.Recurrence {
+	case models.RecurrenceNone:
+		req.RecurrenceUntil = nil
+	case models.RecurrenceDaily, models.RecurrenceWeekly:
+		if req.EndsAt.Sub(req.StartsAt) > step(req.Recurrence) {
+			return fmt.Errorf("a %s window cannot be longer than its repeat interval", req.Recurrence)
+		}
+		if req.RecurrenceUntil != nil && !req.RecurrenceUntil.After(req.StartsAt) {
+			return fmt.Errorf("recurrence_until must be after starts_at")
+		}
+	default:
+		return fmt.Errorf("recurrence must be none, daily or weekly")
+	}
+	return nil
+}
+
+func ValidateScope(scopeType string) error {
+	switch scopeType {
+	case models.ScopeDevice, models.ScopeGroup, models.ScopeSite:
+		return nil
+	}
+	return fmt.Errorf("scope_type must be device, group or site")
+}
+
+// Matches reports whether the window's scope covers the device.
+func Matches(scopeType, scopeKey, deviceID, site, group string) bool {
+	switch scopeType {
+	case models.ScopeDevice:
+		return scopeKey == deviceID
+	case models.ScopeSite:
+		return site != "" && scopeKey == site
+	case models.ScopeGroup:
+		return group != "" && scopeKey == group
+	}
+	return false
+}
+
+// ActiveAt reports whether an occurrence of w contains at.
+func ActiveAt(w models.MaintenanceWindow, at time.Time) bool {
+	return len(Occurrences(w, at, at.Add(time.Nanosecond))) > 0
+}
+
+// Occurrences returns the occurrences of w overlapping [from, to), clipped
+// to that range.
+func Occurrences(w models.MaintenanceWindow, from, to time.Time) []analysis.Period {
+	length := w.EndsAt.Sub(w.StartsAt)
+	interval := step(w.Recurrence)
+
+	var periods []analysis.Period
+	add := func(start time.Time) {
+		end := start.Add(length)
+		if !end.After(from) || !start.Before(to) {
+			return
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		periods = append(periods, analysis.Period{Start: start, End: end})
+	}
+
+	if interval == 0 {
+		add(w.StartsAt)
+		return periods
+	}
+
+	// 範囲の直前の回から数える
+	n := int64(0)
+	if from.Sub(w.StartsAt) > length {
+		n = int64((from.Sub(w.StartsAt) - length) / interval)
+	}
+	for start := w.StartsAt.Add(time.Duration(n) * interval); start.Before(to); start = start.Add(interval) {
+		if w.RecurrenceUntil != nil && !start.Before(*w.RecurrenceUntil) {
+			break
+		}
+		add(start)
+	}
+	return periods
+}
+
+// Merge sorts periods and joins overlapping or touching ones.
+func Merge(periods []analysis.Period) []analysis.Period {
+	if len(periods) == 0 {
+		return nil
+	}
+	sorted := append([]analysis.Period(nil), periods...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	merged := []analysis.Period{sorted[0]}
+	for _, p := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if p.Start.After(last.End) {
+			merged = append(merged, p)
+			continue
+		}
+		if p.End.After(last.End) {
+			last.End = p.End
+		}
+	}
+	return merged
+}
+
+// PeriodsFor returns the merged maintenance time of one device within
+// [from, to).
+func PeriodsFor(windows []models.MaintenanceWindow, deviceID, site, group string, from, to time.Time) []analysis.Period {
+	var periods []analysis.Period
+	for _, w := range windows {
+		if Matches(w.ScopeType, w.ScopeKey, deviceID, site, group) {
+			periods = append(periods, Occurrences(w, from, to)...)
+		}
+	}
+	return Merge(periods)
+}
+
+// Attach sets the Maintenance periods of each history.
+func Attach(histories []analysis.DeviceHistory, windows []models.MaintenanceWindow, from, to time.Time) {
+	for i := range histories {
+		h := &histories[i]
+		h.Maintenance = PeriodsFor(windows, h.DeviceID, h.Site, h.Group, from, to)
+	}
+}
@@ -0,0 +1,68 @@
+package maintenance
+
+import (
+	"backend/analysis"
+	"backend/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOccurrences_OneOff(t *testing.T) {
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+	w := models.MaintenanceWindow{StartsAt: start, EndsAt: start.Add(2 * time.Hour), Recurrence: models.RecurrenceNone}
+
+	// 範囲にかかる部分だけを返す
+	periods := Occurrences(w, start.Add(time.Hour), start.Add(24*time.Hour))
+	assert.Equal(t, []analysis.Period{{Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)}}, periods)
+
+	assert.Empty(t, Occurrences(w, start.Add(2*time.Hour), start.Add(3*time.Hour)))
+	assert.True(t, ActiveAt(w, start))
+	assert.False(t, ActiveAt(w, start.Add(2*time.Hour)))
+}
+
+func TestOccurrences_Weekly(t *testing.T) {
+	// 毎週水曜 22:00〜翌 02:00、3回目の開始前まで
+	start := time.Date(2024, 1, 3, 22, 0, 0, 0, time.UTC)
+	until := start.Add(14 * 24 * time.Hour)
+	w := models.MaintenanceWindow{StartsAt: start, EndsAt: start.Add(4 * time.Hour), Recurrence: models.RecurrenceWeekly, RecurrenceUntil: &until}
+
+	periods := Occurrences(w, start.Add(24*time.Hour), start.Add(60*24*time.Hour))
+	assert.Len(t, periods, 1)
+	assert.Equal(t, start.Add(7*24*time.Hour), periods[0].Start)
+
+	assert.True(t, ActiveAt(w, start.Add(7*24*time.Hour+3*time.Hour)))
+	assert.False(t, ActiveAt(w, start.Add(7*24*time.Hour+5*time.Hour)))
+	assert.False(t, ActiveAt(w, start.Add(14*24*time.Hour+time.Hour)))
+}
+
+func TestPeriodsFor(t *testing.T) {
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+	windows := []models.MaintenanceWindow{
+		{ScopeType: models.ScopeSite, ScopeKey: "tokyo-office", StartsAt: start, EndsAt: start.Add(time.Hour), Recurrence: models.RecurrenceNone},
+		{ScopeType: models.ScopeDevice, ScopeKey: "device-001", StartsAt: start.Add(30 * time.Minute), EndsAt: start.Add(90 * time.Minute), Recurrence: models.RecurrenceNone},
+		{ScopeType: models.ScopeGroup, ScopeKey: "lab", StartsAt: start, EndsAt: start.Add(5 * time.Hour), Recurrence: models.RecurrenceNone},
+	}
+
+	// 重なった期間は結合し、別グループのウィンドウは含めない
+	periods := PeriodsFor(windows, "device-001", "tokyo-office", "warehouse", start.Add(-time.Hour), start.Add(24*time.Hour))
+	assert.Equal(t, []analysis.Period{{Start: start, End: start.Add(90 * time.Minute)}}, periods)
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	req := models.MaintenanceWindowRequest{Name: "move", ScopeType: models.ScopeSite, ScopeKey: "tokyo-office", StartsAt: start, EndsAt: start.Add(time.Hour)}
+	assert.NoError(t, Validate(&req))
+	assert.Equal(t, models.RecurrenceNone, req.Recurrence)
+
+	req.ScopeType = "building"
+	assert.Error(t, Validate(&req))
+
+	req = models.MaintenanceWindowRequest{ScopeType: models.ScopeDevice, StartsAt: start, EndsAt: start.Add(25 * time.Hour), Recurrence: models.RecurrenceDaily}
+	assert.Error(t, Validate(&req))
+
+	req = models.MaintenanceWindowRequest{ScopeType: models.ScopeDevice, StartsAt: start, EndsAt: start, Recurrence: models.RecurrenceNone}
+	assert.Error(t, Validate(&req))
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	AlertCrashLoop  = "crash_loop"
+	AlertMemoryLeak = "memory_leak"
+)
+
+type Alert struct {
+	ID         int        `json:"id" db:"id"`
+	DeviceID   string     `json:"device_id" db:"device_id"`
+	AlertType  string     `json:"alert_type" db:"alert_type"`
+	Severity   string     `json:"severity" db:"severity"`
+	Message    string     `json:"message" db:"message"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at" db:"resolved_at"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Annotation is an operator's note on a device's timeline, at a point in
+// time (EndsAt nil) or over a range.
+type Annotation struct {
+	ID        int        `json:"id" db:"id"`
+	DeviceID  string     `json:"device_id" db:"device_id"`
+	StartsAt  time.Time  `json:"starts_at" db:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at" db:"ends_at"`
+	Author    string     `json:"author" db:"author"`
+	Text      string     `json:"text" db:"text"`
+	Tags      []string   `json:"tags" db:"tags"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type AnnotationRequest struct {
+	StartsAt time.Time  `json:"starts_at" binding:"required"`
+	EndsAt   *time.Time `json:"ends_at"`
+	Author   string     `json:"author" binding:"required"`
+	Text     string     `json:"text" binding:"required"`
+	Tags     []string   `json:"tags"`
+}
+
+// Timeline item types.
+const (
+	TimelineEvent      = "event"
+	TimelineAnnotation = "annotation"
+)
+
+// TimelineItem is either a power event or an annotation. It is encoded as
+// the fields of the underlying value plus a "type" discriminator.
+type TimelineItem struct {
+	Type       string
+	Event      *PowerEvent
+	Annotation *Annotation
+}
+
+// Time is when the item happened (the start of a range annotation).
+func (t TimelineItem) Time() time.Time {
+	if t.Annotation != nil {
+		return t.Annotation.StartsAt
+	}
+	return t.Event.Timestamp
+}
+
+func (t TimelineItem) MarshalJSON() ([]byte, error) {
+	var body []byte
+	var err error
+	switch t.Type {
+	case TimelineEvent:
+		body, err = json.Marshal(t.Event)
+	case TimelineAnnotation:
+		body, err = json.Marshal(t.Annotation)
+	default:
+		return nil, fmt.Errorf("unknown timeline item type %q", t.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	typeField, err := json.Marshal(t.Type)
+	if err != nil {
+		return nil, err
+	}
+	// {"type":"...", の後に本体のフィールドを続ける
+	out := append([]byte(`{"type":`), typeField...)
+	if len(body) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, body[1:]...), nil
+}
+
+func (t *TimelineItem) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	*t = TimelineItem{Type: head.Type}
+	switch head.Type {
+	case TimelineEvent:
+		t.Event = &PowerEvent{}
+		return json.Unmarshal(data, t.Event)
+	case TimelineAnnotation:
+		t.Annotation = &Annotation{}
+		return json.Unmarshal(data, t.Annotation)
+	}
+	return fmt.Errorf("unknown timeline item type %q", head.Type)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// DeviceCredentials is returned once when a device key is issued; only its
+// hash is stored.
+type DeviceCredentials struct {
+	DeviceID  string    `json:"device_id"`
+	Username  string    `json:"username"`
+	Key       string    `json:"key"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// DeviceMergeRequest moves the history of device From into the device of the
+// request path, e.g. after a reflash changed the device id.
+type DeviceMergeRequest struct {
+	From    string `json:"from" binding:"required"`
+	Actor   string `json:"actor"`
+	Comment string `json:"comment"`
+}
+
+type DeviceMergeResult struct {
+	DeviceID    string `json:"device_id"`
+	MergedFrom  string `json:"merged_from"`
+	MovedEvents int64  `json:"moved_events"`
+	// Aliases are all the old ids whose events now go to DeviceID.
+	Aliases []string `json:"aliases"`
+}
+
+// Device audit actions.
+const (
+	DeviceAuditMerge = "merge"
+)
+
+// DeviceAuditEntry records an administrative change to a device.
+type DeviceAuditEntry struct {
+	ID        int        `json:"id" db:"id"`
+	DeviceID  string     `json:"device_id" db:"device_id"`
+	Action    string     `json:"action" db:"action"`
+	Actor     string     `json:"actor" db:"actor"`
+	Details   JSONObject `json:"details" db:"details"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
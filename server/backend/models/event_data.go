@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSONObject is a JSONB object column. An empty object is stored as NULL.
+type JSONObject map[string]interface{}
+
+func (o *JSONObject) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONObject", src)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*o = m
+	return nil
+}
+
+func (o JSONObject) Value() (driver.Value, error) {
+	if len(o) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]interface{}(o))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// EventDataColumns are the power_events columns EventData is read from, in
+// the order of EventData.ScanFields.
+const EventDataColumns = "client_timestamp, uptime_ms, message, battery_percentage, battery_voltage, wifi_signal_strength, free_heap, data"
+
+// EventData is the payload of a power event. The fields the firmware sends
+// have their own typed columns; anything else (e.g. the details of a reboot
+// event) is kept in the data column as Extra. It is encoded as one flat JSON
+// object with only the fields that are set.
+type EventData struct {
+	ClientTimestamp    *time.Time
+	UptimeMs           *int64
+	Message            *string
+	BatteryPercentage  *int
+	BatteryVoltage     *float64
+	WiFiSignalStrength *int
+	FreeHeap           *int64
+	Extra              JSONObject
+}
+
+// NewEventData takes the payload fields of an ingested event. A missing
+// client timestamp is left unset.
+func NewEventData(req PowerEventRequest) EventData {
+	d := EventData{
+		UptimeMs:           &req.UptimeMs,
+		Message:            &req.Message,
+		BatteryPercentage:  &req.BatteryPercentage,
+		BatteryVoltage:     &req.BatteryVoltage,
+		WiFiSignalStrength: &req.WiFiSignalStrength,
+		FreeHeap:           &req.FreeHeap,
+	}
+	if !req.Timestamp.IsZero() {
+		ts := req.Timestamp.UTC()
+		d.ClientTimestamp = &ts
+	}
+	return d
+}
+
+// ScanFields returns the scan destinations for EventDataColumns.
+func (d *EventData) ScanFields() []interface{} {
+	return []interface{}{&d.ClientTimestamp, &d.UptimeMs, &d.Message, &d.BatteryPercentage, &d.BatteryVoltage, &d.WiFiSignalStrength, &d.FreeHeap, &d.Extra}
+}
+
+// Empty reports whether the event carried no data at all.
+func (d EventData) Empty() bool {
+	return d.ClientTimestamp == nil && d.UptimeMs == nil && d.Message == nil && d.BatteryPercentage == nil &&
+		d.BatteryVoltage == nil && d.WiFiSignalStrength == nil && d.FreeHeap == nil && len(d.Extra) == 0
+}
+
+type eventDataFields struct {
+	ClientTimestamp    *time.Time `json:"client_timestamp,omitempty"`
+	UptimeMs           *int64     `json:"uptime_ms,omitempty"`
+	Message            *string    `json:"message,omitempty"`
+	BatteryPercentage  *int       `json:"battery_percentage,omitempty"`
+	BatteryVoltage     *float64   `json:"battery_voltage,omitempty"`
+	WiFiSignalStrength *int       `json:"wifi_signal_strength,omitempty"`
+	FreeHeap           *int64     `json:"free_heap,omitempty"`
+}
+
+// eventDataKeys are the JSON keys of the typed fields, which take precedence
+// over the same keys in Extra.
+var eventDataKeys = []string{"client_timestamp", "uptime_ms", "message", "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap"}
+
+func (d EventData) MarshalJSON() ([]byte, error) {
+	fields, err := json.Marshal(eventDataFields{d.ClientTimestamp, d.UptimeMs, d.Message, d.BatteryPercentage, d.BatteryVoltage, d.WiFiSignalStrength, d.FreeHeap})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Extra) == 0 {
+		return fields, nil
+	}
+
+	out := map[string]interface{}{}
+	for k, v := range d.Extra {
+		out[k] = v
+	}
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(fields, &typed); err != nil {
+		return nil, err
+	}
+	for k, v := range typed {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+func (d *EventData) UnmarshalJSON(data []byte) error {
+	var fields eventDataFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var extra JSONObject
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	for _, k := range eventDataKeys {
+		delete(extra, k)
+	}
+	if len(extra) == 0 {
+		extra = nil
+	}
+	*d = EventData{fields.ClientTimestamp, fields.UptimeMs, fields.Message, fields.BatteryPercentage, fields.BatteryVoltage, fields.WiFiSignalStrength, fields.FreeHeap, extra}
+	return nil
+}
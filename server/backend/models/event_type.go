@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType struct {
+	Name        string          `json:"name" db:"name"`
+	Description string          `json:"description" db:"description"`
+	Schema      json.RawMessage `json:"schema" db:"schema"`
+	BuiltIn     bool            `json:"built_in"`
+	// Server-only types are generated by the backend and rejected on ingest.
+	ServerOnly bool       `json:"server_only"`
+	CreatedAt  *time.Time `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+type EventTypeRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema" binding:"required"`
+}
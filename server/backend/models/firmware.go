@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type FirmwareRelease struct {
+	ID                int       `json:"id" db:"id"`
+	Version           string    `json:"version" db:"version"`
+	Model             string    `json:"model" db:"model"`
+	Checksum          string    `json:"checksum" db:"checksum"`
+	Size              int64     `json:"size" db:"size"`
+	RolloutPercentage int       `json:"rollout_percentage" db:"rollout_percentage"`
+	Notes             string    `json:"notes,omitempty" db:"notes"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+}
+
+type FirmwareHistoryEntry struct {
+	ID              int       `json:"id" db:"id"`
+	DeviceID        string    `json:"device_id" db:"device_id"`
+	FirmwareVersion string    `json:"firmware_version" db:"firmware_version"`
+	Model           string    `json:"model" db:"model"`
+	SeenAt          time.Time `json:"seen_at" db:"seen_at"`
+}
+
+type RolloutUpdateRequest struct {
+	RolloutPercentage *int `json:"rollout_percentage" binding:"required,min=0,max=100"`
+}
+
+type FirmwareCheckResponse struct {
+	UpdateAvailable bool   `json:"update_available"`
+	CurrentVersion  string `json:"current_version"`
+	Version         string `json:"version,omitempty"`
+	Checksum        string `json:"checksum,omitempty"`
+	Size            int64  `json:"size,omitempty"`
+	URL             string `json:"url,omitempty"`
+}
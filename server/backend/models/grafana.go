@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Request and response bodies of the Grafana JSON datasource protocol.
+
+type GrafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type GrafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+type GrafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+	// Optional filters; older plugin versions send a string or nothing.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type GrafanaTargetFilter struct {
+	DeviceID  string `json:"device_id"`
+	Site      string `json:"site"`
+	EventType string `json:"event_type"`
+}
+
+type GrafanaQueryRequest struct {
+	Range         GrafanaRange    `json:"range"`
+	IntervalMs    int64           `json:"intervalMs"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+	Targets       []GrafanaTarget `json:"targets"`
+}
+
+type GrafanaTimeSeries struct {
+	Target string `json:"target"`
+	// [value, unix milliseconds] pairs.
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type GrafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type GrafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []GrafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type GrafanaAnnotationQuery struct {
+	Name   string `json:"name"`
+	Enable bool   `json:"enable"`
+	Query  string `json:"query"`
+}
+
+type GrafanaAnnotationRequest struct {
+	Range      GrafanaRange           `json:"range"`
+	Annotation GrafanaAnnotationQuery `json:"annotation"`
+}
+
+type GrafanaAnnotation struct {
+	Annotation GrafanaAnnotationQuery `json:"annotation"`
+	// Unix milliseconds.
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd"`
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	Tags    []string `json:"tags"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type RebootRecord struct {
+	BootAt           time.Time `json:"boot_at"`
+	PreviousUptimeMs int64     `json:"previous_uptime_ms"`
+	TriggerEventType string    `json:"trigger_event_type"`
+	CleanBoot        bool      `json:"clean_boot"`
+}
+
+type DeviceHealth struct {
+	DeviceID       string         `json:"device_id"`
+	CrashLooping   bool           `json:"crash_looping"`
+	CrashLoopSince *time.Time     `json:"crash_loop_since"`
+	RebootsLast24h int            `json:"reboots_last_24h"`
+	RebootsLast7d  int            `json:"reboots_last_7d"`
+	LastRebootAt   *time.Time     `json:"last_reboot_at"`
+	RecentReboots  []RebootRecord `json:"recent_reboots"`
+	Heap           *HeapStatus    `json:"heap"`
+}
+
+type HeapStatus struct {
+	DeviceID              string     `json:"device_id"`
+	AnalyzedAt            time.Time  `json:"analyzed_at"`
+	SessionStartedAt      time.Time  `json:"session_started_at"`
+	Samples               int        `json:"samples"`
+	CurrentFreeHeap       int64      `json:"current_free_heap"`
+	SlopeBytesPerHour     *float64   `json:"slope_bytes_per_hour"`
+	RSquared              *float64   `json:"r_squared"`
+	LeakSuspected         bool       `json:"leak_suspected"`
+	ProjectedExhaustionAt *time.Time `json:"projected_exhaustion_at"`
+}
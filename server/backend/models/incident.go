@@ -0,0 +1,118 @@
+package models
+
+import "time"
+
+const (
+	IncidentSiteOutage  = "site_outage"
+	IncidentDeviceFault = "device_fault"
+)
+
+// Incident workflow states.
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+// Root-cause categories set during the post-mortem.
+const (
+	RootCauseUtilityOutage = "utility_outage"
+	RootCauseBreakerTrip   = "breaker_trip"
+	RootCauseUnplugged     = "unplugged"
+	RootCauseDeviceFault   = "device_fault"
+)
+
+// Incident history actions. Entries written by the correlator have the
+// actor "system".
+const (
+	IncidentActionOpened         = "opened"
+	IncidentActionDeviceDown     = "device_down"
+	IncidentActionDeviceRestored = "device_restored"
+	IncidentActionAcknowledged   = "acknowledged"
+	IncidentActionAssigned       = "assigned"
+	IncidentActionRootCause      = "root_cause"
+	IncidentActionCommented      = "commented"
+	IncidentActionResolved       = "resolved"
+	IncidentActionReopened       = "reopened"
+)
+
+type Incident struct {
+	ID             int              `json:"id" db:"id"`
+	ScopeType      string           `json:"scope_type" db:"scope_type"`
+	ScopeKey       string           `json:"scope_key" db:"scope_key"`
+	Classification string           `json:"classification" db:"classification"`
+	DeviceCount    int              `json:"device_count" db:"device_count"`
+	StartedAt      time.Time        `json:"started_at" db:"started_at"`
+	LastEventAt    time.Time        `json:"last_event_at" db:"last_event_at"`
+	ResolvedAt     *time.Time       `json:"resolved_at" db:"resolved_at"`
+	Status         string           `json:"status" db:"status"`
+	Assignee       *string          `json:"assignee" db:"assignee"`
+	RootCause      *string          `json:"root_cause" db:"root_cause"`
+	AcknowledgedAt *time.Time       `json:"acknowledged_at" db:"acknowledged_at"`
+	Devices        []IncidentDevice `json:"devices,omitempty"`
+}
+
+type IncidentDevice struct {
+	IncidentID int        `json:"incident_id" db:"incident_id"`
+	DeviceID   string     `json:"device_id" db:"device_id"`
+	PowerOffAt time.Time  `json:"power_off_at" db:"power_off_at"`
+	PowerOnAt  *time.Time `json:"power_on_at" db:"power_on_at"`
+}
+
+// IncidentHistoryEntry is one step of an incident's timeline: a state
+// change, an assignment, a device going down or coming back, or a comment.
+type IncidentHistoryEntry struct {
+	ID         int     `json:"id" db:"id"`
+	IncidentID int     `json:"incident_id" db:"incident_id"`
+	Action     string  `json:"action" db:"action"`
+	Actor      string  `json:"actor" db:"actor"`
+	DeviceID   *string `json:"device_id,omitempty" db:"device_id"`
+	// New assignee or root cause for assigned/root_cause/resolved entries.
+	Value     *string   `json:"value,omitempty" db:"value"`
+	Comment   string    `json:"comment,omitempty" db:"comment"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type IncidentAcknowledgeRequest struct {
+	Actor string `json:"actor" binding:"required"`
+	// Assigns the incident at the same time when set.
+	Assignee string `json:"assignee"`
+}
+
+// IncidentUpdateRequest changes the assignee or root cause; omitted fields
+// are left as they are and an empty string clears them.
+type IncidentUpdateRequest struct {
+	Actor     string  `json:"actor" binding:"required"`
+	Assignee  *string `json:"assignee"`
+	RootCause *string `json:"root_cause"`
+}
+
+type IncidentCommentRequest struct {
+	Author string `json:"author" binding:"required"`
+	Body   string `json:"body" binding:"required"`
+}
+
+type IncidentResolveRequest struct {
+	Actor     string `json:"actor" binding:"required"`
+	RootCause string `json:"root_cause"`
+	Comment   string `json:"comment"`
+}
+
+type IncidentReopenRequest struct {
+	Actor   string `json:"actor" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+// IncidentSummary aggregates the incidents of one scope and root cause for
+// post-mortems.
+type IncidentSummary struct {
+	ScopeType string `json:"scope_type"`
+	ScopeKey  string `json:"scope_key"`
+	// "" for incidents without a root cause yet.
+	RootCause                string   `json:"root_cause"`
+	Count                    int      `json:"count"`
+	OpenCount                int      `json:"open_count"`
+	DowntimeSeconds          float64  `json:"downtime_seconds"`
+	MeanTimeToAckSeconds     *float64 `json:"mean_time_to_ack_seconds"`
+	MeanTimeToResolveSeconds *float64 `json:"mean_time_to_resolve_seconds"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+const (
+	ScopeDevice = "device"
+	ScopeGroup  = "group"
+	ScopeSite   = "site"
+
+	RecurrenceNone   = "none"
+	RecurrenceDaily  = "daily"
+	RecurrenceWeekly = "weekly"
+)
+
+// MaintenanceWindow is planned work on a device, group or site. A recurring
+// window repeats StartsAt-EndsAt every day or week until RecurrenceUntil.
+type MaintenanceWindow struct {
+	ID              int        `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	ScopeType       string     `json:"scope_type" db:"scope_type"`
+	ScopeKey        string     `json:"scope_key" db:"scope_key"`
+	StartsAt        time.Time  `json:"starts_at" db:"starts_at"`
+	EndsAt          time.Time  `json:"ends_at" db:"ends_at"`
+	Recurrence      string     `json:"recurrence" db:"recurrence"`
+	RecurrenceUntil *time.Time `json:"recurrence_until" db:"recurrence_until"`
+	Reason          string     `json:"reason" db:"reason"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	// Whether an occurrence of the window is in progress now.
+	Active bool `json:"active"`
+}
+
+type MaintenanceWindowRequest struct {
+	Name            string     `json:"name" binding:"required"`
+	ScopeType       string     `json:"scope_type" binding:"required"`
+	ScopeKey        string     `json:"scope_key" binding:"required"`
+	StartsAt        time.Time  `json:"starts_at" binding:"required"`
+	EndsAt          time.Time  `json:"ends_at" binding:"required"`
+	Recurrence      string     `json:"recurrence"`
+	RecurrenceUntil *time.Time `json:"recurrence_until"`
+	Reason          string     `json:"reason"`
+}
+
+// Silence mutes notifications for a device, group or site until it expires.
+// Unlike a maintenance window it does not mark events as expected.
+type Silence struct {
+	ID        int       `json:"id" db:"id"`
+	ScopeType string    `json:"scope_type" db:"scope_type"`
+	ScopeKey  string    `json:"scope_key" db:"scope_key"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	StartsAt  time.Time `json:"starts_at" db:"starts_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SilenceRequest starts a silence now. Exactly one of ExpiresAt and
+// DurationMinutes must be given.
+type SilenceRequest struct {
+	ScopeType       string     `json:"scope_type" binding:"required"`
+	ScopeKey        string     `json:"scope_key" binding:"required"`
+	Reason          string     `json:"reason"`
+	CreatedBy       string     `json:"created_by"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+}
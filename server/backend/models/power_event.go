@@ -7,17 +7,24 @@ type PowerEvent struct {
 	DeviceID  string    `json:"device_id" db:"device_id"`
 	EventType string    `json:"event_type" db:"event_type"`
 	Timestamp time.Time `json:"timestamp" db:"timestamp"`
-	Data      string    `json:"data,omitempty" db:"data"`
+	Data      EventData `json:"data"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// Received during a maintenance window of the device.
+	Expected bool `json:"expected" db:"expected"`
 }
 
 type Device struct {
-	ID          string    `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description,omitempty" db:"description"`
-	LastSeen    time.Time `json:"last_seen" db:"last_seen"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID              string     `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Description     string     `json:"description,omitempty" db:"description"`
+	Model           string     `json:"model,omitempty" db:"model"`
+	FirmwareVersion string     `json:"firmware_version,omitempty" db:"firmware_version"`
+	Site            string     `json:"site,omitempty" db:"site"`
+	Group           string     `json:"group,omitempty" db:"device_group"`
+	OfflineSince    *time.Time `json:"offline_since,omitempty" db:"offline_since"`
+	LastSeen        time.Time  `json:"last_seen" db:"last_seen"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 type PowerEventRequest struct {
@@ -30,9 +37,23 @@ type PowerEventRequest struct {
 	BatteryVoltage     float64   `json:"battery_voltage"`
 	WiFiSignalStrength int       `json:"wifi_signal_strength"`
 	FreeHeap           int64     `json:"free_heap"`
+	FirmwareVersion    string    `json:"firmware_version"`
+	Model              string    `json:"model"`
 }
 
 type DeviceUpdateRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Site        *string `json:"site,omitempty"`
+	Group       *string `json:"group,omitempty"`
+}
+
+type EventStats struct {
+	TotalCount           int        `json:"total_count"`
+	OldestEvent          *time.Time `json:"oldest_event"`
+	NewestEvent          *time.Time `json:"newest_event"`
+	CountLast7Days       int        `json:"count_last_7_days"`
+	CountLast30Days      int        `json:"count_last_30_days"`
+	CountLast90Days      int        `json:"count_last_90_days"`
+	CountOlderThan90Days int        `json:"count_older_than_90_days"`
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+type Webhook struct {
+	ID          int      `json:"id" db:"id"`
+	URL         string   `json:"url" db:"url"`
+	Description string   `json:"description" db:"description"`
+	EventTypes  []string `json:"event_types" db:"event_types"`
+	DeviceIDs   []string `json:"device_ids" db:"device_ids"`
+	Enabled     bool     `json:"enabled" db:"enabled"`
+	// Leave out events during maintenance or a silence.
+	SkipMuted bool `json:"skip_muted" db:"skip_muted"`
+	// Only returned when the webhook is created.
+	Secret    string    `json:"secret,omitempty" db:"secret"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	DeviceIDs   []string `json:"device_ids"`
+	Enabled     *bool    `json:"enabled"`
+	SkipMuted   bool     `json:"skip_muted"`
+	// Generated when empty on create; kept when empty on update.
+	Secret string `json:"secret"`
+}
+
+type WebhookDelivery struct {
+	ID             int64                    `json:"id" db:"id"`
+	WebhookID      int                      `json:"webhook_id" db:"webhook_id"`
+	EventType      string                   `json:"event_type" db:"event_type"`
+	DeviceID       string                   `json:"device_id" db:"device_id"`
+	Payload        json.RawMessage          `json:"payload,omitempty" db:"payload"`
+	Status         string                   `json:"status" db:"status"`
+	Attempts       int                      `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time                `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode *int                     `json:"last_status_code" db:"last_status_code"`
+	LastError      *string                  `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time                `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time               `json:"delivered_at" db:"delivered_at"`
+	AttemptLog     []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at" db:"attempted_at"`
+	StatusCode  *int      `json:"status_code" db:"status_code"`
+	Error       *string   `json:"error" db:"error"`
+	DurationMs  int       `json:"duration_ms" db:"duration_ms"`
+}
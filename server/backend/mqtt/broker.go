@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"backend/credentials"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+type BrokerOptions struct {
+	Address     string
+	TopicPrefix string
+	// Optional login for integrations such as Home Assistant, with access to
+	// all topics.
+	ServiceUsername string
+	ServicePassword string
+}
+
+// Broker is an MQTT broker running inside the backend process for sites
+// without one. Devices log in with their device ID as username and the key
+// issued by the credentials API as password, and may only publish to their
+// own topics. Integrations log in with MQTT_SERVICE_USERNAME or a user created
+// with powerlogger-admin and may use all topics. Messages go straight to the
+// subscriber's handler.
+type Broker struct {
+	server *mochi.Server
+}
+
+// ErrNoServicePassword is returned for a service user without a password,
+// which would give anyone full access.
+var ErrNoServicePassword = errors.New("MQTT_SERVICE_PASSWORD must be set when MQTT_SERVICE_USERNAME is")
+
+func NewBroker(opts BrokerOptions, store *credentials.Store, subscriber *Subscriber) (*Broker, error) {
+	if opts.ServiceUsername != "" && opts.ServicePassword == "" {
+		return nil, ErrNoServicePassword
+	}
+	server := mochi.New(&mochi.Options{InlineClient: true})
+	hook := &deviceAuthHook{store: store, prefix: opts.TopicPrefix, serviceUser: opts.ServiceUsername, servicePassword: opts.ServicePassword}
+	if err := server.AddHook(hook, nil); err != nil {
+		return nil, err
+	}
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: opts.Address})); err != nil {
+		return nil, err
+	}
+
+	handler := func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		subscriber.HandleMessage(pk.TopicName, pk.Payload)
+	}
+	if err := server.Subscribe(opts.TopicPrefix+"/+/events", 1, handler); err != nil {
+		return nil, err
+	}
+	if err := server.Subscribe(opts.TopicPrefix+"/+/status", 2, handler); err != nil {
+		return nil, err
+	}
+	return &Broker{server: server}, nil
+}
+
+func (b *Broker) Start() error {
+	return b.server.Serve()
+}
+
+// Publish sends a QoS 1 message from the broker's inline client.
+func (b *Broker) Publish(topic string, payload []byte, retain bool) error {
+	return b.server.Publish(topic, payload, retain, 1)
+}
+
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
+
+type deviceAuthHook struct {
+	mochi.HookBase
+	store           *credentials.Store
+	prefix          string
+	serviceUser     string
+	servicePassword string
+	// users holds the connected clients that logged in as an mqtt_users login.
+	users sync.Map
+}
+
+func (h *deviceAuthHook) isService(cl *mochi.Client) bool {
+	if h.serviceUser != "" && string(cl.Properties.Username) == h.serviceUser {
+		return true
+	}
+	_, ok := h.users.Load(cl)
+	return ok
+}
+
+func (h *deviceAuthHook) ID() string {
+	return "powerlogger-device-auth"
+}
+
+func (h *deviceAuthHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{mochi.OnConnectAuthenticate, mochi.OnACLCheck, mochi.OnDisconnect}, []byte{b})
+}
+
+func (h *deviceAuthHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	if cl.Net.Inline {
+		return true
+	}
+	if h.serviceUser != "" && string(pk.Connect.Username) == h.serviceUser {
+		// 空のパスワードでは全トピック権限を与えない
+		return h.servicePassword != "" && subtle.ConstantTimeCompare(pk.Connect.Password, []byte(h.servicePassword)) == 1
+	}
+	username, password := string(pk.Connect.Username), string(pk.Connect.Password)
+	found, ok, err := h.store.VerifyUser(username, password)
+	if err != nil {
+		log.Printf("Failed to verify MQTT user %s: %v", username, err)
+		return false
+	}
+	if found {
+		if ok {
+			h.users.Store(cl, struct{}{})
+		}
+		return ok
+	}
+	deviceID := username
+	ok, err = h.store.Verify(deviceID, password)
+	if err != nil {
+		log.Printf("Failed to verify MQTT credentials for device %s: %v", deviceID, err)
+		return false
+	}
+	return ok
+}
+
+func (h *deviceAuthHook) OnDisconnect(cl *mochi.Client, _ error, _ bool) {
+	h.users.Delete(cl)
+}
+
+// OnACLCheck gives the service user full access and lets a device publish
+// only to its own events and status topics and subscribe only below its own
+// prefix.
+func (h *deviceAuthHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	if cl.Net.Inline || h.isService(cl) {
+		return true
+	}
+	own := h.prefix + "/" + string(cl.Properties.Username) + "/"
+	if write {
+		return topic == own+"events" || topic == own+"status"
+	}
+	return strings.HasPrefix(topic, own)
+}
@@ -0,0 +1,159 @@
+package mqtt
+
+import (
+	"backend/credentials"
+	"backend/ingest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+func connectDevice(addr, username, password string) (paho.Client, error) {
+	client := paho.NewClient(paho.NewClientOptions().
+		AddBroker("tcp://"+addr).
+		SetClientID(username).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(false).
+		SetWill("powerlogger/"+username+"/status", StatusOffline, 1, false))
+	token := client.Connect()
+	token.WaitTimeout(5 * time.Second)
+	return client, token.Error()
+}
+
+func TestBroker_AuthenticatesDevicesAndIngests(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(true)
+
+	key := "secret-key"
+	mock.ExpectQuery("SELECT password_hash FROM mqtt_users WHERE username = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}))
+	mock.ExpectQuery("SELECT key_hash FROM device_credentials WHERE device_id = COALESCE\\(\\(SELECT device_id FROM device_aliases WHERE alias_id = \\$1\\), \\$1\\)").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}).AddRow(credentials.Hash(key)))
+	mock.ExpectExec("INSERT INTO devices").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "power_on", sqlmock.AnyArg(), false, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE devices SET offline_since = \\$1 WHERE id = \\$2").
+		WithArgs(sqlmock.AnyArg(), "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	addr := freeAddr(t)
+	subscriber := NewSubscriber(SubscriberOptions{TopicPrefix: "powerlogger"}, ingest.NewPipeline(db))
+	broker, err := NewBroker(BrokerOptions{Address: addr, TopicPrefix: "powerlogger"}, credentials.NewStore(db), subscriber)
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Start())
+	defer broker.Close()
+
+	client, err := connectDevice(addr, "device-001", key)
+	assert.NoError(t, err)
+	defer client.Disconnect(100)
+
+	client.Publish("powerlogger/device-001/events", 1, false, `{"event_type": "power_on"}`).WaitTimeout(time.Second)
+
+	// 他のデバイスのトピックへの発行は ACL 違反で切断され、ラストウィルで offline になる
+	client.Publish("powerlogger/device-002/events", 1, false, `{"event_type": "power_off"}`).WaitTimeout(time.Second)
+
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestBroker_RejectsWrongKey(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT password_hash FROM mqtt_users WHERE username = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}))
+	mock.ExpectQuery("SELECT key_hash FROM device_credentials WHERE device_id = COALESCE\\(\\(SELECT device_id FROM device_aliases WHERE alias_id = \\$1\\), \\$1\\)").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}).AddRow(credentials.Hash("secret-key")))
+
+	addr := freeAddr(t)
+	subscriber := NewSubscriber(SubscriberOptions{TopicPrefix: "powerlogger"}, ingest.NewPipeline(db))
+	broker, err := NewBroker(BrokerOptions{Address: addr, TopicPrefix: "powerlogger"}, credentials.NewStore(db), subscriber)
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Start())
+	defer broker.Close()
+
+	_, err = connectDevice(addr, "device-001", "wrong-key")
+	assert.Error(t, err)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeviceAuthHook_ACL(t *testing.T) {
+	hook := &deviceAuthHook{prefix: "powerlogger"}
+	device := &mochi.Client{Properties: mochi.ClientProperties{Username: []byte("device-001")}}
+
+	assert.True(t, hook.OnACLCheck(device, "powerlogger/device-001/events", true))
+	assert.True(t, hook.OnACLCheck(device, "powerlogger/device-001/status", true))
+	assert.False(t, hook.OnACLCheck(device, "powerlogger/device-002/events", true))
+	assert.False(t, hook.OnACLCheck(device, "powerlogger/device-001/other", true))
+	assert.True(t, hook.OnACLCheck(device, "powerlogger/device-001/commands", false))
+	assert.False(t, hook.OnACLCheck(device, "powerlogger/#", false))
+}
+
+func TestDeviceAuthHook_ServiceUser(t *testing.T) {
+	hook := &deviceAuthHook{prefix: "powerlogger", serviceUser: "homeassistant", servicePassword: "ha-secret"}
+	service := &mochi.Client{Properties: mochi.ClientProperties{Username: []byte("homeassistant")}}
+
+	connect := func(username, password string) packets.Packet {
+		return packets.Packet{Connect: packets.ConnectParams{Username: []byte(username), Password: []byte(password)}}
+	}
+	assert.True(t, hook.OnConnectAuthenticate(service, connect("homeassistant", "ha-secret")))
+	assert.False(t, hook.OnConnectAuthenticate(service, connect("homeassistant", "wrong")))
+
+	assert.True(t, hook.OnACLCheck(service, "homeassistant/status", false))
+	assert.True(t, hook.OnACLCheck(service, "powerlogger/#", false))
+
+	// パスワードが空のサービスユーザーは認証しない
+	hook.servicePassword = ""
+	assert.False(t, hook.OnConnectAuthenticate(service, connect("homeassistant", "")))
+}
+
+func TestDeviceAuthHook_MQTTUser(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT password_hash FROM mqtt_users WHERE username = \\$1").
+		WithArgs("grafana").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(credentials.Hash("user-secret")))
+
+	hook := &deviceAuthHook{store: credentials.NewStore(db), prefix: "powerlogger"}
+	user := &mochi.Client{Properties: mochi.ClientProperties{Username: []byte("grafana")}}
+	pk := packets.Packet{Connect: packets.ConnectParams{Username: []byte("grafana"), Password: []byte("user-secret")}}
+
+	// 管理 CLI で作成したユーザーは全トピックにアクセスできる（デバイスとしては認証しない）
+	assert.True(t, hook.OnConnectAuthenticate(user, pk))
+	assert.True(t, hook.OnACLCheck(user, "powerlogger/#", false))
+	assert.True(t, hook.OnACLCheck(user, "powerlogger/device-001/commands", true))
+
+	// 切断後は権限を残さない
+	hook.OnDisconnect(user, nil, false)
+	assert.False(t, hook.OnACLCheck(user, "powerlogger/#", false))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewBroker_ServiceUserWithoutPassword(t *testing.T) {
+	// 空のパスワードではブローカーを起動しない
+	_, err := NewBroker(BrokerOptions{Address: "127.0.0.1:0", TopicPrefix: "powerlogger", ServiceUsername: "homeassistant"}, nil, nil)
+	assert.Equal(t, ErrNoServicePassword, err)
+}
@@ -0,0 +1,173 @@
+// Package mqtt connects the backend to an MQTT broker: devices publish events
+// to <prefix>/<device_id>/events and a last will to <prefix>/<device_id>/status.
+package mqtt
+
+import (
+	"backend/eventtypes"
+	"backend/ingest"
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// StatusOffline is the payload devices set as their last will.
+	StatusOffline = "offline"
+	StatusOnline  = "online"
+)
+
+type SubscriberOptions struct {
+	BrokerURL   string
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string
+}
+
+type Subscriber struct {
+	opts     SubscriberOptions
+	pipeline *ingest.Pipeline
+	client   paho.Client
+}
+
+func NewSubscriber(opts SubscriberOptions, pipeline *ingest.Pipeline) *Subscriber {
+	return &Subscriber{opts: opts, pipeline: pipeline}
+}
+
+// Start connects to the broker and subscribes. Subscriptions are renewed on
+// every reconnect.
+func (s *Subscriber) Start() error {
+	co := paho.NewClientOptions().
+		AddBroker(s.opts.BrokerURL).
+		SetClientID(s.opts.ClientID).
+		SetUsername(s.opts.Username).
+		SetPassword(s.opts.Password).
+		SetCleanSession(false).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetOnConnectHandler(s.subscribe).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("MQTT connection lost: %v", err)
+		})
+
+	s.client = paho.NewClient(co)
+	// ブローカーに繋がらなくても再試行を続けるので、起動は止めない
+	token := s.client.Connect()
+	if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (s *Subscriber) Stop() {
+	if s.client != nil {
+		s.client.Disconnect(250)
+	}
+}
+
+// Publish sends a QoS 1 message through the subscriber's connection.
+func (s *Subscriber) Publish(topic string, payload []byte, retain bool) error {
+	if s.client == nil {
+		return errors.New("MQTT client not started")
+	}
+	token := s.client.Publish(topic, 1, retain, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+func (s *Subscriber) subscribe(client paho.Client) {
+	filters := map[string]byte{
+		s.opts.TopicPrefix + "/+/events": 1,
+		s.opts.TopicPrefix + "/+/status": 1,
+	}
+	token := client.SubscribeMultiple(filters, func(_ paho.Client, msg paho.Message) {
+		s.HandleMessage(msg.Topic(), msg.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		log.Printf("MQTT subscribe failed: %v", token.Error())
+		return
+	}
+	log.Printf("MQTT subscribed to %s/+/events and %s/+/status", s.opts.TopicPrefix, s.opts.TopicPrefix)
+}
+
+// HandleMessage routes one message by topic. Failures are logged; MQTT has no
+// way to report them back to the device.
+func (s *Subscriber) HandleMessage(topic string, payload []byte) {
+	deviceID, kind, ok := s.parseTopic(topic)
+	if !ok {
+		log.Printf("Ignoring MQTT message on unexpected topic %s", topic)
+		return
+	}
+
+	var err error
+	switch kind {
+	case "events":
+		err = s.handleEvent(deviceID, payload)
+	case "status":
+		err = s.handleStatus(deviceID, payload)
+	}
+	if err != nil {
+		log.Printf("Failed to handle MQTT message on %s: %v", topic, err)
+	}
+}
+
+func (s *Subscriber) parseTopic(topic string) (deviceID, kind string, ok bool) {
+	rest := strings.TrimPrefix(topic, s.opts.TopicPrefix+"/")
+	if rest == topic {
+		return "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func (s *Subscriber) handleEvent(deviceID string, payload []byte) error {
+	var req models.PowerEventRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	// device_id はトピックから決まる（ペイロードでの省略可、不一致は拒否）
+	if req.DeviceID == "" {
+		req.DeviceID = deviceID
+	} else if req.DeviceID != deviceID {
+		return fmt.Errorf("payload device_id %q does not match topic", req.DeviceID)
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return err
+	}
+
+	result, err := s.pipeline.Ingest(req, payload)
+	var verr *eventtypes.ValidationError
+	if errors.As(err, &verr) {
+		return fmt.Errorf("rejected: %v", verr)
+	}
+	if err != nil {
+		return err
+	}
+	for _, w := range result.Warnings {
+		log.Printf("MQTT event from device %s accepted with warning: %v", deviceID, w)
+	}
+	return nil
+}
+
+func (s *Subscriber) handleStatus(deviceID string, payload []byte) error {
+	switch strings.TrimSpace(string(payload)) {
+	case StatusOffline:
+		return s.pipeline.MarkOffline(deviceID, time.Now())
+	case StatusOnline:
+		return s.pipeline.MarkOnline(deviceID, time.Now())
+	}
+	return fmt.Errorf("unknown status payload %q", payload)
+}
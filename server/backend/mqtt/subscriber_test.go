@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"backend/ingest"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// テスト用の外部ブローカーを空きポートで起動する
+func startBroker(t *testing.T) (*mochi.Server, string) {
+	addr := freeAddr(t)
+	server := mochi.New(&mochi.Options{InlineClient: true})
+	assert.NoError(t, server.AddHook(new(auth.AllowHook), nil))
+	assert.NoError(t, server.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: addr})))
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return server, "tcp://" + addr
+}
+
+func TestSubscriber_IngestsEventsFromBroker(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO devices").
+		WithArgs("device-001", "device-001", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "power_off", sqlmock.AnyArg(), false, nil, 1000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE devices SET offline_since = \\$1 WHERE id = \\$2").
+		WithArgs(sqlmock.AnyArg(), "device-001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	broker, url := startBroker(t)
+	sub := NewSubscriber(SubscriberOptions{BrokerURL: url, ClientID: "backend-test", TopicPrefix: "powerlogger"}, ingest.NewPipeline(db))
+	assert.NoError(t, sub.Start())
+	defer sub.Stop()
+
+	// 購読が完了するまで待ってから発行
+	assert.Eventually(t, func() bool {
+		return len(broker.Topics.Subscribers("powerlogger/device-001/status").Subscriptions) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// イベントとラストウィルは受信順に処理される
+	assert.NoError(t, broker.Publish("powerlogger/device-001/events", []byte(`{"event_type": "power_off", "uptime_ms": 1000}`), false, 1))
+	assert.NoError(t, broker.Publish("powerlogger/device-001/status", []byte("offline"), false, 1))
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestHandleMessage_DeviceIDMismatch(t *testing.T) {
+	// モックDB作成（DBには到達しない）
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sub := NewSubscriber(SubscriberOptions{TopicPrefix: "powerlogger"}, ingest.NewPipeline(db))
+	sub.HandleMessage("powerlogger/device-001/events", []byte(`{"device_id": "device-002", "event_type": "power_on"}`))
+	sub.HandleMessage("other/device-001/events", []byte(`{"event_type": "power_on"}`))
+	sub.HandleMessage("powerlogger/device-001/events", []byte(`not json`))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseTopic(t *testing.T) {
+	sub := NewSubscriber(SubscriberOptions{TopicPrefix: "powerlogger"}, nil)
+
+	deviceID, kind, ok := sub.parseTopic("powerlogger/device-001/events")
+	assert.True(t, ok)
+	assert.Equal(t, "device-001", deviceID)
+	assert.Equal(t, "events", kind)
+
+	_, _, ok = sub.parseTopic("powerlogger/device-001/events/extra")
+	assert.False(t, ok)
+	_, _, ok = sub.parseTopic("powerlogger//status")
+	assert.False(t, ok)
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"backend/analysis"
+	"backend/models"
+	"database/sql"
+	"time"
+)
+
+type DigestDevice struct {
+	deviceInfo
+	Outages      []analysis.Outage
+	OutageTotal  time.Duration
+	BatteryLows  int
+	MinBattery   *int
+	Offline      []analysis.Period
+	OfflineTotal time.Duration
+}
+
+type Digest struct {
+	From        time.Time
+	To          time.Time
+	DeviceCount int
+	// Only devices with something to report.
+	Devices []DigestDevice
+}
+
+// BuildDigest summarizes each device's outages, battery_low events and
+// silences longer than offlineAfter within [from, to).
+func BuildDigest(db *sql.DB, from, to time.Time, offlineAfter time.Duration) (Digest, error) {
+	digest := Digest{From: from, To: to}
+
+	rows, err := db.Query(`
+		SELECT d.id, d.name, COALESCE(d.site, ''), COALESCE(p.event_type, ''), p.timestamp,
+			(SELECT MAX(e.timestamp) FROM power_events e WHERE e.device_id = d.id AND e.timestamp < $1)
+		FROM devices d
+		LEFT JOIN LATERAL (
+			SELECT event_type, timestamp FROM power_events
+			WHERE device_id = d.id AND timestamp < $1 AND event_type IN ('power_on', 'power_off')
+			ORDER BY timestamp DESC LIMIT 1
+		) p ON true
+		ORDER BY d.id`, from)
+	if err != nil {
+		return digest, err
+	}
+	defer rows.Close()
+
+	var devices []deviceInfo
+	var histories []analysis.DeviceHistory
+	index := map[string]int{}
+	for rows.Next() {
+		var d deviceInfo
+		var h analysis.DeviceHistory
+		if err := rows.Scan(&d.DeviceID, &d.DeviceName, &d.Site, &h.PriorPowerState, &h.PriorPowerStateAt, &h.LastSeenBefore); err != nil {
+			return digest, err
+		}
+		h.DeviceID, h.Site = d.DeviceID, d.Site
+		index[d.DeviceID] = len(histories)
+		devices = append(devices, d)
+		histories = append(histories, h)
+	}
+	if err := rows.Err(); err != nil {
+		return digest, err
+	}
+	digest.DeviceCount = len(devices)
+
+	// バッテリー残量は battery_low のデータだけ読む
+	eventRows, err := db.Query(`
+		SELECT device_id, event_type, timestamp, CASE WHEN event_type = 'battery_low' THEN battery_percentage END
+		FROM power_events
+		WHERE timestamp >= $1 AND timestamp < $2
+		ORDER BY device_id, timestamp`, from, to)
+	if err != nil {
+		return digest, err
+	}
+	defer eventRows.Close()
+
+	for eventRows.Next() {
+		var e analysis.Event
+		var battery *int
+		if err := eventRows.Scan(&e.DeviceID, &e.EventType, &e.Timestamp, &battery); err != nil {
+			return digest, err
+		}
+		e.SetData(models.EventData{BatteryPercentage: battery})
+		if i, ok := index[e.DeviceID]; ok {
+			histories[i].Events = append(histories[i].Events, e)
+		}
+	}
+	if err := eventRows.Err(); err != nil {
+		return digest, err
+	}
+
+	for i, h := range histories {
+		d := DigestDevice{deviceInfo: devices[i]}
+		for _, o := range analysis.FindOutages(h, from, to) {
+			end := to
+			if o.End != nil {
+				end = *o.End
+			}
+			if o.Start.Before(from) {
+				o.Start = from
+			}
+			d.Outages = append(d.Outages, o)
+			d.OutageTotal += end.Sub(o.Start)
+		}
+		for _, e := range h.Events {
+			if e.EventType != "battery_low" {
+				continue
+			}
+			d.BatteryLows++
+			if e.HasBattery && (d.MinBattery == nil || int(e.BatteryPercentage) < *d.MinBattery) {
+				pct := int(e.BatteryPercentage)
+				d.MinBattery = &pct
+			}
+		}
+		d.Offline = analysis.SilentPeriods(h, from, to, offlineAfter)
+		for _, p := range d.Offline {
+			d.OfflineTotal += p.Duration()
+		}
+
+		if len(d.Outages) > 0 || d.BatteryLows > 0 || len(d.Offline) > 0 {
+			digest.Devices = append(digest.Devices, d)
+		}
+	}
+	return digest, nil
+}
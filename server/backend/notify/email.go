@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+type EmailOptions struct {
+	To []string
+	// Send immediate mails for outages, low battery and alerts.
+	Immediate bool
+	// Hour of day (in Location) the digest of the previous 24 hours is sent;
+	// negative disables the digest.
+	DigestHour int
+	Location   *time.Location
+	// Minimum time between low battery mails for the same device.
+	BatteryCooldown time.Duration
+	// Silence longer than this is reported as offline in the digest.
+	OfflineAfter time.Duration
+}
+
+type deviceInfo struct {
+	DeviceID   string
+	DeviceName string
+	Site       string
+}
+
+type OutageData struct {
+	deviceInfo
+	At                time.Time
+	BatteryPercentage *int
+}
+
+type RestoredData struct {
+	deviceInfo
+	Since    time.Time
+	At       time.Time
+	Duration time.Duration
+}
+
+type BatteryLowData struct {
+	deviceInfo
+	At                time.Time
+	BatteryPercentage int
+	BatteryVoltage    float64
+}
+
+type AlertData struct {
+	deviceInfo
+	AlertType string
+	Severity  string
+	Message   string
+	At        time.Time
+}
+
+type message struct {
+	template string
+	data     interface{}
+	deviceID string
+}
+
+// EmailNotifier turns stored events and new alerts into mails. It implements
+// ingest.Listener and alerts.Notifier; mails are rendered and sent on the
+// Run goroutine.
+type EmailNotifier struct {
+	db        *sql.DB
+	mailer    *Mailer
+	templates *Templates
+	opts      EmailOptions
+	queue     chan func() *message
+
+	// Worker-owned state.
+	outageSince map[string]time.Time
+	batterySent map[string]time.Time
+}
+
+func NewEmailNotifier(db *sql.DB, mailer *Mailer, templates *Templates, opts EmailOptions) *EmailNotifier {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	return &EmailNotifier{
+		db:          db,
+		mailer:      mailer,
+		templates:   templates,
+		opts:        opts,
+		queue:       make(chan func() *message, 256),
+		outageSince: map[string]time.Time{},
+		batterySent: map[string]time.Time{},
+	}
+}
+
+func (n *EmailNotifier) enqueue(f func() *message) {
+	if !n.opts.Immediate {
+		return
+	}
+	select {
+	case n.queue <- f:
+	default:
+		log.Printf("Email notification queue full, dropping notification")
+	}
+}
+
+// EventStored implements ingest.Listener.
+func (n *EmailNotifier) EventStored(e ingest.StoredEvent) {
+	// メンテナンス中・サイレンス中は送らない（既に停電メールを送った復旧は通知する）
+	if e.Muted() && e.EventType != "power_on" {
+		return
+	}
+	switch e.EventType {
+	case "power_off", "power_on", "battery_low":
+		n.enqueue(func() *message { return n.forEvent(e) })
+	}
+}
+
+// AlertRaised implements alerts.Notifier.
+func (n *EmailNotifier) AlertRaised(a models.Alert) {
+	n.enqueue(func() *message {
+		return &message{template: "alert", deviceID: a.DeviceID, data: AlertData{
+			deviceInfo: n.device(a.DeviceID),
+			AlertType:  a.AlertType,
+			Severity:   a.Severity,
+			Message:    a.Message,
+			At:         a.CreatedAt,
+		}}
+	})
+}
+
+// forEvent decides on the worker which mail, if any, an event produces:
+// one outage mail per power_off run, a restored mail only after an outage
+// mail, and low battery mails at most once per cooldown.
+func (n *EmailNotifier) forEvent(e ingest.StoredEvent) *message {
+	switch e.EventType {
+	case "power_off":
+		if _, ok := n.outageSince[e.DeviceID]; ok {
+			return nil
+		}
+		n.outageSince[e.DeviceID] = e.ReceivedAt
+		data := OutageData{deviceInfo: n.device(e.DeviceID), At: e.ReceivedAt}
+		if e.BatteryPercentage > 0 {
+			pct := e.BatteryPercentage
+			data.BatteryPercentage = &pct
+		}
+		return &message{template: "outage", deviceID: e.DeviceID, data: data}
+
+	case "power_on":
+		since, ok := n.outageSince[e.DeviceID]
+		if !ok {
+			return nil
+		}
+		delete(n.outageSince, e.DeviceID)
+		return &message{template: "restored", deviceID: e.DeviceID, data: RestoredData{
+			deviceInfo: n.device(e.DeviceID),
+			Since:      since,
+			At:         e.ReceivedAt,
+			Duration:   e.ReceivedAt.Sub(since),
+		}}
+
+	case "battery_low":
+		if last, ok := n.batterySent[e.DeviceID]; ok && e.ReceivedAt.Sub(last) < n.opts.BatteryCooldown {
+			return nil
+		}
+		n.batterySent[e.DeviceID] = e.ReceivedAt
+		return &message{template: "battery_low", deviceID: e.DeviceID, data: BatteryLowData{
+			deviceInfo:        n.device(e.DeviceID),
+			At:                e.ReceivedAt,
+			BatteryPercentage: e.BatteryPercentage,
+			BatteryVoltage:    e.BatteryVoltage,
+		}}
+	}
+	return nil
+}
+
+// restoreOutages rebuilds outageSince from the latest power_on/power_off of
+// each device, so that an outage mailed before a restart still gets its
+// restored mail and is not mailed again. Expected power_offs were never
+// mailed and are skipped.
+func (n *EmailNotifier) restoreOutages() error {
+	rows, err := n.db.Query(`
+		SELECT DISTINCT ON (device_id) device_id, event_type, expected, timestamp
+		FROM power_events
+		WHERE event_type IN ($1, $2)
+		ORDER BY device_id, timestamp DESC`, "power_off", "power_on")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deviceID, eventType string
+		var expected bool
+		var at time.Time
+		if err := rows.Scan(&deviceID, &eventType, &expected, &at); err != nil {
+			return err
+		}
+		if eventType == "power_off" && !expected {
+			n.outageSince[deviceID] = at
+		}
+	}
+	return rows.Err()
+}
+
+func (n *EmailNotifier) device(deviceID string) deviceInfo {
+	d := deviceInfo{DeviceID: deviceID, DeviceName: deviceID}
+	err := n.db.QueryRow("SELECT name, COALESCE(site, '') FROM devices WHERE id = $1", deviceID).Scan(&d.DeviceName, &d.Site)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to load device %s for notification: %v", deviceID, err)
+	}
+	return d
+}
+
+func (n *EmailNotifier) send(m *message) error {
+	subject, body, err := n.templates.Render(m.template, m.data)
+	if err != nil {
+		return err
+	}
+	return n.mailer.Send(n.opts.To, subject, body)
+}
+
+// NextDigest is the first digest time after now.
+func (n *EmailNotifier) NextDigest(now time.Time) time.Time {
+	local := now.In(n.opts.Location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), n.opts.DigestHour, 0, 0, 0, n.opts.Location)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Run sends queued immediate mails and the daily digest until ctx is
+// cancelled.
+func (n *EmailNotifier) Run(ctx context.Context) {
+	if n.opts.Immediate {
+		if err := n.restoreOutages(); err != nil {
+			log.Printf("Failed to restore open outages for email notifications: %v", err)
+		}
+	}
+
+	var digest <-chan time.Time
+	var digestAt time.Time
+	schedule := func() {
+		if n.opts.DigestHour < 0 {
+			return
+		}
+		digestAt = n.NextDigest(time.Now())
+		digest = time.After(time.Until(digestAt))
+	}
+	schedule()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-n.queue:
+			m := f()
+			if m == nil {
+				continue
+			}
+			if err := n.send(m); err != nil {
+				log.Printf("Failed to send %s email for device %s: %v", m.template, m.deviceID, err)
+			}
+		case <-digest:
+			if err := n.SendDigest(digestAt.AddDate(0, 0, -1), digestAt); err != nil {
+				log.Printf("Failed to send daily digest: %v", err)
+			}
+			schedule()
+		}
+	}
+}
+
+// SendDigest mails the summary of [from, to).
+func (n *EmailNotifier) SendDigest(from, to time.Time) error {
+	digest, err := BuildDigest(n.db, from, to, n.opts.OfflineAfter)
+	if err != nil {
+		return err
+	}
+	return n.send(&message{template: "digest", data: digest})
+}
@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var tokyo = time.FixedZone("JST", 9*60*60)
+
+func testNotifier(t *testing.T, opts EmailOptions) (*EmailNotifier, sqlmock.Sqlmock, <-chan sinkMessage) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	host, port, messages := startSMTPSink(t)
+	templates, err := LoadTemplates("", tokyo)
+	assert.NoError(t, err)
+	opts.To = []string{"facilities@example.com"}
+	opts.Location = tokyo
+	n := NewEmailNotifier(db, NewMailer(SMTPOptions{Host: host, Port: port, From: "powerlogger@example.com"}), templates, opts)
+	return n, mock, messages
+}
+
+func expectDevice(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT name, COALESCE\\(site, ''\\) FROM devices WHERE id = \\$1").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "site"}).AddRow("事務所", "tokyo-office"))
+}
+
+func event(eventType string, at time.Time, battery int) ingest.StoredEvent {
+	return ingest.StoredEvent{
+		PowerEventRequest: models.PowerEventRequest{DeviceID: "device-001", EventType: eventType, BatteryPercentage: battery, BatteryVoltage: 3.45},
+		ReceivedAt:        at,
+	}
+}
+
+func TestEmailNotifier_OutageAndRestore(t *testing.T) {
+	n, mock, messages := testNotifier(t, EmailOptions{Immediate: true})
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expectDevice(mock)
+	expectDevice(mock)
+
+	// 停電中の power_off の重複では再送しない
+	m := n.forEvent(event("power_off", at, 90))
+	assert.NoError(t, n.send(m))
+	assert.Nil(t, n.forEvent(event("power_off", at.Add(time.Minute), 89)))
+	m = n.forEvent(event("power_on", at.Add(83*time.Minute), 70))
+	assert.NoError(t, n.send(m))
+
+	// アサーション
+	subject, body := decodeMail(t, (<-messages).data)
+	assert.Equal(t, "[停電] 事務所（tokyo-office） で電源断を検知しました", subject)
+	assert.Contains(t, body, "検知時刻: 2024-01-01 09:00")
+	assert.Contains(t, body, "バッテリー残量: 90%")
+
+	subject, body = decodeMail(t, (<-messages).data)
+	assert.Equal(t, "[復旧] 事務所（tokyo-office） の電源が復旧しました", subject)
+	assert.Contains(t, body, "停電時間: 1時間23分")
+
+	// 通知していない停電の復旧は送らない
+	assert.Nil(t, n.forEvent(event("power_on", at.Add(2*time.Hour), 70)))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEmailNotifier_RestoreOutages(t *testing.T) {
+	n, mock, messages := testNotifier(t, EmailOptions{Immediate: true})
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 再起動前に停電メールを送った device-001 と、計画停電中の device-002
+	mock.ExpectQuery("SELECT DISTINCT ON \\(device_id\\) device_id, event_type, expected, timestamp FROM power_events").
+		WithArgs("power_off", "power_on").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "event_type", "expected", "timestamp"}).
+			AddRow("device-001", "power_off", false, at).
+			AddRow("device-002", "power_off", true, at).
+			AddRow("device-003", "power_on", false, at))
+	expectDevice(mock)
+
+	assert.NoError(t, n.restoreOutages())
+
+	// 停電メールは再送せず、復旧メールを送る
+	assert.Nil(t, n.forEvent(event("power_off", at.Add(time.Minute), 89)))
+	m := n.forEvent(event("power_on", at.Add(30*time.Minute), 70))
+	assert.NoError(t, n.send(m))
+
+	// アサーション
+	subject, body := decodeMail(t, (<-messages).data)
+	assert.Equal(t, "[復旧] 事務所（tokyo-office） の電源が復旧しました", subject)
+	assert.Contains(t, body, "停電時間: 30分")
+	assert.NotContains(t, n.outageSince, "device-002")
+	assert.NotContains(t, n.outageSince, "device-003")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEmailNotifier_BatteryLowCooldown(t *testing.T) {
+	n, mock, _ := testNotifier(t, EmailOptions{Immediate: true, BatteryCooldown: time.Hour})
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expectDevice(mock)
+	expectDevice(mock)
+
+	m := n.forEvent(event("battery_low", at, 15))
+	assert.NotNil(t, m)
+	subject, body, err := n.templates.Render(m.template, m.data)
+	assert.NoError(t, err)
+	assert.Equal(t, "[バッテリー低下] 事務所（tokyo-office） の残量が 15% です", subject)
+	assert.Contains(t, body, "バッテリー電圧: 3.45V")
+
+	assert.Nil(t, n.forEvent(event("battery_low", at.Add(30*time.Minute), 12)))
+	assert.NotNil(t, n.forEvent(event("battery_low", at.Add(61*time.Minute), 10)))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEmailNotifier_ImmediateDisabled(t *testing.T) {
+	n, _, _ := testNotifier(t, EmailOptions{Immediate: false})
+
+	n.EventStored(event("power_off", time.Now(), 90))
+	n.AlertRaised(models.Alert{DeviceID: "device-001", AlertType: models.AlertCrashLoop})
+
+	assert.Len(t, n.queue, 0)
+}
+
+func TestNextDigest(t *testing.T) {
+	n, _, _ := testNotifier(t, EmailOptions{DigestHour: 8})
+
+	// JST 7:59 → 当日 8:00、8:00 → 翌日 8:00
+	assert.Equal(t, time.Date(2024, 1, 1, 8, 0, 0, 0, tokyo), n.NextDigest(time.Date(2024, 1, 1, 7, 59, 0, 0, tokyo)))
+	assert.Equal(t, time.Date(2024, 1, 2, 8, 0, 0, 0, tokyo), n.NextDigest(time.Date(2024, 1, 1, 8, 0, 0, 0, tokyo)))
+}
+
+func TestSendDigest(t *testing.T) {
+	n, mock, messages := testNotifier(t, EmailOptions{DigestHour: 8, OfflineAfter: 10 * time.Minute})
+	to := time.Date(2024, 1, 2, 8, 0, 0, 0, tokyo)
+	from := to.AddDate(0, 0, -1)
+	before := from.Add(-time.Minute)
+
+	mock.ExpectQuery("SELECT d.id, d.name, COALESCE\\(d.site, ''\\), COALESCE\\(p.event_type, ''\\), p.timestamp").
+		WithArgs(from).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "site", "event_type", "timestamp", "last_seen"}).
+			AddRow("device-001", "事務所", "tokyo-office", "power_on", from.Add(-time.Hour), before).
+			AddRow("device-002", "倉庫", "", "power_on", from.Add(-time.Hour), before))
+
+	// device-001: 30分の停電とバッテリー低下、device-002: 5分ごとに報告（異常なし）
+	rows := sqlmock.NewRows([]string{"device_id", "event_type", "timestamp", "battery_percentage"})
+	for ts := from; ts.Before(to); ts = ts.Add(5 * time.Minute) {
+		eventType := "periodic_status"
+		var battery interface{}
+		switch ts.Sub(from) {
+		case 2 * time.Hour:
+			eventType = "power_off"
+		case 2*time.Hour + 10*time.Minute:
+			eventType, battery = "battery_low", 18
+		case 2*time.Hour + 30*time.Minute:
+			eventType = "power_on"
+		}
+		rows.AddRow("device-001", eventType, ts, battery)
+	}
+	for ts := from; ts.Before(to); ts = ts.Add(5 * time.Minute) {
+		rows.AddRow("device-002", "periodic_status", ts, nil)
+	}
+	mock.ExpectQuery("SELECT device_id, event_type, timestamp, CASE WHEN event_type = 'battery_low' THEN battery_percentage END").
+		WithArgs(from, to).
+		WillReturnRows(rows)
+
+	assert.NoError(t, n.SendDigest(from, to))
+
+	// アサーション
+	subject, body := decodeMail(t, (<-messages).data)
+	assert.Equal(t, "[日次レポート] 2024-01-01 の電源・デバイス状況", subject)
+	assert.Contains(t, body, "デバイス数: 2 / 要確認: 1")
+	assert.Contains(t, body, "■ 事務所（tokyo-office）")
+	assert.Contains(t, body, "停電: 1回 / 合計 30分")
+	assert.Contains(t, body, "    - 2024-01-01 10:00 〜 2024-01-01 10:30")
+	assert.Contains(t, body, "バッテリー低下: 1回（最低 18%）")
+	assert.NotContains(t, body, "倉庫")
+	assert.NotContains(t, body, "オフライン")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
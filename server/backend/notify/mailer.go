@@ -0,0 +1,89 @@
+// Package notify sends email notifications: immediate mails for outages, low
+// battery and new alerts, and a daily digest.
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPOptions struct {
+	Host string
+	Port int
+	// Authentication is skipped when Username is empty, e.g. for a local
+	// SMTP sink.
+	Username string
+	Password string
+	From     string
+}
+
+// Mailer sends UTF-8 plain text mail through an SMTP server. STARTTLS is used
+// when the server offers it.
+type Mailer struct {
+	opts SMTPOptions
+}
+
+func NewMailer(opts SMTPOptions) *Mailer {
+	return &Mailer{opts: opts}
+}
+
+func (m *Mailer) Send(to []string, subject, body string) error {
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+	addr := net.JoinHostPort(m.opts.Host, fmt.Sprint(m.opts.Port))
+	msg, err := buildMessage(m.opts.From, to, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(addr, auth, envelopeAddress(m.opts.From), to, msg)
+}
+
+// envelopeAddress strips a display name: "Power Logger <a@b>" -> "a@b".
+func envelopeAddress(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
+
+// buildMessage encodes the subject as RFC 2047 and the body as base64 so
+// Japanese text survives any relay.
+func buildMessage(from string, to []string, subject, body string, at time.Time) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "powerlogger"
+	if i := strings.LastIndex(envelopeAddress(from), "@"); i >= 0 {
+		domain = envelopeAddress(from)[i+1:]
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", at.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sinkMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPSink accepts mail on a local port the way a development SMTP sink
+// (e.g. Mailpit) would, without authentication or TLS.
+func startSMTPSink(t *testing.T) (string, int, <-chan sinkMessage) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan sinkMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- sinkMessage) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+	reply("220 sink ready")
+	var msg sinkMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = sinkMessage{from: strings.Trim(strings.TrimSpace(line)[10:], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msg.data = data.String()
+			messages <- msg
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// decodeMail returns the decoded subject and body of a message from the sink.
+func decodeMail(t *testing.T, data string) (string, string) {
+	m, err := mail.ReadMessage(strings.NewReader(data))
+	assert.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	assert.NoError(t, err)
+	raw, err := io.ReadAll(m.Body)
+	assert.NoError(t, err)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	assert.NoError(t, err)
+	return subject, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func TestMailer_SendsJapaneseMail(t *testing.T) {
+	host, port, messages := startSMTPSink(t)
+	mailer := NewMailer(SMTPOptions{Host: host, Port: port, From: "電源ロガー <powerlogger@example.com>"})
+
+	err := mailer.Send([]string{"facilities@example.com"}, "[停電] 事務所で電源断", "本文です。\n2行目")
+	assert.NoError(t, err)
+
+	msg := <-messages
+	assert.Equal(t, "powerlogger@example.com", msg.from)
+	assert.Equal(t, []string{"facilities@example.com"}, msg.to)
+	subject, body := decodeMail(t, msg.data)
+	assert.Equal(t, "[停電] 事務所で電源断", subject)
+	assert.Equal(t, "本文です。\n2行目", body)
+	assert.Contains(t, msg.data, "Content-Type: text/plain; charset=UTF-8")
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"backend/models"
+	"bytes"
+	"embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+var alertLabels = map[string]string{
+	models.AlertCrashLoop:  "クラッシュループ",
+	models.AlertMemoryLeak: "メモリリークの疑い",
+}
+
+// Templates renders "<name>.subject" and "<name>.body" for each mail kind.
+type Templates struct {
+	t *template.Template
+}
+
+// LoadTemplates parses the built-in Japanese templates, then any *.tmpl in
+// dir (if set), whose definitions replace the built-in ones. Times are shown
+// in loc.
+func LoadTemplates(dir string, loc *time.Location) (*Templates, error) {
+	funcs := template.FuncMap{
+		"time":     func(t time.Time) string { return t.In(loc).Format("2006-01-02 15:04") },
+		"date":     func(t time.Time) string { return t.In(loc).Format("2006-01-02") },
+		"duration": formatDuration,
+		"alertLabel": func(alertType string) string {
+			if label, ok := alertLabels[alertType]; ok {
+				return label
+			}
+			return alertType
+		},
+	}
+
+	t, err := template.New("notify").Funcs(funcs).ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			if t, err = t.ParseFiles(files...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Templates{t: t}, nil
+}
+
+func (t *Templates) Render(name string, data interface{}) (subject, body string, err error) {
+	var s, b bytes.Buffer
+	if err := t.t.ExecuteTemplate(&s, name+".subject", data); err != nil {
+		return "", "", err
+	}
+	if err := t.t.ExecuteTemplate(&b, name+".body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(s.String()), b.String(), nil
+}
+
+// formatDuration writes a duration as e.g. "1時間23分", or in seconds when
+// shorter than a minute.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d秒", int(d.Seconds()))
+	}
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%d分", minutes)
+	}
+	return fmt.Sprintf("%d時間%d分", minutes/60, minutes%60)
+}
@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"backend/models"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object the spec uses.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+var (
+	eventDataType    = reflect.TypeOf(models.EventData{})
+	timelineItemType = reflect.TypeOf(models.TimelineItem{})
+)
+
+// override returns the schema of types whose JSON encoding is custom and
+// cannot be derived from their fields.
+func (r *registry) override(t reflect.Type) (*Schema, bool) {
+	switch t {
+	case eventDataType:
+		s := r.structSchema(reflect.TypeOf(eventDataFields{}))
+		return &Schema{
+			Type:                 "object",
+			Description:          "Payload of the event: the fields the firmware sends plus any other fields (e.g. the details of a detected reboot).",
+			Properties:           s.Properties,
+			AdditionalProperties: true,
+		}, true
+	case timelineItemType:
+		typeProperty := func(value string) *Schema {
+			return &Schema{Type: "object", Required: []string{"type"}, Properties: map[string]*Schema{
+				"type": {Type: "string", Enum: []string{value}},
+			}}
+		}
+		return &Schema{
+			Description: "A power event or an annotation, flattened with a type field.",
+			OneOf: []*Schema{
+				{AllOf: []*Schema{r.schemaFor(reflect.TypeOf(models.PowerEvent{})), typeProperty(models.TimelineEvent)}},
+				{AllOf: []*Schema{r.schemaFor(reflect.TypeOf(models.Annotation{})), typeProperty(models.TimelineAnnotation)}},
+			},
+		}, true
+	}
+	return nil, false
+}
+
+// eventDataFields mirrors the typed fields of models.EventData.
+type eventDataFields struct {
+	ClientTimestamp    *time.Time `json:"client_timestamp,omitempty"`
+	UptimeMs           *int64     `json:"uptime_ms,omitempty"`
+	Message            *string    `json:"message,omitempty"`
+	BatteryPercentage  *int       `json:"battery_percentage,omitempty"`
+	BatteryVoltage     *float64   `json:"battery_voltage,omitempty"`
+	WiFiSignalStrength *int       `json:"wifi_signal_strength,omitempty"`
+	FreeHeap           *int64     `json:"free_heap,omitempty"`
+}
+
+// registry collects the named component schemas referenced by the spec.
+type registry struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type
+}
+
+func newRegistry() *registry {
+	return &registry{schemas: map[string]*Schema{}, types: map[string]reflect.Type{}}
+}
+
+// schemaFor returns the schema of t. Named structs and overridden types are
+// added to the components and referenced.
+func (r *registry) schemaFor(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := r.schemaFor(t.Elem())
+		if s.Ref != "" {
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+	default:
+		panic(fmt.Sprintf("openapi: unsupported type %s", t))
+	}
+
+	name := t.Name()
+	if name == "" {
+		return r.structSchema(t)
+	}
+	if existing, ok := r.types[name]; ok {
+		if existing != t {
+			panic(fmt.Sprintf("openapi: schema name %s is used by %s and %s", name, existing, t))
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	r.types[name] = t
+	if s, ok := r.override(t); ok {
+		r.schemas[name] = s
+	} else {
+		r.schemas[name] = r.structSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema follows encoding/json: exported fields by their json tag,
+// embedded structs flattened. Fields without omitempty are required.
+func (r *registry) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := r.structSchema(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = r.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
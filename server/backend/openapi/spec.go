@@ -0,0 +1,530 @@
+// Package openapi builds the OpenAPI 3 description of the HTTP API, served at
+// /api/openapi.json. Schemas are derived from the Go types the handlers
+// encode, so they follow the models; the list of operations below must
+// match the routes registered in main (checked by the router tests).
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/analysis"
+	"backend/handlers"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Prefix is where the /api routes are mounted.
+	Prefix = "/api"
+	// V2Prefix is where the same routes are served with the v2 envelope.
+	V2Prefix = "/api/v2"
+	// SpecPath is the route serving the spec itself.
+	SpecPath = "/api/openapi.json"
+)
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Tags       []Tag                           `json:"tags,omitempty"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Tags        []string            `json:"tags"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// route describes one operation of the /api routes.
+type route struct {
+	method  string
+	path    string // gin syntax, relative to Prefix
+	id      string
+	summary string
+	tag     string
+	query   []Parameter
+	// body is the JSON request body, form a multipart/form-data body.
+	body interface{}
+	form *Schema
+	// status and response are the successful response; a nil response is
+	// a Message.
+	status   int
+	response interface{}
+	// produces replaces JSON for the successful response, alsoCSV adds
+	// text/csv (format=csv).
+	produces string
+	alsoCSV  bool
+	// legacy routes are not served under V2Prefix.
+	legacy bool
+}
+
+// Message is the body of responses that only confirm an action.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Error is the body of /api error responses.
+type Error struct {
+	Error string `json:"error"`
+}
+
+type PowerEventCreated struct {
+	Message string `json:"message"`
+	// Warnings are set when the event type has a schema in warn mode.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type EventCleanupRequest struct {
+	OlderThanDays int `json:"older_than_days"`
+}
+
+type EventCleanupResult struct {
+	Message      string `json:"message"`
+	DeletedCount int64  `json:"deleted_count"`
+	CutoffDate   string `json:"cutoff_date"`
+}
+
+type BackfillStarted struct {
+	Status string    `json:"status"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+}
+
+type IncidentSummaryReport struct {
+	From      time.Time                `json:"from"`
+	To        time.Time                `json:"to"`
+	Summaries []models.IncidentSummary `json:"summaries"`
+}
+
+type GrafanaStatus struct {
+	Status string `json:"status"`
+}
+
+// Problem is the body of /api/v2 error responses (RFC 7807). Other members
+// may be present, e.g. the reason an event was rejected.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// Meta is the page information of /api/v2 lists.
+type Meta struct {
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	Count   int  `json:"count"`
+	HasMore bool `json:"has_more"`
+}
+
+func query(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: typ}}
+}
+
+func enumQuery(name, description string, values ...string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: "string", Enum: values}}
+}
+
+var (
+	fromQuery = query("from", "string", "Start of the period (RFC 3339 or YYYY-MM-DD)")
+	toQuery   = query("to", "string", "End of the period (RFC 3339 or YYYY-MM-DD)")
+	daysQuery = query("days", "integer", "Number of days to analyze")
+	// limitQuery is the own limit of routes returning the newest N results.
+	limitQuery = query("limit", "integer", "Maximum number of results (1-1000)")
+)
+
+var routes = []route{
+	// Power events
+	{method: "POST", path: "/power-events", id: "createPowerEvent", summary: "Record a power event", tag: "power-events",
+		body: models.PowerEventRequest{}, status: http.StatusCreated, response: PowerEventCreated{}},
+	{method: "GET", path: "/power-events", id: "listPowerEvents", summary: "List power events, newest first", tag: "power-events",
+		response: []models.PowerEvent{}},
+	{method: "GET", path: "/power-events/search", id: "searchPowerEvents", summary: "Search power events", tag: "power-events",
+		query: []Parameter{
+			{Name: "q", In: "query", Required: true, Description: "Search query, e.g. battery_percentage<20 timeout", Schema: &Schema{Type: "string"}},
+			fromQuery, toQuery, limitQuery,
+		}, response: []models.PowerEvent{}},
+	{method: "GET", path: "/power-events/:id", id: "getPowerEvent", summary: "Get a power event", tag: "power-events",
+		response: models.PowerEvent{}},
+	{method: "GET", path: "/power-events/device/:deviceId/timeline", id: "getDeviceTimeline", summary: "Events and annotations of a device, newest first", tag: "power-events",
+		response: []models.TimelineItem{}},
+	{method: "GET", path: "/power-events/stats", id: "getEventStats", summary: "Event counts by age", tag: "power-events",
+		response: models.EventStats{}},
+	{method: "DELETE", path: "/power-events/cleanup", id: "deleteOldEvents", summary: "Delete events older than a number of days", tag: "power-events",
+		body: EventCleanupRequest{}, response: EventCleanupResult{}},
+
+	// Event types
+	{method: "GET", path: "/event-types", id: "listEventTypes", summary: "List event types", tag: "event-types",
+		response: []models.EventType{}},
+	{method: "GET", path: "/event-types/:name", id: "getEventType", summary: "Get an event type", tag: "event-types",
+		response: models.EventType{}},
+	{method: "POST", path: "/event-types", id: "createEventType", summary: "Register a custom event type", tag: "event-types",
+		body: models.EventTypeRequest{}, status: http.StatusCreated, response: models.EventType{}},
+	{method: "PUT", path: "/event-types/:name", id: "updateEventType", summary: "Update a custom event type", tag: "event-types",
+		body: models.EventTypeRequest{}, response: models.EventType{}},
+	{method: "DELETE", path: "/event-types/:name", id: "deleteEventType", summary: "Delete a custom event type", tag: "event-types"},
+
+	// Devices
+	{method: "GET", path: "/devices", id: "listDevices", summary: "List devices", tag: "devices",
+		response: []models.Device{}},
+	{method: "GET", path: "/devices/:deviceId", id: "getDevice", summary: "Get a device", tag: "devices",
+		response: models.Device{}},
+	{method: "PUT", path: "/devices/:deviceId", id: "updateDevice", summary: "Update a device", tag: "devices",
+		body: models.DeviceUpdateRequest{}},
+	{method: "DELETE", path: "/devices/:deviceId", id: "deleteDevice", summary: "Delete a device", tag: "devices"},
+	{method: "POST", path: "/devices/:deviceId/merge", id: "mergeDevice", summary: "Move the history of another device id into a device", tag: "devices",
+		body: models.DeviceMergeRequest{}, response: models.DeviceMergeResult{}},
+	{method: "GET", path: "/devices/:deviceId/aliases", id: "listDeviceAliases", summary: "Old ids merged into a device", tag: "devices",
+		response: []string{}},
+	{method: "GET", path: "/devices/:deviceId/audit", id: "getDeviceAudit", summary: "Administrative changes to a device", tag: "devices",
+		response: []models.DeviceAuditEntry{}},
+	{method: "GET", path: "/devices/:deviceId/firmware-history", id: "getDeviceFirmwareHistory", summary: "Firmware versions reported by a device", tag: "devices",
+		response: []models.FirmwareHistoryEntry{}},
+	{method: "GET", path: "/devices/:deviceId/battery", id: "getDeviceBattery", summary: "Battery discharge analysis", tag: "devices",
+		query: []Parameter{daysQuery}, response: analysis.BatteryReport{}},
+	{method: "GET", path: "/devices/:deviceId/health", id: "getDeviceHealth", summary: "Reboots and heap status of a device", tag: "devices",
+		response: models.DeviceHealth{}},
+	{method: "POST", path: "/devices/:deviceId/credentials", id: "rotateDeviceCredentials", summary: "Issue a new MQTT key for a device", tag: "devices",
+		status: http.StatusCreated, response: models.DeviceCredentials{}},
+	{method: "DELETE", path: "/devices/:deviceId/credentials", id: "revokeDeviceCredentials", summary: "Revoke the MQTT key of a device", tag: "devices"},
+	{method: "GET", path: "/devices/:deviceId/annotations", id: "listAnnotations", summary: "List annotations of a device", tag: "devices",
+		query:    []Parameter{query("tag", "string", "Only annotations with this tag"), fromQuery, toQuery},
+		response: []models.Annotation{}},
+	{method: "POST", path: "/devices/:deviceId/annotations", id: "createAnnotation", summary: "Annotate a device timeline", tag: "devices",
+		body: models.AnnotationRequest{}, status: http.StatusCreated, response: models.Annotation{}},
+	{method: "GET", path: "/devices/:deviceId/annotations/:id", id: "getAnnotation", summary: "Get an annotation", tag: "devices",
+		response: models.Annotation{}},
+	{method: "PUT", path: "/devices/:deviceId/annotations/:id", id: "updateAnnotation", summary: "Update an annotation", tag: "devices",
+		body: models.AnnotationRequest{}, response: models.Annotation{}},
+	{method: "DELETE", path: "/devices/:deviceId/annotations/:id", id: "deleteAnnotation", summary: "Delete an annotation", tag: "devices"},
+
+	// Incidents
+	{method: "GET", path: "/incidents", id: "listIncidents", summary: "List incidents", tag: "incidents",
+		query: []Parameter{
+			enumQuery("status", "", models.IncidentOpen, models.IncidentAcknowledged, models.IncidentResolved),
+			query("classification", "string", ""), query("site", "string", ""), query("group", "string", ""),
+			query("assignee", "string", ""), query("root_cause", "string", ""),
+		}, response: []models.Incident{}},
+	{method: "GET", path: "/incidents/summary", id: "getIncidentSummary", summary: "Incident counts and times by scope and root cause", tag: "incidents",
+		query: []Parameter{fromQuery, toQuery, query("site", "string", "")}, response: IncidentSummaryReport{}},
+	{method: "GET", path: "/incidents/:id", id: "getIncident", summary: "Get an incident", tag: "incidents",
+		response: models.Incident{}},
+	{method: "PUT", path: "/incidents/:id", id: "updateIncident", summary: "Update an incident", tag: "incidents",
+		body: models.IncidentUpdateRequest{}, response: models.Incident{}},
+	{method: "POST", path: "/incidents/:id/acknowledge", id: "acknowledgeIncident", summary: "Acknowledge an incident", tag: "incidents",
+		body: models.IncidentAcknowledgeRequest{}, response: models.Incident{}},
+	{method: "POST", path: "/incidents/:id/resolve", id: "resolveIncident", summary: "Resolve an incident", tag: "incidents",
+		body: models.IncidentResolveRequest{}, response: models.Incident{}},
+	{method: "POST", path: "/incidents/:id/reopen", id: "reopenIncident", summary: "Reopen an incident", tag: "incidents",
+		body: models.IncidentReopenRequest{}, response: models.Incident{}},
+	{method: "POST", path: "/incidents/:id/comments", id: "addIncidentComment", summary: "Comment on an incident", tag: "incidents",
+		body: models.IncidentCommentRequest{}, status: http.StatusCreated, response: models.IncidentHistoryEntry{}},
+	{method: "GET", path: "/incidents/:id/history", id: "getIncidentHistory", summary: "History of an incident", tag: "incidents",
+		response: []models.IncidentHistoryEntry{}},
+
+	// Alerts
+	{method: "GET", path: "/health/heap", id: "getHeapAnalysis", summary: "Heap trend of all devices", tag: "alerts",
+		query: []Parameter{query("leak_suspected", "boolean", "Only devices with a suspected leak")}, response: []models.HeapStatus{}},
+	{method: "GET", path: "/alerts", id: "listAlerts", summary: "List alerts", tag: "alerts",
+		query:    []Parameter{enumQuery("status", "", "open", "resolved"), query("device_id", "string", ""), query("type", "string", "")},
+		response: []models.Alert{}},
+
+	// Reports
+	{method: "GET", path: "/reports/availability", id: "getAvailabilityReport", summary: "Availability, outages, MTBF and MTTR", tag: "reports",
+		query:    []Parameter{fromQuery, toQuery, query("offline_after_minutes", "integer", ""), enumQuery("format", "", "json", "csv")},
+		response: handlers.AvailabilityReport{}, alsoCSV: true},
+	{method: "GET", path: "/reports/connectivity", id: "getConnectivityReport", summary: "WiFi signal strength and delivery gaps", tag: "reports",
+		query: []Parameter{
+			fromQuery, toQuery, query("site", "string", ""), enumQuery("bucket", "", "hour", "day"),
+			query("low_rssi", "integer", "RSSI (dBm) below which a reading is weak"), query("gap_minutes", "integer", ""),
+		}, response: handlers.ConnectivityReport{}},
+
+	// Export
+	{method: "POST", path: "/export/influx/backfill", id: "backfillInflux", summary: "Re-export stored events to InfluxDB", tag: "export",
+		query: []Parameter{fromQuery, toQuery}, status: http.StatusAccepted, response: BackfillStarted{}},
+
+	// Webhooks
+	{method: "GET", path: "/webhooks", id: "listWebhooks", summary: "List webhooks", tag: "webhooks",
+		response: []models.Webhook{}},
+	{method: "POST", path: "/webhooks", id: "createWebhook", summary: "Subscribe a webhook", tag: "webhooks",
+		body: models.WebhookRequest{}, status: http.StatusCreated, response: models.Webhook{}},
+	{method: "GET", path: "/webhooks/:id", id: "getWebhook", summary: "Get a webhook", tag: "webhooks",
+		response: models.Webhook{}},
+	{method: "PUT", path: "/webhooks/:id", id: "updateWebhook", summary: "Update a webhook", tag: "webhooks",
+		body: models.WebhookRequest{}, response: models.Webhook{}},
+	{method: "DELETE", path: "/webhooks/:id", id: "deleteWebhook", summary: "Delete a webhook", tag: "webhooks"},
+	{method: "GET", path: "/webhooks/:id/deliveries", id: "listWebhookDeliveries", summary: "Deliveries of a webhook, newest first", tag: "webhooks",
+		query:    []Parameter{enumQuery("status", "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead), limitQuery},
+		response: []models.WebhookDelivery{}},
+	{method: "GET", path: "/webhooks/:id/deliveries/:deliveryId", id: "getWebhookDelivery", summary: "Get a delivery", tag: "webhooks",
+		response: models.WebhookDelivery{}},
+	{method: "POST", path: "/webhooks/:id/deliveries/:deliveryId/redeliver", id: "redeliverWebhook", summary: "Queue a delivery again", tag: "webhooks",
+		status: http.StatusAccepted},
+
+	// Maintenance windows and silences
+	{method: "GET", path: "/maintenance-windows", id: "listMaintenanceWindows", summary: "List maintenance windows", tag: "maintenance",
+		query:    []Parameter{query("active", "boolean", "Only windows in effect now"), query("scope_type", "string", ""), query("scope_key", "string", "")},
+		response: []models.MaintenanceWindow{}},
+	{method: "POST", path: "/maintenance-windows", id: "createMaintenanceWindow", summary: "Create a maintenance window", tag: "maintenance",
+		body: models.MaintenanceWindowRequest{}, status: http.StatusCreated, response: models.MaintenanceWindow{}},
+	{method: "GET", path: "/maintenance-windows/:id", id: "getMaintenanceWindow", summary: "Get a maintenance window", tag: "maintenance",
+		response: models.MaintenanceWindow{}},
+	{method: "PUT", path: "/maintenance-windows/:id", id: "updateMaintenanceWindow", summary: "Update a maintenance window", tag: "maintenance",
+		body: models.MaintenanceWindowRequest{}, response: models.MaintenanceWindow{}},
+	{method: "DELETE", path: "/maintenance-windows/:id", id: "deleteMaintenanceWindow", summary: "Delete a maintenance window", tag: "maintenance"},
+	{method: "GET", path: "/silences", id: "listSilences", summary: "List active silences", tag: "maintenance",
+		query: []Parameter{query("expired", "boolean", "Include expired silences")}, response: []models.Silence{}},
+	{method: "POST", path: "/silences", id: "createSilence", summary: "Silence notifications", tag: "maintenance",
+		body: models.SilenceRequest{}, status: http.StatusCreated, response: models.Silence{}},
+	{method: "DELETE", path: "/silences/:id", id: "expireSilence", summary: "Expire a silence", tag: "maintenance"},
+
+	// Firmware
+	{method: "GET", path: "/firmware/check", id: "checkFirmwareUpdate", summary: "Check for a firmware update (polled by devices)", tag: "firmware",
+		query:    []Parameter{query("device_id", "string", ""), query("model", "string", ""), query("version", "string", "")},
+		response: models.FirmwareCheckResponse{}},
+	{method: "POST", path: "/firmware/releases", id: "createFirmwareRelease", summary: "Upload a firmware release", tag: "firmware",
+		form: &Schema{Type: "object", Required: []string{"version", "model", "file"}, Properties: map[string]*Schema{
+			"version":            {Type: "string"},
+			"model":              {Type: "string"},
+			"rollout_percentage": {Type: "integer"},
+			"notes":              {Type: "string"},
+			"file":               {Type: "string", Format: "binary"},
+		}}, status: http.StatusCreated, response: models.FirmwareRelease{}},
+	{method: "GET", path: "/firmware/releases", id: "listFirmwareReleases", summary: "List firmware releases", tag: "firmware",
+		query: []Parameter{query("model", "string", "")}, response: []models.FirmwareRelease{}},
+	{method: "GET", path: "/firmware/releases/:id", id: "getFirmwareRelease", summary: "Get a firmware release", tag: "firmware",
+		response: models.FirmwareRelease{}},
+	{method: "GET", path: "/firmware/releases/:id/binary", id: "downloadFirmwareRelease", summary: "Download a firmware binary", tag: "firmware",
+		produces: "application/octet-stream"},
+	{method: "PUT", path: "/firmware/releases/:id/rollout", id: "updateFirmwareRollout", summary: "Change the rollout percentage", tag: "firmware",
+		body: models.RolloutUpdateRequest{}},
+	{method: "DELETE", path: "/firmware/releases/:id", id: "deleteFirmwareRelease", summary: "Delete a firmware release", tag: "firmware"},
+
+	// Legacy items
+	{method: "GET", path: "/v1/items", id: "listItems", summary: "List items", tag: "items",
+		response: []models.Item{}},
+
+	// Grafana JSON datasource (the protocol Grafana expects, not under v2)
+	{method: "GET", path: "/grafana", id: "grafanaTestConnection", summary: "Grafana connection test", tag: "grafana",
+		response: GrafanaStatus{}, legacy: true},
+	{method: "POST", path: "/grafana/search", id: "grafanaSearch", summary: "Grafana metric and variable search", tag: "grafana",
+		body: models.GrafanaSearchRequest{}, response: []string{}, legacy: true},
+	{method: "POST", path: "/grafana/query", id: "grafanaQuery", summary: "Grafana time series and table query", tag: "grafana",
+		body: models.GrafanaQueryRequest{}, response: []interface{}{}, legacy: true},
+	{method: "POST", path: "/grafana/annotations", id: "grafanaAnnotations", summary: "Grafana outage annotations", tag: "grafana",
+		body: models.GrafanaAnnotationRequest{}, response: []models.GrafanaAnnotation{}, legacy: true},
+}
+
+var pathParam = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// integerParams are path parameters that are numeric ids.
+var integerParams = map[string]bool{"id": true, "deliveryId": true}
+
+// OpenAPIPath converts a gin path to OpenAPI syntax (/devices/{deviceId}).
+func OpenAPIPath(ginPath string) string {
+	return pathParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+var (
+	buildOnce sync.Once
+	document  *Document
+)
+
+// Spec returns the API description.
+func Spec() *Document {
+	buildOnce.Do(func() { document = build() })
+	return document
+}
+
+// Handler serves the spec.
+func Handler(c *gin.Context) {
+	c.JSON(http.StatusOK, Spec())
+}
+
+func build() *Document {
+	r := newRegistry()
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "M5StickC Power Logger API",
+			Version: "2.0.0",
+			Description: "Every route under " + Prefix + " is also served under " + V2Prefix +
+				" (except the Grafana datasource), where successful responses are wrapped in {\"data\", \"meta\"}, " +
+				"lists take limit and offset, and errors are application/problem+json.",
+		},
+		Paths: map[string]map[string]Operation{},
+	}
+	errorSchema := r.schemaFor(reflect.TypeOf(Error{}))
+	problemSchema := r.schemaFor(reflect.TypeOf(Problem{}))
+	metaSchema := r.schemaFor(reflect.TypeOf(Meta{}))
+
+	add := func(path, method string, op Operation) {
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]Operation{}
+		}
+		if _, ok := doc.Paths[path][method]; ok {
+			panic(fmt.Sprintf("openapi: duplicate operation %s %s", method, path))
+		}
+		doc.Paths[path][method] = op
+	}
+
+	tags := map[string]bool{}
+	for _, rt := range routes {
+		tags[rt.tag] = true
+		v1 := r.operation(rt, func(success *Schema, list bool) *Schema { return success }, "application/json", errorSchema)
+		add(OpenAPIPath(Prefix+rt.path), strings.ToLower(rt.method), v1)
+		if rt.legacy {
+			continue
+		}
+
+		v2Path := rt.path
+		if v2Path == "/v1/items" {
+			v2Path = "/items"
+		}
+		v2 := r.operation(rt, func(success *Schema, list bool) *Schema {
+			envelope := &Schema{Type: "object", Required: []string{"data"}, Properties: map[string]*Schema{"data": success}}
+			if list {
+				envelope.Properties["meta"] = metaSchema
+				envelope.Required = append(envelope.Required, "meta")
+			}
+			return envelope
+		}, "application/problem+json", problemSchema)
+		v2.OperationID += "V2"
+		if rt.method == "GET" && isList(rt.response) {
+			// The route's own limit is replaced by the v2 page.
+			params := v2.Parameters[:0:0]
+			for _, p := range v2.Parameters {
+				if p.Name != "limit" {
+					params = append(params, p)
+				}
+			}
+			v2.Parameters = append(params,
+				query("limit", "integer", "Page size (1-1000, default 100)"),
+				query("offset", "integer", "Number of items to skip"))
+		}
+		add(OpenAPIPath(V2Prefix+v2Path), strings.ToLower(rt.method), v2)
+	}
+
+	add(SpecPath, "get", Operation{
+		OperationID: "getOpenAPISpec",
+		Summary:     "This document",
+		Tags:        []string{"meta"},
+		Responses: map[string]Response{"200": {Description: "OpenAPI document", Content: map[string]MediaType{
+			"application/json": {Schema: &Schema{Type: "object"}},
+		}}},
+	})
+	tags["meta"] = true
+
+	for name := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: name})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	doc.Components.Schemas = r.schemas
+	return doc
+}
+
+func isList(response interface{}) bool {
+	return response != nil && reflect.TypeOf(response).Kind() == reflect.Slice
+}
+
+// operation builds rt with the success body passed through wrap and errors
+// described by errorSchema.
+func (r *registry) operation(rt route, wrap func(success *Schema, list bool) *Schema, errorType string, errorSchema *Schema) Operation {
+	op := Operation{OperationID: rt.id, Summary: rt.summary, Tags: []string{rt.tag}}
+
+	for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+		schema := &Schema{Type: "string"}
+		if integerParams[m[1]] {
+			schema = &Schema{Type: "integer"}
+		}
+		op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	op.Parameters = append(op.Parameters, rt.query...)
+
+	switch {
+	case rt.body != nil:
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: r.schemaFor(reflect.TypeOf(rt.body))},
+		}}
+	case rt.form != nil:
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"multipart/form-data": {Schema: rt.form},
+		}}
+	}
+
+	status := rt.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	if rt.produces != "" {
+		success.Content = map[string]MediaType{rt.produces: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	} else {
+		response := rt.response
+		if response == nil {
+			response = Message{}
+		}
+		success.Content = map[string]MediaType{
+			"application/json": {Schema: wrap(r.schemaFor(reflect.TypeOf(response)), isList(response))},
+		}
+		if rt.alsoCSV {
+			success.Content["text/csv"] = MediaType{Schema: &Schema{Type: "string"}}
+		}
+	}
+
+	op.Responses = map[string]Response{
+		fmt.Sprint(status): success,
+		"default":          {Description: "Error", Content: map[string]MediaType{errorType: {Schema: errorSchema}}},
+	}
+	return op
+}
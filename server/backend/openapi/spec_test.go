@@ -0,0 +1,76 @@
+package openapi
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpec_References(t *testing.T) {
+	b, err := json.Marshal(Spec())
+	assert.NoError(t, err)
+
+	// すべての $ref が components に存在する
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(b), -1)
+	assert.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Contains(t, Spec().Components.Schemas, ref[1])
+	}
+}
+
+func TestSpec_Operations(t *testing.T) {
+	ids := map[string]bool{}
+	for path, ops := range Spec().Paths {
+		for method, op := range ops {
+			// operationId は一意
+			assert.False(t, ids[op.OperationID], op.OperationID)
+			ids[op.OperationID] = true
+
+			// パスのパラメーターはすべて定義されている
+			declared := map[string]bool{}
+			names := map[string]bool{}
+			for _, p := range op.Parameters {
+				assert.False(t, names[p.In+p.Name], "%s %s: duplicate parameter %s", method, path, p.Name)
+				names[p.In+p.Name] = true
+				if p.In == "path" {
+					declared[p.Name] = true
+				}
+			}
+			for _, m := range regexp.MustCompile(`\{([^}]+)\}`).FindAllStringSubmatch(path, -1) {
+				assert.True(t, declared[m[1]], "%s %s: %s", method, path, m[1])
+			}
+
+			assert.NotEmpty(t, op.Responses, "%s %s", method, path)
+		}
+	}
+}
+
+func TestSpec_Schemas(t *testing.T) {
+	schemas := Spec().Components.Schemas
+
+	// 必須項目は omitempty のない項目
+	assert.ElementsMatch(t, []string{"id", "device_id", "event_type", "timestamp", "data", "created_at", "expected"}, schemas["PowerEvent"].Required)
+
+	// data は型付きの項目と任意の項目をもつオブジェクト
+	data := schemas["EventData"]
+	assert.Equal(t, true, data.AdditionalProperties)
+	assert.Equal(t, "integer", data.Properties["battery_percentage"].Type)
+	assert.True(t, data.Properties["battery_percentage"].Nullable)
+
+	// ポインターは nullable
+	assert.True(t, schemas["EventStats"].Properties["oldest_event"].Nullable)
+
+	// v2 の一覧はエンベロープで包まれ、ページングできる
+	op := Spec().Paths["/api/v2/power-events/search"]["get"]
+	var params []string
+	for _, p := range op.Parameters {
+		params = append(params, p.Name)
+	}
+	assert.Equal(t, "q,from,to,limit,offset", strings.Join(params, ","))
+	envelope := op.Responses["200"].Content["application/json"].Schema
+	assert.Equal(t, []string{"data", "meta"}, envelope.Required)
+	assert.Contains(t, op.Responses["default"].Content, "application/problem+json")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"backend/apiv2"
+	"backend/handlers"
+	"backend/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeHandlers are the handlers setupRouter dispatches to.
+type routeHandlers struct {
+	Items       *handlers.ItemHandler
+	PowerEvents *handlers.PowerEventHandler
+	EventTypes  *handlers.EventTypeHandler
+	Devices     *handlers.DeviceHandler
+	Firmware    *handlers.FirmwareHandler
+	Incidents   *handlers.IncidentHandler
+	Alerts      *handlers.AlertHandler
+	Reports     *handlers.ReportHandler
+	Export      *handlers.ExportHandler
+	Webhooks    *handlers.WebhookHandler
+	Maintenance *handlers.MaintenanceHandler
+	Grafana     *handlers.GrafanaHandler
+	Annotations *handlers.AnnotationHandler
+}
+
+// setupRouter registers every route. The routes must match the operations
+// of package openapi (see router_test.go).
+func setupRouter(h routeHandlers) *gin.Engine {
+	router := gin.Default()
+
+	// CORS設定
+	router.Use(func(c *gin.Context) {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	})
+
+	// /api と /api/v2 で同じハンドラーを使う（list は一覧を返すルート）
+	registerRoutes := func(api *gin.RouterGroup, wrap, list func(gin.HandlerFunc) gin.HandlerFunc) {
+		// Power Events API
+		api.POST("/power-events", wrap(h.PowerEvents.CreatePowerEvent))
+		api.GET("/power-events", list(h.PowerEvents.GetPowerEvents))
+		api.GET("/power-events/search", list(h.PowerEvents.SearchPowerEvents))
+		api.GET("/power-events/:id", wrap(h.PowerEvents.GetPowerEventByID))
+		api.GET("/power-events/device/:deviceId/timeline", list(h.PowerEvents.GetDeviceTimeline))
+		api.GET("/power-events/stats", wrap(h.PowerEvents.GetEventStats))
+		api.DELETE("/power-events/cleanup", wrap(h.PowerEvents.DeleteOldEvents))
+
+		// Event Type API
+		api.GET("/event-types", list(h.EventTypes.GetEventTypes))
+		api.GET("/event-types/:name", wrap(h.EventTypes.GetEventType))
+		api.POST("/event-types", wrap(h.EventTypes.CreateEventType))
+		api.PUT("/event-types/:name", wrap(h.EventTypes.UpdateEventType))
+		api.DELETE("/event-types/:name", wrap(h.EventTypes.DeleteEventType))
+
+		// Device Management API
+		api.GET("/devices", list(h.Devices.GetDevices))
+		api.GET("/devices/:deviceId", wrap(h.Devices.GetDeviceByID))
+		api.PUT("/devices/:deviceId", wrap(h.Devices.UpdateDevice))
+		api.DELETE("/devices/:deviceId", wrap(h.Devices.DeleteDevice))
+		api.POST("/devices/:deviceId/merge", wrap(h.Devices.MergeDevice))
+		api.GET("/devices/:deviceId/aliases", list(h.Devices.GetDeviceAliases))
+		api.GET("/devices/:deviceId/audit", list(h.Devices.GetDeviceAudit))
+		api.GET("/devices/:deviceId/firmware-history", list(h.Firmware.GetDeviceFirmwareHistory))
+		api.GET("/devices/:deviceId/battery", wrap(h.Devices.GetDeviceBattery))
+		api.GET("/devices/:deviceId/health", wrap(h.Devices.GetDeviceHealth))
+		api.POST("/devices/:deviceId/credentials", wrap(h.Devices.RotateDeviceCredentials))
+		api.DELETE("/devices/:deviceId/credentials", wrap(h.Devices.RevokeDeviceCredentials))
+		api.GET("/devices/:deviceId/annotations", list(h.Annotations.GetAnnotations))
+		api.POST("/devices/:deviceId/annotations", wrap(h.Annotations.CreateAnnotation))
+		api.GET("/devices/:deviceId/annotations/:id", wrap(h.Annotations.GetAnnotationByID))
+		api.PUT("/devices/:deviceId/annotations/:id", wrap(h.Annotations.UpdateAnnotation))
+		api.DELETE("/devices/:deviceId/annotations/:id", wrap(h.Annotations.DeleteAnnotation))
+
+		// Incident API
+		api.GET("/incidents", list(h.Incidents.GetIncidents))
+		api.GET("/incidents/summary", wrap(h.Incidents.GetIncidentSummary))
+		api.GET("/incidents/:id", wrap(h.Incidents.GetIncidentByID))
+		api.PUT("/incidents/:id", wrap(h.Incidents.UpdateIncident))
+		api.POST("/incidents/:id/acknowledge", wrap(h.Incidents.AcknowledgeIncident))
+		api.POST("/incidents/:id/resolve", wrap(h.Incidents.ResolveIncident))
+		api.POST("/incidents/:id/reopen", wrap(h.Incidents.ReopenIncident))
+		api.POST("/incidents/:id/comments", wrap(h.Incidents.AddIncidentComment))
+		api.GET("/incidents/:id/history", list(h.Incidents.GetIncidentHistory))
+
+		// Alert API
+		api.GET("/health/heap", list(h.Devices.GetHeapAnalysis))
+		api.GET("/alerts", list(h.Alerts.GetAlerts))
+
+		// Report API
+		api.GET("/reports/availability", wrap(h.Reports.GetAvailabilityReport))
+		api.GET("/reports/connectivity", wrap(h.Reports.GetConnectivityReport))
+
+		// Export API
+		api.POST("/export/influx/backfill", wrap(h.Export.BackfillInflux))
+
+		// Webhook API
+		api.GET("/webhooks", list(h.Webhooks.GetWebhooks))
+		api.POST("/webhooks", wrap(h.Webhooks.CreateWebhook))
+		api.GET("/webhooks/:id", wrap(h.Webhooks.GetWebhookByID))
+		api.PUT("/webhooks/:id", wrap(h.Webhooks.UpdateWebhook))
+		api.DELETE("/webhooks/:id", wrap(h.Webhooks.DeleteWebhook))
+		api.GET("/webhooks/:id/deliveries", list(h.Webhooks.GetWebhookDeliveries))
+		api.GET("/webhooks/:id/deliveries/:deliveryId", wrap(h.Webhooks.GetWebhookDelivery))
+		api.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", wrap(h.Webhooks.RedeliverWebhook))
+
+		// Maintenance window / silence API
+		api.GET("/maintenance-windows", list(h.Maintenance.GetMaintenanceWindows))
+		api.POST("/maintenance-windows", wrap(h.Maintenance.CreateMaintenanceWindow))
+		api.GET("/maintenance-windows/:id", wrap(h.Maintenance.GetMaintenanceWindowByID))
+		api.PUT("/maintenance-windows/:id", wrap(h.Maintenance.UpdateMaintenanceWindow))
+		api.DELETE("/maintenance-windows/:id", wrap(h.Maintenance.DeleteMaintenanceWindow))
+		api.GET("/silences", list(h.Maintenance.GetSilences))
+		api.POST("/silences", wrap(h.Maintenance.CreateSilence))
+		api.DELETE("/silences/:id", wrap(h.Maintenance.ExpireSilence))
+
+		// Firmware Release API
+		api.GET("/firmware/check", wrap(h.Firmware.CheckUpdate))
+		api.POST("/firmware/releases", wrap(h.Firmware.CreateRelease))
+		api.GET("/firmware/releases", list(h.Firmware.GetReleases))
+		api.GET("/firmware/releases/:id", wrap(h.Firmware.GetReleaseByID))
+		api.GET("/firmware/releases/:id/binary", wrap(h.Firmware.DownloadRelease))
+		api.PUT("/firmware/releases/:id/rollout", wrap(h.Firmware.UpdateRollout))
+		api.DELETE("/firmware/releases/:id", wrap(h.Firmware.DeleteRelease))
+	}
+
+	api := router.Group("/api")
+	{
+		// Legacy API
+		v1 := api.Group("/v1")
+		{
+			v1.GET("/items", h.Items.GetItems)
+		}
+
+		plain := func(handler gin.HandlerFunc) gin.HandlerFunc { return handler }
+		registerRoutes(api, plain, plain)
+
+		// Grafana JSON datasource API
+		api.GET("/grafana", h.Grafana.TestConnection)
+		api.POST("/grafana/search", h.Grafana.Search)
+		api.POST("/grafana/query", h.Grafana.Query)
+		api.POST("/grafana/annotations", h.Grafana.Annotations)
+
+		// OpenAPI
+		api.GET("/openapi.json", openapi.Handler)
+	}
+
+	// v2: 共通のレスポンス形式（エンベロープ・problem+json）
+	v2 := api.Group("/v2")
+	{
+		v2.GET("/items", apiv2.AdaptList(h.Items.GetItems))
+		registerRoutes(v2, apiv2.Adapt, apiv2.AdaptList)
+	}
+	router.NoRoute(apiv2.NoRoute)
+
+	return router
+}
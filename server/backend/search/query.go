@@ -0,0 +1,244 @@
+// Package search parses the event search language of
+// GET /api/power-events/search into parameterized SQL conditions.
+//
+// A query is a list of terms joined by whitespace or AND. A term is either a
+// predicate on a field (battery_percentage<20, event_type=system_error,
+// message="disk full") or free text, which is matched against the event
+// message with PostgreSQL full-text search ("quoted text" as a phrase).
+// Fields with a power_events column are compared on the column, any other
+// field on the data column.
+//
+// Free text and predicates on device_id, event_type, battery_percentage and
+// wifi_signal_strength are backed by indexes, as are = and != on data fields
+// (through the GIN index on data). Predicates on message, uptime_ms,
+// battery_voltage and free_heap and comparisons (<, >, ...) on data fields
+// are not; they filter the events the other conditions leave.
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MessageVector is the tsvector expression the message index is built on.
+// Conditions must use exactly this expression for the index to apply.
+const MessageVector = "to_tsvector('simple', COALESCE(message, ''))"
+
+const maxQueryLength = 1000
+
+var fieldPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,63}$`)
+
+type columnKind int
+
+const (
+	textColumn columnKind = iota + 1
+	numericColumn
+)
+
+// columnFields are predicates on power_events columns rather than data.
+var columnFields = map[string]columnKind{
+	"device_id":            textColumn,
+	"event_type":           textColumn,
+	"message":              textColumn,
+	"uptime_ms":            numericColumn,
+	"battery_percentage":   numericColumn,
+	"battery_voltage":      numericColumn,
+	"wifi_signal_strength": numericColumn,
+	"free_heap":            numericColumn,
+}
+
+type Predicate struct {
+	Field string
+	Op    string
+	// Value is a float64, bool or string.
+	Value interface{}
+}
+
+type Query struct {
+	// Words and Phrases are matched against the message.
+	Words      []string
+	Phrases    []string
+	Predicates []Predicate
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func isOpChar(r byte) bool {
+	return r == '<' || r == '>' || r == '=' || r == '!'
+}
+
+func tokenize(q string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(q); {
+		switch ch := q[i]; {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '"':
+			end := strings.IndexByte(q[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+			tokens = append(tokens, token{tokenString, q[i+1 : i+1+end]})
+			i += end + 2
+		case isOpChar(ch):
+			j := i
+			for j < len(q) && isOpChar(q[j]) {
+				j++
+			}
+			op := q[i:j]
+			switch op {
+			case "<", "<=", ">", ">=", "=", "!=":
+			default:
+				return nil, fmt.Errorf("invalid operator %q", op)
+			}
+			tokens = append(tokens, token{tokenOp, op})
+			i = j
+		default:
+			j := i
+			for j < len(q) && !isOpChar(q[j]) && !strings.ContainsRune(" \t\n\r\"", rune(q[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, q[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// Parse reads a search query. Field names and operators are checked here so
+// that nothing from the query is ever spliced into SQL.
+func Parse(q string) (*Query, error) {
+	if len(q) > maxQueryLength {
+		return nil, fmt.Errorf("query is longer than %d characters", maxQueryLength)
+	}
+	tokens, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.kind == tokenOp:
+			return nil, fmt.Errorf("operator %q needs a field name before it", t.text)
+		case t.kind == tokenWord && i+1 < len(tokens) && tokens[i+1].kind == tokenOp:
+			if i+2 >= len(tokens) || tokens[i+2].kind == tokenOp {
+				return nil, fmt.Errorf("missing value after %s%s", t.text, tokens[i+1].text)
+			}
+			p, err := newPredicate(t.text, tokens[i+1].text, tokens[i+2])
+			if err != nil {
+				return nil, err
+			}
+			query.Predicates = append(query.Predicates, p)
+			i += 2
+		case t.kind == tokenString:
+			if strings.TrimSpace(t.text) != "" {
+				query.Phrases = append(query.Phrases, t.text)
+			}
+		case t.text == "AND":
+		case t.text == "OR" || t.text == "NOT":
+			return nil, fmt.Errorf("%s is not supported; terms are always combined with AND", t.text)
+		default:
+			query.Words = append(query.Words, t.text)
+		}
+	}
+	if len(query.Words) == 0 && len(query.Phrases) == 0 && len(query.Predicates) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	return query, nil
+}
+
+func newPredicate(field, op string, value token) (Predicate, error) {
+	if !fieldPattern.MatchString(field) {
+		return Predicate{}, fmt.Errorf("invalid field name %q", field)
+	}
+	if field == "client_timestamp" {
+		return Predicate{}, fmt.Errorf("client_timestamp cannot be searched; use from and to")
+	}
+	p := Predicate{Field: field, Op: op, Value: value.text}
+	kind := columnFields[field]
+	if value.kind == tokenWord && kind != textColumn {
+		if f, err := strconv.ParseFloat(value.text, 64); err == nil {
+			p.Value = f
+		} else if value.text == "true" || value.text == "false" {
+			p.Value = value.text == "true"
+		}
+	}
+	_, numeric := p.Value.(float64)
+	if kind == numericColumn && !numeric {
+		return Predicate{}, fmt.Errorf("%s%s%s: %s is numeric", field, op, value.text, field)
+	}
+	if !numeric && op != "=" && op != "!=" {
+		return Predicate{}, fmt.Errorf("%s%s%s: %s needs a number", field, op, value.text, op)
+	}
+	return p, nil
+}
+
+// Where returns the query's conditions, numbering placeholders after the
+// args already collected, and args extended with the query's values.
+func (q *Query) Where(args []interface{}) ([]string, []interface{}) {
+	var conditions []string
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(q.Words) > 0 {
+		conditions = append(conditions, MessageVector+" @@ plainto_tsquery('simple', "+arg(strings.Join(q.Words, " "))+")")
+	}
+	for _, phrase := range q.Phrases {
+		conditions = append(conditions, MessageVector+" @@ phraseto_tsquery('simple', "+arg(phrase)+")")
+	}
+
+	for _, p := range q.Predicates {
+		if columnFields[p.Field] != 0 {
+			// Field names are from the fixed list, values are parameters.
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", p.Field, sqlOp(p.Op), arg(p.Value)))
+			continue
+		}
+		switch p.Op {
+		case "=":
+			// Containment can use the GIN index on data.
+			conditions = append(conditions, "data @> "+arg(containment(p))+"::jsonb")
+		case "!=":
+			// Both the key test and the containment can use the GIN index.
+			key := arg(p.Field)
+			conditions = append(conditions, fmt.Sprintf("(data ? %s::text AND NOT data @> %s::jsonb)", key, arg(containment(p))))
+		default:
+			// Non-numeric values compare as NULL instead of failing the cast.
+			// No index covers this expression.
+			key := arg(p.Field)
+			conditions = append(conditions, fmt.Sprintf(
+				"CASE WHEN jsonb_typeof(data->%s::text) = 'number' THEN (data->>%s::text)::numeric END %s %s",
+				key, key, p.Op, arg(p.Value)))
+		}
+	}
+	return conditions, args
+}
+
+func sqlOp(op string) string {
+	if op == "!=" {
+		return "<>"
+	}
+	return op
+}
+
+func containment(p Predicate) string {
+	b, _ := json.Marshal(map[string]interface{}{p.Field: p.Value})
+	return string(b)
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`battery_percentage<20 AND wifi_signal_strength <= -80 timeout "disk full" event_type=system_error`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"timeout"}, q.Words)
+	assert.Equal(t, []string{"disk full"}, q.Phrases)
+	assert.Equal(t, []Predicate{
+		{Field: "battery_percentage", Op: "<", Value: 20.0},
+		{Field: "wifi_signal_strength", Op: "<=", Value: -80.0},
+		{Field: "event_type", Op: "=", Value: "system_error"},
+	}, q.Predicates)
+}
+
+func TestParse_Values(t *testing.T) {
+	// 列の値は数字でも文字列のまま、data の値は数値・真偽値に変換する
+	q, err := Parse(`device_id=123 charging=true model="M5StickC Plus"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []Predicate{
+		{Field: "device_id", Op: "=", Value: "123"},
+		{Field: "charging", Op: "=", Value: true},
+		{Field: "model", Op: "=", Value: "M5StickC Plus"},
+	}, q.Predicates)
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"   AND ",
+		"battery_percentage<",
+		"<20",
+		"battery_percentage=<20",
+		"message<abc",
+		`"unterminated`,
+		"Battery<20",
+		"data->>'x'<1",
+		"timeout OR reset",
+		"battery_percentage=low",
+		"client_timestamp>1",
+	} {
+		_, err := Parse(q)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	q, err := Parse(`battery_percentage<20 free_heap!=0 event_type!=power_on "wifi lost" reset previous_uptime_ms>=1000 clean_boot!=true`)
+	assert.NoError(t, err)
+
+	// 既存の引数の後ろから番号を振る。列のある項目は列で比較する
+	conditions, args := q.Where([]interface{}{"existing"})
+	assert.Equal(t, []string{
+		MessageVector + " @@ plainto_tsquery('simple', $2)",
+		MessageVector + " @@ phraseto_tsquery('simple', $3)",
+		"battery_percentage < $4",
+		"free_heap <> $5",
+		"event_type <> $6",
+		"CASE WHEN jsonb_typeof(data->$7::text) = 'number' THEN (data->>$7::text)::numeric END >= $8",
+		"(data ? $9::text AND NOT data @> $10::jsonb)",
+	}, conditions)
+	assert.Equal(t, []interface{}{"existing", "reset", "wifi lost", 20.0, 0.0, "power_on", "previous_uptime_ms", 1000.0, "clean_boot", `{"clean_boot":true}`}, args)
+}
+
+func TestWhere_Containment(t *testing.T) {
+	q, err := Parse(`message="it's fine" x=1 trigger_event_type=power_on`)
+	assert.NoError(t, err)
+
+	// 値は SQL に埋め込まず引数（data の項目は JSON）として渡す
+	conditions, args := q.Where(nil)
+	assert.Equal(t, []string{"message = $1", "data @> $2::jsonb", "data @> $3::jsonb"}, conditions)
+	assert.Equal(t, []interface{}{"it's fine", `{"x":1}`, `{"trigger_event_type":"power_on"}`}, args)
+}
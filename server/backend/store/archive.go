@@ -0,0 +1,181 @@
+package store
+
+import (
+	"backend/models"
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Record is one line of an export: a device or one of its events. Devices
+// come before their events.
+type Record struct {
+	Device *models.Device     `json:"device,omitempty"`
+	Event  *models.PowerEvent `json:"event,omitempty"`
+}
+
+// ExportFilter narrows an export. Zero values select everything.
+type ExportFilter struct {
+	DeviceID string
+	From     time.Time
+	To       time.Time
+}
+
+const eventColumns = "id, device_id, event_type, timestamp, created_at, expected, " + models.EventDataColumns
+
+// Export writes the devices and their events (oldest first) as JSON Lines
+// and returns how many of each were written.
+func Export(db *sql.DB, w io.Writer, filter ExportFilter) (devices, events int, err error) {
+	enc := json.NewEncoder(w)
+
+	deviceQuery := "SELECT " + deviceColumns + " FROM devices"
+	var deviceArgs []interface{}
+	if filter.DeviceID != "" {
+		deviceQuery += " WHERE id = $1"
+		deviceArgs = append(deviceArgs, filter.DeviceID)
+	}
+	rows, err := db.Query(deviceQuery+" ORDER BY id", deviceArgs...)
+	if err != nil {
+		return 0, 0, err
+	}
+	for rows.Next() {
+		var d models.Device
+		if err := scanDevice(rows, &d); err != nil {
+			rows.Close()
+			return devices, 0, err
+		}
+		if err := enc.Encode(Record{Device: &d}); err != nil {
+			rows.Close()
+			return devices, 0, err
+		}
+		devices++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return devices, 0, err
+	}
+
+	var conds []string
+	var args []interface{}
+	if filter.DeviceID != "" {
+		args = append(args, filter.DeviceID)
+		conds = append(conds, fmt.Sprintf("device_id = $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conds = append(conds, fmt.Sprintf("timestamp >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conds = append(conds, fmt.Sprintf("timestamp < $%d", len(args)))
+	}
+	eventQuery := "SELECT " + eventColumns + " FROM power_events"
+	if len(conds) > 0 {
+		eventQuery += " WHERE " + strings.Join(conds, " AND ")
+	}
+	rows, err = db.Query(eventQuery+" ORDER BY timestamp, id", args...)
+	if err != nil {
+		return devices, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.PowerEvent
+		dest := append([]interface{}{&e.ID, &e.DeviceID, &e.EventType, &e.Timestamp, &e.CreatedAt, &e.Expected}, e.Data.ScanFields()...)
+		if err := rows.Scan(dest...); err != nil {
+			return devices, events, err
+		}
+		if err := enc.Encode(Record{Event: &e}); err != nil {
+			return devices, events, err
+		}
+		events++
+	}
+	return devices, events, rows.Err()
+}
+
+type ImportResult struct {
+	Devices int
+	Events  int
+	// Skipped counts the records already in the database: devices with the
+	// same id and events of the same device, type and time.
+	Skipped int
+}
+
+// Import reads an export in a single transaction. Existing devices are kept
+// as they are and events get new ids, so importing the same file twice adds
+// nothing. Derived data (incidents, heap analysis) is not updated.
+func Import(db *sql.DB, r io.Reader) (ImportResult, error) {
+	var result ImportResult
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var inserted sql.Result
+		switch {
+		case rec.Device != nil:
+			d := rec.Device
+			inserted, err = tx.Exec(`
+				INSERT INTO devices (id, name, description, model, firmware_version, site, device_group, offline_since, last_seen, created_at, updated_at)
+				VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $11)
+				ON CONFLICT (id) DO NOTHING`,
+				d.ID, d.Name, d.Description, d.Model, d.FirmwareVersion, d.Site, d.Group, d.OfflineSince, d.LastSeen, d.CreatedAt, d.UpdatedAt,
+			)
+		case rec.Event != nil:
+			e := rec.Event
+			var exists bool
+			err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM power_events WHERE device_id = $1 AND event_type = $2 AND timestamp = $3)",
+				e.DeviceID, e.EventType, e.Timestamp).Scan(&exists)
+			if err == nil && exists {
+				result.Skipped++
+				continue
+			}
+			if err == nil {
+				inserted, err = tx.Exec(`
+					INSERT INTO power_events (device_id, event_type, timestamp, expected, client_timestamp, uptime_ms, message,
+						battery_percentage, battery_voltage, wifi_signal_strength, free_heap, data, created_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+					e.DeviceID, e.EventType, e.Timestamp, e.Expected, e.Data.ClientTimestamp, e.Data.UptimeMs, e.Data.Message,
+					e.Data.BatteryPercentage, e.Data.BatteryVoltage, e.Data.WiFiSignalStrength, e.Data.FreeHeap, e.Data.Extra, e.CreatedAt,
+				)
+			}
+		default:
+			return result, fmt.Errorf("line %d: neither a device nor an event", line)
+		}
+		if err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		n, err := inserted.RowsAffected()
+		if err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		switch {
+		case n == 0:
+			result.Skipped++
+		case rec.Device != nil:
+			result.Devices++
+		default:
+			result.Events++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"backend/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrSameDevice is returned when a device is merged into itself.
+var ErrSameDevice = errors.New("cannot merge a device into itself")
+
+// MergeDevices moves the history of device fromID into toID in a single
+// transaction: its events, firmware history, annotations, alerts, incident
+// membership, maintenance and silence scopes and webhook filters. fromID's
+// MQTT key moves too unless toID has its own, in which case devices still
+// using fromID's key must be re-provisioned. fromID is then deleted and kept
+// as an alias of toID (as are the aliases fromID had), so events still sent
+// under it are stored under toID. The merge is recorded in device_audit_log.
+// It returns sql.ErrNoRows when either device does not exist.
+func MergeDevices(db *sql.DB, fromID, toID, actor, comment string) (*models.DeviceMergeResult, error) {
+	if fromID == toID {
+		return nil, ErrSameDevice
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 同時に受信したイベントが移動元に書き込まれないよう両方をロック
+	var locked int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM (SELECT id FROM devices WHERE id IN ($1, $2) ORDER BY id FOR UPDATE) d`,
+		fromID, toID,
+	).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if locked != 2 {
+		return nil, sql.ErrNoRows
+	}
+
+	result := &models.DeviceMergeResult{DeviceID: toID, MergedFrom: fromID}
+	moved, err := tx.Exec("UPDATE power_events SET device_id = $2 WHERE device_id = $1", fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+	if result.MovedEvents, err = moved.RowsAffected(); err != nil {
+		return nil, err
+	}
+
+	// Rows that would clash with toID's own (an open alert of the same type,
+	// the same incident) stay with fromID and are deleted with it.
+	statements := []string{
+		"UPDATE device_firmware_history SET device_id = $2 WHERE device_id = $1",
+		"UPDATE device_annotations SET device_id = $2 WHERE device_id = $1",
+		`UPDATE alerts SET device_id = $2 WHERE device_id = $1 AND (resolved_at IS NOT NULL OR NOT EXISTS (
+			SELECT 1 FROM alerts open WHERE open.device_id = $2 AND open.alert_type = alerts.alert_type AND open.resolved_at IS NULL))`,
+		`UPDATE incident_devices SET device_id = $2 WHERE device_id = $1 AND incident_id NOT IN (
+			SELECT incident_id FROM incident_devices WHERE device_id = $2)`,
+		"UPDATE incident_history SET device_id = $2 WHERE device_id = $1",
+		"UPDATE maintenance_windows SET scope_key = $2 WHERE scope_type = 'device' AND scope_key = $1",
+		"UPDATE silences SET scope_key = $2 WHERE scope_type = 'device' AND scope_key = $1",
+		// Webhooks match events on the resolved id, i.e. toID.
+		"UPDATE webhooks SET device_ids = array_replace(device_ids, $1, $2) WHERE $1 = ANY(device_ids)",
+		// The device can keep connecting with its old id and key.
+		`UPDATE device_credentials SET device_id = $2 WHERE device_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM device_credentials own WHERE own.device_id = $2)`,
+		"UPDATE device_aliases SET device_id = $2 WHERE device_id = $1",
+		// toID is a device again, so it must not route elsewhere
+		"DELETE FROM device_aliases WHERE alias_id = $2",
+		// The merged device keeps the details it lacks from fromID.
+		`UPDATE devices SET
+			description = COALESCE(NULLIF(devices.description, ''), src.description),
+			model = COALESCE(devices.model, src.model),
+			firmware_version = COALESCE(devices.firmware_version, src.firmware_version),
+			site = COALESCE(devices.site, src.site),
+			device_group = COALESCE(devices.device_group, src.device_group),
+			last_seen = GREATEST(devices.last_seen, src.last_seen),
+			created_at = LEAST(devices.created_at, src.created_at)
+		FROM devices src
+		WHERE devices.id = $2 AND src.id = $1`,
+		"DELETE FROM devices WHERE id = $1",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, fromID, toID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(`
+		INSERT INTO device_aliases (alias_id, device_id, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (alias_id) DO UPDATE SET device_id = $2, created_at = $3`,
+		fromID, toID, now,
+	); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE devices SET updated_at = $2 WHERE id = $1", toID, now); err != nil {
+		return nil, err
+	}
+
+	details := models.JSONObject{"from": fromID, "moved_events": result.MovedEvents}
+	if comment != "" {
+		details["comment"] = comment
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO device_audit_log (device_id, action, actor, details, created_at) VALUES ($1, $2, $3, $4, $5)",
+		toID, models.DeviceAuditMerge, actor, details, now,
+	); err != nil {
+		return nil, err
+	}
+
+	if result.Aliases, err = deviceAliases(tx, toID); err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// DeviceAliases returns the old ids that route to a device.
+func DeviceAliases(db *sql.DB, deviceID string) ([]string, error) {
+	return deviceAliases(db, deviceID)
+}
+
+func deviceAliases(q queryer, deviceID string) ([]string, error) {
+	rows, err := q.Query("SELECT alias_id FROM device_aliases WHERE device_id = $1 ORDER BY alias_id", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []string{}
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// ResolveDeviceID returns the device an id belongs to: the merged device for
+// an alias, else the id itself.
+func ResolveDeviceID(db *sql.DB, id string) (string, error) {
+	var deviceID string
+	err := db.QueryRow("SELECT device_id FROM device_aliases WHERE alias_id = $1", id).Scan(&deviceID)
+	if err == sql.ErrNoRows {
+		return id, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return deviceID, nil
+}
+
+// DeviceAuditLog returns the audit entries of a device, newest first: limit
+// of them after skipping offset, or all of them when limit is 0.
+func DeviceAuditLog(db *sql.DB, deviceID string, limit, offset int) ([]models.DeviceAuditEntry, error) {
+	page, args := limitClause([]interface{}{deviceID}, limit, offset)
+	rows, err := db.Query(`
+		SELECT id, device_id, action, actor, details, created_at FROM device_audit_log
+		WHERE device_id = $1 ORDER BY created_at DESC, id DESC`+page, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.DeviceAuditEntry{}
+	for rows.Next() {
+		var e models.DeviceAuditEntry
+		if err := rows.Scan(&e.ID, &e.DeviceID, &e.Action, &e.Actor, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
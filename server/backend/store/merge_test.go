@@ -0,0 +1,117 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeDevices(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM \\(SELECT id FROM devices WHERE id IN \\(\\$1, \\$2\\) ORDER BY id FOR UPDATE\\) d").
+		WithArgs("M5S2_OLD", "M5S2_NEW").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectExec("UPDATE power_events SET device_id = \\$2 WHERE device_id = \\$1").
+		WithArgs("M5S2_OLD", "M5S2_NEW").
+		WillReturnResult(sqlmock.NewResult(0, 120))
+	// 関連する履歴を移し、移動元は別名として残す
+	for _, stmt := range []string{
+		"UPDATE device_firmware_history",
+		"UPDATE device_annotations",
+		"UPDATE alerts",
+		"UPDATE incident_devices",
+		"UPDATE incident_history",
+		"UPDATE maintenance_windows",
+		"UPDATE silences",
+		"UPDATE webhooks SET device_ids = array_replace\\(device_ids, \\$1, \\$2\\) WHERE \\$1 = ANY\\(device_ids\\)",
+		"UPDATE device_credentials SET device_id = \\$2 WHERE device_id = \\$1 AND NOT EXISTS",
+		"UPDATE device_aliases SET device_id = \\$2 WHERE device_id = \\$1",
+		"DELETE FROM device_aliases WHERE alias_id = \\$2",
+		"UPDATE devices SET (.+) FROM devices src",
+		"DELETE FROM devices WHERE id = \\$1",
+	} {
+		mock.ExpectExec(stmt).WithArgs("M5S2_OLD", "M5S2_NEW").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec("INSERT INTO device_aliases").
+		WithArgs("M5S2_OLD", "M5S2_NEW", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE devices SET updated_at = \\$2 WHERE id = \\$1").
+		WithArgs("M5S2_NEW", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 監査ログに記録
+	mock.ExpectExec("INSERT INTO device_audit_log").
+		WithArgs("M5S2_NEW", "merge", "alice", `{"comment":"reflashed","from":"M5S2_OLD","moved_events":120}`, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT alias_id FROM device_aliases WHERE device_id = \\$1").
+		WithArgs("M5S2_NEW").
+		WillReturnRows(sqlmock.NewRows([]string{"alias_id"}).AddRow("M5S2_OLD").AddRow("M5S2_OLDER"))
+	mock.ExpectCommit()
+
+	result, err := MergeDevices(db, "M5S2_OLD", "M5S2_NEW", "alice", "reflashed")
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, "M5S2_NEW", result.DeviceID)
+	assert.Equal(t, "M5S2_OLD", result.MergedFrom)
+	assert.Equal(t, int64(120), result.MovedEvents)
+	assert.Equal(t, []string{"M5S2_OLD", "M5S2_OLDER"}, result.Aliases)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeDevices_NotFound(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// どちらかが存在しなければ何も変更しない
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM").
+		WithArgs("unknown", "M5S2_NEW").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	_, err = MergeDevices(db, "unknown", "M5S2_NEW", "", "")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// 自分自身には統合できない
+	_, err = MergeDevices(db, "M5S2_NEW", "M5S2_NEW", "", "")
+	assert.Equal(t, ErrSameDevice, err)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveDeviceID(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT device_id FROM device_aliases WHERE alias_id = \\$1").
+		WithArgs("M5S2_OLD").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id"}).AddRow("M5S2_NEW"))
+	mock.ExpectQuery("SELECT device_id FROM device_aliases WHERE alias_id = \\$1").
+		WithArgs("M5S2_NEW").
+		WillReturnError(sql.ErrNoRows)
+
+	// 別名は統合先に、それ以外はそのまま
+	id, err := ResolveDeviceID(db, "M5S2_OLD")
+	assert.NoError(t, err)
+	assert.Equal(t, "M5S2_NEW", id)
+	id, err = ResolveDeviceID(db, "M5S2_NEW")
+	assert.NoError(t, err)
+	assert.Equal(t, "M5S2_NEW", id)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
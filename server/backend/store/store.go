@@ -0,0 +1,115 @@
+// Package store holds the database operations shared by the HTTP handlers
+// and the powerlogger-admin command, so that both apply the same semantics.
+package store
+
+import (
+	"backend/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// deviceColumns are read by scanDevice.
+const deviceColumns = "id, name, description, COALESCE(model, ''), COALESCE(firmware_version, ''), COALESCE(site, ''), COALESCE(device_group, ''), offline_since, last_seen, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// limitClause returns the LIMIT and OFFSET for a query taking args, and args
+// with theirs appended. It is empty when limit is 0.
+func limitClause(args []interface{}, limit, offset int) (string, []interface{}) {
+	if limit == 0 {
+		return "", args
+	}
+	args = append(args, limit, offset)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args
+}
+
+func scanDevice(row rowScanner, d *models.Device) error {
+	return row.Scan(&d.ID, &d.Name, &d.Description, &d.Model, &d.FirmwareVersion, &d.Site, &d.Group, &d.OfflineSince, &d.LastSeen, &d.CreatedAt, &d.UpdatedAt)
+}
+
+// ListDevices returns devices, newest first: limit of them after skipping
+// offset, or all of them when limit is 0.
+func ListDevices(db *sql.DB, limit, offset int) ([]models.Device, error) {
+	page, args := limitClause(nil, limit, offset)
+	rows, err := db.Query("SELECT "+deviceColumns+" FROM devices ORDER BY created_at DESC"+page, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []models.Device
+	for rows.Next() {
+		var device models.Device
+		if err := scanDevice(rows, &device); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func DeviceExists(db *sql.DB, deviceID string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM devices WHERE id = $1)", deviceID).Scan(&exists)
+	return exists, err
+}
+
+// RenameDevice sets the display name of a device. It returns sql.ErrNoRows
+// when the device does not exist.
+func RenameDevice(db *sql.DB, deviceID, name string) error {
+	result, err := db.Exec("UPDATE devices SET name = $1, updated_at = $2 WHERE id = $3", name, time.Now(), deviceID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+// DeleteDevice deletes a device and its power events. It returns
+// sql.ErrNoRows when the device does not exist.
+func DeleteDevice(db *sql.DB, deviceID string) error {
+	if _, err := db.Exec("DELETE FROM power_events WHERE device_id = $1", deviceID); err != nil {
+		return err
+	}
+	result, err := db.Exec("DELETE FROM devices WHERE id = $1", deviceID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func requireRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EventsCutoff returns the cutoff for deleting events older than the given
+// number of days.
+func EventsCutoff(now time.Time, olderThanDays int) time.Time {
+	return now.AddDate(0, 0, -olderThanDays)
+}
+
+// CountEventsBefore counts the events received before cutoff.
+func CountEventsBefore(db *sql.DB, cutoff time.Time) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM power_events WHERE timestamp < $1", cutoff).Scan(&count)
+	return count, err
+}
+
+// DeleteEventsBefore deletes the events received before cutoff and returns
+// how many were deleted.
+func DeleteEventsBefore(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM power_events WHERE timestamp < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var deviceRowColumns = []string{"id", "name", "description", "model", "firmware_version", "site", "group", "offline_since", "last_seen", "created_at", "updated_at"}
+
+func TestRenameDevice_NotFound(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE devices SET name = \\$1, updated_at = \\$2 WHERE id = \\$3").
+		WithArgs("Kitchen", sqlmock.AnyArg(), "unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// 存在しないデバイスは sql.ErrNoRows
+	assert.Equal(t, sql.ErrNoRows, RenameDevice(db, "unknown", "Kitchen"))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanup(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := EventsCutoff(now, 90)
+	assert.Equal(t, time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC), cutoff)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM power_events WHERE timestamp < \\$1").
+		WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectExec("DELETE FROM power_events WHERE timestamp < \\$1").
+		WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	count, err := CountEventsBefore(db, cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+	deleted, err := DeleteEventsBefore(db, cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExport(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	from := at.Add(-time.Hour)
+	mock.ExpectQuery("SELECT (.+) FROM devices WHERE id = \\$1 ORDER BY id").
+		WithArgs("device-001").
+		WillReturnRows(sqlmock.NewRows(deviceRowColumns).
+			AddRow("device-001", "Kitchen", "", "M5StickCPlus2", "1.0.0", "", "", nil, at, at, at))
+	mock.ExpectQuery("SELECT (.+) FROM power_events WHERE device_id = \\$1 AND timestamp >= \\$2 ORDER BY timestamp, id").
+		WithArgs("device-001", from).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "device_id", "event_type", "timestamp", "created_at", "expected",
+			"client_timestamp", "uptime_ms", "message", "battery_percentage", "battery_voltage", "wifi_signal_strength", "free_heap", "data"}).
+			AddRow(1, "device-001", "power_off", at, at, false, nil, 1000, "Mains power lost", 80, 4.0, -60, 180000, []byte(`{"reboot":true}`)))
+
+	var buf bytes.Buffer
+	devices, events, err := Export(db, &buf, ExportFilter{DeviceID: "device-001", From: from})
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, 1, devices)
+	assert.Equal(t, 1, events)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `{"device":{"id":"device-001","name":"Kitchen"`)
+	assert.Contains(t, lines[1], `"message":"Mains power lost"`)
+	assert.Contains(t, lines[1], `"reboot":true`)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImport(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	input := `{"device":{"id":"device-001","name":"Kitchen","last_seen":"2024-01-01T00:00:00Z","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}}
+
+{"event":{"id":1,"device_id":"device-001","event_type":"power_off","timestamp":"2024-01-01T00:00:00Z","data":{"uptime_ms":1000,"reboot":true},"created_at":"2024-01-01T00:00:00Z","expected":false}}
+{"event":{"id":2,"device_id":"device-001","event_type":"power_on","timestamp":"2024-01-01T00:10:00Z","data":{},"created_at":"2024-01-01T00:10:00Z","expected":false}}
+`
+	mock.ExpectBegin()
+	// 既存のデバイスはそのまま
+	mock.ExpectExec("INSERT INTO devices (.+) ON CONFLICT \\(id\\) DO NOTHING").
+		WithArgs("device-001", "Kitchen", "", "", "", "", "", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("device-001", "power_off", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("INSERT INTO power_events").
+		WithArgs("device-001", "power_off", sqlmock.AnyArg(), false, nil, int64(1000), nil, nil, nil, nil, nil, `{"reboot":true}`, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 1))
+	// 取り込み済みのイベントは追加しない
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("device-001", "power_on", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectCommit()
+
+	result, err := Import(db, strings.NewReader(input))
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, ImportResult{Devices: 0, Events: 1, Skipped: 2}, result)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImport_InvalidLine(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	// 不正な行があれば何も取り込まない
+	_, err = Import(db, strings.NewReader("{\"note\":1}\n"))
+	assert.EqualError(t, err, "line 1: neither a device nor an event")
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
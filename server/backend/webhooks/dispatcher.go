@@ -0,0 +1,346 @@
+// Package webhooks queues stored events for matching webhook subscriptions
+// and delivers them with signed HTTP requests, retrying with exponential
+// backoff until the delivery succeeds or is dead-lettered.
+package webhooks
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Powerlogger-Signature"
+	TimestampHeader = "X-Powerlogger-Timestamp"
+	EventHeader     = "X-Powerlogger-Event"
+	DeliveryHeader  = "X-Powerlogger-Delivery"
+)
+
+type Options struct {
+	// A delivery is dead-lettered after this many failed attempts.
+	MaxAttempts int
+	// Delay before the first retry, doubled on each further failure up to
+	// MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	// How often the queue is checked for due retries.
+	PollInterval time.Duration
+	// Deliveries sent in parallel.
+	Concurrency int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:  10,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   time.Hour,
+		Timeout:      10 * time.Second,
+		PollInterval: 5 * time.Second,
+		Concurrency:  8,
+	}
+}
+
+// Payload is the JSON body of every delivery. Expected is set for events
+// during a maintenance window of the device, Silenced for events covered by a
+// silence.
+type Payload struct {
+	EventType  string          `json:"event_type"`
+	DeviceID   string          `json:"device_id"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Expected   bool            `json:"expected"`
+	Silenced   bool            `json:"silenced"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type Dispatcher struct {
+	db     *sql.DB
+	opts   Options
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewDispatcher(db *sql.DB, opts Options) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Sign returns the signature header value for a delivery: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is the delay after the given number of failed attempts.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.opts.BaseBackoff
+	for i := 1; i < attempts && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return delay
+}
+
+// EventStored implements ingest.Listener. The deliveries are queued in the
+// database before the ingest returns, so none are lost when the dispatcher
+// falls behind or the process stops; only sending happens on Run's
+// goroutine.
+func (d *Dispatcher) EventStored(e ingest.StoredEvent) {
+	n, err := d.Enqueue(e)
+	if err != nil {
+		log.Printf("Failed to queue webhooks for device %s: %v", e.DeviceID, err)
+		return
+	}
+	if n > 0 {
+		d.Wake()
+	}
+}
+
+// Wake makes Run check the queue now instead of at the next poll.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+			d.DeliverDue(ctx)
+		case <-ticker.C:
+			d.DeliverDue(ctx)
+		}
+	}
+}
+
+// Enqueue adds a pending delivery for every enabled webhook whose filters
+// match the event and returns how many were added. Events during maintenance
+// or a silence are delivered too, except to webhooks with skip_muted.
+func (d *Dispatcher) Enqueue(e ingest.StoredEvent) (int64, error) {
+	data := e.Data
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	payload, err := json.Marshal(Payload{
+		EventType:  e.EventType,
+		DeviceID:   e.DeviceID,
+		ReceivedAt: e.ReceivedAt,
+		Expected:   e.Expected,
+		Silenced:   e.Silenced,
+		Data:       data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_type, device_id, payload, next_attempt_at)
+		SELECT id, $1, $2, $3, $4 FROM webhooks
+		WHERE enabled
+			AND (cardinality(event_types) = 0 OR $1 = ANY(event_types))
+			AND (cardinality(device_ids) = 0 OR $2 = ANY(device_ids))
+			AND NOT (skip_muted AND $5)`,
+		e.EventType, e.DeviceID, string(payload), e.ReceivedAt, e.Muted(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type delivery struct {
+	id        int64
+	url       string
+	secret    string
+	eventType string
+	payload   []byte
+	attempts  int
+}
+
+// DeliverDue sends pending deliveries whose next attempt is due, oldest
+// first.
+func (d *Dispatcher) DeliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := d.loadDue(100)
+		if err != nil {
+			log.Printf("Failed to load due webhook deliveries: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		sem := make(chan struct{}, d.opts.Concurrency)
+		var wg sync.WaitGroup
+		for _, dl := range due {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(dl delivery) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := d.attempt(dl); err != nil {
+					log.Printf("Failed to record webhook delivery %d: %v", dl.id, err)
+				}
+			}(dl)
+		}
+		wg.Wait()
+
+		if len(due) < 100 {
+			return
+		}
+	}
+}
+
+// loadDue claims up to limit due deliveries by moving their next attempt past
+// the time needed to send them all, so that another poll or server instance
+// skips them meanwhile. If the process stops before recording the outcome,
+// they are retried once the claim runs out.
+func (d *Dispatcher) loadDue(limit int) ([]delivery, error) {
+	now := time.Now()
+	rounds := (limit + d.opts.Concurrency - 1) / d.opts.Concurrency
+	claimedUntil := now.Add(time.Duration(rounds+1) * d.opts.Timeout)
+	rows, err := d.db.Query(`
+		UPDATE webhook_deliveries dl SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = dl.webhook_id AND dl.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING dl.id, w.url, w.secret, dl.event_type, dl.payload, dl.attempts`, now, claimedUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []delivery
+	for rows.Next() {
+		var dl delivery
+		if err := rows.Scan(&dl.id, &dl.url, &dl.secret, &dl.eventType, &dl.payload, &dl.attempts); err != nil {
+			return nil, err
+		}
+		due = append(due, dl)
+	}
+	return due, rows.Err()
+}
+
+// attempt sends one delivery and records the outcome: delivered on a 2xx,
+// otherwise rescheduled with backoff or dead-lettered after MaxAttempts.
+func (d *Dispatcher) attempt(dl delivery) error {
+	started := time.Now()
+	statusCode, sendErr := d.send(dl, started)
+	duration := time.Since(started)
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	var errText *string
+	if sendErr != nil {
+		s := sendErr.Error()
+		errText = &s
+	}
+
+	if _, err := d.db.Exec(
+		"INSERT INTO webhook_delivery_attempts (delivery_id, attempted_at, status_code, error, duration_ms) VALUES ($1, $2, $3, $4, $5)",
+		dl.id, started, code, errText, int(duration.Milliseconds()),
+	); err != nil {
+		return err
+	}
+
+	attempts := dl.attempts + 1
+	if sendErr == nil {
+		_, err := d.db.Exec(
+			"UPDATE webhook_deliveries SET status = $1, attempts = $2, last_status_code = $3, last_error = NULL, delivered_at = $4 WHERE id = $5",
+			models.WebhookDeliveryDelivered, attempts, code, time.Now(), dl.id,
+		)
+		return err
+	}
+
+	status, next := models.WebhookDeliveryPending, started.Add(d.Backoff(attempts))
+	if attempts >= d.opts.MaxAttempts {
+		status = models.WebhookDeliveryDead
+		log.Printf("Webhook delivery %d dead after %d attempts: %v", dl.id, attempts, sendErr)
+	}
+	_, err := d.db.Exec(
+		"UPDATE webhook_deliveries SET status = $1, attempts = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5 WHERE id = $6",
+		status, attempts, code, errText, next, dl.id,
+	)
+	return err
+}
+
+func (d *Dispatcher) send(dl delivery, at time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, dl.url, bytes.NewReader(dl.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := at.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "powerlogger-webhooks")
+	req.Header.Set(EventHeader, dl.eventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(dl.id, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(dl.secret, timestamp, dl.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Redeliver puts a delivery back in the queue with a fresh set of attempts,
+// whatever its current status. It reports false if the delivery does not
+// belong to the webhook.
+func (d *Dispatcher) Redeliver(webhookID int, deliveryID int64) (bool, error) {
+	result, err := d.db.Exec(
+		"UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, delivered_at = NULL WHERE id = $3 AND webhook_id = $4",
+		models.WebhookDeliveryPending, time.Now(), deliveryID, webhookID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	d.Wake()
+	return true, nil
+}
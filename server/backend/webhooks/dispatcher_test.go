@@ -0,0 +1,206 @@
+package webhooks
+
+import (
+	"backend/ingest"
+	"backend/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.MaxAttempts = 3
+	return opts
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event_type":"power_off"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1704067200." + string(body)))
+
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), Sign("secret", 1704067200, body))
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, DefaultOptions())
+
+	assert.Equal(t, 30*time.Second, d.Backoff(1))
+	assert.Equal(t, time.Minute, d.Backoff(2))
+	assert.Equal(t, 4*time.Minute, d.Backoff(4))
+	assert.Equal(t, time.Hour, d.Backoff(20))
+}
+
+func TestEnqueue(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO webhook_deliveries (.+) SELECT id, \\$1, \\$2, \\$3, \\$4 FROM webhooks").
+		WithArgs("power_off", "device-001", `{"event_type":"power_off","device_id":"device-001","received_at":"2024-01-01T00:00:00Z","expected":false,"silenced":false,"data":{"battery_percentage":80}}`, at, false).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	d := NewDispatcher(db, testOptions())
+	n, err := d.Enqueue(ingest.StoredEvent{
+		PowerEventRequest: models.PowerEventRequest{DeviceID: "device-001", EventType: "power_off"},
+		ReceivedAt:        at,
+		Data:              []byte(`{"battery_percentage":80}`),
+	})
+
+	// アサーション
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEventStored(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// 配信はインジェスト中に DB に登録する（メモリ上のキューで落とさない）
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs("power_off", "device-001", sqlmock.AnyArg(), sqlmock.AnyArg(), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d := NewDispatcher(db, testOptions())
+	d.EventStored(ingest.StoredEvent{PowerEventRequest: models.PowerEventRequest{DeviceID: "device-001", EventType: "power_off"}})
+	assert.Len(t, d.wake, 1)
+
+	// メンテナンス中のイベントも expected を付けて配信する（skip_muted の Webhook を除く）
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO webhook_deliveries (.+) AND NOT \\(skip_muted AND \\$5\\)").
+		WithArgs("power_off", "device-001", `{"event_type":"power_off","device_id":"device-001","received_at":"2024-01-01T00:00:00Z","expected":true,"silenced":false,"data":{}}`, at, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	d.EventStored(ingest.StoredEvent{PowerEventRequest: models.PowerEventRequest{DeviceID: "device-001", EventType: "power_off"}, ReceivedAt: at, Expected: true})
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func dueRows(url string, attempts int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "url", "secret", "event_type", "payload", "attempts"}).
+		AddRow(7, url, "secret", "power_off", []byte(`{"event_type":"power_off"}`), attempts)
+}
+
+func TestDeliverDue_SignedDelivery(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// 送信中の配信は他のポーリングやサーバーが取らないよう、次回試行時刻を進めて確保する
+	mock.ExpectQuery("UPDATE webhook_deliveries dl SET next_attempt_at = \\$2 (.+) FOR UPDATE SKIP LOCKED\\) RETURNING dl.id, w.url, w.secret, dl.event_type, dl.payload, dl.attempts").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 100).
+		WillReturnRows(dueRows(server.URL, 0))
+	mock.ExpectExec("INSERT INTO webhook_delivery_attempts").
+		WithArgs(int64(7), sqlmock.AnyArg(), http.StatusNoContent, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = \\$2, last_status_code = \\$3, last_error = NULL").
+		WithArgs(models.WebhookDeliveryDelivered, 1, http.StatusNoContent, sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d := NewDispatcher(db, testOptions())
+	d.DeliverDue(context.Background())
+
+	// アサーション
+	assert.NotNil(t, received)
+	assert.Equal(t, "power_off", received.Header.Get(EventHeader))
+	assert.Equal(t, "7", received.Header.Get(DeliveryHeader))
+	timestamp, err := strconv.ParseInt(received.Header.Get(TimestampHeader), 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, Sign("secret", timestamp, body), received.Header.Get(SignatureHeader))
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliverDue_RetryAndDeadLetter(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// 1回目の失敗はバックオフして再試行
+	mock.ExpectQuery("UPDATE webhook_deliveries dl SET next_attempt_at").
+		WillReturnRows(dueRows(server.URL, 0))
+	mock.ExpectExec("INSERT INTO webhook_delivery_attempts").
+		WithArgs(int64(7), sqlmock.AnyArg(), http.StatusBadGateway, "unexpected status 502", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = \\$2, last_status_code = \\$3, last_error = \\$4, next_attempt_at = \\$5").
+		WithArgs(models.WebhookDeliveryPending, 1, http.StatusBadGateway, "unexpected status 502", sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// 最大回数に達したら dead
+	mock.ExpectQuery("UPDATE webhook_deliveries dl SET next_attempt_at").
+		WillReturnRows(dueRows(server.URL, 2))
+	mock.ExpectExec("INSERT INTO webhook_delivery_attempts").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1").
+		WithArgs(models.WebhookDeliveryDead, 3, http.StatusBadGateway, "unexpected status 502", sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d := NewDispatcher(db, testOptions())
+	d.DeliverDue(context.Background())
+	d.DeliverDue(context.Background())
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedeliver(t *testing.T) {
+	// モックDB作成
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = 0").
+		WithArgs(models.WebhookDeliveryPending, sqlmock.AnyArg(), int64(7), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = 0").
+		WithArgs(models.WebhookDeliveryPending, sqlmock.AnyArg(), int64(8), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	d := NewDispatcher(db, testOptions())
+
+	ok, err := d.Redeliver(1, 7)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, d.wake, 1)
+
+	ok, err = d.Redeliver(1, 8)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// モックの期待値を満たしたか確認
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -11,6 +11,12 @@ CREATE TABLE IF NOT EXISTS devices (
     id VARCHAR(255) PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     description TEXT,
+    model VARCHAR(100),
+    firmware_version VARCHAR(50),
+    site VARCHAR(255),
+    device_group VARCHAR(255),
+    crash_loop_since TIMESTAMP,
+    offline_since TIMESTAMP,
     last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
@@ -22,16 +28,257 @@ CREATE TABLE IF NOT EXISTS power_events (
     device_id VARCHAR(255) NOT NULL,
     event_type VARCHAR(50) NOT NULL,
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- Payload fields sent by the firmware
+    client_timestamp TIMESTAMP,
+    uptime_ms BIGINT,
+    message TEXT,
+    battery_percentage INTEGER,
+    battery_voltage DOUBLE PRECISION,
+    wifi_signal_strength INTEGER,
+    free_heap BIGINT,
+    -- Any other fields (e.g. the details of a detected reboot)
     data JSONB,
+    -- Received during a maintenance window of the device
+    expected BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
 );
 
+-- Firmware version history per device
+CREATE TABLE IF NOT EXISTS device_firmware_history (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL,
+    firmware_version VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+);
+
+-- Firmware release registry (OTA)
+CREATE TABLE IF NOT EXISTS firmware_releases (
+    id SERIAL PRIMARY KEY,
+    version VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    binary_data BYTEA NOT NULL,
+    rollout_percentage INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percentage BETWEEN 0 AND 100),
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (model, version)
+);
+
+-- Site incidents (near-simultaneous power_off events correlated by site/group)
+CREATE TABLE IF NOT EXISTS incidents (
+    id SERIAL PRIMARY KEY,
+    scope_type VARCHAR(20) NOT NULL,
+    scope_key VARCHAR(255) NOT NULL,
+    classification VARCHAR(50) NOT NULL,
+    device_count INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    last_event_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    assignee VARCHAR(255),
+    root_cause VARCHAR(50) CHECK (root_cause IN ('utility_outage', 'breaker_trip', 'unplugged', 'device_fault')),
+    acknowledged_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS incident_devices (
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    power_off_at TIMESTAMP NOT NULL,
+    power_on_at TIMESTAMP,
+    PRIMARY KEY (incident_id, device_id)
+);
+
+-- Incident timeline: state changes, assignments, devices going down/up and comments
+CREATE TABLE IF NOT EXISTS incident_history (
+    id SERIAL PRIMARY KEY,
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    action VARCHAR(30) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    device_id VARCHAR(255),
+    value VARCHAR(255),
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Device alerts (at most one open alert per device and type)
+CREATE TABLE IF NOT EXISTS alerts (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    alert_type VARCHAR(50) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+-- Latest free_heap trend of each device's current boot session
+CREATE TABLE IF NOT EXISTS device_heap_analysis (
+    device_id VARCHAR(255) PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    analyzed_at TIMESTAMP NOT NULL,
+    session_started_at TIMESTAMP NOT NULL,
+    samples INTEGER NOT NULL,
+    current_free_heap BIGINT NOT NULL,
+    slope_bytes_per_hour DOUBLE PRECISION,
+    r_squared DOUBLE PRECISION,
+    leak_suspected BOOLEAN NOT NULL DEFAULT FALSE,
+    projected_exhaustion_at TIMESTAMP
+);
+
+-- Per-device keys for the embedded MQTT broker (SHA-256 of the key)
+CREATE TABLE IF NOT EXISTS device_credentials (
+    device_id VARCHAR(255) PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    key_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rotated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Embedded MQTT broker logins with access to all topics (SHA-256 of the password)
+CREATE TABLE IF NOT EXISTS mqtt_users (
+    username VARCHAR(255) PRIMARY KEY,
+    password_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Custom event types (built-in types are defined in the backend)
+CREATE TABLE IF NOT EXISTS event_types (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    schema JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Outbound webhook subscriptions (empty filter arrays match everything;
+-- skip_muted leaves out events during maintenance or a silence)
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    secret VARCHAR(255) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    device_ids TEXT[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    skip_muted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Persistent webhook delivery queue: pending -> delivered, or dead after the last retry
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+-- One row per delivery attempt
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempted_at TIMESTAMP NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    duration_ms INTEGER NOT NULL
+);
+
+-- Planned maintenance; a recurring window repeats daily or weekly until recurrence_until
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    scope_type VARCHAR(20) NOT NULL CHECK (scope_type IN ('device', 'group', 'site')),
+    scope_key VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    recurrence VARCHAR(20) NOT NULL DEFAULT 'none' CHECK (recurrence IN ('none', 'daily', 'weekly')),
+    recurrence_until TIMESTAMP,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+-- Ad-hoc notification silences
+CREATE TABLE IF NOT EXISTS silences (
+    id SERIAL PRIMARY KEY,
+    scope_type VARCHAR(20) NOT NULL CHECK (scope_type IN ('device', 'group', 'site')),
+    scope_key VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    starts_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Operator notes on a device timeline; ends_at is NULL for a point in time
+CREATE TABLE IF NOT EXISTS device_annotations (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    author VARCHAR(255) NOT NULL,
+    text TEXT NOT NULL,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at IS NULL OR ends_at >= starts_at)
+);
+
+-- Old device ids kept when a device is merged into another; events sent
+-- under an alias are stored under device_id
+CREATE TABLE IF NOT EXISTS device_aliases (
+    alias_id VARCHAR(255) PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit trail of device administration (merges); kept after a device is deleted
+CREATE TABLE IF NOT EXISTS device_audit_log (
+    id SERIAL PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    details JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_power_events_device_id ON power_events(device_id);
 CREATE INDEX IF NOT EXISTS idx_power_events_timestamp ON power_events(timestamp);
 CREATE INDEX IF NOT EXISTS idx_power_events_event_type ON power_events(event_type);
+CREATE INDEX IF NOT EXISTS idx_power_events_device_timestamp ON power_events(device_id, timestamp);
+-- Event search: full-text search on the message, the payload columns and data = / != predicates (@>, ?)
+CREATE INDEX IF NOT EXISTS idx_power_events_message_tsv ON power_events USING GIN (to_tsvector('simple', COALESCE(message, '')));
+CREATE INDEX IF NOT EXISTS idx_power_events_battery_percentage ON power_events(battery_percentage);
+CREATE INDEX IF NOT EXISTS idx_power_events_wifi_signal_strength ON power_events(wifi_signal_strength);
+CREATE INDEX IF NOT EXISTS idx_power_events_data ON power_events USING GIN (data);
 CREATE INDEX IF NOT EXISTS idx_devices_last_seen ON devices(last_seen);
+CREATE INDEX IF NOT EXISTS idx_devices_site ON devices(site);
+CREATE INDEX IF NOT EXISTS idx_device_aliases_device_id ON device_aliases(device_id);
+CREATE INDEX IF NOT EXISTS idx_device_audit_log_device_id ON device_audit_log(device_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_alerts_device_open ON alerts(device_id, alert_type) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_incidents_scope ON incidents(scope_type, scope_key, started_at);
+CREATE INDEX IF NOT EXISTS idx_incidents_status ON incidents(status, started_at);
+CREATE INDEX IF NOT EXISTS idx_incident_history_incident_id ON incident_history(incident_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_incident_devices_device_id ON incident_devices(device_id) WHERE power_on_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_device_firmware_history_device_id ON device_firmware_history(device_id, seen_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id);
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_scope ON maintenance_windows(scope_type, scope_key);
+CREATE INDEX IF NOT EXISTS idx_silences_scope ON silences(scope_type, scope_key, expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_annotations_device_id ON device_annotations(device_id, starts_at);
 
 -- サンプルデータ
 INSERT INTO items (name, description) VALUES
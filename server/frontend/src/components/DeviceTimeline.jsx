@@ -121,12 +121,32 @@ function DeviceTimeline() {
       ) : (
         <div className="timeline">
           <div className="timeline-header">
-            <h3>Events ({events.length})</h3>
+            <h3>Events ({events.filter((event) => event.type !== 'annotation').length})</h3>
           </div>
           
           <div className="timeline-events">
-            {events.map((event, index) => (
-              <div key={event.id} className={`timeline-event ${getEventTypeClass(event.event_type)}`}>
+            {events.map((event, index) => event.type === 'annotation' ? (
+              <div key={`annotation-${event.id}`} className="timeline-event event-annotation">
+                <div className="event-marker"></div>
+                <div className="event-content">
+                  <div className="event-header">
+                    <span className="event-type">メモ</span>
+                    <time className="event-time" dateTime={event.starts_at}>
+                      {new Date(event.starts_at).toLocaleString()}
+                      {event.ends_at && ` 〜 ${new Date(event.ends_at).toLocaleString()}`}
+                    </time>
+                  </div>
+                  <p className="annotation-text">{event.text}</p>
+                  <div className="event-meta">
+                    <small>
+                      {event.author}
+                      {event.tags && event.tags.length > 0 && ` · ${event.tags.map((tag) => `#${tag}`).join(' ')}`}
+                    </small>
+                  </div>
+                </div>
+              </div>
+            ) : (
+              <div key={`event-${event.id}`} className={`timeline-event ${getEventTypeClass(event.event_type)}`}>
                 <div className="event-marker"></div>
                 <div className="event-content">
                   <div className="event-header">
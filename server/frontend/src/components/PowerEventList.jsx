@@ -247,7 +247,7 @@ function PowerEventList() {
                     </time>
                   </td>
                   <td className="event-data">
-                    <span title={event.data}>
+                    <span title={JSON.stringify(event.data)}>
                       {formatEventData(event.data)}
                     </span>
                   </td>